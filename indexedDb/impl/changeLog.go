@@ -0,0 +1,405 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+// This file contains the change log, a persisted and ordered feed of the events
+// sent to the main thread. Each change is written in the same transaction as
+// the mutation that caused it, so the log never disagrees with the data.
+
+package impl
+
+import (
+	"encoding/json"
+	"syscall/js"
+	"time"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
+	"gitlab.com/elixxir/wasm-utils/utils"
+	"gitlab.com/xx_network/primitives/netTime"
+)
+
+const (
+	// ChangeLogStoreName is the name of the [idb.ObjectStore] that holds the
+	// change log.
+	ChangeLogStoreName = "changeLog"
+
+	// changeLogStorePkey is the keyPath of the change log store (must match
+	// the json struct tag).
+	changeLogStorePkey = "seq"
+
+	// ChangeEvent is the event type sent on the event update callback after
+	// the original event of each change. The data is [Change]. It is outside
+	// the range used by bindings event types.
+	ChangeEvent int64 = 100002
+
+	// ChangeLogMaxAge is how long changes are kept. Older changes are deleted
+	// when the database is opened.
+	ChangeLogMaxAge = 7 * 24 * time.Hour
+
+	// changeBatchSize is the number of changes read at once when delivering
+	// them to the main thread.
+	changeBatchSize = 100
+)
+
+// Change is a single event in the change log.
+type Change struct {
+	// Seq is the sequence number of the change. It increases with each change
+	// and is never reused.
+	Seq uint64 `json:"seq"`
+
+	// EventType is the event type sent on the event update callback.
+	EventType int64 `json:"eventType"`
+
+	// Data is the JSON of the event sent on the event update callback.
+	Data json.RawMessage `json:"data"`
+
+	// Timestamp is the time the change was made.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// storedChange defines the IndexedDb representation of a single Change.
+type storedChange struct {
+	Seq       uint64    `json:"seq,omitempty"` // Matches changeLogStorePkey
+	EventType int64     `json:"event_type"`
+	Timestamp time.Time `json:"timestamp"`
+
+	// Data is the JSON of the event. If the database is encrypted, it is
+	// encrypted in chunks of the cipher's block size with EncryptChunks.
+	// Otherwise, it holds the JSON as a single element.
+	Data []string `json:"data"`
+}
+
+// ChangeLog manages the change log of a database and delivers each change to
+// the main thread, in order, once it is committed.
+type ChangeLog struct {
+	db      *idb.Database
+	cipher  idbCrypto.Cipher
+	deliver func(eventType int64, data any)
+
+	// notify signals the dispatcher that changes have been committed.
+	notify chan struct{}
+}
+
+// CreateChangeLogStore builds the change log [idb.ObjectStore]. It must be
+// called during a database upgrade.
+func CreateChangeLogStore(db *idb.Database) error {
+	_, err := db.CreateObjectStore(ChangeLogStoreName,
+		idb.ObjectStoreOptions{
+			KeyPath:       js.ValueOf(changeLogStorePkey),
+			AutoIncrement: true,
+		})
+	return err
+}
+
+// NewChangeLog returns a ChangeLog for the given database and starts
+// delivering new changes with deliver. Changes older than ChangeLogMaxAge are
+// deleted. If the database is encrypted, the event data is encrypted with the
+// cipher.
+func NewChangeLog(db *idb.Database, cipher idbCrypto.Cipher,
+	deliver func(eventType int64, data any)) (*ChangeLog, error) {
+	c := &ChangeLog{
+		db:      db,
+		cipher:  cipher,
+		deliver: deliver,
+		notify:  make(chan struct{}, 1),
+	}
+
+	if err := c.trim(netTime.Now().Add(-ChangeLogMaxAge)); err != nil {
+		return nil, err
+	}
+
+	// Changes made before now were delivered by a previous session
+	lastSeq, err := c.LastSeq()
+	if err != nil {
+		return nil, err
+	}
+	go c.dispatch(lastSeq)
+
+	return c, nil
+}
+
+// Append adds a change to the log as part of the transaction, which must
+// include the ChangeLogStoreName object store. Call Publish once the
+// transaction has committed to deliver it.
+func (c *ChangeLog) Append(
+	txn *Transaction, eventType int64, data any) error {
+	changeObj, err := c.changeToValue(eventType, data)
+	if err != nil {
+		return err
+	}
+	if _, err = txn.Put(ChangeLogStoreName, changeObj); err != nil {
+		return errors.Errorf("Unable to put change: %+v", err)
+	}
+	return nil
+}
+
+// Record adds a change to the log in its own transaction and delivers it. It
+// is used for events that do not modify any other store.
+func (c *ChangeLog) Record(eventType int64, data any) error {
+	err := RunTransaction(c.db, func(txn *Transaction) error {
+		return c.Append(txn, eventType, data)
+	}, ChangeLogStoreName)
+	if err != nil {
+		return errors.Errorf("failed to record change: %+v", err)
+	}
+	c.Publish()
+	return nil
+}
+
+// Publish signals that changes have been committed and must be delivered. It
+// never blocks.
+func (c *ChangeLog) Publish() {
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+// GetChangesSince returns up to limit changes made after the change with the
+// given sequence number, ordered by sequence number. Passing zero returns the
+// oldest changes that are kept.
+func (c *ChangeLog) GetChangesSince(seq uint64, limit int) ([]Change, error) {
+	parentErr := errors.New("failed to GetChangesSince")
+
+	if limit <= 0 {
+		return nil, errors.WithMessagef(parentErr,
+			"limit must be greater than zero, received %d", limit)
+	}
+
+	// Prepare the Transaction
+	txn, err := c.db.Transaction(idb.TransactionReadOnly, ChangeLogStoreName)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(ChangeLogStoreName)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to get ObjectStore: %+v", err)
+	}
+
+	// Set up the operation
+	keyRange, err := idb.NewKeyRangeLowerBound(js.ValueOf(seq), true)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to NewKeyRangeLowerBound: %+v", err)
+	}
+	cursorRequest, err := store.OpenCursorRange(keyRange, idb.CursorNext)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to open Cursor: %+v", err)
+	}
+
+	// Perform the operation
+	changes := make([]Change, 0)
+	err = SendCursorRequest(cursorRequest,
+		func(cursor *idb.CursorWithValue) error {
+			value, err := cursor.Value()
+			if err != nil {
+				return err
+			}
+			change, err := c.valueToChange(value)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, change)
+			if len(changes) >= limit {
+				return idb.ErrCursorStopIter
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to get changes: %+v", err)
+	}
+
+	return changes, nil
+}
+
+// LastSeq returns the sequence number of the newest change. Returns zero if
+// the log is empty.
+func (c *ChangeLog) LastSeq() (uint64, error) {
+	parentErr := errors.New("failed to get last change")
+
+	txn, err := c.db.Transaction(idb.TransactionReadOnly, ChangeLogStoreName)
+	if err != nil {
+		return 0, errors.WithMessagef(parentErr,
+			"Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(ChangeLogStoreName)
+	if err != nil {
+		return 0, errors.WithMessagef(parentErr,
+			"Unable to get ObjectStore: %+v", err)
+	}
+	cursorRequest, err := store.OpenCursor(idb.CursorPrevious)
+	if err != nil {
+		return 0, errors.WithMessagef(parentErr,
+			"Unable to open Cursor: %+v", err)
+	}
+
+	var seq uint64
+	err = SendCursorRequest(cursorRequest,
+		func(cursor *idb.CursorWithValue) error {
+			key, err := cursor.Key()
+			if err != nil {
+				return err
+			}
+			seq = uint64(key.Int())
+			return idb.ErrCursorStopIter
+		})
+	if err != nil {
+		return 0, errors.WithMessagef(parentErr, "%+v", err)
+	}
+	return seq, nil
+}
+
+// dispatch delivers committed changes made after lastSeq in order each time it
+// is notified. Changes are read back from the log, so they are delivered in
+// the order they were committed even if they were published out of order.
+func (c *ChangeLog) dispatch(lastSeq uint64) {
+	for range c.notify {
+		for {
+			changes, err := c.GetChangesSince(lastSeq, changeBatchSize)
+			if err != nil {
+				jww.ERROR.Printf("Failed to deliver changes after %d: %+v",
+					lastSeq, err)
+				break
+			}
+
+			for _, change := range changes {
+				c.deliver(change.EventType, change.Data)
+				c.deliver(ChangeEvent, change)
+				lastSeq = change.Seq
+			}
+
+			if len(changes) < changeBatchSize {
+				break
+			}
+		}
+	}
+}
+
+// trim deletes every change made before the cutoff.
+func (c *ChangeLog) trim(cutoff time.Time) error {
+	parentErr := errors.New("failed to trim change log")
+
+	txn, err := c.db.Transaction(idb.TransactionReadWrite, ChangeLogStoreName)
+	if err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(ChangeLogStoreName)
+	if err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to get ObjectStore: %+v", err)
+	}
+	cursorRequest, err := store.OpenCursor(idb.CursorNext)
+	if err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to open Cursor: %+v", err)
+	}
+
+	// Changes are stored in the order they were made, so deletion stops at
+	// the first change after the cutoff
+	var deleted int
+	err = SendCursorRequest(cursorRequest,
+		func(cursor *idb.CursorWithValue) error {
+			value, err := cursor.Value()
+			if err != nil {
+				return err
+			}
+			var change storedChange
+			err = json.Unmarshal([]byte(utils.JsToJson(value)), &change)
+			if err != nil {
+				return err
+			}
+			if !change.Timestamp.Before(cutoff) {
+				return idb.ErrCursorStopIter
+			}
+			if _, err = cursor.Delete(); err != nil {
+				return err
+			}
+			deleted++
+			return nil
+		})
+	if err != nil {
+		return errors.WithMessagef(parentErr, "%+v", err)
+	}
+
+	if deleted > 0 {
+		jww.DEBUG.Printf("Deleted %d changes made before %s", deleted, cutoff)
+	}
+	return nil
+}
+
+// changeToValue converts the event to the js.Value that is stored, encrypting
+// the event data if the database is encrypted.
+func (c *ChangeLog) changeToValue(
+	eventType int64, data any) (js.Value, error) {
+	dataJSON, err := json.Marshal(data)
+	if err != nil {
+		return js.Undefined(), errors.Errorf(
+			"Unable to marshal change data: %+v", err)
+	}
+
+	change := storedChange{
+		EventType: eventType,
+		Timestamp: netTime.Now(),
+		Data:      []string{string(dataJSON)},
+	}
+	if c.cipher != nil {
+		change.Data, err = EncryptChunks(c.cipher, dataJSON)
+		if err != nil {
+			return js.Undefined(), errors.Errorf(
+				"Unable to encrypt change data: %+v", err)
+		}
+	}
+
+	changeJSON, err := json.Marshal(change)
+	if err != nil {
+		return js.Undefined(), errors.Errorf(
+			"Unable to marshal change: %+v", err)
+	}
+	return utils.JsonToJS(changeJSON)
+}
+
+// valueToChange converts the stored js.Value to a Change, decrypting the event
+// data if the database is encrypted.
+func (c *ChangeLog) valueToChange(value js.Value) (Change, error) {
+	var stored storedChange
+	err := json.Unmarshal([]byte(utils.JsToJson(value)), &stored)
+	if err != nil {
+		return Change{}, errors.Errorf("Unable to unmarshal change: %+v", err)
+	}
+
+	var data []byte
+	if c.cipher != nil {
+		data, err = DecryptChunks(c.cipher, stored.Data)
+		if err != nil {
+			return Change{}, errors.Errorf(
+				"Unable to decrypt change %d: %+v", stored.Seq, err)
+		}
+	} else if len(stored.Data) == 1 {
+		data = []byte(stored.Data[0])
+	} else {
+		return Change{}, errors.Errorf(
+			"Change %d has %d data elements, expected 1",
+			stored.Seq, len(stored.Data))
+	}
+
+	return Change{
+		Seq:       stored.Seq,
+		EventType: stored.EventType,
+		Data:      data,
+		Timestamp: stored.Timestamp,
+	}, nil
+}
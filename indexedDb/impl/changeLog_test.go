@@ -0,0 +1,231 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package impl
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+
+	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
+	"gitlab.com/xx_network/crypto/csprng"
+	"gitlab.com/xx_network/primitives/netTime"
+)
+
+// testChangeData is the event data recorded in tests.
+type testChangeData struct {
+	N int `json:"n"`
+}
+
+// Tests that changes recorded with ChangeLog.Record are returned in order by
+// ChangeLog.GetChangesSince, with and without encryption.
+func TestChangeLog_GetChangesSince(t *testing.T) {
+	cipher, err := idbCrypto.NewCipher(
+		[]byte("testPass"), []byte("testSalt"), 64, csprng.NewSystemRNG())
+	if err != nil {
+		t.Fatalf("Failed to create cipher: %+v", err)
+	}
+
+	for _, c := range []idbCrypto.Cipher{nil, cipher} {
+		name := "TestChangeLog_GetChangesSince"
+		if c != nil {
+			name += "_withCipher"
+		}
+		t.Run(name, func(t *testing.T) {
+			db := newChangeLogTestDB(name, t)
+			changeLog, err := NewChangeLog(db, c, func(int64, any) {})
+			if err != nil {
+				t.Fatalf("Failed to create change log: %+v", err)
+			}
+
+			const numChanges = 5
+			for i := 0; i < numChanges; i++ {
+				err = changeLog.Record(int64(i), testChangeData{i})
+				if err != nil {
+					t.Fatalf("Failed to record change %d: %+v", i, err)
+				}
+			}
+
+			changes, err := changeLog.GetChangesSince(0, numChanges+1)
+			if err != nil {
+				t.Fatalf("Failed to get changes: %+v", err)
+			} else if len(changes) != numChanges {
+				t.Fatalf("Unexpected number of changes."+
+					"\nexpected: %d\nreceived: %d", numChanges, len(changes))
+			}
+			for i, change := range changes {
+				var data testChangeData
+				if err = json.Unmarshal(change.Data, &data); err != nil {
+					t.Errorf("Failed to unmarshal data of change %d: %+v",
+						i, err)
+				}
+				if change.EventType != int64(i) || data.N != i {
+					t.Errorf("Unexpected change %d: %+v", i, change)
+				}
+				if i > 0 && change.Seq <= changes[i-1].Seq {
+					t.Errorf("Sequence number of change %d (%d) is not "+
+						"greater than the previous (%d).",
+						i, change.Seq, changes[i-1].Seq)
+				}
+			}
+
+			// Resuming returns only the following changes, up to the limit
+			resumed, err := changeLog.GetChangesSince(changes[1].Seq, 2)
+			if err != nil {
+				t.Fatalf("Failed to get changes: %+v", err)
+			} else if len(resumed) != 2 || resumed[0].Seq != changes[2].Seq ||
+				resumed[1].Seq != changes[3].Seq {
+				t.Errorf("Unexpected resumed changes.\nexpected: %+v"+
+					"\nreceived: %+v", changes[2:4], resumed)
+			}
+
+			lastSeq, err := changeLog.LastSeq()
+			if err != nil {
+				t.Fatalf("Failed to get last sequence number: %+v", err)
+			} else if lastSeq != changes[numChanges-1].Seq {
+				t.Errorf("Unexpected last sequence number."+
+					"\nexpected: %d\nreceived: %d",
+					changes[numChanges-1].Seq, lastSeq)
+			}
+		})
+	}
+}
+
+// Tests that ChangeLog.Record stores event data larger than the block size of
+// the cipher and that it is returned unchanged by ChangeLog.GetChangesSince.
+func TestChangeLog_Record_SmallBlockSize(t *testing.T) {
+	cipher, err := idbCrypto.NewCipher(
+		[]byte("testPass"), []byte("testSalt"), 32, csprng.NewSystemRNG())
+	if err != nil {
+		t.Fatalf("Failed to create cipher: %+v", err)
+	}
+
+	db := newChangeLogTestDB("TestChangeLog_Record_SmallBlockSize", t)
+	changeLog, err := NewChangeLog(db, cipher, func(int64, any) {})
+	if err != nil {
+		t.Fatalf("Failed to create change log: %+v", err)
+	}
+
+	expected := map[string]string{
+		"text": strings.Repeat("TestChangeLog_Record_SmallBlockSize", 10)}
+	if err = changeLog.Record(5, expected); err != nil {
+		t.Fatalf("Failed to record change: %+v", err)
+	}
+
+	changes, err := changeLog.GetChangesSince(0, 2)
+	if err != nil {
+		t.Fatalf("Failed to get changes: %+v", err)
+	} else if len(changes) != 1 {
+		t.Fatalf("Unexpected number of changes.\nexpected: %d\nreceived: %d",
+			1, len(changes))
+	}
+
+	var received map[string]string
+	if err = json.Unmarshal(changes[0].Data, &received); err != nil {
+		t.Fatalf("Failed to unmarshal data: %+v", err)
+	} else if received["text"] != expected["text"] {
+		t.Errorf("Unexpected data.\nexpected: %v\nreceived: %v",
+			expected, received)
+	}
+}
+
+// Tests that new changes are delivered in order with their ChangeEvent and
+// that changes made before the ChangeLog was created are not delivered again.
+func TestChangeLog_dispatch(t *testing.T) {
+	db := newChangeLogTestDB("TestChangeLog_dispatch", t)
+	previous, err := NewChangeLog(db, nil, func(int64, any) {})
+	if err != nil {
+		t.Fatalf("Failed to create change log: %+v", err)
+	}
+	if err = previous.Record(1, testChangeData{1}); err != nil {
+		t.Fatalf("Failed to record change: %+v", err)
+	}
+
+	events := make(chan int64, 10)
+	changeLog, err := NewChangeLog(db, nil, func(eventType int64, _ any) {
+		events <- eventType
+	})
+	if err != nil {
+		t.Fatalf("Failed to create change log: %+v", err)
+	}
+	for _, eventType := range []int64{2, 3} {
+		err = changeLog.Record(eventType, testChangeData{int(eventType)})
+		if err != nil {
+			t.Fatalf("Failed to record change: %+v", err)
+		}
+	}
+
+	for i, expected := range []int64{2, ChangeEvent, 3, ChangeEvent} {
+		select {
+		case eventType := <-events:
+			if eventType != expected {
+				t.Errorf("Unexpected event type %d.\nexpected: %d"+
+					"\nreceived: %d", i, expected, eventType)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for event %d.", i)
+		}
+	}
+}
+
+// Tests that ChangeLog.trim only deletes changes made before the cutoff.
+func TestChangeLog_trim(t *testing.T) {
+	db := newChangeLogTestDB("TestChangeLog_trim", t)
+	changeLog, err := NewChangeLog(db, nil, func(int64, any) {})
+	if err != nil {
+		t.Fatalf("Failed to create change log: %+v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err = changeLog.Record(int64(i), testChangeData{i}); err != nil {
+			t.Fatalf("Failed to record change %d: %+v", i, err)
+		}
+	}
+	cutoff := netTime.Now()
+	if err = changeLog.Record(3, testChangeData{3}); err != nil {
+		t.Fatalf("Failed to record change: %+v", err)
+	}
+
+	if err = changeLog.trim(cutoff); err != nil {
+		t.Fatalf("Failed to trim change log: %+v", err)
+	}
+
+	changes, err := changeLog.GetChangesSince(0, 10)
+	if err != nil {
+		t.Fatalf("Failed to get changes: %+v", err)
+	} else if len(changes) != 1 || changes[0].EventType != 3 {
+		t.Errorf("Unexpected changes after trim: %+v", changes)
+	}
+}
+
+// newChangeLogTestDB creates a new idb.Database with only the change log
+// store.
+func newChangeLogTestDB(name string, t *testing.T) *idb.Database {
+	ctx, cancel := NewContext()
+	defer cancel()
+	name += strconv.FormatInt(netTime.Now().UnixNano(), 10)
+	openRequest, err := idb.Global().Open(ctx, name, 0,
+		func(db *idb.Database, _ uint, _ uint) error {
+			return CreateChangeLogStore(db)
+		})
+	if err != nil {
+		t.Fatalf("Failed to open database: %+v", err)
+	}
+
+	db, err := openRequest.Await(ctx)
+	if err != nil {
+		t.Fatalf("Failed to open database: %+v", err)
+	}
+	return db
+}
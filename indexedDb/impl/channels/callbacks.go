@@ -10,9 +10,12 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"syscall/js"
 	"time"
 
+	"github.com/hack-pad/safejs"
 	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
 
@@ -23,7 +26,9 @@ import (
 	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
 	"gitlab.com/elixxir/crypto/message"
 	"gitlab.com/elixxir/wasm-utils/exception"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
 	wChannels "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/channels"
+	"gitlab.com/elixxir/xxdk-wasm/storage"
 	"gitlab.com/elixxir/xxdk-wasm/worker"
 	"gitlab.com/xx_network/crypto/csprng"
 	"gitlab.com/xx_network/primitives/id"
@@ -35,7 +40,7 @@ var zeroUUID = []byte{0, 0, 0, 0, 0, 0, 0, 0}
 // send information between the event model and the main thread.
 type manager struct {
 	wtm   *worker.ThreadManager
-	model channels.EventModel
+	model *wasmModel
 }
 
 // registerCallbacks registers all the reception callbacks to manage messages
@@ -50,8 +55,29 @@ func (m *manager) registerCallbacks() {
 	m.wtm.RegisterCallback(wChannels.UpdateFromUUIDTag, m.updateFromUuidCB)
 	m.wtm.RegisterCallback(wChannels.UpdateFromMessageIDTag, m.updateFromMessageIdCB)
 	m.wtm.RegisterCallback(wChannels.GetMessageTag, m.getMessageCB)
+	m.wtm.RegisterContextCallback(wChannels.GetMessagesTag, m.getMessagesCB)
+	m.wtm.RegisterCallback(
+		wChannels.GetPinnedMessagesTag, m.getPinnedMessagesCB)
+	m.wtm.RegisterContextCallback(
+		wChannels.SearchMessagesTag, m.searchMessagesCB)
 	m.wtm.RegisterCallback(wChannels.DeleteMessageTag, m.deleteMessageCB)
 	m.wtm.RegisterCallback(wChannels.MuteUserTag, m.muteUserCB)
+	m.wtm.RegisterCallback(wChannels.MarkReadTag, m.markReadCB)
+	m.wtm.RegisterCallback(wChannels.GetUnreadCountTag, m.getUnreadCountCB)
+	m.wtm.RegisterCallback(
+		wChannels.GetUnreadSummaryTag, m.getUnreadSummaryCB)
+	m.wtm.RegisterCallback(wChannels.GetReactionsTag, m.getReactionsCB)
+	m.wtm.RegisterCallback(wChannels.GetThreadTag, m.getThreadCB)
+	m.wtm.RegisterCallback(wChannels.GetReplyCountsTag, m.getReplyCountsCB)
+	m.wtm.RegisterCallback(
+		wChannels.SetRetentionPolicyTag, m.setRetentionPolicyCB)
+	m.wtm.RegisterCallback(wChannels.GetChangesSinceTag, m.getChangesSinceCB)
+	m.wtm.RegisterCallback(wChannels.SetIdentityTag, m.setIdentityCB)
+	m.wtm.RegisterCallback(wChannels.GetMentionsTag, m.getMentionsCB)
+
+	// Live queries are made over a MessageChannel opened by the main thread
+	m.wtm.RegisterMessageChannelCallback(
+		wChannels.LiveQueryKey, m.registerLiveQueryChannel)
 }
 
 // newWASMEventModelCB is the callback for NewWASMEventModel. Returns an empty
@@ -65,6 +91,12 @@ func (m *manager) newWASMEventModelCB(message []byte, reply func(message []byte)
 		return
 	}
 
+	// Apply the timeouts set on the main thread over the startup flags
+	if err = impl.SetTimeouts(msg.Timeouts); err != nil {
+		reply([]byte(err.Error()))
+		return
+	}
+
 	// Create new encryption cipher
 	rng := fastRNG.NewStreamGenerator(12, 1024, csprng.NewSystemRNG)
 	encryption, err := idbCrypto.NewCipherFromJSON(
@@ -75,8 +107,9 @@ func (m *manager) newWASMEventModelCB(message []byte, reply func(message []byte)
 		return
 	}
 
-	m.model, err = NewWASMEventModel(
-		msg.DatabaseName, encryption, m.eventUpdateCallback)
+	encryptAll := msg.EncryptionMode == storage.EncryptionAll
+	m.model, err = NewWASMEventModel(msg.DatabaseName, encryption,
+		encryptAll, msg.EvictionPolicy, m.eventUpdateCallback, m.wtm.Run)
 	if err != nil {
 		reply([]byte(err.Error()))
 		return
@@ -341,6 +374,100 @@ func (m *manager) getMessageCB(messageData []byte, reply func(message []byte)) {
 	}
 }
 
+// getMessagesCB is the callback for wasmModel.GetMessages. Returns JSON
+// marshalled channels.GetMessagesReply. If an error occurs, then Error will be
+// set with the error message. Otherwise, Messages will be set.
+func (m *manager) getMessagesCB(
+	ctx context.Context, message []byte, reply func(message []byte)) {
+	var replyMsg wChannels.GetMessagesReply
+	defer func() {
+		if replyMessage, err := json.Marshal(replyMsg); err != nil {
+			exception.Throwf("[CH] Failed to JSON marshal %T for "+
+				"GetMessages: %+v", replyMsg, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	var msg wChannels.GetMessagesMessage
+	err := json.Unmarshal(message, &msg)
+	if err != nil {
+		replyMsg.Error = errors.Errorf("failed to JSON unmarshal %T from "+
+			"main thread: %+v", msg, err).Error()
+		return
+	}
+
+	messages, err := m.model.GetMessages(ctx,
+		msg.ChannelID, msg.Cursor, msg.Limit, msg.IncludeHidden)
+	if err != nil {
+		replyMsg.Error = err.Error()
+	} else {
+		replyMsg.Messages = messages
+	}
+}
+
+// getPinnedMessagesCB is the callback for wasmModel.GetPinnedMessages. Returns
+// JSON marshalled channels.GetMessagesReply. If an error occurs, then Error
+// will be set with the error message. Otherwise, Messages will be set.
+func (m *manager) getPinnedMessagesCB(
+	message []byte, reply func(message []byte)) {
+	var replyMsg wChannels.GetMessagesReply
+	defer func() {
+		if replyMessage, err := json.Marshal(replyMsg); err != nil {
+			exception.Throwf("[CH] Failed to JSON marshal %T for "+
+				"GetPinnedMessages: %+v", replyMsg, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	channelID, err := id.Unmarshal(message)
+	if err != nil {
+		replyMsg.Error = errors.Errorf("failed to unmarshal channel ID from "+
+			"main thread: %+v", err).Error()
+		return
+	}
+
+	messages, err := m.model.GetPinnedMessages(channelID)
+	if err != nil {
+		replyMsg.Error = err.Error()
+	} else {
+		replyMsg.Messages = messages
+	}
+}
+
+// searchMessagesCB is the callback for wasmModel.SearchMessages. Returns JSON
+// marshalled channels.SearchMessagesReply. If an error occurs, then Error will
+// be set with the error message. Otherwise, UUIDs will be set.
+func (m *manager) searchMessagesCB(
+	ctx context.Context, message []byte, reply func(message []byte)) {
+	var replyMsg wChannels.SearchMessagesReply
+	defer func() {
+		if replyMessage, err := json.Marshal(replyMsg); err != nil {
+			exception.Throwf("[CH] Failed to JSON marshal %T for "+
+				"SearchMessages: %+v", replyMsg, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	var msg wChannels.SearchMessagesMessage
+	err := json.Unmarshal(message, &msg)
+	if err != nil {
+		replyMsg.Error = errors.Errorf("failed to JSON unmarshal %T from "+
+			"main thread: %+v", msg, err).Error()
+		return
+	}
+
+	uuids, err := m.model.SearchMessages(
+		ctx, msg.Query, msg.ChannelID, msg.Limit)
+	if err != nil {
+		replyMsg.Error = err.Error()
+	} else {
+		replyMsg.UUIDs = uuids
+	}
+}
+
 // deleteMessageCB is the callback for wasmModel.DeleteMessage. Always returns
 // nil; meaning, no response is supplied (or expected).
 func (m *manager) deleteMessageCB(messageData []byte, reply func(message []byte)) {
@@ -371,3 +498,348 @@ func (m *manager) muteUserCB(message []byte, _ func([]byte)) {
 	}
 	m.model.MuteUser(msg.ChannelID, msg.PubKey, msg.Unmute)
 }
+
+// markReadCB is the callback for wasmModel.MarkRead. Returns an empty slice on
+// success or an error message on failure.
+func (m *manager) markReadCB(message []byte, reply func(message []byte)) {
+	var uuid uint64
+	err := json.Unmarshal(message, &uuid)
+	if err != nil {
+		reply([]byte(errors.Errorf("failed to JSON unmarshal %T from main "+
+			"thread: %+v", uuid, err).Error()))
+		return
+	}
+
+	if err = m.model.MarkRead(uuid); err != nil {
+		reply([]byte(err.Error()))
+		return
+	}
+
+	reply(nil)
+}
+
+// getUnreadCountCB is the callback for wasmModel.GetUnreadCount. Returns JSON
+// marshalled channels.GetUnreadCountReply. If an error occurs, then Error will
+// be set with the error message. Otherwise, Unread will be set.
+func (m *manager) getUnreadCountCB(message []byte, reply func(message []byte)) {
+	var replyMsg wChannels.GetUnreadCountReply
+	defer func() {
+		if replyMessage, err := json.Marshal(replyMsg); err != nil {
+			exception.Throwf("[CH] Failed to JSON marshal %T for "+
+				"GetUnreadCount: %+v", replyMsg, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	channelID, err := id.Unmarshal(message)
+	if err != nil {
+		replyMsg.Error = errors.Errorf("failed to unmarshal channel ID from "+
+			"main thread: %+v", err).Error()
+		return
+	}
+
+	unread, err := m.model.GetUnreadCount(channelID)
+	if err != nil {
+		replyMsg.Error = err.Error()
+	} else {
+		replyMsg.Unread = unread
+	}
+}
+
+// getUnreadSummaryCB is the callback for wasmModel.GetUnreadSummary. Returns
+// JSON marshalled channels.GetUnreadSummaryReply. If an error occurs, then
+// Error will be set with the error message. Otherwise, Summary will be set.
+func (m *manager) getUnreadSummaryCB(_ []byte, reply func(message []byte)) {
+	var replyMsg wChannels.GetUnreadSummaryReply
+	defer func() {
+		if replyMessage, err := json.Marshal(replyMsg); err != nil {
+			exception.Throwf("[CH] Failed to JSON marshal %T for "+
+				"GetUnreadSummary: %+v", replyMsg, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	summary, err := m.model.GetUnreadSummary()
+	if err != nil {
+		replyMsg.Error = err.Error()
+	} else {
+		replyMsg.Summary = summary
+	}
+}
+
+// getReactionsCB is the callback for wasmModel.GetReactions. Returns JSON
+// marshalled channels.GetReactionsReply. If an error occurs, then Error will be
+// set with the error message. Otherwise, Reactions will be set.
+func (m *manager) getReactionsCB(message []byte, reply func(message []byte)) {
+	var replyMsg wChannels.GetReactionsReply
+	defer func() {
+		if replyMessage, err := json.Marshal(replyMsg); err != nil {
+			exception.Throwf("[CH] Failed to JSON marshal %T for "+
+				"GetReactions: %+v", replyMsg, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	var msg wChannels.GetReactionsMessage
+	err := json.Unmarshal(message, &msg)
+	if err != nil {
+		replyMsg.Error = errors.Errorf("failed to JSON unmarshal %T from "+
+			"main thread: %+v", msg, err).Error()
+		return
+	}
+
+	reactions, err := m.model.GetReactions(msg.MessageIDs, msg.Self)
+	if err != nil {
+		replyMsg.Error = err.Error()
+	} else {
+		replyMsg.Reactions = reactions
+	}
+}
+
+// getThreadCB is the callback for wasmModel.GetThread. Returns JSON marshalled
+// channels.GetThreadReply. If an error occurs, then Error will be set with the
+// error message. Otherwise, Thread will be set.
+func (m *manager) getThreadCB(message []byte, reply func(message []byte)) {
+	var replyMsg wChannels.GetThreadReply
+	defer func() {
+		if replyMessage, err := json.Marshal(replyMsg); err != nil {
+			exception.Throwf("[CH] Failed to JSON marshal %T for "+
+				"GetThread: %+v", replyMsg, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	var msg wChannels.GetThreadMessage
+	err := json.Unmarshal(message, &msg)
+	if err != nil {
+		replyMsg.Error = errors.Errorf("failed to JSON unmarshal %T from "+
+			"main thread: %+v", msg, err).Error()
+		return
+	}
+
+	thread, err := m.model.GetThread(msg.RootMessageID, msg.Limit, msg.Cursor)
+	if err != nil {
+		replyMsg.Error = err.Error()
+	} else {
+		replyMsg.Thread = thread
+	}
+}
+
+// getReplyCountsCB is the callback for wasmModel.GetReplyCounts. Returns JSON
+// marshalled channels.GetReplyCountsReply. If an error occurs, then Error will
+// be set with the error message. Otherwise, ReplyCounts will be set.
+func (m *manager) getReplyCountsCB(
+	messageData []byte, reply func(message []byte)) {
+	var replyMsg wChannels.GetReplyCountsReply
+	defer func() {
+		if replyMessage, err := json.Marshal(replyMsg); err != nil {
+			exception.Throwf("[CH] Failed to JSON marshal %T for "+
+				"GetReplyCounts: %+v", replyMsg, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	var messageIDs []message.ID
+	err := json.Unmarshal(messageData, &messageIDs)
+	if err != nil {
+		replyMsg.Error = errors.Errorf("failed to JSON unmarshal %T from "+
+			"main thread: %+v", messageIDs, err).Error()
+		return
+	}
+
+	counts, err := m.model.GetReplyCounts(messageIDs)
+	if err != nil {
+		replyMsg.Error = err.Error()
+	} else {
+		replyMsg.ReplyCounts = counts
+	}
+}
+
+// setRetentionPolicyCB is the callback for wasmModel.SetRetentionPolicy.
+// Returns nothing on success or an error message on failure.
+func (m *manager) setRetentionPolicyCB(
+	message []byte, reply func(message []byte)) {
+	var msg wChannels.SetRetentionPolicyMessage
+	err := json.Unmarshal(message, &msg)
+	if err != nil {
+		reply([]byte(errors.Errorf("failed to JSON unmarshal %T from main "+
+			"thread: %+v", msg, err).Error()))
+		return
+	}
+
+	err = m.model.SetRetentionPolicy(msg.ChannelID, msg.Policy)
+	if err != nil {
+		reply([]byte(err.Error()))
+		return
+	}
+
+	reply(nil)
+}
+
+// getChangesSinceCB is the callback for wasmModel.GetChangesSince. Returns
+// JSON marshalled channels.GetChangesSinceReply. If an error occurs, then Error
+// will be set with the error message. Otherwise, Changes will be set.
+func (m *manager) getChangesSinceCB(
+	message []byte, reply func(message []byte)) {
+	var replyMsg wChannels.GetChangesSinceReply
+	defer func() {
+		if replyMessage, err := json.Marshal(replyMsg); err != nil {
+			exception.Throwf("[CH] Failed to JSON marshal %T for "+
+				"GetChangesSince: %+v", replyMsg, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	var msg wChannels.GetChangesSinceMessage
+	err := json.Unmarshal(message, &msg)
+	if err != nil {
+		replyMsg.Error = errors.Errorf("failed to JSON unmarshal %T from "+
+			"main thread: %+v", msg, err).Error()
+		return
+	}
+
+	changes, err := m.model.GetChangesSince(msg.Seq, msg.Limit)
+	if err != nil {
+		replyMsg.Error = err.Error()
+	} else {
+		replyMsg.Changes = changes
+	}
+}
+
+// setIdentityCB is the callback for wasmModel.SetIdentity. Returns nothing on
+// success or an error message on failure.
+func (m *manager) setIdentityCB(message []byte, reply func(message []byte)) {
+	var msg wChannels.SetIdentityMessage
+	err := json.Unmarshal(message, &msg)
+	if err != nil {
+		reply([]byte(errors.Errorf("failed to JSON unmarshal %T from main "+
+			"thread: %+v", msg, err).Error()))
+		return
+	}
+
+	err = m.model.SetIdentity(msg.PubKey, msg.CodesetVersion)
+	if err != nil {
+		reply([]byte(err.Error()))
+		return
+	}
+
+	reply(nil)
+}
+
+// getMentionsCB is the callback for wasmModel.GetMentions. Returns JSON
+// marshalled channels.GetMentionsReply. If an error occurs, then Error will be
+// set with the error message. Otherwise, Mentions will be set.
+func (m *manager) getMentionsCB(message []byte, reply func(message []byte)) {
+	var replyMsg wChannels.GetMentionsReply
+	defer func() {
+		if replyMessage, err := json.Marshal(replyMsg); err != nil {
+			exception.Throwf("[CH] Failed to JSON marshal %T for "+
+				"GetMentions: %+v", replyMsg, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	var msg wChannels.GetMentionsMessage
+	err := json.Unmarshal(message, &msg)
+	if err != nil {
+		replyMsg.Error = errors.Errorf("failed to JSON unmarshal %T from "+
+			"main thread: %+v", msg, err).Error()
+		return
+	}
+
+	mentions, err := m.model.GetMentions(msg.PubKey, msg.Cursor, msg.Limit)
+	if err != nil {
+		replyMsg.Error = err.Error()
+	} else {
+		replyMsg.Mentions = mentions
+	}
+}
+
+// registerLiveQueryChannel is the callback for the live query MessageChannel
+// opened by the main thread. Subscriptions are made and their updates are
+// sent over it.
+func (m *manager) registerLiveQueryChannel(port js.Value, channelName string) {
+	mm, err := worker.NewMessageManager(
+		safejs.Safe(port), channelName+"-worker", worker.DefaultParams())
+	if err != nil {
+		jww.ERROR.Printf("[CH] Failed to create live query manager: %+v", err)
+		return
+	}
+
+	mm.RegisterCallback(wChannels.SubscribeTag,
+		func(message []byte, reply func(message []byte)) {
+			m.subscribeCB(mm, message, reply)
+		})
+	mm.RegisterCallback(wChannels.UnsubscribeTag, m.unsubscribeCB)
+}
+
+// subscribeCB is the callback for wasmModel.Subscribe. Updates to the query
+// are sent with the MessageManager of the live query MessageChannel. Returns
+// JSON marshalled channels.SubscribeReply. If an error occurs, then Error will
+// be set with the error message.
+func (m *manager) subscribeCB(mm *worker.MessageManager, message []byte,
+	reply func(message []byte)) {
+	var replyMsg wChannels.SubscribeReply
+	defer func() {
+		if replyMessage, err := json.Marshal(replyMsg); err != nil {
+			exception.Throwf("[CH] Failed to JSON marshal %T for "+
+				"Subscribe: %+v", replyMsg, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	var msg wChannels.SubscribeMessage
+	err := json.Unmarshal(message, &msg)
+	if err != nil {
+		replyMsg.Error = errors.Errorf("failed to JSON unmarshal %T from "+
+			"main thread: %+v", msg, err).Error()
+		return
+	} else if m.model == nil {
+		replyMsg.Error = "event model is not initialized"
+		return
+	}
+
+	err = m.model.Subscribe(msg.SubscriptionID, msg.Query,
+		func(update wChannels.LiveQueryUpdate) {
+			data, err := json.Marshal(update)
+			if err != nil {
+				jww.ERROR.Printf("[CH] Failed to JSON marshal %T for live "+
+					"query %d: %+v", update, update.SubscriptionID, err)
+				return
+			}
+			err = mm.SendNoResponse(wChannels.LiveQueryUpdateTag, data)
+			if err != nil {
+				jww.ERROR.Printf("[CH] Failed to send update for live query "+
+					"%d: %+v", update.SubscriptionID, err)
+			}
+		})
+	if err != nil {
+		replyMsg.Error = err.Error()
+	}
+}
+
+// unsubscribeCB is the callback for wasmModel.Unsubscribe. It does not return
+// a reply.
+func (m *manager) unsubscribeCB(message []byte, _ func([]byte)) {
+	var msg wChannels.UnsubscribeMessage
+	err := json.Unmarshal(message, &msg)
+	if err != nil {
+		jww.ERROR.Printf("[CH] Could not JSON unmarshal %T for Unsubscribe "+
+			"from main thread: %+v", msg, err)
+		return
+	} else if m.model == nil {
+		return
+	}
+
+	if err = m.model.Unsubscribe(msg.SubscriptionID); err != nil {
+		jww.WARN.Printf("[CH] %+v", err)
+	}
+}
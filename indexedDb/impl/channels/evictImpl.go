@@ -0,0 +1,182 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/client/v4/bindings"
+	"gitlab.com/elixxir/client/v4/channels"
+	cft "gitlab.com/elixxir/client/v4/channelsFileTransfer"
+	"gitlab.com/elixxir/wasm-utils/utils"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	"gitlab.com/elixxir/xxdk-wasm/storage"
+	"gitlab.com/xx_network/primitives/netTime"
+)
+
+// evict frees at least the given number of bytes by removing the data of the
+// oldest completed files and then the text of the oldest messages. It
+// implements [impl.Evictor].
+func (w *wasmModel) evict(
+	policy storage.EvictionPolicy, bytes uint64) (uint64, error) {
+	freed, err := w.evictFiles(bytes)
+	if err != nil {
+		return freed, err
+	} else if freed >= bytes {
+		return freed, nil
+	}
+
+	evicted, err := w.evictMessages(
+		bytes-freed, netTime.Now().Add(-policy.MinMessageAge))
+	return freed + evicted, err
+}
+
+// evictFiles removes the data of the oldest completed files until at least the
+// given number of bytes are freed. Only files with a link are evicted, so they
+// can be downloaded again. Returns the number of bytes freed.
+func (w *wasmModel) evictFiles(bytes uint64) (uint64, error) {
+	results, err := impl.GetAll(w.db, fileStoreName)
+	if err != nil {
+		return 0, errors.Errorf("failed to evict files: %+v", err)
+	}
+
+	// The stored files are modified without decrypting them
+	files := make([]*File, 0, len(results))
+	for _, result := range results {
+		f, err := valueToFile(result)
+		if err != nil {
+			return 0, errors.Errorf("failed to evict files: %+v", err)
+		}
+		if cft.Status(f.Status) == cft.Complete &&
+			(len(f.Data) > 0 || len(f.EncryptedData) > 0) &&
+			(len(f.Link) > 0 || len(f.EncryptedLink) > 0) {
+			files = append(files, f)
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].Timestamp.Before(files[j].Timestamp)
+	})
+
+	var freed uint64
+	for _, f := range files {
+		if freed >= bytes {
+			break
+		}
+		freed += uint64(len(f.Data))
+		for _, chunk := range f.EncryptedData {
+			freed += uint64(len(chunk))
+		}
+		f.Data, f.EncryptedData = nil, nil
+
+		data, err := json.Marshal(f)
+		if err != nil {
+			return freed, errors.Errorf("failed to evict files: %+v", err)
+		}
+		fileObj, err := utils.JsonToJS(data)
+		if err != nil {
+			return freed, errors.Errorf("failed to evict files: %+v", err)
+		}
+		if _, err = impl.Put(w.db, fileStoreName, fileObj); err != nil {
+			return freed, errors.Errorf("failed to evict files: %+v", err)
+		}
+	}
+
+	return freed, nil
+}
+
+// evictMessages removes the text of the oldest messages sent before the cutoff
+// until at least the given number of bytes are freed. Pinned messages are
+// never evicted. Returns the number of bytes freed.
+func (w *wasmModel) evictMessages(
+	bytes uint64, cutoff time.Time) (uint64, error) {
+	results, err := impl.GetAll(w.db, messageStoreName)
+	if err != nil {
+		return 0, errors.Errorf("failed to evict messages: %+v", err)
+	}
+
+	var msgs []storedMessage
+	for _, result := range results {
+		msg, err := valueToMessage(result)
+		if err != nil {
+			return 0, errors.Errorf("failed to evict messages: %+v", err)
+		}
+		if !msg.Evicted && !msg.Pinned && msg.Timestamp.Before(cutoff) &&
+			isSearchable(channels.MessageType(msg.Type)) {
+			msgs = append(msgs, storedMessage{
+				value: result,
+				msg:   msg,
+				size:  uint64(len(msg.Text)),
+			})
+		}
+	}
+	sort.SliceStable(msgs, func(i, j int) bool {
+		return msgs[i].msg.Timestamp.Before(msgs[j].msg.Timestamp)
+	})
+
+	// An empty text is encrypted if the database is encrypted, since every
+	// text is decrypted when read
+	var text string
+	if w.cipher != nil {
+		text, err = w.cipher.Encrypt([]byte{})
+		if err != nil {
+			return 0, errors.Errorf("failed to evict messages: %+v", err)
+		}
+	}
+
+	var freed uint64
+	for _, stored := range msgs {
+		if freed >= bytes {
+			break
+		}
+
+		// The stored record is modified without decrypting it, but the
+		// channel ID is needed for the event
+		opened, err := w.openMessage(stored.value)
+		if err != nil {
+			return freed, errors.Errorf("failed to evict messages: %+v", err)
+		}
+		channelID := changeChannelID(opened.ChannelID)
+
+		stored.msg.Text = text
+		stored.msg.Evicted = true
+		msgObj, err := storedMessageToValue(stored.msg)
+		if err != nil {
+			return freed, errors.Errorf("failed to evict messages: %+v", err)
+		}
+		err = impl.RunTransaction(w.db, func(txn *impl.Transaction) error {
+			if _, err := txn.Put(messageStoreName, msgObj); err != nil {
+				return err
+			}
+			return w.changes.Append(txn, bindings.MessageReceived,
+				bindings.MessageReceivedJSON{
+					UUID:      int64(stored.msg.ID),
+					ChannelID: channelID,
+					Update:    true,
+				})
+		}, messageStoreName, impl.ChangeLogStoreName)
+		if err != nil {
+			return freed, errors.Errorf("failed to evict messages: %+v", err)
+		}
+		freed += stored.size
+
+		if err = w.search.Remove(stored.msg.ID); err != nil {
+			jww.ERROR.Printf("Failed to remove evicted Message %d from "+
+				"search index: %+v", stored.msg.ID, err)
+		}
+		w.changes.Publish()
+	}
+
+	return freed, nil
+}
@@ -18,6 +18,7 @@ import (
 	"gitlab.com/elixxir/wasm-utils/utils"
 	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
 	"strings"
+	"syscall/js"
 	"time"
 )
 
@@ -63,7 +64,7 @@ func (w *wasmModel) UpdateFile(fileID fileTransfer.ID, fileLink,
 		}
 		return errors.WithMessage(err, parentErr)
 	}
-	currentFile, err := valueToFile(fileObj)
+	currentFile, err := w.valueToDecryptedFile(fileObj)
 	if err != nil {
 		return errors.WithMessage(err, parentErr)
 	}
@@ -86,8 +87,13 @@ func (w *wasmModel) UpdateFile(fileID fileTransfer.ID, fileLink,
 }
 
 // upsertFile is a helper function that will update an existing File
-// if File.Id is specified. Otherwise, it will perform an insert.
+// if File.Id is specified. Otherwise, it will perform an insert. The file data
+// and link are encrypted if the database is encrypted.
 func (w *wasmModel) upsertFile(newFile *File) error {
+	if err := w.encryptFile(newFile); err != nil {
+		return err
+	}
+
 	newFileJson, err := json.Marshal(&newFile)
 	if err != nil {
 		return err
@@ -117,7 +123,7 @@ func (w *wasmModel) GetFile(fileID fileTransfer.ID) (
 		return cft.ModelFile{}, err
 	}
 
-	resultFile, err := valueToFile(fileObj)
+	resultFile, err := w.valueToDecryptedFile(fileObj)
 	if err != nil {
 		return cft.ModelFile{}, err
 	}
@@ -145,3 +151,82 @@ func (w *wasmModel) DeleteFile(fileID fileTransfer.ID) error {
 	}
 	return err
 }
+
+// encryptFile replaces the plaintext data and link of the File with their
+// encrypted chunks. It does nothing if the database is not encrypted or the
+// File is already encrypted.
+func (w *wasmModel) encryptFile(f *File) error {
+	if w.cipher == nil {
+		return nil
+	}
+
+	var err error
+	if f.Data != nil {
+		f.EncryptedData, err = impl.EncryptChunks(w.cipher, f.Data)
+		if err != nil {
+			return errors.WithMessage(err, "failed to encrypt file data")
+		}
+		f.Data = nil
+	}
+	if f.Link != nil {
+		f.EncryptedLink, err = impl.EncryptChunks(w.cipher, f.Link)
+		if err != nil {
+			return errors.WithMessage(err, "failed to encrypt file link")
+		}
+		f.Link = nil
+	}
+
+	return nil
+}
+
+// valueToDecryptedFile converts the js.Value to a File and decrypts its data
+// and link. Files stored before encryption was added are returned as is.
+func (w *wasmModel) valueToDecryptedFile(fileObj js.Value) (*File, error) {
+	f, err := valueToFile(fileObj)
+	if err != nil {
+		return nil, err
+	}
+
+	if w.cipher == nil {
+		return f, nil
+	}
+
+	if len(f.EncryptedData) > 0 {
+		f.Data, err = impl.DecryptChunks(w.cipher, f.EncryptedData)
+		if err != nil {
+			return nil, errors.WithMessage(err, "failed to decrypt file data")
+		}
+		f.EncryptedData = nil
+	}
+	if len(f.EncryptedLink) > 0 {
+		f.Link, err = impl.DecryptChunks(w.cipher, f.EncryptedLink)
+		if err != nil {
+			return nil, errors.WithMessage(err, "failed to decrypt file link")
+		}
+		f.EncryptedLink = nil
+	}
+
+	return f, nil
+}
+
+// encryptFileValue is the [impl.RewriteStore] function that encrypts a File
+// stored in plaintext. Returns js.Undefined if the File does not need to be
+// rewritten.
+func (w *wasmModel) encryptFileValue(fileObj js.Value) (js.Value, error) {
+	f, err := valueToFile(fileObj)
+	if err != nil {
+		return js.Undefined(), err
+	} else if f.Data == nil && f.Link == nil {
+		return js.Undefined(), nil
+	}
+
+	if err = w.encryptFile(f); err != nil {
+		return js.Undefined(), err
+	}
+
+	fileJson, err := json.Marshal(f)
+	if err != nil {
+		return js.Undefined(), err
+	}
+	return utils.JsonToJS(fileJson)
+}
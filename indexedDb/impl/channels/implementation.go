@@ -10,10 +10,13 @@
 package main
 
 import (
+	"context"
 	"crypto/ed25519"
 	"encoding/json"
+	"math"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall/js"
 	"time"
 
@@ -30,7 +33,9 @@ import (
 	"gitlab.com/elixxir/crypto/message"
 	"gitlab.com/elixxir/wasm-utils/utils"
 	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	wChannels "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/channels"
 	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/netTime"
 )
 
 // wasmModel implements [channels.EventModel] interface backed by IndexedDb.
@@ -39,38 +44,50 @@ import (
 type wasmModel struct {
 	db            *idb.Database
 	cipher        idbCrypto.Cipher
+	search        *impl.SearchIndex
+	changes       *impl.ChangeLog
 	eventCallback eventUpdate
+
+	// blinder is set if all sensitive fields are encrypted. Indexed fields
+	// then hold blinded values.
+	blinder *impl.Blinder
+
+	// liveQueries are the live queries registered by the main thread, keyed
+	// on their subscription ID.
+	liveQueries map[uint64]*liveQuery
+	liveMux     sync.Mutex
+
+	// self is the public key of the local user, which is set by the main
+	// thread. It is nil until then.
+	self    ed25519.PublicKey
+	selfMux sync.Mutex
 }
 
 // JoinChannel is called whenever a channel is joined locally.
 func (w *wasmModel) JoinChannel(channel *cryptoBroadcast.Channel) {
 	parentErr := errors.New("failed to JoinChannel")
 
-	// Build object
-	newChannel := Channel{
+	channelObj, err := w.channelToValue(&Channel{
 		ID:          channel.ReceptionID.Marshal(),
 		Name:        channel.Name,
 		Description: channel.Description,
-	}
-
-	// Convert to jsObject
-	newChannelJson, err := json.Marshal(&newChannel)
+	})
 	if err != nil {
-		jww.ERROR.Printf("%+v", errors.WithMessagef(parentErr,
-			"Unable to marshal Channel: %+v", err))
+		jww.ERROR.Printf("%+v", errors.WithMessagef(parentErr, "%+v", err))
 		return
 	}
-	channelObj, err := utils.JsonToJS(newChannelJson)
+
+	_, err = impl.Put(w.db, channelStoreName, channelObj)
 	if err != nil {
 		jww.ERROR.Printf("%+v", errors.WithMessagef(parentErr,
-			"Unable to marshal Channel: %+v", err))
+			"Unable to put Channel: %+v", err))
 		return
 	}
 
-	_, err = impl.Put(w.db, channelStoreName, channelObj)
+	_, _, err = w.getOrCreateReadMarker(channel.ReceptionID.Marshal())
 	if err != nil {
 		jww.ERROR.Printf("%+v", errors.WithMessagef(parentErr,
-			"Unable to put Channel: %+v", err))
+			"Unable to create read marker: %+v", err))
 	}
 }
 
@@ -78,66 +95,63 @@ func (w *wasmModel) JoinChannel(channel *cryptoBroadcast.Channel) {
 func (w *wasmModel) LeaveChannel(channelID *id.ID) {
 	parentErr := errors.New("failed to LeaveChannel")
 
-	// Delete the channel from storage
-	err := impl.Delete(w.db, channelStoreName, js.ValueOf(channelID.String()))
-	if err != nil {
-		jww.ERROR.Printf("%+v", errors.WithMessagef(parentErr,
-			"Unable to delete Channel: %+v", err))
-		return
-	}
-
-	// Clean up lingering data
-	err = w.deleteMsgByChannel(channelID)
+	// Delete the channel and all of its data from storage at once, so that no
+	// data is left behind if any deletion fails
+	channelKey := w.blind(channelID.Marshal())
+	err := impl.RunTransaction(w.db, func(txn *impl.Transaction) error {
+		err := txn.Delete(channelStoreName, impl.EncodeBytes(channelKey))
+		if err != nil {
+			return errors.Errorf("Unable to delete Channel: %+v", err)
+		}
+		if err = w.deleteMsgByChannel(txn, channelID); err != nil {
+			return errors.Errorf(
+				"Deleting Channel's Message data failed: %+v", err)
+		}
+		if err = w.search.RemoveScopeTxn(txn, channelKey); err != nil {
+			return errors.Errorf(
+				"Deleting Channel's search data failed: %+v", err)
+		}
+		if err = impl.DeleteReadMarkerTxn(txn, channelKey); err != nil {
+			return errors.Errorf(
+				"Deleting Channel's read marker failed: %+v", err)
+		}
+		err = txn.Delete(retentionStoreName, w.indexKey(channelID.Marshal()))
+		if err != nil {
+			return errors.Errorf(
+				"Deleting Channel's retention policy failed: %+v", err)
+		}
+		err = txn.DeleteByIndex(mutedUserStoreName,
+			mutedUserStoreChannelIndex, w.indexKey(channelID.Marshal()))
+		if err != nil {
+			return errors.Errorf(
+				"Deleting Channel's muted users failed: %+v", err)
+		}
+		err = txn.DeleteByIndex(mentionStoreName,
+			mentionStoreChannelIndex, w.indexKey(channelID.Marshal()))
+		if err != nil {
+			return errors.Errorf(
+				"Deleting Channel's mentions failed: %+v", err)
+		}
+		return nil
+	}, channelStoreName, messageStoreName, impl.SearchStoreName,
+		impl.ReadMarkerStoreName, retentionStoreName, mutedUserStoreName,
+		mentionStoreName)
 	if err != nil {
-		jww.ERROR.Printf("%+v", errors.WithMessagef(parentErr,
-			"Deleting Channel's Message data failed: %+v", err))
+		jww.ERROR.Printf("%+v", errors.WithMessagef(parentErr, "%+v", err))
 		return
 	}
 	jww.DEBUG.Printf("Successfully deleted channel: %s", channelID)
+	w.clearLiveQueries(channelID)
 }
 
 // deleteMsgByChannel is a private helper that uses messageStoreChannelIndex
-// to delete all Message with the given Channel ID.
-func (w *wasmModel) deleteMsgByChannel(channelID *id.ID) error {
-	parentErr := errors.New("failed to deleteMsgByChannel")
-
-	// Prepare the Transaction
-	txn, err := w.db.Transaction(idb.TransactionReadWrite, messageStoreName)
+// to delete all Message with the given Channel ID as part of the transaction.
+func (w *wasmModel) deleteMsgByChannel(
+	txn *impl.Transaction, channelID *id.ID) error {
+	err := txn.DeleteByIndex(messageStoreName, messageStoreChannelIndex,
+		w.indexKey(channelID.Marshal()))
 	if err != nil {
-		return errors.WithMessagef(parentErr,
-			"Unable to create Transaction: %+v", err)
-	}
-	store, err := txn.ObjectStore(messageStoreName)
-	if err != nil {
-		return errors.WithMessagef(parentErr,
-			"Unable to get ObjectStore: %+v", err)
-	}
-	index, err := store.Index(messageStoreChannelIndex)
-	if err != nil {
-		return errors.WithMessagef(parentErr,
-			"Unable to get Index: %+v", err)
-	}
-
-	// Set up the operation
-	keyRange, err := idb.NewKeyRangeOnly(impl.EncodeBytes(channelID.Marshal()))
-	if err != nil {
-		return errors.WithMessagef(parentErr,
-			"Unable to NewKeyRangeOnly: %+v", err)
-	}
-	cursorRequest, err := index.OpenCursorRange(keyRange, idb.CursorNext)
-	if err != nil {
-		return errors.WithMessagef(parentErr, "Unable to open Cursor: %+v", err)
-	}
-
-	// Perform the operation
-	err = impl.SendCursorRequest(cursorRequest,
-		func(cursor *idb.CursorWithValue) error {
-			_, err := cursor.Delete()
-			return err
-		})
-	if err != nil {
-		return errors.WithMessagef(parentErr,
-			"Unable to delete Message data: %+v", err)
+		return errors.WithMessage(err, "failed to deleteMsgByChannel")
 	}
 	return nil
 }
@@ -151,6 +165,7 @@ func (w *wasmModel) ReceiveMessage(channelID *id.ID, messageID message.ID,
 	codeset uint8, timestamp time.Time, lease time.Duration, round rounds.Round,
 	mType channels.MessageType, status channels.SentStatus, hidden bool) uint64 {
 	var err error
+	plaintext := text
 
 	// Handle encryption, if it is present
 	if w.cipher != nil {
@@ -168,17 +183,22 @@ func (w *wasmModel) ReceiveMessage(channelID *id.ID, messageID message.ID,
 		text, pubKey, dmToken, codeset, timestamp, lease, round.ID, mType,
 		false, hidden, status)
 
-	uuid, err := w.upsertMessage(msgToInsert)
+	mentioned := w.receiveMentions(pubKey, dmToken, codeset, mType, plaintext)
+	uuid, err := w.upsertMentionedMessage(msgToInsert, mentioned)
 	if err != nil {
 		jww.ERROR.Printf("Failed to receive Message: %+v", err)
 		return 0
 	}
 
-	go w.eventCallback(bindings.MessageReceived, bindings.MessageReceivedJSON{
-		UUID:      int64(uuid),
-		ChannelID: channelID,
-		Update:    false,
-	})
+	// Messages from muted senders are not searchable until they are unmuted
+	if isSearchable(mType) && !msgToInsert.MutedHidden {
+		err = w.search.Add(uuid, w.blind(channelIDBytes), timestamp, plaintext)
+		if err != nil {
+			jww.ERROR.Printf("Failed to index Message: %+v", err)
+		}
+	}
+
+	w.changes.Publish()
 	return uuid
 }
 
@@ -194,6 +214,7 @@ func (w *wasmModel) ReceiveReply(channelID *id.ID, messageID,
 	round rounds.Round, mType channels.MessageType, status channels.SentStatus,
 	hidden bool) uint64 {
 	var err error
+	plaintext := text
 
 	// Handle encryption, if it is present
 	if w.cipher != nil {
@@ -208,19 +229,24 @@ func (w *wasmModel) ReceiveReply(channelID *id.ID, messageID,
 
 	msgToInsert := buildMessage(channelIDBytes, messageID.Bytes(),
 		replyTo.Bytes(), nickname, text, pubKey, dmToken, codeset,
-		timestamp, lease, round.ID, mType, hidden, false, status)
+		timestamp, lease, round.ID, mType, false, hidden, status)
 
-	uuid, err := w.upsertMessage(msgToInsert)
+	mentioned := w.receiveMentions(pubKey, dmToken, codeset, mType, plaintext)
+	uuid, err := w.upsertMentionedMessage(msgToInsert, mentioned)
 	if err != nil {
 		jww.ERROR.Printf("Failed to receive reply: %+v", err)
 		return 0
 	}
 
-	go w.eventCallback(bindings.MessageReceived, bindings.MessageReceivedJSON{
-		UUID:      int64(uuid),
-		ChannelID: channelID,
-		Update:    false,
-	})
+	// Messages from muted senders are not searchable until they are unmuted
+	if isSearchable(mType) && !msgToInsert.MutedHidden {
+		err = w.search.Add(uuid, w.blind(channelIDBytes), timestamp, plaintext)
+		if err != nil {
+			jww.ERROR.Printf("Failed to index reply: %+v", err)
+		}
+	}
+
+	w.changes.Publish()
 	return uuid
 }
 
@@ -252,17 +278,17 @@ func (w *wasmModel) ReceiveReaction(channelID *id.ID, messageID,
 		reaction, pubKey, dmToken, codeset, timestamp, lease, round.ID, mType,
 		false, hidden, status)
 
+	if err = w.registerSender(pubKey, codeset, dmToken); err != nil {
+		jww.ERROR.Printf("Failed to register sender: %+v", err)
+	}
+
 	uuid, err := w.upsertMessage(msgToInsert)
 	if err != nil {
 		jww.ERROR.Printf("Failed to receive reaction: %+v", err)
 		return 0
 	}
 
-	go w.eventCallback(bindings.MessageReceived, bindings.MessageReceivedJSON{
-		UUID:      int64(uuid),
-		ChannelID: channelID,
-		Update:    false,
-	})
+	w.changes.Publish()
 	return uuid
 }
 
@@ -282,26 +308,16 @@ func (w *wasmModel) UpdateFromUUID(uuid uint64, messageID *message.ID,
 	// Convert messageID to the key generated by json.Marshal
 	key := js.ValueOf(uuid)
 
-	// Use the key to get the existing Message
-	msgObj, err := impl.Get(w.db, messageStoreName, key)
+	// Use the key to get and update the existing Message
+	_, err := w.updateMessage(func(txn *impl.Transaction) (js.Value, error) {
+		return txn.Get(messageStoreName, key)
+	}, messageID, timestamp, round, pinned, hidden, status)
 	if err != nil {
 		if strings.Contains(err.Error(), impl.ErrDoesNotExist) {
 			return errors.WithMessage(channels.NoMessageErr, parentErr)
 		}
 		return errors.WithMessage(err, parentErr)
 	}
-
-	currentMsg, err := valueToMessage(msgObj)
-	if err != nil {
-		return errors.WithMessagef(err,
-			"%s Failed to marshal Message", parentErr)
-	}
-
-	_, err = w.updateMessage(currentMsg, messageID, timestamp,
-		round, pinned, hidden, status)
-	if err != nil {
-		return errors.WithMessage(err, parentErr)
-	}
 	return nil
 }
 
@@ -322,26 +338,16 @@ func (w *wasmModel) UpdateFromMessageID(messageID message.ID,
 	status *channels.SentStatus) (uint64, error) {
 	parentErr := "failed to UpdateFromMessageID"
 
-	msgObj, err := impl.GetIndex(w.db, messageStoreName,
-		messageStoreMessageIndex, impl.EncodeBytes(messageID.Marshal()))
+	key := w.indexKey(messageID.Marshal())
+	uuid, err := w.updateMessage(func(txn *impl.Transaction) (js.Value, error) {
+		return txn.GetIndex(messageStoreName, messageStoreMessageIndex, key)
+	}, &messageID, timestamp, round, pinned, hidden, status)
 	if err != nil {
 		if strings.Contains(err.Error(), impl.ErrDoesNotExist) {
 			return 0, errors.WithMessage(channels.NoMessageErr, parentErr)
 		}
 		return 0, errors.WithMessage(err, parentErr)
 	}
-
-	currentMsg, err := valueToMessage(msgObj)
-	if err != nil {
-		return 0, errors.WithMessagef(err,
-			"%s Failed to marshal Message", parentErr)
-	}
-
-	uuid, err := w.updateMessage(currentMsg, &messageID, timestamp,
-		round, pinned, hidden, status)
-	if err != nil {
-		return 0, errors.WithMessage(err, parentErr)
-	}
 	return uuid, nil
 }
 
@@ -376,69 +382,205 @@ func buildMessage(channelID, messageID, parentID []byte, nickname,
 	}
 }
 
-// updateMessage is a helper for updating a stored message.
-func (w *wasmModel) updateMessage(currentMsg *Message, messageID *message.ID,
+// updateMessage is a helper for updating a stored message. The message is
+// read with get, modified, and stored in a single transaction so that
+// concurrent updates to the same message are not lost.
+func (w *wasmModel) updateMessage(
+	get func(txn *impl.Transaction) (js.Value, error), messageID *message.ID,
 	timestamp *time.Time, round *rounds.Round, pinned, hidden *bool,
 	status *channels.SentStatus) (uint64, error) {
 
-	if status != nil {
-		currentMsg.Status = uint8(*status)
-	}
+	// Replies to the new ID may have been received first. They are counted
+	// before the transaction starts, since it commits once it has no pending
+	// requests.
+	var replyCount uint
 	if messageID != nil {
-		currentMsg.MessageID = messageID.Bytes()
+		var err error
+		replyCount, err = w.countReplies(messageID.Bytes())
+		if err != nil {
+			return 0, err
+		}
 	}
 
-	if round != nil {
-		currentMsg.Round = uint64(round.ID)
-	}
+	var before, currentMsg *Message
+	var uuid uint64
+	err := impl.RunTransaction(w.db, func(txn *impl.Transaction) error {
+		msgObj, err := get(txn)
+		if err != nil {
+			return err
+		}
+		currentMsg, err = w.openMessage(msgObj)
+		if err != nil {
+			return errors.WithMessage(err, "Failed to marshal Message")
+		}
+		original := *currentMsg
+		before = &original
 
-	if timestamp != nil {
-		currentMsg.Timestamp = *timestamp
-	}
+		if status != nil {
+			currentMsg.Status = uint8(*status)
+		}
+		if messageID != nil {
+			currentMsg.MessageID = messageID.Bytes()
+			currentMsg.ReplyCount = replyCount
+		}
 
-	if pinned != nil {
-		currentMsg.Pinned = *pinned
-	}
+		if round != nil {
+			currentMsg.Round = uint64(round.ID)
+		}
 
-	if hidden != nil {
-		currentMsg.Hidden = *hidden
-	}
+		if timestamp != nil {
+			currentMsg.Timestamp = *timestamp
+		}
 
-	// Store the updated Message
-	uuid, err := w.upsertMessage(currentMsg)
+		if pinned != nil {
+			if !*pinned {
+				currentMsg.PinnedAt = 0
+			} else if !currentMsg.Pinned {
+				currentMsg.PinnedAt = netTime.Now().UnixMilli()
+			}
+			currentMsg.Pinned = *pinned
+		}
+
+		// A message hidden because its sender is muted stays hidden until the
+		// sender is unmuted, unless it is hidden for its own sake
+		if hidden != nil && (*hidden || !currentMsg.MutedHidden) {
+			currentMsg.Hidden = *hidden
+			currentMsg.MutedHidden = false
+		}
+
+		// Store the updated Message
+		messageObj, err := w.messageToValue(currentMsg)
+		if err != nil {
+			return err
+		}
+		msgIdObj, err := txn.Put(messageStoreName, messageObj)
+		if err != nil {
+			return errors.Errorf("Unable to put Message: %+v", err)
+		}
+		uuid = uint64(msgIdObj.Int())
+
+		err = w.changes.Append(txn, bindings.MessageReceived,
+			bindings.MessageReceivedJSON{
+				UUID:      int64(uuid),
+				ChannelID: changeChannelID(currentMsg.ChannelID),
+				Update:    true,
+			})
+		if err != nil {
+			return err
+		}
+		err = w.updateUnreadTxn(txn, currentMsg.ChannelID, before, currentMsg)
+		if err != nil {
+			return err
+		}
+		return w.updateReplyCountTxn(txn, before, currentMsg)
+	}, messageStoreName, mutedUserStoreName, impl.ReadMarkerStoreName,
+		impl.ChangeLogStoreName)
 	if err != nil {
 		return 0, err
 	}
+	w.changes.Publish()
+
+	return uuid, nil
+}
 
-	channelID, err := id.Unmarshal(currentMsg.ChannelID)
+// messageToValue converts the Message to the js.Value that is stored,
+// encrypting its sensitive fields if all sensitive fields are encrypted.
+func (w *wasmModel) messageToValue(msg *Message) (js.Value, error) {
+	msg.SortTime = msg.Timestamp.UnixMilli()
+	msg.ExpiresAt = leaseExpiry(msg)
+	stored, err := w.sealMessage(msg)
 	if err != nil {
-		return 0, err
+		return js.Undefined(), errors.Errorf(
+			"Unable to encrypt Message: %+v", err)
 	}
 
-	go w.eventCallback(bindings.MessageReceived, bindings.MessageReceivedJSON{
-		UUID:      int64(uuid),
-		ChannelID: channelID,
-		Update:    true,
-	})
-
-	return uuid, nil
+	// Convert to jsObject
+	newMessageJson, err := json.Marshal(stored)
+	if err != nil {
+		return js.Undefined(), errors.Errorf(
+			"Unable to marshal Message: %+v", err)
+	}
+	messageObj, err := utils.JsonToJS(newMessageJson)
+	if err != nil {
+		return js.Undefined(), errors.Errorf(
+			"Unable to marshal Message: %+v", err)
+	}
+	return messageObj, nil
 }
 
 // upsertMessage is a helper function that will update an existing record
 // if Message.ID is specified. Otherwise, it will perform an insert.
 func (w *wasmModel) upsertMessage(msg *Message) (uint64, error) {
-	// Convert to jsObject
-	newMessageJson, err := json.Marshal(msg)
-	if err != nil {
-		return 0, errors.Errorf("Unable to marshal Message: %+v", err)
+	return w.upsertMentionedMessage(msg, nil)
+}
+
+// upsertMentionedMessage upserts the Message like upsertMessage. If it is
+// inserted, a Mention of each of the mentioned identities, given as blinded
+// public keys, is stored with it.
+func (w *wasmModel) upsertMentionedMessage(
+	msg *Message, mentioned [][]byte) (uint64, error) {
+	// Replies may be received before the message they reply to
+	if msg.ID == 0 {
+		replyCount, err := w.countReplies(msg.MessageID)
+		if err != nil {
+			return 0, errors.Errorf("Unable to count replies: %+v", err)
+		}
+		msg.ReplyCount = replyCount
+
+		if msg.Pinned && msg.PinnedAt == 0 {
+			msg.PinnedAt = netTime.Now().UnixMilli()
+		}
+
+		// Messages from muted senders are hidden as they are received
+		muted, err := w.isMuted(msg.ChannelID, msg.Pubkey)
+		if err != nil {
+			return 0, err
+		} else if muted && !msg.Hidden {
+			msg.Hidden = true
+			msg.MutedHidden = true
+		}
 	}
-	messageObj, err := utils.JsonToJS(newMessageJson)
+
+	messageObj, err := w.messageToValue(msg)
 	if err != nil {
-		return 0, errors.Errorf("Unable to marshal Message: %+v", err)
+		return 0, err
 	}
 
-	// Store message to database
-	msgIdObj, err := impl.Put(w.db, messageStoreName, messageObj)
+	// Only new messages that are shown notify the local user of a mention
+	mentionsMe := msg.ID == 0 && !msg.Hidden &&
+		w.mentionsSelf(mentioned, msg.Pubkey)
+
+	// Store message to database along with its mentions and change
+	var uuid uint64
+	err = impl.RunTransaction(w.db, func(txn *impl.Transaction) error {
+		msgIdObj, err := txn.Put(messageStoreName, messageObj)
+		if err != nil {
+			return err
+		}
+		uuid = uint64(msgIdObj.Int())
+		if msg.ID == 0 {
+			if err = w.putMentions(txn, uuid, msg, mentioned); err != nil {
+				return err
+			}
+		}
+		err = w.changes.Append(txn, bindings.MessageReceived,
+			wChannels.MessageReceivedJSON{
+				MessageReceivedJSON: bindings.MessageReceivedJSON{
+					UUID:      int64(uuid),
+					ChannelID: changeChannelID(msg.ChannelID),
+					Update:    msg.ID != 0,
+				},
+				MentionsMe: mentionsMe,
+			})
+		if err != nil || msg.ID != 0 {
+			return err
+		}
+		if err = w.updateUnreadTxn(txn, msg.ChannelID, nil, msg); err != nil {
+			return err
+		}
+		return w.updateReplyCountTxn(txn, nil, msg)
+	}, messageStoreName, mentionStoreName, mutedUserStoreName,
+		impl.ReadMarkerStoreName, impl.ChangeLogStoreName)
 	if err != nil {
 		// Do not error out when this message already exists inside
 		// the DB. Instead, set the ID and re-attempt as an update.
@@ -461,18 +603,29 @@ func (w *wasmModel) upsertMessage(msg *Message) (uint64, error) {
 				inErr)
 		}
 		return 0, errors.Errorf("Unable to put Message: %+v\n%s",
-			err, newMessageJson)
+			err, utils.JsToJson(messageObj))
 	}
 
-	uuid := msgIdObj.Int()
 	jww.DEBUG.Printf("Successfully stored message %d", uuid)
-	return uint64(uuid), nil
+	return uuid, nil
+}
+
+// changeChannelID unmarshalls the channel ID for the change of a message.
+// Returns nil if the channel ID is invalid so that the change is still
+// recorded.
+func changeChannelID(channelID []byte) *id.ID {
+	chID, err := id.Unmarshal(channelID)
+	if err != nil {
+		jww.WARN.Printf("Unable to unmarshal channel ID for change: %+v", err)
+		return nil
+	}
+	return chID
 }
 
 // GetMessage returns the message with the given [channel.MessageID].
 func (w *wasmModel) GetMessage(
 	messageID message.ID) (channels.ModelMessage, error) {
-	msgIDStr := impl.EncodeBytes(messageID.Marshal())
+	msgIDStr := w.indexKey(messageID.Marshal())
 
 	resultObj, err := impl.GetIndex(w.db, messageStoreName,
 		messageStoreMessageIndex, msgIDStr)
@@ -480,30 +633,246 @@ func (w *wasmModel) GetMessage(
 		return channels.ModelMessage{}, err
 	}
 
-	lookupResult, err := valueToMessage(resultObj)
+	lookupResult, err := w.openMessage(resultObj)
+	if err != nil {
+		return channels.ModelMessage{}, err
+	}
+
+	return toModelMessage(lookupResult)
+}
+
+// GetMessages returns up to limit messages in the given channel that are
+// ordered before the cursor, ordered from newest to oldest. Messages are
+// ordered by timestamp, to the millisecond, and then by UUID. If cursor is
+// nil, then the newest messages are returned. Hidden messages are excluded
+// unless includeHidden is set.
+//
+// To page through the history of a channel, call GetMessages again with the
+// timestamp and UUID of the oldest message in the previous result.
+func (w *wasmModel) GetMessages(ctx context.Context, channelID *id.ID,
+	cursor *wChannels.MessageCursor, limit int, includeHidden bool) (
+	[]channels.ModelMessage, error) {
+	parentErr := errors.New("failed to GetMessages")
+
+	if limit <= 0 {
+		return nil, errors.WithMessagef(parentErr,
+			"limit must be greater than zero, received %d", limit)
+	}
+
+	// Prepare the Transaction
+	txn, err := w.db.Transaction(idb.TransactionReadOnly, messageStoreName)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(messageStoreName)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to get ObjectStore: %+v", err)
+	}
+	index, err := store.Index(messageStoreChannelTimestampIndex)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to get Index: %+v", err)
+	}
+
+	// Set up the operation. Messages with the same timestamp as the cursor
+	// are in the range, since they are only ordered before it if their UUID
+	// is lower.
+	key := w.indexKey(channelID.Marshal())
+	upper := js.ValueOf([]any{key, math.Inf(1)})
+	if cursor != nil {
+		upper = js.ValueOf([]any{key, cursor.Timestamp.UnixMilli()})
+	}
+	keyRange, err := idb.NewKeyRangeBound(
+		js.ValueOf([]any{key, math.Inf(-1)}), upper, false, false)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to NewKeyRangeBound: %+v", err)
+	}
+	cursorRequest, err := index.OpenCursorRange(keyRange, idb.CursorPrevious)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to open Cursor: %+v", err)
+	}
+
+	// Perform the operation
+	results := make([]*Message, 0, limit)
+	err = impl.SendCursorRequestContext(ctx, cursorRequest,
+		func(c *idb.CursorWithValue) error {
+			if cursor != nil {
+				primaryKey, err := c.PrimaryKey()
+				if err != nil {
+					return err
+				}
+				indexKey, err := c.Key()
+				if err != nil {
+					return err
+				}
+				if int64(indexKey.Index(1).Float()) ==
+					cursor.Timestamp.UnixMilli() &&
+					uint64(primaryKey.Float()) >= cursor.UUID {
+					return nil
+				}
+			}
+
+			value, err := c.Value()
+			if err != nil {
+				return err
+			}
+			msg, err := w.openMessage(value)
+			if err != nil {
+				return err
+			}
+			if msg.Hidden && !includeHidden {
+				return nil
+			}
+			results = append(results, msg)
+			if len(results) >= limit {
+				return idb.ErrCursorStopIter
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to get Message data: %+v", err)
+	}
+
+	messages := make([]channels.ModelMessage, len(results))
+	for i, msg := range results {
+		messages[i], err = w.toDecryptedModelMessage(msg)
+		if err != nil {
+			return nil, errors.WithMessagef(parentErr,
+				"Unable to convert Message %d: %+v", msg.ID, err)
+		}
+	}
+
+	return messages, nil
+}
+
+// GetPinnedMessages returns the pinned messages in the given channel, ordered
+// from most to least recently pinned. Hidden messages are excluded.
+func (w *wasmModel) GetPinnedMessages(
+	channelID *id.ID) ([]channels.ModelMessage, error) {
+	parentErr := errors.New("failed to GetPinnedMessages")
+
+	// Prepare the Transaction
+	txn, err := w.db.Transaction(idb.TransactionReadOnly, messageStoreName)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(messageStoreName)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to get ObjectStore: %+v", err)
+	}
+	index, err := store.Index(messageStoreChannelPinnedIndex)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to get Index: %+v", err)
+	}
+
+	// Set up the operation. Every pin time in the channel is in the range.
+	channelKey := w.indexKey(channelID.Marshal())
+	keyRange, err := idb.NewKeyRangeBound(
+		js.ValueOf([]any{channelKey, math.Inf(-1)}),
+		js.ValueOf([]any{channelKey, math.Inf(1)}), false, false)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to NewKeyRangeBound: %+v", err)
+	}
+	cursorRequest, err := index.OpenCursorRange(keyRange, idb.CursorPrevious)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to open Cursor: %+v", err)
+	}
+
+	// Perform the operation
+	results := make([]*Message, 0)
+	err = impl.SendCursorRequest(cursorRequest,
+		func(cursor *idb.CursorWithValue) error {
+			value, err := cursor.Value()
+			if err != nil {
+				return err
+			}
+			msg, err := w.openMessage(value)
+			if err != nil {
+				return err
+			}
+			if !msg.Hidden {
+				results = append(results, msg)
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to get Message data: %+v", err)
+	}
+
+	messages := make([]channels.ModelMessage, len(results))
+	for i, msg := range results {
+		messages[i], err = w.toDecryptedModelMessage(msg)
+		if err != nil {
+			return nil, errors.WithMessagef(parentErr,
+				"Unable to convert Message %d: %+v", msg.ID, err)
+		}
+	}
+
+	return messages, nil
+}
+
+// toDecryptedModelMessage converts an opened Message into a
+// [channels.ModelMessage] with the decrypted contents.
+func (w *wasmModel) toDecryptedModelMessage(
+	msg *Message) (channels.ModelMessage, error) {
+	modelMsg, err := toModelMessage(msg)
 	if err != nil {
 		return channels.ModelMessage{}, err
 	}
 
+	// Handle decryption, if it is present
+	if w.cipher != nil {
+		modelMsg.Content, err = w.cipher.Decrypt(msg.Text)
+		if err != nil {
+			return channels.ModelMessage{}, errors.Errorf(
+				"Unable to decrypt Message %d: %+v", msg.ID, err)
+		}
+	}
+	return modelMsg, nil
+}
+
+// toModelMessage is a helper that converts a stored Message into a
+// [channels.ModelMessage]. The contents are returned as stored.
+func toModelMessage(msg *Message) (channels.ModelMessage, error) {
+	var err error
+	var messageID message.ID
+	if msg.MessageID != nil {
+		messageID, err = message.UnmarshalID(msg.MessageID)
+		if err != nil {
+			return channels.ModelMessage{}, err
+		}
+	}
+
 	var channelId *id.ID
-	if lookupResult.ChannelID != nil {
-		channelId, err = id.Unmarshal(lookupResult.ChannelID)
+	if msg.ChannelID != nil {
+		channelId, err = id.Unmarshal(msg.ChannelID)
 		if err != nil {
 			return channels.ModelMessage{}, err
 		}
 	}
 
 	var parentMsgId message.ID
-	if lookupResult.ParentMessageID != nil {
-		parentMsgId, err = message.UnmarshalID(lookupResult.ParentMessageID)
+	if msg.ParentMessageID != nil {
+		parentMsgId, err = message.UnmarshalID(msg.ParentMessageID)
 		if err != nil {
 			return channels.ModelMessage{}, err
 		}
 	}
 
 	lease := time.Duration(0)
-	if len(lookupResult.Lease) > 0 {
-		leaseInt, err := strconv.ParseInt(lookupResult.Lease, 10, 64)
+	if len(msg.Lease) > 0 {
+		leaseInt, err := strconv.ParseInt(msg.Lease, 10, 64)
 		if err != nil {
 			return channels.ModelMessage{}, err
 		}
@@ -511,48 +880,466 @@ func (w *wasmModel) GetMessage(
 	}
 
 	return channels.ModelMessage{
-		UUID:            lookupResult.ID,
-		Nickname:        lookupResult.Nickname,
+		UUID:            msg.ID,
+		Nickname:        msg.Nickname,
 		MessageID:       messageID,
 		ChannelID:       channelId,
 		ParentMessageID: parentMsgId,
-		Timestamp:       lookupResult.Timestamp,
+		Timestamp:       msg.Timestamp,
 		Lease:           lease,
-		Status:          channels.SentStatus(lookupResult.Status),
-		Hidden:          lookupResult.Hidden,
-		Pinned:          lookupResult.Pinned,
-		Content:         []byte(lookupResult.Text),
-		Type:            channels.MessageType(lookupResult.Type),
-		Round:           id.Round(lookupResult.Round),
-		PubKey:          lookupResult.Pubkey,
-		CodesetVersion:  lookupResult.CodesetVersion,
+		Status:          channels.SentStatus(msg.Status),
+		Hidden:          msg.Hidden,
+		Pinned:          msg.Pinned,
+		Content:         []byte(msg.Text),
+		Type:            channels.MessageType(msg.Type),
+		Round:           id.Round(msg.Round),
+		PubKey:          msg.Pubkey,
+		CodesetVersion:  msg.CodesetVersion,
+		DmToken:         msg.DmToken,
 	}, nil
 }
 
 // DeleteMessage removes a message with the given messageID from storage.
 func (w *wasmModel) DeleteMessage(messageID message.ID) error {
-	err := impl.DeleteIndex(w.db, messageStoreName,
-		messageStoreMessageIndex, pkeyName, impl.EncodeBytes(messageID.Marshal()))
+	msgObj, err := impl.GetIndex(w.db, messageStoreName,
+		messageStoreMessageIndex, w.indexKey(messageID.Marshal()))
+	if err != nil {
+		return err
+	}
+	msg, err := w.openMessage(msgObj)
 	if err != nil {
 		return err
 	}
 
-	go w.eventCallback(bindings.MessageDeleted, bindings.MessageDeletedJSON{
-		MessageID: messageID,
-	})
+	return w.deleteMessage(messageID, msg)
+}
+
+// deleteMessage removes the stored Message, which must have been read with
+// openMessage, and notifies the main thread.
+func (w *wasmModel) deleteMessage(messageID message.ID, msg *Message) error {
+	err := impl.RunTransaction(w.db, func(txn *impl.Transaction) error {
+		err := txn.Delete(messageStoreName, js.ValueOf(msg.ID))
+		if err != nil {
+			return err
+		}
+		err = txn.DeleteByIndex(mentionStoreName,
+			mentionStoreMessageIndex, js.ValueOf(msg.ID))
+		if err != nil {
+			return err
+		}
+		err = w.changes.Append(txn, bindings.MessageDeleted,
+			bindings.MessageDeletedJSON{MessageID: messageID})
+		if err != nil {
+			return err
+		}
+		if err = w.updateUnreadTxn(txn, msg.ChannelID, msg, nil); err != nil {
+			return err
+		}
+		return w.updateReplyCountTxn(txn, msg, nil)
+	}, messageStoreName, mentionStoreName, mutedUserStoreName,
+		impl.ReadMarkerStoreName, impl.ChangeLogStoreName)
+	if err != nil {
+		return err
+	}
+
+	err = w.search.Remove(msg.ID)
+	w.changes.Publish()
+	return err
+}
+
+// SearchMessages returns the UUIDs of up to limit messages whose text contains
+// every word in the query, ordered from newest to oldest. If channelID is not
+// nil, only messages in that channel are searched.
+func (w *wasmModel) SearchMessages(ctx context.Context, query string,
+	channelID *id.ID, limit int) ([]uint64, error) {
+	var scope []byte
+	if channelID != nil {
+		scope = w.blind(channelID.Marshal())
+	}
+	return w.search.Search(ctx, query, scope, limit)
+}
+
+// GetChangesSince returns up to limit changes made after the change with the
+// given sequence number, ordered by sequence number. Changes older than
+// impl.ChangeLogMaxAge are not kept.
+func (w *wasmModel) GetChangesSince(seq uint64, limit int) (
+	[]impl.Change, error) {
+	return w.changes.GetChangesSince(seq, limit)
+}
+
+// rebuildSearchIndex adds every searchable message currently in storage to the
+// search index. Progress is reported periodically with the number of messages
+// processed and the total. It is safe to call more than once.
+func (w *wasmModel) rebuildSearchIndex(progress func(done, total uint)) error {
+	parentErr := errors.New("failed to rebuildSearchIndex")
+
+	results, err := impl.GetAll(w.db, messageStoreName)
+	if err != nil {
+		return errors.WithMessagef(parentErr, "%+v", err)
+	}
+
+	total := uint(len(results))
+	var indexed int
+	for i, result := range results {
+		if i > 0 && i%impl.MigrationProgressInterval == 0 {
+			progress(uint(i), total)
+		}
 
+		msg, err := w.openMessage(result)
+		if err != nil {
+			return errors.WithMessagef(parentErr,
+				"Unable to unmarshal Message: %+v", err)
+		}
+		if !isSearchable(channels.MessageType(msg.Type)) || msg.MutedHidden {
+			continue
+		}
+
+		if err = w.addToSearch(msg); err != nil {
+			return errors.WithMessagef(parentErr, "%+v", err)
+		}
+		indexed++
+	}
+
+	progress(total, total)
+	jww.INFO.Printf("Added %d messages to the search index", indexed)
 	return nil
 }
 
-// MuteUser is called whenever a user is muted or unmuted.
+// addToSearch adds the text of the opened Message to the search index.
+func (w *wasmModel) addToSearch(msg *Message) error {
+	text := []byte(msg.Text)
+	if w.cipher != nil {
+		var err error
+		text, err = w.cipher.Decrypt(msg.Text)
+		if err != nil {
+			return errors.Errorf(
+				"Unable to decrypt Message %d: %+v", msg.ID, err)
+		}
+	}
+
+	return w.search.Add(
+		msg.ID, w.blind(msg.ChannelID), msg.Timestamp, string(text))
+}
+
+// isSearchable returns true if messages of the given type contain text that
+// should be added to the search index.
+func isSearchable(mType channels.MessageType) bool {
+	return mType == channels.Text || mType == channels.AdminText
+}
+
+// MuteUser is called whenever a user is muted or unmuted. The messages of a
+// muted user in the channel are hidden and shown again once they are unmuted.
 func (w *wasmModel) MuteUser(
 	channelID *id.ID, pubKey ed25519.PublicKey, unmute bool) {
+	if err := w.setUserMuted(channelID, pubKey, !unmute); err != nil {
+		jww.ERROR.Printf("Failed to mute user: %+v", err)
+
+		// The main thread is still notified of the change
+		err = w.changes.Record(bindings.UserMuted, bindings.UserMutedJSON{
+			ChannelID: channelID,
+			PubKey:    pubKey,
+			Unmute:    unmute,
+		})
+		if err != nil {
+			jww.ERROR.Printf("Failed to record muted user: %+v", err)
+		}
+	}
 
-	go w.eventCallback(bindings.UserMuted, bindings.UserMutedJSON{
-		ChannelID: channelID,
-		PubKey:    pubKey,
-		Unmute:    unmute,
+	if err := w.recountUnread(channelID.Marshal()); err != nil {
+		jww.ERROR.Printf("Failed to update unread count for muted user: "+
+			"%+v", err)
+	}
+}
+
+// sensitiveFields contains the fields of a Message that are encrypted when all
+// sensitive fields are encrypted. It is JSON marshalled and stored encrypted in
+// Message.Sensitive.
+type sensitiveFields struct {
+	Nickname        string `json:"nickname"`
+	MessageID       []byte `json:"message_id"`
+	ChannelID       []byte `json:"channel_id"`
+	ParentMessageID []byte `json:"parent_message_id"`
+	Pubkey          []byte `json:"pubkey"`
+	DmToken         uint32 `json:"dm_token"`
+}
+
+// blind returns the blinded value if all sensitive fields are encrypted.
+// Otherwise, the value is returned unchanged.
+func (w *wasmModel) blind(value []byte) []byte {
+	if w.blinder == nil {
+		return value
+	}
+	return w.blinder.Blind(value)
+}
+
+// indexKey returns the key used to look up the value in an index.
+func (w *wasmModel) indexKey(value []byte) js.Value {
+	return impl.EncodeBytes(w.blind(value))
+}
+
+// sealMessage returns the Message as it is stored. If all sensitive fields are
+// encrypted, a copy is returned with the sensitive fields encrypted in
+// Sensitive and the indexed fields replaced with blinded values. Otherwise,
+// the Message is returned unchanged.
+func (w *wasmModel) sealMessage(msg *Message) (*Message, error) {
+	if w.blinder == nil {
+		return msg, nil
+	}
+
+	data, err := json.Marshal(sensitiveFields{
+		Nickname:        msg.Nickname,
+		MessageID:       msg.MessageID,
+		ChannelID:       msg.ChannelID,
+		ParentMessageID: msg.ParentMessageID,
+		Pubkey:          msg.Pubkey,
+		DmToken:         msg.DmToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := *msg
+	sealed.Sensitive, err = impl.EncryptChunks(w.cipher, data)
+	if err != nil {
+		return nil, err
+	}
+	sealed.Nickname = ""
+	sealed.MessageID = w.blinder.Blind(msg.MessageID)
+	sealed.ChannelID = w.blinder.Blind(msg.ChannelID)
+	sealed.ParentMessageID = w.blinder.Blind(msg.ParentMessageID)
+	sealed.Pubkey = w.blinder.Blind(msg.Pubkey)
+	sealed.DmToken = 0
+	return &sealed, nil
+}
+
+// openMessage converts js.Value to Message and decrypts its sensitive
+// fields, if they are encrypted.
+func (w *wasmModel) openMessage(msgObj js.Value) (*Message, error) {
+	msg, err := valueToMessage(msgObj)
+	if err != nil || msg.Sensitive == nil {
+		return msg, err
+	} else if w.cipher == nil {
+		return nil, errors.New("cannot decrypt Message without a cipher")
+	}
+
+	data, err := impl.DecryptChunks(w.cipher, msg.Sensitive)
+	if err != nil {
+		return nil, errors.Errorf(
+			"Unable to decrypt Message %d: %+v", msg.ID, err)
+	}
+	var fields sensitiveFields
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return nil, errors.Errorf(
+			"Unable to unmarshal Message %d: %+v", msg.ID, err)
+	}
+
+	msg.Nickname = fields.Nickname
+	msg.MessageID = fields.MessageID
+	msg.ChannelID = fields.ChannelID
+	msg.ParentMessageID = fields.ParentMessageID
+	msg.Pubkey = fields.Pubkey
+	msg.DmToken = fields.DmToken
+	msg.Sensitive = nil
+	return msg, nil
+}
+
+// channelFields contains the fields of a Channel that are encrypted when all
+// sensitive fields are encrypted. It is JSON marshalled and stored encrypted in
+// Channel.Sensitive.
+type channelFields struct {
+	ID          []byte `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// channelToValue seals the Channel and converts it to a js.Value.
+func (w *wasmModel) channelToValue(channel *Channel) (js.Value, error) {
+	stored, err := w.sealChannel(channel)
+	if err != nil {
+		return js.Undefined(), errors.Errorf(
+			"Unable to encrypt Channel: %+v", err)
+	}
+
+	channelJson, err := json.Marshal(stored)
+	if err != nil {
+		return js.Undefined(), errors.Errorf(
+			"Unable to marshal Channel: %+v", err)
+	}
+	channelObj, err := utils.JsonToJS(channelJson)
+	if err != nil {
+		return js.Undefined(), errors.Errorf(
+			"Unable to marshal Channel: %+v", err)
+	}
+	return channelObj, nil
+}
+
+// sealChannel returns the Channel as it is stored. If all sensitive fields are
+// encrypted, a copy is returned with the fields encrypted in Sensitive and the
+// ID replaced with the blinded ID. Otherwise, the Channel is returned
+// unchanged.
+func (w *wasmModel) sealChannel(channel *Channel) (*Channel, error) {
+	if w.blinder == nil {
+		return channel, nil
+	}
+
+	data, err := json.Marshal(channelFields{
+		ID:          channel.ID,
+		Name:        channel.Name,
+		Description: channel.Description,
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	sensitive, err := impl.EncryptChunks(w.cipher, data)
+	if err != nil {
+		return nil, err
+	}
+	return &Channel{
+		ID:        w.blinder.Blind(channel.ID),
+		Sensitive: sensitive,
+	}, nil
+}
+
+// openChannel converts js.Value to Channel and decrypts its sensitive fields,
+// if they are encrypted.
+func (w *wasmModel) openChannel(channelObj js.Value) (*Channel, error) {
+	channel, err := valueToChannel(channelObj)
+	if err != nil || channel.Sensitive == nil {
+		return channel, err
+	} else if w.cipher == nil {
+		return nil, errors.New("cannot decrypt Channel without a cipher")
+	}
+
+	data, err := impl.DecryptChunks(w.cipher, channel.Sensitive)
+	if err != nil {
+		return nil, errors.Errorf("Unable to decrypt Channel: %+v", err)
+	}
+	var fields channelFields
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return nil, errors.Errorf("Unable to unmarshal Channel: %+v", err)
+	}
+
+	return &Channel{
+		ID:          fields.ID,
+		Name:        fields.Name,
+		Description: fields.Description,
+	}, nil
+}
+
+// sealChannels seals every Channel stored in plaintext before the Channel was
+// encrypted with the other sensitive fields. The blinded ID is the primary key
+// of a sealed Channel, so each plaintext Channel is replaced rather than
+// updated in place.
+func (w *wasmModel) sealChannels(
+	db *idb.Database, progress func(done, total uint)) error {
+	results, err := impl.GetAll(db, channelStoreName)
+	if err != nil {
+		return err
+	}
+
+	var plaintext []*Channel
+	for _, result := range results {
+		channel, err := valueToChannel(result)
+		if err != nil {
+			return errors.Errorf("Unable to unmarshal Channel: %+v", err)
+		} else if channel.Sensitive == nil {
+			plaintext = append(plaintext, channel)
+		}
+	}
+
+	err = impl.RunTransaction(db, func(txn *impl.Transaction) error {
+		for _, channel := range plaintext {
+			channelObj, err := w.channelToValue(channel)
+			if err != nil {
+				return err
+			}
+			err = txn.Delete(channelStoreName, impl.EncodeBytes(channel.ID))
+			if err != nil {
+				return errors.Errorf("Unable to delete Channel: %+v", err)
+			}
+			if _, err = txn.Put(channelStoreName, channelObj); err != nil {
+				return errors.Errorf("Unable to put Channel: %+v", err)
+			}
+		}
+		return nil
+	}, channelStoreName)
+	if err != nil {
+		return err
+	}
+
+	progress(uint(len(results)), uint(len(results)))
+	return nil
+}
+
+// resealMessageValue is the [impl.RewriteStore] function that adds the blinded
+// public key to a Message stored before the sender index existed. Returns
+// js.Undefined if the Message does not need to be rewritten.
+func (w *wasmModel) resealMessageValue(msgObj js.Value) (js.Value, error) {
+	stored, err := valueToMessage(msgObj)
+	if err != nil {
+		return js.Undefined(), err
+	} else if stored.Sensitive == nil || stored.Pubkey != nil {
+		return js.Undefined(), nil
+	}
+
+	msg, err := w.openMessage(msgObj)
+	if err != nil {
+		return js.Undefined(), err
+	}
+	return w.messageToValue(msg)
+}
+
+// sortTimeValue is the [impl.RewriteStore] function that sets the sort time of
+// a Message stored before the sort time existed. Returns js.Undefined if the
+// Message does not need to be rewritten.
+func sortTimeValue(msgObj js.Value) (js.Value, error) {
+	msg, err := valueToMessage(msgObj)
+	if err != nil {
+		return js.Undefined(), err
+	} else if msg.SortTime == msg.Timestamp.UnixMilli() {
+		return js.Undefined(), nil
+	}
+
+	// The timestamp is not a sensitive field, so the stored record is
+	// modified without decrypting it
+	msg.SortTime = msg.Timestamp.UnixMilli()
+	return storedMessageToValue(msg)
+}
+
+// expiresAtValue is the [impl.RewriteStore] function that sets the expiry time
+// of a Message with a lease stored before the expiry time existed. Returns
+// js.Undefined if the Message does not need to be rewritten.
+func expiresAtValue(msgObj js.Value) (js.Value, error) {
+	msg, err := valueToMessage(msgObj)
+	if err != nil {
+		return js.Undefined(), err
+	} else if msg.ExpiresAt == leaseExpiry(msg) {
+		return js.Undefined(), nil
+	}
+
+	// The lease and timestamp are not sensitive fields, so the stored record
+	// is modified without decrypting it
+	msg.ExpiresAt = leaseExpiry(msg)
+	return storedMessageToValue(msg)
+}
+
+// pinnedAtValue is the [impl.RewriteStore] function that sets the pin time of
+// a pinned Message stored before the pin time existed. The time it was sent is
+// used, since the time it was pinned is unknown. Returns js.Undefined if the
+// Message does not need to be rewritten.
+func pinnedAtValue(msgObj js.Value) (js.Value, error) {
+	msg, err := valueToMessage(msgObj)
+	if err != nil {
+		return js.Undefined(), err
+	} else if !msg.Pinned || msg.PinnedAt != 0 {
+		return js.Undefined(), nil
+	}
+
+	// The pin time is not a sensitive field, so the stored record is
+	// modified without decrypting it
+	msg.PinnedAt = msg.Timestamp.UnixMilli()
+	return storedMessageToValue(msg)
 }
 
 // valueToMessage is a helper for converting js.Value to Message.
@@ -561,6 +1348,13 @@ func valueToMessage(msgObj js.Value) (*Message, error) {
 	return resultMsg, json.Unmarshal([]byte(utils.JsToJson(msgObj)), resultMsg)
 }
 
+// valueToChannel is a helper for converting js.Value to Channel.
+func valueToChannel(channelObj js.Value) (*Channel, error) {
+	resultChannel := &Channel{}
+	return resultChannel,
+		json.Unmarshal([]byte(utils.JsToJson(channelObj)), resultChannel)
+}
+
 // valueToFile is a helper for converting js.Value to File.
 func valueToFile(fileObj js.Value) (*File, error) {
 	resultFile := &File{}
@@ -11,11 +11,17 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"os"
+	"sort"
 	"strconv"
+	"syscall/js"
 	"testing"
 	"time"
 
@@ -23,15 +29,19 @@ import (
 	jww "github.com/spf13/jwalterweatherman"
 	"github.com/stretchr/testify/require"
 
+	"gitlab.com/elixxir/client/v4/bindings"
 	"gitlab.com/elixxir/client/v4/channels"
 	cft "gitlab.com/elixxir/client/v4/channelsFileTransfer"
 	"gitlab.com/elixxir/client/v4/cmix/rounds"
 	cryptoBroadcast "gitlab.com/elixxir/crypto/broadcast"
+	"gitlab.com/elixxir/crypto/codename"
 	"gitlab.com/elixxir/crypto/fileTransfer"
 	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
 	"gitlab.com/elixxir/crypto/message"
 	"gitlab.com/elixxir/wasm-utils/storage"
+	"gitlab.com/elixxir/wasm-utils/utils"
 	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	wChannels "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/channels"
 	"gitlab.com/xx_network/crypto/csprng"
 	"gitlab.com/xx_network/primitives/id"
 	"gitlab.com/xx_network/primitives/netTime"
@@ -47,7 +57,7 @@ var dummyEU = func(int64, any) {}
 // Happy path test for receiving, updating, getting, and deleting a File.
 func TestWasmModel_ReceiveFile(t *testing.T) {
 	testString := "TestWasmModel_ReceiveFile"
-	m, err := newWASMModel(testString, nil, dummyEU)
+	m, err := newWASMModel(testString, nil, false, dummyEU)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -116,6 +126,147 @@ func TestWasmModel_ReceiveFile(t *testing.T) {
 	}
 }
 
+// Tests that the data and link of a File are encrypted at rest when the model
+// has a cipher and are decrypted by GetFile and UpdateFile.
+func TestWasmModel_ReceiveFile_Encrypted(t *testing.T) {
+	testString := "TestWasmModel_ReceiveFile_Encrypted"
+	c, err := idbCrypto.NewCipher(
+		[]byte("testPass"), []byte("testSalt"), 32, csprng.NewSystemRNG())
+	require.NoError(t, err)
+	m, err := newWASMModel(testString, c, false, dummyEU)
+	require.NoError(t, err)
+
+	data := bytes.Repeat([]byte(testString), 10)
+	link := []byte("link")
+	fId := fileTransfer.NewID(data)
+	err = m.ReceiveFile(fId, link, data, time.Now(), cft.Downloading)
+	require.NoError(t, err)
+
+	// The stored row must not contain the plaintext
+	raw, err := impl.Get(m.db, fileStoreName, impl.EncodeBytes(fId.Marshal()))
+	require.NoError(t, err)
+	require.NotContains(t,
+		utils.JsToJson(raw), base64.StdEncoding.EncodeToString(data))
+	stored, err := valueToFile(raw)
+	require.NoError(t, err)
+	require.Nil(t, stored.Data)
+	require.Nil(t, stored.Link)
+	require.NotEmpty(t, stored.EncryptedData)
+	require.NotEmpty(t, stored.EncryptedLink)
+
+	// Updating the status keeps the encrypted data
+	status := cft.Complete
+	require.NoError(t, m.UpdateFile(fId, nil, nil, nil, &status))
+	file, err := m.GetFile(fId)
+	require.NoError(t, err)
+	require.Equal(t, data, file.Data)
+	require.Equal(t, link, file.Link)
+	require.Equal(t, status, file.Status)
+}
+
+// Tests that when all sensitive fields are encrypted, the stored Message only
+// contains blinded IDs and encrypted nickname, public key, and DM token, and
+// that messages can still be looked up, updated, searched, and deleted.
+func TestWasmModel_EncryptAll(t *testing.T) {
+	ctx := context.Background()
+	testString := "TestWasmModel_EncryptAll"
+	storage.GetLocalStorage().Clear()
+	c, err := idbCrypto.NewCipher(
+		[]byte("testPass"), []byte("testSalt"), 32, csprng.NewSystemRNG())
+	require.NoError(t, err)
+	m, err := newWASMModel(testString, c, true, dummyEU)
+	require.NoError(t, err)
+
+	channelID := id.NewIdFromString(testString, id.Generic, t)
+	parentID := message.DeriveChannelMessageID(channelID, 0, []byte("parent"))
+	msgID := message.DeriveChannelMessageID(channelID, 1, []byte("reply"))
+	nickname := "secretNickname"
+	pubKey := []byte("secretPublicKey0secretPublicKey0")
+	uuid := m.ReceiveReply(channelID, msgID, parentID, nickname,
+		"hello world", pubKey, 42, 0, netTime.Now(), time.Second,
+		rounds.Round{ID: 5}, channels.Text, channels.Sent, false)
+	require.NotZero(t, uuid)
+
+	// The stored row must not contain any of the sensitive values
+	raw, err := impl.Get(m.db, messageStoreName, js.ValueOf(uuid))
+	require.NoError(t, err)
+	rawJson := utils.JsToJson(raw)
+	for _, b := range [][]byte{
+		channelID.Marshal(), parentID.Marshal(), msgID.Marshal(), pubKey} {
+		require.NotContains(t, rawJson, base64.StdEncoding.EncodeToString(b))
+	}
+	require.NotContains(t, rawJson, nickname)
+	stored, err := valueToMessage(raw)
+	require.NoError(t, err)
+	require.NotEmpty(t, stored.Sensitive)
+	require.Zero(t, stored.DmToken)
+
+	// Lookups by the blinded indexes still work
+	msg, err := m.GetMessage(msgID)
+	require.NoError(t, err)
+	require.Equal(t, nickname, msg.Nickname)
+	require.Equal(t, channelID, msg.ChannelID)
+	require.Equal(t, parentID, msg.ParentMessageID)
+	require.Equal(t, ed25519.PublicKey(pubKey), msg.PubKey)
+	require.Equal(t, uint32(42), msg.DmToken)
+
+	status := channels.Delivered
+	_, err = m.UpdateFromMessageID(msgID, nil, nil, nil, nil, &status)
+	require.NoError(t, err)
+	messages, err := m.GetMessages(ctx, channelID, nil, 10, false)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	require.Equal(t, status, messages[0].Status)
+	require.Equal(t, msgID, messages[0].MessageID)
+
+	results, err := m.SearchMessages(ctx, "hello", channelID, 10)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{uuid}, results)
+
+	require.NoError(t, m.DeleteMessage(msgID))
+	_, err = m.GetMessage(msgID)
+	require.Error(t, err)
+}
+
+// Tests that when all sensitive fields are encrypted, the stored Channel only
+// contains the blinded channel ID and that the channel can still be listed and
+// left.
+func TestWasmModel_EncryptAll_Channel(t *testing.T) {
+	testString := "TestWasmModel_EncryptAll_Channel"
+	storage.GetLocalStorage().Clear()
+	c, err := idbCrypto.NewCipher(
+		[]byte("testPass"), []byte("testSalt"), 32, csprng.NewSystemRNG())
+	require.NoError(t, err)
+	m, err := newWASMModel(testString, c, true, dummyEU)
+	require.NoError(t, err)
+
+	channel := &cryptoBroadcast.Channel{
+		ReceptionID: id.NewIdFromString(testString, id.Generic, t),
+		Name:        "secretName",
+		Description: "secretDescription",
+	}
+	m.JoinChannel(channel)
+
+	// The stored row must not contain any of the sensitive values
+	results, err := impl.Dump(m.db, channelStoreName)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.NotContains(t, results[0], base64.StdEncoding.EncodeToString(
+		channel.ReceptionID.Marshal()))
+	require.NotContains(t, results[0], channel.Name)
+	require.NotContains(t, results[0], channel.Description)
+
+	summary, err := m.GetUnreadSummary()
+	require.NoError(t, err)
+	require.Len(t, summary, 1)
+	require.Equal(t, channel.ReceptionID, summary[0].ChannelID)
+
+	m.LeaveChannel(channel.ReceptionID)
+	results, err = impl.Dump(m.db, channelStoreName)
+	require.NoError(t, err)
+	require.Empty(t, results)
+}
+
 // Happy path, insert message and look it up
 func TestWasmModel_GetMessage(t *testing.T) {
 	cipher, err := idbCrypto.NewCipher(
@@ -133,7 +284,7 @@ func TestWasmModel_GetMessage(t *testing.T) {
 			storage.GetLocalStorage().Clear()
 			testMsgId := message.DeriveChannelMessageID(&id.ID{1}, 0, []byte(testString))
 
-			eventModel, err := newWASMModel(testString, c, dummyEU)
+			eventModel, err := newWASMModel(testString, c, false, dummyEU)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -163,7 +314,7 @@ func TestWasmModel_DeleteMessage(t *testing.T) {
 	storage.GetLocalStorage().Clear()
 	testString := "TestWasmModel_DeleteMessage"
 	testMsgId := message.DeriveChannelMessageID(&id.ID{1}, 0, []byte(testString))
-	eventModel, err := newWASMModel(testString, nil, dummyEU)
+	eventModel, err := newWASMModel(testString, nil, false, dummyEU)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -219,7 +370,7 @@ func Test_wasmModel_UpdateSentStatus(t *testing.T) {
 			testString := "Test_wasmModel_UpdateSentStatus" + cs
 			testMsgId := message.DeriveChannelMessageID(
 				&id.ID{1}, 0, []byte(testString))
-			eventModel, err2 := newWASMModel(testString, c, dummyEU)
+			eventModel, err2 := newWASMModel(testString, c, false, dummyEU)
 			if err2 != nil {
 				t.Fatal(err)
 			}
@@ -290,7 +441,7 @@ func Test_wasmModel_JoinChannel_LeaveChannel(t *testing.T) {
 		}
 		t.Run("Test_wasmModel_JoinChannel_LeaveChannel"+cs, func(t *testing.T) {
 			storage.GetLocalStorage().Clear()
-			eventModel, err2 := newWASMModel("test", c, dummyEU)
+			eventModel, err2 := newWASMModel("test", c, false, dummyEU)
 			if err2 != nil {
 				t.Fatal(err2)
 			}
@@ -343,7 +494,7 @@ func Test_wasmModel_UUIDTest(t *testing.T) {
 		t.Run("Test_wasmModel_UUIDTest"+cs, func(t *testing.T) {
 			storage.GetLocalStorage().Clear()
 			testString := "testHello" + cs
-			eventModel, err2 := newWASMModel(testString, c, dummyEU)
+			eventModel, err2 := newWASMModel(testString, c, false, dummyEU)
 			if err2 != nil {
 				t.Fatal(err2)
 			}
@@ -389,7 +540,7 @@ func Test_wasmModel_DuplicateReceives(t *testing.T) {
 		testString := "Test_wasmModel_DuplicateReceives" + cs
 		t.Run(testString, func(t *testing.T) {
 			storage.GetLocalStorage().Clear()
-			eventModel, err := newWASMModel(testString, c, dummyEU)
+			eventModel, err := newWASMModel(testString, c, false, dummyEU)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -440,7 +591,7 @@ func Test_wasmModel_deleteMsgByChannel(t *testing.T) {
 			storage.GetLocalStorage().Clear()
 			totalMessages := 10
 			expectedMessages := 5
-			eventModel, err := newWASMModel(testString, c, dummyEU)
+			eventModel, err := newWASMModel(testString, c, false, dummyEU)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -477,7 +628,10 @@ func Test_wasmModel_deleteMsgByChannel(t *testing.T) {
 			}
 
 			// Do delete
-			err = eventModel.deleteMsgByChannel(deleteChannel)
+			err = impl.RunTransaction(eventModel.db,
+				func(txn *impl.Transaction) error {
+					return eventModel.deleteMsgByChannel(txn, deleteChannel)
+				}, messageStoreName)
 			if err != nil {
 				t.Error(err)
 			}
@@ -494,6 +648,1233 @@ func Test_wasmModel_deleteMsgByChannel(t *testing.T) {
 	}
 }
 
+// Tests that wasmModel.GetMessages returns decrypted pages of messages for a
+// single channel, newest first, and respects the limit, timestamp cursor, and
+// hidden filter.
+func Test_wasmModel_GetMessages(t *testing.T) {
+	ctx := context.Background()
+	cipher, err := idbCrypto.NewCipher(
+		[]byte("testPass"), []byte("testSalt"), 128, csprng.NewSystemRNG())
+	if err != nil {
+		t.Fatalf("Failed to create cipher")
+	}
+	for _, c := range []idbCrypto.Cipher{nil, cipher} {
+		cs := ""
+		if c != nil {
+			cs = "_withCipher"
+		}
+		testString := "Test_wasmModel_GetMessages" + cs
+		t.Run(testString, func(t *testing.T) {
+			storage.GetLocalStorage().Clear()
+			eventModel, err := newWASMModel(testString, c, false, dummyEU)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			channelID := id.NewIdFromString("channel", id.Generic, t)
+			otherChannelID := id.NewIdFromString("other", id.Generic, t)
+			start := netTime.Now().Round(0)
+
+			// Store messages out of timestamp order, interleaved with messages
+			// on another channel. Every fourth message is hidden and each
+			// timestamp is shared by two messages.
+			const totalMessages = 12
+			type stored struct{ i, uuid int }
+			var visible []stored
+			for _, i := range []int{5, 0, 11, 3, 8, 1, 10, 6, 2, 9, 4, 7} {
+				testStr := testString + strconv.Itoa(i)
+				testMsgId := message.DeriveChannelMessageID(
+					channelID, uint64(i), []byte(testStr))
+				uuid := eventModel.ReceiveMessage(channelID, testMsgId,
+					testStr, testStr, []byte{8, 6, 7, 5}, 0, 0,
+					start.Add(time.Duration(i/2)*time.Minute), time.Second,
+					rounds.Round{ID: id.Round(i)}, 0, channels.Sent, i%4 == 3)
+				if i%4 != 3 {
+					visible = append(visible, stored{i, int(uuid)})
+				}
+
+				otherMsgId := message.DeriveChannelMessageID(
+					otherChannelID, uint64(i), []byte(testStr))
+				eventModel.ReceiveMessage(otherChannelID, otherMsgId, testStr,
+					testStr, []byte{8, 6, 7, 5}, 0, 0,
+					start.Add(time.Duration(i/2)*time.Minute), time.Second,
+					rounds.Round{ID: id.Round(i)}, 0, channels.Sent, false)
+			}
+
+			// Messages with the same timestamp are ordered by UUID
+			sort.Slice(visible, func(a, b int) bool {
+				if visible[a].i/2 != visible[b].i/2 {
+					return visible[a].i/2 > visible[b].i/2
+				}
+				return visible[a].uuid > visible[b].uuid
+			})
+			expected := make([]int, len(visible))
+			for k, v := range visible {
+				expected[k] = v.i
+			}
+
+			// Page through all visible messages with pages that split the
+			// messages with the same timestamp
+			var received []int
+			var cursor *wChannels.MessageCursor
+			for {
+				page, err := eventModel.GetMessages(
+					ctx, channelID, cursor, 3, false)
+				require.NoError(t, err)
+				if len(page) == 0 {
+					break
+				}
+				require.LessOrEqual(t, len(page), 3)
+				for _, msg := range page {
+					require.Equal(t, channelID, msg.ChannelID)
+					require.False(t, msg.Hidden)
+					i, err := strconv.Atoi(
+						string(msg.Content)[len(testString):])
+					require.NoError(t, err)
+					received = append(received, i)
+				}
+				last := page[len(page)-1]
+				cursor = &wChannels.MessageCursor{
+					Timestamp: last.Timestamp, UUID: last.UUID}
+			}
+			require.Equal(t, expected, received)
+
+			// Check that hidden messages are returned when requested
+			all, err := eventModel.GetMessages(
+				ctx, channelID, nil, totalMessages, true)
+			require.NoError(t, err)
+			require.Len(t, all, totalMessages)
+			require.Equal(t, start.Add(5*time.Minute).UnixNano(),
+				all[0].Timestamp.UnixNano())
+
+			// Check that an invalid limit is rejected
+			_, err = eventModel.GetMessages(
+				ctx, channelID, nil, 0, true)
+			require.Error(t, err)
+
+			// Check that a cancelled query is aborted
+			cancelledCtx, cancel := context.WithCancel(ctx)
+			cancel()
+			_, err = eventModel.GetMessages(
+				cancelledCtx, channelID, nil, totalMessages, true)
+			require.ErrorContains(t, err, context.Canceled.Error())
+		})
+	}
+}
+
+// Tests that wasmModel.GetPinnedMessages returns only the visible pinned
+// messages in the channel, ordered from most to least recently pinned.
+func Test_wasmModel_GetPinnedMessages(t *testing.T) {
+	cipher, err := idbCrypto.NewCipher(
+		[]byte("testPass"), []byte("testSalt"), 128, csprng.NewSystemRNG())
+	require.NoError(t, err)
+	for _, c := range []idbCrypto.Cipher{nil, cipher} {
+		cs := ""
+		if c != nil {
+			cs = "_withCipher"
+		}
+		testString := "Test_wasmModel_GetPinnedMessages" + cs
+		t.Run(testString, func(t *testing.T) {
+			storage.GetLocalStorage().Clear()
+			eventModel, err := newWASMModel(testString, c, c != nil, dummyEU)
+			require.NoError(t, err)
+
+			channelID := id.NewIdFromString("channel", id.Generic, t)
+			otherChannelID := id.NewIdFromString("other", id.Generic, t)
+			start := netTime.Now().Round(0)
+			receive := func(channelID *id.ID, i int) message.ID {
+				text := "message " + strconv.Itoa(i)
+				msgID := message.DeriveChannelMessageID(
+					channelID, uint64(i), []byte(text))
+				uuid := eventModel.ReceiveMessage(channelID, msgID,
+					testString, text, []byte(testString), 0, 0,
+					start.Add(time.Duration(i)*time.Minute), time.Second,
+					rounds.Round{ID: id.Round(i)}, channels.Text,
+					channels.Sent, false)
+				require.NotZero(t, uuid)
+				return msgID
+			}
+			update := func(msgID message.ID, pinned, hidden *bool) {
+				_, err := eventModel.UpdateFromMessageID(
+					msgID, nil, nil, pinned, hidden, nil)
+				require.NoError(t, err)
+
+				// Pin times are in milliseconds
+				time.Sleep(2 * time.Millisecond)
+			}
+			pinned := func() []message.ID {
+				messages, err := eventModel.GetPinnedMessages(channelID)
+				require.NoError(t, err)
+				messageIDs := make([]message.ID, len(messages))
+				for i, msg := range messages {
+					require.True(t, msg.Pinned)
+					require.Equal(t, testString, msg.Nickname)
+					messageIDs[i] = msg.MessageID
+				}
+				return messageIDs
+			}
+
+			ids := []message.ID{
+				receive(channelID, 0), receive(channelID, 1),
+				receive(channelID, 2), receive(otherChannelID, 3)}
+			require.Empty(t, pinned())
+
+			yes, no := true, false
+			update(ids[1], &yes, nil)
+			update(ids[0], &yes, nil)
+			update(ids[2], &yes, nil)
+			update(ids[3], &yes, nil)
+			update(ids[2], nil, &yes)
+			require.Equal(t, []message.ID{ids[0], ids[1]}, pinned())
+
+			// Pinning a pinned message does not change its pin time
+			update(ids[1], &yes, nil)
+			require.Equal(t, []message.ID{ids[0], ids[1]}, pinned())
+
+			update(ids[0], &no, nil)
+			require.Equal(t, []message.ID{ids[1]}, pinned())
+		})
+	}
+}
+
+// Tests that wasmModel.GetMentions pages through the messages that mention an
+// identity by public key, DM token, or codename, that hidden and deleted
+// messages are excluded, and that the MessageReceived change of each new
+// message that mentions the local user is flagged.
+func Test_wasmModel_GetMentions(t *testing.T) {
+	cipher, err := idbCrypto.NewCipher(
+		[]byte("testPass"), []byte("testSalt"), 128, csprng.NewSystemRNG())
+	require.NoError(t, err)
+	for _, c := range []idbCrypto.Cipher{nil, cipher} {
+		cs := ""
+		if c != nil {
+			cs = "_withCipher"
+		}
+		testString := "Test_wasmModel_GetMentions" + cs
+		t.Run(testString, func(t *testing.T) {
+			storage.GetLocalStorage().Clear()
+			eventModel, err := newWASMModel(testString, c, c != nil, dummyEU)
+			require.NoError(t, err)
+
+			// A few codenames contain spaces, which cannot be mentioned
+			newIdentity := func() codename.Identity {
+				for {
+					pubKey, _, err := ed25519.GenerateKey(csprng.NewSystemRNG())
+					require.NoError(t, err)
+					identity, err := codename.ConstructIdentity(pubKey, 0)
+					require.NoError(t, err)
+					if len(parseMentions("@"+identity.Codename)) == 1 {
+						return identity
+					}
+				}
+			}
+			selfIdentity, senderIdentity := newIdentity(), newIdentity()
+			self, sender := selfIdentity.PubKey, senderIdentity.PubKey
+			const senderDmToken = 1234
+			require.NoError(t, eventModel.SetIdentity(self, 0))
+
+			channelID := id.NewIdFromString("channel", id.Generic, t)
+			start := netTime.Now().Round(0)
+			receive := func(i int, text string, pubKey ed25519.PublicKey,
+				dmToken uint32, hidden bool) uint64 {
+				msgID := message.DeriveChannelMessageID(
+					channelID, uint64(i), []byte(text))
+				uuid := eventModel.ReceiveMessage(channelID, msgID,
+					testString, text, pubKey, dmToken, 0,
+					start.Add(time.Duration(i)*time.Minute), time.Second,
+					rounds.Round{ID: id.Round(i)}, channels.Text,
+					channels.Sent, false)
+				require.NotZero(t, uuid)
+				if hidden {
+					require.NoError(t, eventModel.UpdateFromUUID(
+						uuid, nil, nil, nil, nil, &hidden, nil))
+				}
+				return uuid
+			}
+			mentions := func(pubKey ed25519.PublicKey,
+				cursor *wChannels.MentionCursor, limit int) (
+				[]uint64, *wChannels.MentionCursor) {
+				page, err := eventModel.GetMentions(pubKey, cursor, limit)
+				require.NoError(t, err)
+				uuids := make([]uint64, len(page.Messages))
+				for i, msg := range page.Messages {
+					require.Equal(t, testString, msg.Nickname)
+					uuids[i] = msg.UUID
+				}
+				return uuids, page.Next
+			}
+
+			uuids := []uint64{
+				receive(0, "hi @"+selfIdentity.Codename+"!", sender,
+					senderDmToken, false),
+				receive(1, "@"+strconv.Itoa(senderDmToken)+" and @"+
+					base64.StdEncoding.EncodeToString(self), sender,
+					senderDmToken, false),
+				receive(2, "hey @"+senderIdentity.Codename, self, 5678, false),
+				receive(3, "mail me@"+selfIdentity.Codename+" or @unknown",
+					sender, senderDmToken, false),
+				receive(4, "@"+selfIdentity.Codename, sender, senderDmToken,
+					true),
+			}
+
+			// Page through the mentions of the local user
+			page, next := mentions(self, nil, 1)
+			require.Equal(t, []uint64{uuids[1]}, page)
+			require.NotNil(t, next)
+			page, next = mentions(self, next, 1)
+			require.Equal(t, []uint64{uuids[0]}, page)
+			require.Nil(t, next)
+
+			page, next = mentions(sender, nil, 10)
+			require.Equal(t, []uint64{uuids[2], uuids[1]}, page)
+			require.Nil(t, next)
+
+			// Only new messages from others that mention the local user are
+			// flagged
+			changes, err := eventModel.GetChangesSince(0, 100)
+			require.NoError(t, err)
+			mentionsMe := make(map[uint64]bool)
+			for _, change := range changes {
+				if change.EventType != bindings.MessageReceived {
+					continue
+				}
+				var event wChannels.MessageReceivedJSON
+				require.NoError(t, json.Unmarshal(change.Data, &event))
+				if !event.Update {
+					mentionsMe[uint64(event.UUID)] = event.MentionsMe
+				}
+			}
+			require.Equal(t, map[uint64]bool{uuids[0]: true, uuids[1]: true,
+				uuids[2]: false, uuids[3]: false, uuids[4]: true}, mentionsMe)
+
+			// Deleted messages and left channels are removed from the index
+			msg, err := eventModel.GetMessage(message.DeriveChannelMessageID(
+				channelID, 1, []byte("@"+strconv.Itoa(senderDmToken)+" and @"+
+					base64.StdEncoding.EncodeToString(self))))
+			require.NoError(t, err)
+			require.NoError(t, eventModel.DeleteMessage(msg.MessageID))
+			page, _ = mentions(self, nil, 10)
+			require.Equal(t, []uint64{uuids[0]}, page)
+
+			eventModel.LeaveChannel(channelID)
+			page, _ = mentions(sender, nil, 10)
+			require.Empty(t, page)
+		})
+	}
+}
+
+// Tests that parseMentions finds mentions by public key, DM token, and
+// codename, and ignores @ signs that do not start a mention.
+func Test_parseMentions(t *testing.T) {
+	pubKey := make([]byte, ed25519.PublicKeySize)
+	pubKey[0] = 1
+	encoded := base64.StdEncoding.EncodeToString(pubKey)
+
+	tests := map[string][]mentionToken{
+		"no mentions":             nil,
+		"@":                       nil,
+		"email me@example.com":    nil,
+		"@0":                      nil,
+		"hi @zestyDragon!":        {{codename: "zestyDragon"}},
+		"@42, @42":                {{dmToken: 42}, {dmToken: 42}},
+		"(@" + encoded + ")":      {{pubKey: pubKey}},
+		"@a@b @c+d":               {{codename: "a"}},
+		"<p>@zestyDragon</p>":     {{codename: "zestyDragon"}},
+		"@héroïqueDragon, please": {{codename: "héroïqueDragon"}},
+	}
+
+	for text, expected := range tests {
+		require.Equal(t, expected, parseMentions(text), text)
+	}
+}
+
+// Tests that wasmModel.SearchMessages finds messages containing every word in
+// the query, ordered from newest to oldest, and that deleted messages and left
+// channels are removed from the index.
+func Test_wasmModel_SearchMessages(t *testing.T) {
+	ctx := context.Background()
+	cipher, err := idbCrypto.NewCipher(
+		[]byte("testPass"), []byte("testSalt"), 128, csprng.NewSystemRNG())
+	if err != nil {
+		t.Fatalf("Failed to create cipher")
+	}
+	for _, c := range []idbCrypto.Cipher{nil, cipher} {
+		cs := ""
+		if c != nil {
+			cs = "_withCipher"
+		}
+		testString := "Test_wasmModel_SearchMessages" + cs
+		t.Run(testString, func(t *testing.T) {
+			storage.GetLocalStorage().Clear()
+			eventModel, err := newWASMModel(testString, c, false, dummyEU)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			channelID := id.NewIdFromString("channel", id.Generic, t)
+			otherChannelID := id.NewIdFromString("other", id.Generic, t)
+			start := netTime.Now().Round(0)
+
+			texts := []struct {
+				channelID *id.ID
+				text      string
+				mType     channels.MessageType
+			}{
+				{channelID, "Hello, world!", channels.Text},
+				{channelID, "hello there", channels.Text},
+				{channelID, "World peace", channels.Text},
+				{otherChannelID, "HELLO WORLD", channels.Text},
+				{channelID, "hello world", channels.Reaction},
+			}
+			uuids := make([]uint64, len(texts))
+			messageIDs := make([]message.ID, len(texts))
+			for i, tt := range texts {
+				messageIDs[i] = message.DeriveChannelMessageID(
+					tt.channelID, uint64(i), []byte(tt.text))
+				uuids[i] = eventModel.ReceiveMessage(tt.channelID,
+					messageIDs[i], testString, tt.text, []byte{8, 6, 7, 5}, 0,
+					0, start.Add(time.Duration(i)*time.Minute), time.Second,
+					rounds.Round{ID: id.Round(i)}, tt.mType, channels.Sent,
+					false)
+				require.NotZero(t, uuids[i])
+			}
+
+			results, err := eventModel.SearchMessages(ctx, "hello", channelID, 10)
+			require.NoError(t, err)
+			require.Equal(t, []uint64{uuids[1], uuids[0]}, results)
+
+			results, err = eventModel.SearchMessages(ctx, "WORLD hello", nil, 10)
+			require.NoError(t, err)
+			require.Equal(t, []uint64{uuids[3], uuids[0]}, results)
+
+			results, err = eventModel.SearchMessages(ctx, "world", nil, 1)
+			require.NoError(t, err)
+			require.Equal(t, []uint64{uuids[3]}, results)
+
+			results, err = eventModel.SearchMessages(ctx, "goodbye", nil, 10)
+			require.NoError(t, err)
+			require.Empty(t, results)
+
+			// Deleted messages are no longer found
+			require.NoError(t, eventModel.DeleteMessage(messageIDs[0]))
+			results, err = eventModel.SearchMessages(ctx, "world", channelID, 10)
+			require.NoError(t, err)
+			require.Equal(t, []uint64{uuids[2]}, results)
+
+			// Messages in a left channel are no longer found
+			eventModel.LeaveChannel(otherChannelID)
+			results, err = eventModel.SearchMessages(ctx, "hello", nil, 10)
+			require.NoError(t, err)
+			require.Equal(t, []uint64{uuids[1]}, results)
+
+			// Check that an invalid limit is rejected
+			_, err = eventModel.SearchMessages(ctx, "hello", nil, 0)
+			require.Error(t, err)
+		})
+	}
+}
+
+// Tests that wasmModel.GetChangesSince returns the change of each mutation in
+// the order they were made and that the changes are sent on the event
+// callback in the same order.
+func Test_wasmModel_GetChangesSince(t *testing.T) {
+	storage.GetLocalStorage().Clear()
+	testString := "Test_wasmModel_GetChangesSince"
+	events := make(chan int64, 20)
+	eventModel, err := newWASMModel(testString, nil, false,
+		func(eventType int64, _ any) {
+			// Unread counts are sent directly instead of from the change log
+			if eventType == bindings.MessageReceived ||
+				eventType == bindings.MessageDeleted {
+				events <- eventType
+			}
+		})
+	require.NoError(t, err)
+
+	channelID := id.NewIdFromString(testString, id.Generic, t)
+	messageID := message.DeriveChannelMessageID(
+		channelID, 0, []byte(testString))
+	uuid := eventModel.ReceiveMessage(channelID, messageID, testString,
+		testString, []byte{8, 6, 7, 5}, 0, 0, netTime.Now(), time.Second,
+		rounds.Round{ID: 1}, channels.Text, channels.Sent, false)
+	require.NotZero(t, uuid)
+
+	status := channels.Delivered
+	require.NoError(t, eventModel.UpdateFromUUID(
+		uuid, nil, nil, nil, nil, nil, &status))
+	require.NoError(t, eventModel.DeleteMessage(messageID))
+
+	expected := []int64{
+		bindings.MessageReceived, bindings.MessageReceived,
+		bindings.MessageDeleted,
+	}
+	changes, err := eventModel.GetChangesSince(0, 10)
+	require.NoError(t, err)
+	require.Len(t, changes, len(expected))
+	for i, change := range changes {
+		require.Equal(t, expected[i], change.EventType)
+	}
+
+	var received bindings.MessageReceivedJSON
+	require.NoError(t, json.Unmarshal(changes[0].Data, &received))
+	require.Equal(t, int64(uuid), received.UUID)
+	require.Equal(t, channelID, received.ChannelID)
+	require.False(t, received.Update)
+
+	// Resuming from the first change skips it
+	changes, err = eventModel.GetChangesSince(changes[0].Seq, 10)
+	require.NoError(t, err)
+	require.Len(t, changes, len(expected)-1)
+
+	for i, eventType := range expected {
+		select {
+		case received := <-events:
+			require.Equal(t, eventType, received, "event %d", i)
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for event %d.", i)
+		}
+	}
+}
+
+// Tests that wasmModel.Subscribe sends the messages of the live query and then
+// an update for each message inserted into, updated in, or removed from it, and
+// that no updates are sent after wasmModel.Unsubscribe.
+func Test_wasmModel_Subscribe(t *testing.T) {
+	storage.GetLocalStorage().Clear()
+	testString := "Test_wasmModel_Subscribe"
+	eventModel, err := newWASMModel(testString, nil, false, dummyEU)
+	require.NoError(t, err)
+
+	channelID := id.NewIdFromString(testString, id.Generic, t)
+	otherChannelID := id.NewIdFromString("other", id.Generic, t)
+	start := netTime.Now().Round(0)
+	receive := func(channelID *id.ID, i int) (uint64, message.ID) {
+		text := testString + strconv.Itoa(i)
+		messageID := message.DeriveChannelMessageID(
+			channelID, uint64(i), []byte(text))
+		uuid := eventModel.ReceiveMessage(channelID, messageID, testString,
+			text, []byte{8, 6, 7, 5}, 0, 0,
+			start.Add(time.Duration(i)*time.Minute), time.Second,
+			rounds.Round{ID: id.Round(i)}, channels.Text, channels.Sent,
+			false)
+		require.NotZero(t, uuid)
+		return uuid, messageID
+	}
+
+	uuid0, messageID0 := receive(channelID, 0)
+
+	query := wChannels.LiveQuery{ChannelID: channelID}
+	updates := make(chan wChannels.LiveQueryUpdate, 10)
+	require.NoError(t, eventModel.Subscribe(5, query,
+		func(update wChannels.LiveQueryUpdate) { updates <- update }))
+
+	update := nextLiveQueryUpdate(t, updates)
+	require.True(t, update.Reset)
+	require.Equal(t, uint64(5), update.SubscriptionID)
+	require.Len(t, update.Inserted, 1)
+	require.Equal(t, messageID0, update.Inserted[0].MessageID)
+
+	// Messages in other channels are not sent
+	receive(otherChannelID, 1)
+	_, messageID2 := receive(channelID, 2)
+	update = nextLiveQueryUpdate(t, updates)
+	require.Len(t, update.Inserted, 1)
+	require.Equal(t, messageID2, update.Inserted[0].MessageID)
+
+	status := channels.Delivered
+	require.NoError(t, eventModel.UpdateFromUUID(
+		uuid0, nil, nil, nil, nil, nil, &status))
+	update = nextLiveQueryUpdate(t, updates)
+	require.Len(t, update.Updated, 1)
+	require.Equal(t, channels.Delivered, update.Updated[0].Status)
+
+	// Hidden messages no longer match the query
+	hidden := true
+	require.NoError(t, eventModel.UpdateFromUUID(
+		uuid0, nil, nil, nil, nil, &hidden, nil))
+	update = nextLiveQueryUpdate(t, updates)
+	require.Equal(t, []message.ID{messageID0}, update.Removed)
+
+	require.NoError(t, eventModel.DeleteMessage(messageID2))
+	update = nextLiveQueryUpdate(t, updates)
+	require.Equal(t, []message.ID{messageID2}, update.Removed)
+
+	// Once the update of the other query is received, any update for the
+	// cancelled query would have been sent
+	require.NoError(t, eventModel.Unsubscribe(5))
+	require.Error(t, eventModel.Unsubscribe(5))
+	otherUpdates := make(chan wChannels.LiveQueryUpdate, 10)
+	require.NoError(t, eventModel.Subscribe(6, query,
+		func(update wChannels.LiveQueryUpdate) { otherUpdates <- update }))
+	require.True(t, nextLiveQueryUpdate(t, otherUpdates).Reset)
+	receive(channelID, 3)
+	require.Len(t, nextLiveQueryUpdate(t, otherUpdates).Inserted, 1)
+	require.Empty(t, updates)
+
+	// Check that an invalid query is rejected
+	require.Error(t, eventModel.Subscribe(7, wChannels.LiveQuery{},
+		func(wChannels.LiveQueryUpdate) {}))
+}
+
+// Tests that wasmModel.queryMessages only returns the messages of the channel in
+// the time window of the live query, ordered from newest to oldest.
+func Test_wasmModel_queryMessages(t *testing.T) {
+	storage.GetLocalStorage().Clear()
+	testString := "Test_wasmModel_queryMessages"
+	eventModel, err := newWASMModel(testString, nil, false, dummyEU)
+	require.NoError(t, err)
+
+	channelID := id.NewIdFromString(testString, id.Generic, t)
+	otherChannelID := id.NewIdFromString("other", id.Generic, t)
+	start := netTime.Now().Round(0)
+	var expected []message.ID
+	for i := 0; i < 5; i++ {
+		for _, chID := range []*id.ID{channelID, otherChannelID} {
+			text := testString + strconv.Itoa(i)
+			messageID := message.DeriveChannelMessageID(
+				chID, uint64(i), []byte(text))
+			uuid := eventModel.ReceiveMessage(chID, messageID, testString,
+				text, []byte{8, 6, 7, 5}, 0, 0,
+				start.Add(time.Duration(i)*time.Minute), time.Second,
+				rounds.Round{ID: id.Round(i)}, channels.Text, channels.Sent,
+				false)
+			require.NotZero(t, uuid)
+			if chID == channelID && (i == 1 || i == 2) {
+				expected = append([]message.ID{messageID}, expected...)
+			}
+		}
+	}
+
+	// Start is inclusive and End is exclusive
+	results, err := eventModel.queryMessages(wChannels.LiveQuery{
+		ChannelID: channelID,
+		Start:     start.Add(time.Minute),
+		End:       start.Add(3 * time.Minute),
+	})
+	require.NoError(t, err)
+	received := make([]message.ID, len(results))
+	for i, msg := range results {
+		received[i], err = message.UnmarshalID(msg.MessageID)
+		require.NoError(t, err)
+	}
+	require.Equal(t, expected, received)
+}
+
+// nextLiveQueryUpdate returns the next update received on the channel or fails
+// the test if none is received in time.
+func nextLiveQueryUpdate(t *testing.T,
+	updates chan wChannels.LiveQueryUpdate) wChannels.LiveQueryUpdate {
+	select {
+	case update := <-updates:
+		return update
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for live query update.")
+		return wChannels.LiveQueryUpdate{}
+	}
+}
+
+// Tests that the unread count of a channel is updated as messages are received
+// and deleted, that hidden messages and messages from muted users are not
+// counted, and that wasmModel.MarkRead resets it.
+func Test_wasmModel_GetUnreadCount(t *testing.T) {
+	cipher, err := idbCrypto.NewCipher(
+		[]byte("testPass"), []byte("testSalt"), 128, csprng.NewSystemRNG())
+	if err != nil {
+		t.Fatalf("Failed to create cipher")
+	}
+	for _, c := range []idbCrypto.Cipher{nil, cipher} {
+		cs := ""
+		if c != nil {
+			cs = "_withCipher"
+		}
+		testString := "Test_wasmModel_GetUnreadCount" + cs
+		t.Run(testString, func(t *testing.T) {
+			storage.GetLocalStorage().Clear()
+			eventModel, err := newWASMModel(testString, c, c != nil, dummyEU)
+			require.NoError(t, err)
+
+			channelID := id.NewIdFromString("channel", id.Generic, t)
+			eventModel.JoinChannel(&cryptoBroadcast.Channel{
+				ReceptionID: channelID, Name: "channel"})
+			sender := ed25519.PublicKey("sender")
+			mutedSender := ed25519.PublicKey("muted")
+			eventModel.MuteUser(channelID, mutedSender, false)
+			start := netTime.Now().Round(0)
+
+			receive := func(i int, pubKey ed25519.PublicKey,
+				mType channels.MessageType, hidden bool) (uint64, message.ID) {
+				text := "message " + strconv.Itoa(i)
+				msgID := message.DeriveChannelMessageID(
+					channelID, uint64(i), []byte(text))
+				uuid := eventModel.ReceiveMessage(channelID, msgID,
+					testString, text, pubKey, 0, 0,
+					start.Add(time.Duration(i)*time.Minute), time.Second,
+					rounds.Round{ID: id.Round(i)}, mType, channels.Sent, hidden)
+				require.NotZero(t, uuid)
+				return uuid, msgID
+			}
+
+			first, _ := receive(0, sender, channels.Text, false)
+			second, secondID := receive(1, sender, channels.Text, false)
+			receive(2, sender, channels.Text, true)
+			receive(3, mutedSender, channels.Text, false)
+			receive(4, sender, channels.Reaction, false)
+			receive(5, sender, channels.Text, false)
+
+			unread, err := eventModel.GetUnreadCount(channelID)
+			require.NoError(t, err)
+			require.Equal(t, uint(3), unread)
+
+			// The new count is recorded with the message that changed it
+			changes, err := eventModel.GetChangesSince(0, 100)
+			require.NoError(t, err)
+			require.GreaterOrEqual(t, len(changes), 2)
+			require.Equal(t, bindings.MessageReceived,
+				changes[len(changes)-2].EventType)
+			last := changes[len(changes)-1]
+			require.Equal(t, impl.UnreadCountEvent, last.EventType)
+			var count wChannels.UnreadCount
+			require.NoError(t, json.Unmarshal(last.Data, &count))
+			require.Equal(t, uint(3), count.Unread)
+
+			// Reading the count of a channel without a marker does not
+			// create one
+			otherID := id.NewIdFromString("other", id.Generic, t)
+			unread, err = eventModel.GetUnreadCount(otherID)
+			require.NoError(t, err)
+			require.Zero(t, unread)
+			marker, err := impl.GetReadMarker(
+				eventModel.db, eventModel.blind(otherID.Marshal()))
+			require.NoError(t, err)
+			require.Nil(t, marker)
+
+			// Unmuting the sender counts their messages
+			eventModel.MuteUser(channelID, mutedSender, true)
+			unread, err = eventModel.GetUnreadCount(channelID)
+			require.NoError(t, err)
+			require.Equal(t, uint(4), unread)
+
+			require.NoError(t, eventModel.MarkRead(second))
+			unread, err = eventModel.GetUnreadCount(channelID)
+			require.NoError(t, err)
+			require.Equal(t, uint(2), unread)
+
+			// The new count is the last change in the change log
+			changes, err = eventModel.GetChangesSince(0, 100)
+			require.NoError(t, err)
+			last = changes[len(changes)-1]
+			require.Equal(t, impl.UnreadCountEvent, last.EventType)
+			require.NoError(t, json.Unmarshal(last.Data, &count))
+			require.Equal(t, second, count.LastRead)
+			require.Equal(t, uint(2), count.Unread)
+
+			// Marking an older message does not move the read position back
+			require.NoError(t, eventModel.MarkRead(first))
+			summary, err := eventModel.GetUnreadSummary()
+			require.NoError(t, err)
+			require.Len(t, summary, 1)
+			require.True(t, channelID.Cmp(summary[0].ChannelID))
+			require.Equal(t, second, summary[0].LastRead)
+			require.Equal(t, uint(2), summary[0].Unread)
+
+			// Deleting a read message does not change the count, but deleting
+			// an unread message does
+			require.NoError(t, eventModel.DeleteMessage(secondID))
+			unread, err = eventModel.GetUnreadCount(channelID)
+			require.NoError(t, err)
+			require.Equal(t, uint(2), unread)
+			_, lastID := receive(6, sender, channels.Text, false)
+			require.NoError(t, eventModel.DeleteMessage(lastID))
+			unread, err = eventModel.GetUnreadCount(channelID)
+			require.NoError(t, err)
+			require.Equal(t, uint(2), unread)
+		})
+	}
+}
+
+// Tests that wasmModel.MuteUser hides the existing and new messages of the
+// sender in the channel and removes them from the search index, and that
+// unmuting shows only the messages hidden by the mute.
+func Test_wasmModel_MuteUser(t *testing.T) {
+	ctx := context.Background()
+	cipher, err := idbCrypto.NewCipher(
+		[]byte("testPass"), []byte("testSalt"), 128, csprng.NewSystemRNG())
+	require.NoError(t, err)
+	for _, c := range []idbCrypto.Cipher{nil, cipher} {
+		cs := ""
+		if c != nil {
+			cs = "_withCipher"
+		}
+		testString := "Test_wasmModel_MuteUser" + cs
+		t.Run(testString, func(t *testing.T) {
+			storage.GetLocalStorage().Clear()
+			eventModel, err := newWASMModel(testString, c, c != nil, dummyEU)
+			require.NoError(t, err)
+
+			channelID := id.NewIdFromString("channel", id.Generic, t)
+			otherChannelID := id.NewIdFromString("other", id.Generic, t)
+			sender := ed25519.PublicKey("sender")
+			mutedSender := ed25519.PublicKey("muted")
+			start := netTime.Now().Round(0)
+			receive := func(channelID *id.ID, i int, pubKey ed25519.PublicKey,
+				hidden bool) message.ID {
+				text := "hello " + strconv.Itoa(i)
+				msgID := message.DeriveChannelMessageID(
+					channelID, uint64(i), []byte(text))
+				uuid := eventModel.ReceiveMessage(channelID, msgID,
+					testString, text, pubKey, 0, 0,
+					start.Add(time.Duration(i)*time.Minute), time.Second,
+					rounds.Round{ID: id.Round(i)}, channels.Text,
+					channels.Sent, hidden)
+				require.NotZero(t, uuid)
+				return msgID
+			}
+			visible := func(channelID *id.ID) []message.ID {
+				messages, err := eventModel.GetMessages(
+					ctx, channelID, nil, 10, false)
+				require.NoError(t, err)
+				messageIDs := make([]message.ID, len(messages))
+				for i := range messages {
+					messageIDs[len(messages)-1-i] = messages[i].MessageID
+				}
+				return messageIDs
+			}
+			searchCount := func(channelID *id.ID) int {
+				results, err := eventModel.SearchMessages(
+					ctx, "hello", channelID, 10)
+				require.NoError(t, err)
+				return len(results)
+			}
+
+			senderID := receive(channelID, 0, sender, false)
+			mutedID := receive(channelID, 1, mutedSender, false)
+			receive(channelID, 2, mutedSender, true)
+			otherID := receive(otherChannelID, 3, mutedSender, false)
+
+			// Messages in the channel are hidden and no longer searchable
+			eventModel.MuteUser(channelID, mutedSender, false)
+			require.Equal(t, []message.ID{senderID}, visible(channelID))
+			require.Equal(t, []message.ID{otherID}, visible(otherChannelID))
+			require.Equal(t, 1, searchCount(channelID))
+			require.Equal(t, 1, searchCount(otherChannelID))
+
+			// New messages from the muted sender are hidden
+			newID := receive(channelID, 4, mutedSender, false)
+			msg, err := eventModel.GetMessage(newID)
+			require.NoError(t, err)
+			require.True(t, msg.Hidden)
+			require.Equal(t, []message.ID{senderID}, visible(channelID))
+
+			// A message hidden while muted stays hidden after unmuting
+			hidden := true
+			_, err = eventModel.UpdateFromMessageID(
+				mutedID, nil, nil, nil, &hidden, nil)
+			require.NoError(t, err)
+
+			eventModel.MuteUser(channelID, mutedSender, true)
+			require.Equal(t, []message.ID{senderID, newID}, visible(channelID))
+			require.Equal(t, 4, searchCount(channelID))
+		})
+	}
+}
+
+// Tests that wasmModel.GetReactions counts each user once per emoji, marks the
+// emojis reacted with by the local identity, and ignores hidden reactions,
+// reactions from muted users, and invalid reactions.
+func Test_wasmModel_GetReactions(t *testing.T) {
+	cipher, err := idbCrypto.NewCipher(
+		[]byte("testPass"), []byte("testSalt"), 128, csprng.NewSystemRNG())
+	if err != nil {
+		t.Fatalf("Failed to create cipher")
+	}
+	for _, c := range []idbCrypto.Cipher{nil, cipher} {
+		cs := ""
+		if c != nil {
+			cs = "_withCipher"
+		}
+		testString := "Test_wasmModel_GetReactions" + cs
+		t.Run(testString, func(t *testing.T) {
+			storage.GetLocalStorage().Clear()
+			eventModel, err := newWASMModel(testString, c, c != nil, dummyEU)
+			require.NoError(t, err)
+
+			channelID := id.NewIdFromString("channel", id.Generic, t)
+			self := ed25519.PublicKey("self")
+			muted := ed25519.PublicKey("muted")
+			eventModel.MuteUser(channelID, muted, false)
+			now := netTime.Now().Round(0)
+
+			parentID := message.DeriveChannelMessageID(
+				channelID, 0, []byte("parent"))
+			require.NotZero(t, eventModel.ReceiveMessage(channelID, parentID,
+				"nick", "parent", self, 0, 0, now, time.Second,
+				rounds.Round{ID: 0}, channels.Text, channels.Sent, false))
+			otherID := message.DeriveChannelMessageID(
+				channelID, 1, []byte("other"))
+			require.NotZero(t, eventModel.ReceiveMessage(channelID, otherID,
+				"nick", "other", self, 0, 0, now, time.Second,
+				rounds.Round{ID: 1}, channels.Text, channels.Sent, false))
+
+			reactions := []struct {
+				reaction string
+				pubKey   ed25519.PublicKey
+				hidden   bool
+			}{
+				{"👍", ed25519.PublicKey("alice"), false},
+				{"👍", ed25519.PublicKey("bob"), false},
+				{"👍", ed25519.PublicKey("alice"), false},
+				{"😀", self, false},
+				{"👍", ed25519.PublicKey("carol"), true},
+				{"👍", muted, false},
+				{"not an emoji", ed25519.PublicKey("bob"), false},
+			}
+			for i, r := range reactions {
+				msgID := message.DeriveChannelMessageID(
+					channelID, uint64(i+2), []byte(r.reaction))
+				require.NotZero(t, eventModel.ReceiveReaction(channelID,
+					msgID, parentID, "nick", r.reaction, r.pubKey, 0, 0, now,
+					time.Second, rounds.Round{ID: id.Round(i + 2)},
+					channels.Reaction, channels.Sent, r.hidden))
+			}
+
+			results, err := eventModel.GetReactions(
+				[]message.ID{parentID, otherID}, self)
+			require.NoError(t, err)
+			require.Equal(t, []wChannels.MessageReactions{{
+				MessageID: parentID,
+				Reactions: []wChannels.Reaction{
+					{Emoji: "👍", Count: 2, Reacted: false},
+					{Emoji: "😀", Count: 1, Reacted: true},
+				},
+			}, {
+				MessageID: otherID,
+				Reactions: []wChannels.Reaction{},
+			}}, results)
+		})
+	}
+}
+
+// Tests that wasmModel.GetThread pages through the replies to a message in
+// order and that the reply count of the message is kept up to date.
+func Test_wasmModel_GetThread(t *testing.T) {
+	cipher, err := idbCrypto.NewCipher(
+		[]byte("testPass"), []byte("testSalt"), 128, csprng.NewSystemRNG())
+	if err != nil {
+		t.Fatalf("Failed to create cipher")
+	}
+	for _, c := range []idbCrypto.Cipher{nil, cipher} {
+		cs := ""
+		if c != nil {
+			cs = "_withCipher"
+		}
+		testString := "Test_wasmModel_GetThread" + cs
+		t.Run(testString, func(t *testing.T) {
+			storage.GetLocalStorage().Clear()
+			eventModel, err := newWASMModel(testString, c, c != nil, dummyEU)
+			require.NoError(t, err)
+
+			channelID := id.NewIdFromString("channel", id.Generic, t)
+			pubKey := ed25519.PublicKey("pubKey")
+			now := netTime.Now().Round(0)
+			rootID := message.DeriveChannelMessageID(
+				channelID, 0, []byte("root"))
+			replyCounts := func() uint {
+				counts, err := eventModel.GetReplyCounts(
+					[]message.ID{rootID})
+				require.NoError(t, err)
+				return counts[0]
+			}
+
+			// Replies received before the root message are counted once it
+			// is received
+			replyIDs := make([]message.ID, 4)
+			for i := range replyIDs {
+				replyIDs[i] = message.DeriveChannelMessageID(
+					channelID, uint64(i+1), []byte(fmt.Sprintf("reply%d", i)))
+				require.NotZero(t, eventModel.ReceiveReply(channelID,
+					replyIDs[i], rootID, "nick", fmt.Sprintf("reply%d", i),
+					pubKey, 0, 0, now.Add(time.Duration(i)*time.Second),
+					time.Second, rounds.Round{ID: id.Round(i + 1)},
+					channels.Text, channels.Sent, false))
+			}
+			reactionID := message.DeriveChannelMessageID(
+				channelID, 5, []byte("reaction"))
+			require.NotZero(t, eventModel.ReceiveReaction(channelID,
+				reactionID, rootID, "nick", "👍", pubKey, 0, 0, now,
+				time.Second, rounds.Round{ID: 5}, channels.Reaction,
+				channels.Sent, false))
+			require.Zero(t, replyCounts())
+
+			rootUUID := eventModel.ReceiveMessage(channelID, rootID,
+				"nick", "root", pubKey, 0, 0, now, time.Second,
+				rounds.Round{ID: 0}, channels.Text, channels.Sent, false)
+			require.NotZero(t, rootUUID)
+			require.Equal(t, uint(4), replyCounts())
+
+			// Page through the thread
+			var replies []string
+			var cursor *wChannels.ThreadCursor
+			for pages := 0; ; pages++ {
+				require.Less(t, pages, 3)
+				thread, err := eventModel.GetThread(rootID, 3, cursor)
+				require.NoError(t, err)
+				require.Equal(t, uint(4), thread.ReplyCount)
+				for _, reply := range thread.Replies {
+					require.Equal(t, rootID, reply.ParentMessageID)
+					replies = append(replies, string(reply.Content))
+				}
+				if cursor = thread.Next; cursor == nil {
+					break
+				}
+			}
+			require.Equal(t,
+				[]string{"reply0", "reply1", "reply2", "reply3"}, replies)
+
+			// Deleted and hidden replies are no longer counted
+			require.NoError(t, eventModel.DeleteMessage(replyIDs[0]))
+
+			// The update to the root is recorded with the deletion
+			changes, err := eventModel.GetChangesSince(0, 100)
+			require.NoError(t, err)
+			i := len(changes) - 1
+			for ; i >= 0; i-- {
+				if changes[i].EventType == bindings.MessageDeleted {
+					break
+				}
+			}
+			require.GreaterOrEqual(t, i, 0)
+			require.Less(t, i+1, len(changes))
+			require.Equal(t,
+				bindings.MessageReceived, changes[i+1].EventType)
+			var received bindings.MessageReceivedJSON
+			require.NoError(t, json.Unmarshal(changes[i+1].Data, &received))
+			require.Equal(t, int64(rootUUID), received.UUID)
+			require.Equal(t, channelID, received.ChannelID)
+			require.True(t, received.Update)
+
+			hidden := true
+			_, err = eventModel.UpdateFromMessageID(
+				replyIDs[1], nil, nil, nil, &hidden, nil)
+			require.NoError(t, err)
+			require.Equal(t, uint(2), replyCounts())
+
+			thread, err := eventModel.GetThread(rootID, 10, nil)
+			require.NoError(t, err)
+			require.Equal(t, uint(2), thread.ReplyCount)
+			require.Len(t, thread.Replies, 2)
+			require.Nil(t, thread.Next)
+
+			_, err = eventModel.GetThread(rootID, 0, nil)
+			require.Error(t, err)
+		})
+	}
+}
+
+// Tests that wasmModel.sweep deletes messages whose lease has expired and
+// messages outside the retention policy of their channel.
+func Test_wasmModel_sweep(t *testing.T) {
+	cipher, err := idbCrypto.NewCipher(
+		[]byte("testPass"), []byte("testSalt"), 128, csprng.NewSystemRNG())
+	if err != nil {
+		t.Fatalf("Failed to create cipher")
+	}
+	for _, c := range []idbCrypto.Cipher{nil, cipher} {
+		cs := ""
+		if c != nil {
+			cs = "_withCipher"
+		}
+		testString := "Test_wasmModel_sweep" + cs
+		t.Run(testString, func(t *testing.T) {
+			storage.GetLocalStorage().Clear()
+			deleted := make(chan message.ID, 10)
+			eventModel, err := newWASMModel(testString, c, c != nil,
+				func(eventType int64, data any) {
+					if eventType == bindings.MessageDeleted {
+						deleted <- data.(bindings.MessageDeletedJSON).MessageID
+					}
+				})
+			require.NoError(t, err)
+
+			now := netTime.Now().Round(0)
+			receive := func(channelID *id.ID, i int, timestamp time.Time,
+				lease time.Duration) message.ID {
+				msgID := message.DeriveChannelMessageID(
+					channelID, uint64(i), []byte(strconv.Itoa(i)))
+				require.NotZero(t, eventModel.ReceiveMessage(channelID, msgID,
+					"nick", strconv.Itoa(i), ed25519.PublicKey("pubKey"), 0, 0,
+					timestamp, lease, rounds.Round{ID: id.Round(i)},
+					channels.Text, channels.Sent, false))
+				return msgID
+			}
+
+			// Messages expire when their lease elapses
+			leaseID := id.NewIdFromString("lease", id.Generic, t)
+			expired := receive(leaseID, 0, now.Add(-2*time.Hour), time.Hour)
+			forever := receive(
+				leaseID, 1, now.Add(-2*time.Hour), channels.ValidForever)
+			current := receive(leaseID, 2, now, time.Hour)
+
+			// Only the newest messages are kept, and pinned messages are not
+			// counted
+			policyID := id.NewIdFromString("policy", id.Generic, t)
+			require.NoError(t, eventModel.SetRetentionPolicy(
+				policyID, wChannels.RetentionPolicy{MaxCount: 2}))
+			policyMsgs := make([]message.ID, 4)
+			for i := range policyMsgs {
+				policyMsgs[i] = receive(policyID, i+3,
+					now.Add(time.Duration(i-10)*time.Minute),
+					channels.ValidForever)
+			}
+			pinned := true
+			_, err = eventModel.UpdateFromMessageID(
+				policyMsgs[0], nil, nil, &pinned, nil, nil)
+			require.NoError(t, err)
+
+			n, err := eventModel.sweep(now)
+			require.NoError(t, err)
+			require.Equal(t, 2, n)
+
+			exists := func(msgID message.ID) bool {
+				_, err := eventModel.GetMessage(msgID)
+				return err == nil
+			}
+			require.False(t, exists(expired))
+			require.False(t, exists(policyMsgs[1]))
+			for _, msgID := range []message.ID{
+				forever, current, policyMsgs[0], policyMsgs[2], policyMsgs[3]} {
+				require.True(t, exists(msgID))
+			}
+
+			for _, msgID := range []message.ID{expired, policyMsgs[1]} {
+				select {
+				case deletedID := <-deleted:
+					require.Contains(t,
+						[]message.ID{expired, policyMsgs[1]}, deletedID)
+				case <-time.After(time.Second):
+					t.Fatalf("Timed out waiting for deletion of %s", msgID)
+				}
+			}
+
+			// Removing the policy keeps all messages
+			require.NoError(t, eventModel.SetRetentionPolicy(
+				policyID, wChannels.RetentionPolicy{}))
+			receive(policyID, 7, now, channels.ValidForever)
+			n, err = eventModel.sweep(now)
+			require.NoError(t, err)
+			require.Zero(t, n)
+
+			require.Error(t, eventModel.SetRetentionPolicy(
+				policyID, wChannels.RetentionPolicy{MaxAge: -time.Second}))
+		})
+	}
+}
+
+// Tests that wasmModel.evictFiles removes the data of the oldest completed
+// files with a link and that wasmModel.evictMessages removes the text of the
+// oldest messages that are not pinned.
+func Test_wasmModel_evict(t *testing.T) {
+	cipher, err := idbCrypto.NewCipher(
+		[]byte("testPass"), []byte("testSalt"), 128, csprng.NewSystemRNG())
+	if err != nil {
+		t.Fatalf("Failed to create cipher")
+	}
+	for _, c := range []idbCrypto.Cipher{nil, cipher} {
+		cs := ""
+		if c != nil {
+			cs = "_withCipher"
+		}
+		testString := "Test_wasmModel_evict" + cs
+		t.Run(testString, func(t *testing.T) {
+			storage.GetLocalStorage().Clear()
+			updated := make(chan int64, 10)
+			eventModel, err := newWASMModel(testString, c, c != nil,
+				func(eventType int64, data any) {
+					if eventType == bindings.MessageReceived {
+						updated <- data.(bindings.MessageReceivedJSON).UUID
+					}
+				})
+			require.NoError(t, err)
+
+			// Only the oldest completed file with a link is evicted
+			now := netTime.Now().Round(0)
+			data := []byte("fileData")
+			complete, incomplete, noLink, newest := fileTransfer.ID{1},
+				fileTransfer.ID{2}, fileTransfer.ID{3}, fileTransfer.ID{4}
+			require.NoError(t, eventModel.ReceiveFile(complete, []byte("link"),
+				data, now.Add(-time.Hour), cft.Complete))
+			require.NoError(t, eventModel.ReceiveFile(incomplete,
+				[]byte("link"), data, now.Add(-time.Hour), cft.Downloading))
+			require.NoError(t, eventModel.ReceiveFile(
+				noLink, nil, data, now.Add(-time.Hour), cft.Complete))
+			require.NoError(t, eventModel.ReceiveFile(
+				newest, []byte("link"), data, now, cft.Complete))
+
+			freed, err := eventModel.evictFiles(1)
+			require.NoError(t, err)
+			require.NotZero(t, freed)
+			for fileID, evicted := range map[fileTransfer.ID]bool{
+				complete: true, incomplete: false, noLink: false, newest: false} {
+				f, err := eventModel.GetFile(fileID)
+				require.NoError(t, err)
+				require.Equal(t, []byte("link"), f.Link)
+				if evicted {
+					require.Empty(t, f.Data)
+				} else {
+					require.Equal(t, data, f.Data)
+				}
+			}
+
+			// Only old messages that are not pinned are evicted
+			channelID := id.NewIdFromString("evict", id.Generic, t)
+			receive := func(i int, timestamp time.Time) message.ID {
+				msgID := message.DeriveChannelMessageID(
+					channelID, uint64(i), []byte(strconv.Itoa(i)))
+				require.NotZero(t, eventModel.ReceiveMessage(channelID, msgID,
+					"nick", "text"+strconv.Itoa(i), ed25519.PublicKey("pubKey"),
+					0, 0, timestamp, channels.ValidForever,
+					rounds.Round{ID: id.Round(i)}, channels.Text,
+					channels.Sent, false))
+				<-updated
+				return msgID
+			}
+			old := receive(0, now.Add(-2*time.Hour))
+			pinnedID := receive(1, now.Add(-2*time.Hour))
+			current := receive(2, now)
+			pinned := true
+			_, err = eventModel.UpdateFromMessageID(
+				pinnedID, nil, nil, &pinned, nil, nil)
+			require.NoError(t, err)
+			<-updated
+
+			freed, err = eventModel.evictMessages(
+				math.MaxUint64, now.Add(-time.Hour))
+			require.NoError(t, err)
+			require.NotZero(t, freed)
+
+			oldMsg, err := eventModel.GetMessage(old)
+			require.NoError(t, err)
+			require.Empty(t, oldMsg.Content)
+			select {
+			case uuid := <-updated:
+				require.EqualValues(t, oldMsg.UUID, uuid)
+			case <-time.After(time.Second):
+				t.Fatalf("Timed out waiting for update of evicted message")
+			}
+			for i, msgID := range []message.ID{pinnedID, current} {
+				msg, err := eventModel.GetMessage(msgID)
+				require.NoError(t, err)
+				require.Equal(t, "text"+strconv.Itoa(i+1), string(msg.Content))
+			}
+
+			// Evicted messages are not evicted again
+			freed, err = eventModel.evictMessages(
+				math.MaxUint64, now.Add(-time.Hour))
+			require.NoError(t, err)
+			require.Zero(t, freed)
+		})
+	}
+}
+
 // This test is designed to prove the behavior of unique indexes.
 // Inserts will not fail, they simply will not happen.
 func TestWasmModel_receiveHelper_UniqueIndex(t *testing.T) {
@@ -510,7 +1891,7 @@ func TestWasmModel_receiveHelper_UniqueIndex(t *testing.T) {
 		t.Run("TestWasmModel_receiveHelper_UniqueIndex"+cs, func(t *testing.T) {
 			storage.GetLocalStorage().Clear()
 			testString := fmt.Sprintf("test_receiveHelper_UniqueIndex_%d", i)
-			eventModel, err := newWASMModel(testString, c, dummyEU)
+			eventModel, err := newWASMModel(testString, c, false, dummyEU)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -624,7 +2005,7 @@ func TestUpsertMessageDuplicates(t *testing.T) {
 		csprng.NewSystemRNG())
 	require.NoError(t, err)
 	testString := "test_duplicateUpsertMessage"
-	eventModel, err := newWASMModel(testString, cipher, dummyEU)
+	eventModel, err := newWASMModel(testString, cipher, false, dummyEU)
 	require.NoError(t, err)
 
 	uuid, err := eventModel.upsertMessage(msg1)
@@ -13,82 +13,213 @@ import (
 	"syscall/js"
 
 	"github.com/hack-pad/go-indexeddb/idb"
-	jww "github.com/spf13/jwalterweatherman"
+	"github.com/pkg/errors"
 
-	"gitlab.com/elixxir/client/v4/channels"
 	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
 	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	"gitlab.com/elixxir/xxdk-wasm/storage"
 )
 
-// currentVersion is the current version of the IndexedDb runtime. Used for
-// migration purposes.
-const currentVersion uint = 1
-
 // eventUpdate takes an event type and JSON object from
 // bindings/channelsCallbacks.go.
 type eventUpdate func(eventType int64, jsonMarshallable any)
 
-// NewWASMEventModel returns a [channels.EventModel] backed by a wasmModel.
-// The name should be a base64 encoding of the users public key. Returns the
-// EventModel based on IndexedDb and the database name as reported by IndexedDb.
+// NewWASMEventModel returns a wasmModel, which implements
+// [channels.EventModel] backed by IndexedDb. The name should be a base64
+// encoding of the users public key. If encryptAll is true, all sensitive
+// fields are encrypted, which requires a cipher. Expired messages are deleted
+// in the background, and data is evicted according to the policy as the
+// storage quota is approached.
+//
+// The wasmModel is not thread safe, so the background work is passed to run,
+// which must run it serially with every other call to the wasmModel.
 func NewWASMEventModel(databaseName string, encryption idbCrypto.Cipher,
-	eventCallback eventUpdate) (channels.EventModel, error) {
-	return newWASMModel(databaseName, encryption, eventCallback)
+	encryptAll bool, policy storage.EvictionPolicy,
+	eventCallback eventUpdate, run func(fn func())) (*wasmModel, error) {
+	model, err := newWASMModel(
+		databaseName, encryption, encryptAll, eventCallback)
+	if err != nil {
+		return nil, err
+	}
+
+	go model.runSweeper(sweepInterval, run)
+
+	impl.SetEvictor(policy, model.evict)
+	go impl.MonitorStorage(impl.MonitorInterval, run)
+	return model, nil
 }
 
 // newWASMModel creates the given [idb.Database] and returns a wasmModel.
 func newWASMModel(databaseName string, encryption idbCrypto.Cipher,
-	eventCallback eventUpdate) (*wasmModel, error) {
-	// Attempt to open database object
-	ctx, cancel := impl.NewContext()
-	defer cancel()
-	openRequest, err := idb.Global().Open(ctx, databaseName, currentVersion,
-		func(db *idb.Database, oldVersion, newVersion uint) error {
-			if oldVersion == newVersion {
-				jww.INFO.Printf("IndexDb version for %s is current: v%d",
-					databaseName, newVersion)
-				return nil
-			}
+	encryptAll bool, eventCallback eventUpdate) (*wasmModel, error) {
+	wrapper := &wasmModel{
+		cipher:        encryption,
+		eventCallback: eventCallback,
+		liveQueries:   make(map[uint64]*liveQuery),
+	}
 
-			jww.INFO.Printf("IndexDb upgrade required for %s: v%d -> v%d",
-				databaseName, oldVersion, newVersion)
+	if encryptAll {
+		if encryption == nil {
+			return nil, errors.New(
+				"cannot encrypt all sensitive fields without a cipher")
+		}
+		blinder, err := impl.NewBlinder(encryption)
+		if err != nil {
+			return nil, err
+		}
+		wrapper.blinder = blinder
+	}
 
-			if oldVersion == 0 && newVersion >= 1 {
-				err := v1Upgrade(db)
-				if err != nil {
-					return err
-				}
-				oldVersion = 1
-			}
+	// Attempt to open database object
+	migrator := impl.NewMigrator(
+		databaseName, wrapper.migrations(), wrapper.migrationProgress)
+	db, err := migrator.Open()
+	if err != nil {
+		return nil, err
+	}
+	wrapper.db = db
 
-			// if oldVersion == 1 && newVersion >= 2 { v2Upgrade(), oldVersion = 2 }
-			return nil
-		})
+	wrapper.search, err = impl.NewSearchIndex(db, encryption)
 	if err != nil {
 		return nil, err
 	}
 
-	// Wait for database open to finish
-	db, err := openRequest.Await(ctx)
+	// Rewrite existing records for any migrations that were just applied or
+	// were interrupted
+	err = migrator.RunPendingRewrites(db)
 	if err != nil {
 		return nil, err
-	} else if ctx.Err() != nil {
-		return nil, ctx.Err()
 	}
 
-	wrapper := &wasmModel{
-		db:            db,
-		cipher:        encryption,
-		eventCallback: eventCallback,
+	// Live queries are updated with each change once it is committed
+	wrapper.changes, err = impl.NewChangeLog(db, encryption,
+		func(eventType int64, data any) {
+			eventCallback(eventType, data)
+			if change, ok := data.(impl.Change); ok {
+				wrapper.updateLiveQueries(change)
+			}
+		})
+	if err != nil {
+		return nil, err
 	}
+
 	return wrapper, nil
 }
 
+// migrations returns the ordered list of database migrations. The migration at
+// index i upgrades the database to version i+1.
+//
+// Migrations can never be changed or reordered without permanently breaking
+// backwards compatibility. New migrations must be appended to the end.
+func (w *wasmModel) migrations() []impl.Migration {
+	return []impl.Migration{
+		{Name: "initial schema", Schema: v1Upgrade},
+		{
+			Name:   "search index",
+			Schema: v2Upgrade,
+			// Messages stored before the search index existed must be indexed
+			Rewrite: func(_ *idb.Database, progress func(done, total uint)) error {
+				return w.rebuildSearchIndex(progress)
+			},
+		},
+		{
+			Name: "encrypt files",
+			// Files were stored in plaintext even in encrypted databases
+			Rewrite: func(db *idb.Database, progress func(done, total uint)) error {
+				if w.cipher == nil {
+					return nil
+				}
+				return impl.RewriteStore(
+					db, fileStoreName, w.encryptFileValue, progress)
+			},
+		},
+		{
+			Name:   "read markers",
+			Schema: v4Upgrade,
+			// Channels joined before read markers existed must have one
+			Rewrite: w.createReadMarkers,
+		},
+		{
+			Name: "reply counts",
+			// Messages stored before replies were counted must be counted
+			Rewrite: w.rebuildReplyCounts,
+		},
+		{
+			Name:   "retention policies",
+			Schema: v6Upgrade,
+			// Messages stored before the expiry time existed must be added to
+			// the index
+			Rewrite: func(db *idb.Database, progress func(done, total uint)) error {
+				return impl.RewriteStore(
+					db, messageStoreName, expiresAtValue, progress)
+			},
+		},
+		{Name: "change log", Schema: v7Upgrade},
+		{
+			Name:   "muted users",
+			Schema: v8Upgrade,
+			// Public keys were not stored blinded, so they must be added to
+			// existing messages to be indexed
+			Rewrite: func(db *idb.Database, progress func(done, total uint)) error {
+				if w.blinder == nil {
+					return nil
+				}
+				return impl.RewriteStore(
+					db, messageStoreName, w.resealMessageValue, progress)
+			},
+		},
+		{
+			Name:   "pinned messages",
+			Schema: v9Upgrade,
+			// Messages pinned before the pin time was stored must be added to
+			// the index
+			Rewrite: func(db *idb.Database, progress func(done, total uint)) error {
+				return impl.RewriteStore(
+					db, messageStoreName, pinnedAtValue, progress)
+			},
+		},
+		{
+			Name:   "mentions",
+			Schema: v10Upgrade,
+			// Messages received before mentions were indexed must be parsed
+			Rewrite: func(_ *idb.Database, progress func(done, total uint)) error {
+				return w.rebuildMentions(progress)
+			},
+		},
+		{
+			Name:   "message order",
+			Schema: v11Upgrade,
+			// Messages stored before the sort time existed must be added to
+			// the index
+			Rewrite: func(db *idb.Database, progress func(done, total uint)) error {
+				return impl.RewriteStore(
+					db, messageStoreName, sortTimeValue, progress)
+			},
+		},
+		{
+			Name: "encrypt channels",
+			// Channels were stored in plaintext even when all sensitive fields
+			// were encrypted
+			Rewrite: func(db *idb.Database, progress func(done, total uint)) error {
+				if w.blinder == nil {
+					return nil
+				}
+				return w.sealChannels(db, progress)
+			},
+		},
+	}
+}
+
+// migrationProgress sends migration progress to the main thread.
+func (w *wasmModel) migrationProgress(p impl.MigrationProgress) {
+	w.eventCallback(impl.MigrationProgressEvent, p)
+}
+
 // v1Upgrade performs the v0 -> v1 database upgrade.
 //
 // This can never be changed without permanently breaking backwards
 // compatibility.
-func v1Upgrade(db *idb.Database) error {
+func v1Upgrade(db *idb.Database, _ *idb.Transaction) error {
 	storeOpts := idb.ObjectStoreOptions{
 		KeyPath:       js.ValueOf(pkeyName),
 		AutoIncrement: true,
@@ -146,3 +277,185 @@ func v1Upgrade(db *idb.Database) error {
 	})
 	return err
 }
+
+// v2Upgrade performs the v1 -> v2 database upgrade, which adds the search
+// index.
+//
+// This can never be changed without permanently breaking backwards
+// compatibility.
+func v2Upgrade(db *idb.Database, _ *idb.Transaction) error {
+	return impl.CreateSearchStore(db)
+}
+
+// v4Upgrade performs the v3 -> v4 database upgrade, which adds the read marker
+// store.
+//
+// This can never be changed without permanently breaking backwards
+// compatibility.
+func v4Upgrade(db *idb.Database, _ *idb.Transaction) error {
+	return impl.CreateReadMarkerStore(db)
+}
+
+// v6Upgrade performs the v5 -> v6 database upgrade, which adds the retention
+// policy store and the index used to find messages whose lease has elapsed.
+//
+// This can never be changed without permanently breaking backwards
+// compatibility.
+func v6Upgrade(db *idb.Database, txn *idb.Transaction) error {
+	_, err := db.CreateObjectStore(retentionStoreName, idb.ObjectStoreOptions{
+		KeyPath:       js.ValueOf(pkeyName),
+		AutoIncrement: false,
+	})
+	if err != nil {
+		return err
+	}
+
+	messageStore, err := txn.ObjectStore(messageStoreName)
+	if err != nil {
+		return err
+	}
+	_, err = messageStore.CreateIndex(messageStoreExpiryIndex,
+		js.ValueOf(messageStoreExpiresAt),
+		idb.IndexOptions{
+			Unique:     false,
+			MultiEntry: false,
+		})
+	return err
+}
+
+// v7Upgrade performs the v6 -> v7 database upgrade, which adds the change log
+// store.
+//
+// This can never be changed without permanently breaking backwards
+// compatibility.
+func v7Upgrade(db *idb.Database, _ *idb.Transaction) error {
+	return impl.CreateChangeLogStore(db)
+}
+
+// v8Upgrade performs the v7 -> v8 database upgrade, which adds the sender
+// index on messages and the muted user store.
+//
+// This can never be changed without permanently breaking backwards
+// compatibility.
+func v8Upgrade(db *idb.Database, txn *idb.Transaction) error {
+	indexOpts := idb.IndexOptions{
+		Unique:     false,
+		MultiEntry: false,
+	}
+
+	messageStore, err := txn.ObjectStore(messageStoreName)
+	if err != nil {
+		return err
+	}
+	_, err = messageStore.CreateIndex(messageStorePubkeyIndex,
+		js.ValueOf(messageStorePubkey), indexOpts)
+	if err != nil {
+		return err
+	}
+
+	mutedUserStore, err := db.CreateObjectStore(mutedUserStoreName,
+		idb.ObjectStoreOptions{
+			KeyPath: js.ValueOf(
+				[]any{mutedUserStoreChannel, mutedUserStorePubkey}),
+			AutoIncrement: false,
+		})
+	if err != nil {
+		return err
+	}
+	_, err = mutedUserStore.CreateIndex(mutedUserStoreChannelIndex,
+		js.ValueOf(mutedUserStoreChannel), indexOpts)
+	return err
+}
+
+// v9Upgrade performs the v8 -> v9 database upgrade, which adds the compound
+// index of pinned messages in each channel.
+//
+// This can never be changed without permanently breaking backwards
+// compatibility.
+func v9Upgrade(_ *idb.Database, txn *idb.Transaction) error {
+	messageStore, err := txn.ObjectStore(messageStoreName)
+	if err != nil {
+		return err
+	}
+	_, err = messageStore.CreateIndex(messageStoreChannelPinnedIndex,
+		js.ValueOf([]any{messageStoreChannel, messageStorePinnedAt}),
+		idb.IndexOptions{
+			Unique:     false,
+			MultiEntry: false,
+		})
+	return err
+}
+
+// v10Upgrade performs the v9 -> v10 database upgrade, which adds the directory
+// of known senders and the index of mentions.
+//
+// This can never be changed without permanently breaking backwards
+// compatibility.
+func v10Upgrade(db *idb.Database, _ *idb.Transaction) error {
+	indexOpts := idb.IndexOptions{
+		Unique:     false,
+		MultiEntry: false,
+	}
+
+	identityStore, err := db.CreateObjectStore(identityStoreName,
+		idb.ObjectStoreOptions{
+			KeyPath:       js.ValueOf(pkeyName),
+			AutoIncrement: false,
+		})
+	if err != nil {
+		return err
+	}
+	_, err = identityStore.CreateIndex(identityStoreCodenameIndex,
+		js.ValueOf(identityStoreCodename), indexOpts)
+	if err != nil {
+		return err
+	}
+	_, err = identityStore.CreateIndex(identityStoreDmTokenIndex,
+		js.ValueOf(identityStoreDmToken), indexOpts)
+	if err != nil {
+		return err
+	}
+
+	mentionStore, err := db.CreateObjectStore(mentionStoreName,
+		idb.ObjectStoreOptions{
+			KeyPath:       js.ValueOf(pkeyName),
+			AutoIncrement: true,
+		})
+	if err != nil {
+		return err
+	}
+	_, err = mentionStore.CreateIndex(mentionStoreMessageIndex,
+		js.ValueOf(mentionStoreMessage), indexOpts)
+	if err != nil {
+		return err
+	}
+	_, err = mentionStore.CreateIndex(mentionStoreChannelIndex,
+		js.ValueOf(mentionStoreChannel), indexOpts)
+	if err != nil {
+		return err
+	}
+	_, err = mentionStore.CreateIndex(mentionStorePubkeyIndex,
+		js.ValueOf([]any{
+			mentionStorePubkey, mentionStoreTimestamp, mentionStoreMessage}),
+		indexOpts)
+	return err
+}
+
+// v11Upgrade performs the v10 -> v11 database upgrade, which adds the index
+// used to page through the messages of a channel.
+//
+// This can never be changed without permanently breaking backwards
+// compatibility.
+func v11Upgrade(_ *idb.Database, txn *idb.Transaction) error {
+	messageStore, err := txn.ObjectStore(messageStoreName)
+	if err != nil {
+		return err
+	}
+	_, err = messageStore.CreateIndex(messageStoreChannelTimestampIndex,
+		js.ValueOf([]any{messageStoreChannel, messageStoreSortTime}),
+		idb.IndexOptions{
+			Unique:     false,
+			MultiEntry: false,
+		})
+	return err
+}
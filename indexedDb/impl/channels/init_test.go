@@ -0,0 +1,358 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package main
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/elixxir/client/v4/channels"
+	cft "gitlab.com/elixxir/client/v4/channelsFileTransfer"
+	cryptoBroadcast "gitlab.com/elixxir/crypto/broadcast"
+	"gitlab.com/elixxir/crypto/fileTransfer"
+	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
+	"gitlab.com/elixxir/crypto/message"
+	"gitlab.com/elixxir/wasm-utils/storage"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	"gitlab.com/xx_network/crypto/csprng"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/netTime"
+)
+
+// Tests that a v1 database containing messages is upgraded to the current
+// version by newWASMModel, that existing messages are added to the search
+// index, and that migration progress is sent on the event callback.
+func Test_newWASMModel_V1Upgrade(t *testing.T) {
+	ctx := context.Background()
+	cipher, err := idbCrypto.NewCipher(
+		[]byte("testPass"), []byte("testSalt"), 128, csprng.NewSystemRNG())
+	if err != nil {
+		t.Fatalf("Failed to create cipher")
+	}
+	for _, c := range []idbCrypto.Cipher{nil, cipher} {
+		cs := ""
+		if c != nil {
+			cs = "_withCipher"
+		}
+		testString := "Test_newWASMModel_V1Upgrade" + cs
+		t.Run(testString, func(t *testing.T) {
+			storage.GetLocalStorage().Clear()
+			channelID := id.NewIdFromString("channel", id.Generic, t)
+			texts := []string{"Hello, world!", "goodbye", "hello there"}
+
+			// Create the v1 database fixture
+			v1 := &wasmModel{cipher: c, eventCallback: dummyEU}
+			migrator := impl.NewMigrator(testString, v1.migrations()[:1], nil)
+			var err error
+			v1.db, err = migrator.Open()
+			require.NoError(t, err)
+			uuids := make([]uint64, len(texts))
+			for i, text := range texts {
+				storedText := text
+				if c != nil {
+					storedText, err = c.Encrypt([]byte(text))
+					require.NoError(t, err)
+				}
+				msgID := message.DeriveChannelMessageID(
+					channelID, uint64(i), []byte(text))
+				// The v1 database has no change log, so the message is put
+				// directly
+				msgObj, err := v1.messageToValue(buildMessage(
+					channelID.Marshal(), msgID.Bytes(), nil, testString,
+					storedText, []byte{8, 6, 7, 5}, 0, 0,
+					netTime.Now().Add(time.Duration(i)*time.Minute),
+					time.Second, id.Round(i), channels.Text, false, false,
+					channels.Sent))
+				require.NoError(t, err)
+				uuidObj, err := impl.Put(v1.db, messageStoreName, msgObj)
+				require.NoError(t, err)
+				uuids[i] = uint64(uuidObj.Int())
+			}
+			require.NoError(t, v1.db.Close())
+
+			// Upgrade the database to the current version
+			var events []impl.MigrationProgress
+			eventModel, err := newWASMModel(testString, c, false,
+				func(eventType int64, data any) {
+					if eventType == impl.MigrationProgressEvent {
+						events = append(events, data.(impl.MigrationProgress))
+					}
+				})
+			require.NoError(t, err)
+
+			results, err := eventModel.SearchMessages(ctx, "hello", channelID, 10)
+			require.NoError(t, err)
+			require.Equal(t, []uint64{uuids[2], uuids[0]}, results)
+
+			var searchEvents []impl.MigrationProgress
+			for _, e := range events {
+				if e.Version == 2 {
+					searchEvents = append(searchEvents, e)
+				}
+			}
+			require.NotEmpty(t, searchEvents)
+			last := searchEvents[len(searchEvents)-1]
+			require.Equal(t, impl.MigrationProgress{
+				DatabaseName: testString,
+				Name:         "search index",
+				Version:      2,
+				Done:         uint(len(texts)),
+				Total:        uint(len(texts)),
+				Complete:     true,
+			}, last)
+
+			// Reopening does not run the migration again
+			events = nil
+			require.NoError(t, eventModel.db.Close())
+			_, err = newWASMModel(testString, c, false,
+				func(eventType int64, data any) {
+					if eventType == impl.MigrationProgressEvent {
+						events = append(events, data.(impl.MigrationProgress))
+					}
+				})
+			require.NoError(t, err)
+			require.Empty(t, events)
+		})
+	}
+}
+
+// Tests that files stored in plaintext in an encrypted v2 database are
+// encrypted by the v3 migration and can still be read.
+func Test_newWASMModel_V2Upgrade_EncryptFiles(t *testing.T) {
+	const testString = "Test_newWASMModel_V2Upgrade_EncryptFiles"
+	storage.GetLocalStorage().Clear()
+	c, err := idbCrypto.NewCipher(
+		[]byte("testPass"), []byte("testSalt"), 16, csprng.NewSystemRNG())
+	require.NoError(t, err)
+
+	// Create the v2 database fixture with a plaintext file
+	v2 := &wasmModel{eventCallback: dummyEU}
+	migrator := impl.NewMigrator(testString, v2.migrations()[:2], nil)
+	v2.db, err = migrator.Open()
+	require.NoError(t, err)
+	data := []byte("file data larger than a single cipher block")
+	link := []byte("file link")
+	fileID := fileTransfer.NewID(data)
+	require.NoError(t, v2.upsertFile(&File{
+		Id:        fileID.Marshal(),
+		Data:      data,
+		Link:      link,
+		Timestamp: netTime.Now(),
+		Status:    uint8(cft.Complete),
+	}))
+	require.NoError(t, v2.db.Close())
+
+	// Upgrade the database with encryption enabled
+	eventModel, err := newWASMModel(testString, c, false, dummyEU)
+	require.NoError(t, err)
+
+	raw, err := impl.Get(eventModel.db, fileStoreName,
+		impl.EncodeBytes(fileID.Marshal()))
+	require.NoError(t, err)
+	stored, err := valueToFile(raw)
+	require.NoError(t, err)
+	require.Nil(t, stored.Data)
+	require.Nil(t, stored.Link)
+	require.Greater(t, len(stored.EncryptedData), 1)
+	require.NotEmpty(t, stored.EncryptedLink)
+
+	file, err := eventModel.GetFile(fileID)
+	require.NoError(t, err)
+	require.Equal(t, data, file.Data)
+	require.Equal(t, link, file.Link)
+}
+
+// Tests that messages stored in a v10 database, before the sort time existed,
+// are added to the channel timestamp index by the v11 migration.
+func Test_newWASMModel_V10Upgrade_MessageOrder(t *testing.T) {
+	const testString = "Test_newWASMModel_V10Upgrade_MessageOrder"
+	storage.GetLocalStorage().Clear()
+
+	// Create the v10 database fixture with messages without a sort time
+	v10 := &wasmModel{eventCallback: dummyEU}
+	migrator := impl.NewMigrator(testString, v10.migrations()[:10], nil)
+	var err error
+	v10.db, err = migrator.Open()
+	require.NoError(t, err)
+	channelID := id.NewIdFromString(testString, id.Generic, t)
+	start := netTime.Now().Round(0)
+	for i := 0; i < 3; i++ {
+		text := testString + strconv.Itoa(i)
+		msg := buildMessage(channelID.Marshal(),
+			message.DeriveChannelMessageID(channelID, uint64(i),
+				[]byte(text)).Bytes(), nil, testString, text,
+			[]byte(testString), 0, 0, start.Add(time.Duration(i)*time.Minute),
+			time.Second, id.Round(i), channels.Text, false, false,
+			channels.Sent)
+		msgObj, err := storedMessageToValue(msg)
+		require.NoError(t, err)
+		_, err = impl.Put(v10.db, messageStoreName, msgObj)
+		require.NoError(t, err)
+	}
+	require.NoError(t, v10.db.Close())
+
+	// Upgrade the database
+	eventModel, err := newWASMModel(testString, nil, false, dummyEU)
+	require.NoError(t, err)
+
+	messages, err := eventModel.GetMessages(
+		context.Background(), channelID, nil, 5, false)
+	require.NoError(t, err)
+	require.Len(t, messages, 3)
+	for i, msg := range messages {
+		require.Equal(t, testString+strconv.Itoa(2-i), string(msg.Content))
+	}
+}
+
+// Tests that channels stored in plaintext in a v11 database are encrypted by
+// the v12 migration when all sensitive fields are encrypted.
+func Test_newWASMModel_V11Upgrade_EncryptChannels(t *testing.T) {
+	const testString = "Test_newWASMModel_V11Upgrade_EncryptChannels"
+	storage.GetLocalStorage().Clear()
+	c, err := idbCrypto.NewCipher(
+		[]byte("testPass"), []byte("testSalt"), 16, csprng.NewSystemRNG())
+	require.NoError(t, err)
+
+	// Create the v11 database fixture with a plaintext channel
+	v11 := &wasmModel{eventCallback: dummyEU}
+	migrator := impl.NewMigrator(testString, v11.migrations()[:11], nil)
+	v11.db, err = migrator.Open()
+	require.NoError(t, err)
+	channel := &cryptoBroadcast.Channel{
+		ReceptionID: id.NewIdFromString(testString, id.Generic, t),
+		Name:        "secretName",
+		Description: "secretDescription",
+	}
+	channelObj, err := v11.channelToValue(&Channel{
+		ID:          channel.ReceptionID.Marshal(),
+		Name:        channel.Name,
+		Description: channel.Description,
+	})
+	require.NoError(t, err)
+	_, err = impl.Put(v11.db, channelStoreName, channelObj)
+	require.NoError(t, err)
+	require.NoError(t, v11.db.Close())
+
+	// Upgrade the database with all sensitive fields encrypted
+	eventModel, err := newWASMModel(testString, c, true, dummyEU)
+	require.NoError(t, err)
+
+	results, err := impl.GetAll(eventModel.db, channelStoreName)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	stored, err := valueToChannel(results[0])
+	require.NoError(t, err)
+	require.NotEmpty(t, stored.Sensitive)
+	require.Empty(t, stored.Name)
+	require.Empty(t, stored.Description)
+
+	opened, err := eventModel.openChannel(results[0])
+	require.NoError(t, err)
+	require.Equal(t, channel.ReceptionID.Marshal(), opened.ID)
+	require.Equal(t, channel.Name, opened.Name)
+	require.Equal(t, channel.Description, opened.Description)
+}
+
+// Tests that messages stored in a v5 database, before the expiry time existed,
+// are added to the expiry index by the v6 migration so that they are deleted
+// by wasmModel.sweep once their lease elapses.
+func Test_newWASMModel_V5Upgrade_MessageExpiry(t *testing.T) {
+	const testString = "Test_newWASMModel_V5Upgrade_MessageExpiry"
+	storage.GetLocalStorage().Clear()
+
+	// Create the v5 database fixture with messages without an expiry time
+	v5 := &wasmModel{eventCallback: dummyEU}
+	migrator := impl.NewMigrator(testString, v5.migrations()[:5], nil)
+	var err error
+	v5.db, err = migrator.Open()
+	require.NoError(t, err)
+	channelID := id.NewIdFromString(testString, id.Generic, t)
+	now := netTime.Now().Round(0)
+	leases := []time.Duration{time.Hour, channels.ValidForever, 3 * time.Hour}
+	msgIDs := make([]message.ID, len(leases))
+	for i, lease := range leases {
+		text := testString + strconv.Itoa(i)
+		msgIDs[i] = message.DeriveChannelMessageID(
+			channelID, uint64(i), []byte(text))
+		msg := buildMessage(channelID.Marshal(), msgIDs[i].Bytes(), nil,
+			testString, text, []byte(testString), 0, 0,
+			now.Add(-2*time.Hour), lease, id.Round(i), channels.Text, false,
+			false, channels.Sent)
+		msgObj, err := storedMessageToValue(msg)
+		require.NoError(t, err)
+		_, err = impl.Put(v5.db, messageStoreName, msgObj)
+		require.NoError(t, err)
+	}
+	require.NoError(t, v5.db.Close())
+
+	// Upgrade the database
+	eventModel, err := newWASMModel(testString, nil, false, dummyEU)
+	require.NoError(t, err)
+
+	n, err := eventModel.sweep(now)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	_, err = eventModel.GetMessage(msgIDs[0])
+	require.Error(t, err)
+	for _, msgID := range msgIDs[1:] {
+		_, err = eventModel.GetMessage(msgID)
+		require.NoError(t, err)
+	}
+}
+
+// Tests that the v4 migration creates the read marker of each channel joined
+// in a v3 database, before read markers existed, so that
+// wasmModel.GetUnreadCount can read the count without creating it.
+func Test_newWASMModel_V3Upgrade_CreateReadMarkers(t *testing.T) {
+	const testString = "Test_newWASMModel_V3Upgrade_CreateReadMarkers"
+	storage.GetLocalStorage().Clear()
+
+	// Create the v3 database fixture with a channel and messages
+	v3 := &wasmModel{eventCallback: dummyEU}
+	migrator := impl.NewMigrator(testString, v3.migrations()[:3], nil)
+	var err error
+	v3.db, err = migrator.Open()
+	require.NoError(t, err)
+	channelID := id.NewIdFromString(testString, id.Generic, t)
+	channelObj, err := v3.channelToValue(&Channel{ID: channelID.Marshal()})
+	require.NoError(t, err)
+	_, err = impl.Put(v3.db, channelStoreName, channelObj)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		text := testString + strconv.Itoa(i)
+		msg := buildMessage(channelID.Marshal(),
+			message.DeriveChannelMessageID(channelID, uint64(i),
+				[]byte(text)).Bytes(), nil, testString, text,
+			[]byte(testString), 0, 0, netTime.Now(), time.Second,
+			id.Round(i), channels.Text, false, false, channels.Sent)
+		msgObj, err := v3.messageToValue(msg)
+		require.NoError(t, err)
+		_, err = impl.Put(v3.db, messageStoreName, msgObj)
+		require.NoError(t, err)
+	}
+	require.NoError(t, v3.db.Close())
+
+	// Upgrade the database
+	eventModel, err := newWASMModel(testString, nil, false, dummyEU)
+	require.NoError(t, err)
+
+	marker, err := impl.GetReadMarker(eventModel.db, channelID.Marshal())
+	require.NoError(t, err)
+	require.NotNil(t, marker)
+	require.Equal(t, uint(3), marker.Unread)
+
+	unread, err := eventModel.GetUnreadCount(channelID)
+	require.NoError(t, err)
+	require.Equal(t, uint(3), unread)
+}
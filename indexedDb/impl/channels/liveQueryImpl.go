@@ -0,0 +1,310 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"syscall/js"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/client/v4/bindings"
+	"gitlab.com/elixxir/client/v4/channels"
+	"gitlab.com/elixxir/crypto/message"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	wChannels "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/channels"
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// liveQuery is a live query registered by the main thread.
+type liveQuery struct {
+	query wChannels.LiveQuery
+
+	// send sends an update of the query to the main thread.
+	send func(update wChannels.LiveQueryUpdate)
+
+	// rows contains the IDs of the messages currently in the query.
+	rows map[message.ID]struct{}
+}
+
+// Subscribe registers the live query with the given subscription ID, which is
+// chosen by the main thread. Every message of the query is sent at once with
+// Reset set, and then each change to them is sent as it is committed.
+//
+// If a subscription with the ID already exists, it is replaced. This happens
+// when the main thread reconnects after the worker is restarted.
+func (w *wasmModel) Subscribe(subscriptionID uint64,
+	query wChannels.LiveQuery, send func(update wChannels.LiveQueryUpdate)) error {
+	parentErr := errors.New("failed to Subscribe")
+
+	if query.ChannelID == nil {
+		return errors.WithMessage(parentErr, "channel ID is required")
+	} else if !query.Start.IsZero() && !query.End.IsZero() &&
+		!query.End.After(query.Start) {
+		return errors.WithMessagef(parentErr,
+			"end %s must be after start %s", query.End, query.Start)
+	}
+
+	// Changes are held back until the current messages are sent so that no
+	// change is missed
+	w.liveMux.Lock()
+	defer w.liveMux.Unlock()
+
+	results, err := w.queryMessages(query)
+	if err != nil {
+		return errors.WithMessagef(parentErr, "%+v", err)
+	}
+
+	lq := &liveQuery{
+		query: query,
+		send:  send,
+		rows:  make(map[message.ID]struct{}, len(results)),
+	}
+	update := wChannels.LiveQueryUpdate{
+		SubscriptionID: subscriptionID,
+		Reset:          true,
+		Inserted:       make([]channels.ModelMessage, len(results)),
+	}
+	for i, msg := range results {
+		update.Inserted[i], err = w.toDecryptedModelMessage(msg)
+		if err != nil {
+			return errors.WithMessagef(parentErr,
+				"Unable to convert Message %d: %+v", msg.ID, err)
+		}
+		lq.rows[update.Inserted[i].MessageID] = struct{}{}
+	}
+
+	w.liveQueries[subscriptionID] = lq
+	send(update)
+	return nil
+}
+
+// Unsubscribe cancels the live query with the given subscription ID.
+func (w *wasmModel) Unsubscribe(subscriptionID uint64) error {
+	w.liveMux.Lock()
+	defer w.liveMux.Unlock()
+	if _, exists := w.liveQueries[subscriptionID]; !exists {
+		return errors.Errorf(
+			"no live query with subscription ID %d", subscriptionID)
+	}
+	delete(w.liveQueries, subscriptionID)
+	return nil
+}
+
+// updateLiveQueries sends the changes made by the committed change to every
+// live query it affects. It is called for each change in the order they were
+// committed.
+func (w *wasmModel) updateLiveQueries(change impl.Change) {
+	w.liveMux.Lock()
+	defer w.liveMux.Unlock()
+	if len(w.liveQueries) == 0 {
+		return
+	}
+
+	var err error
+	switch change.EventType {
+	case bindings.MessageReceived:
+		var event bindings.MessageReceivedJSON
+		if err = json.Unmarshal(change.Data, &event); err == nil {
+			err = w.liveMessageChanged(uint64(event.UUID), event.ChannelID)
+		}
+	case bindings.MessageDeleted:
+		var event bindings.MessageDeletedJSON
+		if err = json.Unmarshal(change.Data, &event); err == nil {
+			w.liveMessageRemoved(nil, event.MessageID)
+		}
+	}
+	if err != nil {
+		jww.ERROR.Printf("Failed to update live queries for change %d: %+v",
+			change.Seq, err)
+	}
+}
+
+// liveMessageChanged sends the message with the given UUID to each live query
+// it is inserted into, updated in, or removed from. The channel ID is used to
+// skip reading the message if no live query is on its channel.
+func (w *wasmModel) liveMessageChanged(uuid uint64, channelID *id.ID) error {
+	if channelID != nil {
+		var found bool
+		for _, lq := range w.liveQueries {
+			found = found || lq.query.ChannelID.Cmp(channelID)
+		}
+		if !found {
+			return nil
+		}
+	}
+
+	msgObj, err := impl.Get(w.db, messageStoreName, js.ValueOf(uuid))
+	if err != nil {
+		// The message was deleted after the change, which is handled by a
+		// later change
+		if strings.Contains(err.Error(), impl.ErrDoesNotExist) {
+			return nil
+		}
+		return err
+	}
+	msg, err := w.openMessage(msgObj)
+	if err != nil {
+		return err
+	}
+	modelMsg, err := w.toDecryptedModelMessage(msg)
+	if err != nil {
+		return errors.Errorf("Unable to convert Message %d: %+v", uuid, err)
+	}
+
+	for subscriptionID, lq := range w.liveQueries {
+		_, exists := lq.rows[modelMsg.MessageID]
+		update := wChannels.LiveQueryUpdate{SubscriptionID: subscriptionID}
+		if matchesLiveQuery(lq.query, msg) {
+			if exists {
+				update.Updated = []channels.ModelMessage{modelMsg}
+			} else {
+				update.Inserted = []channels.ModelMessage{modelMsg}
+				lq.rows[modelMsg.MessageID] = struct{}{}
+			}
+		} else if exists {
+			update.Removed = []message.ID{modelMsg.MessageID}
+			delete(lq.rows, modelMsg.MessageID)
+		} else {
+			continue
+		}
+		lq.send(update)
+	}
+
+	return nil
+}
+
+// liveMessageRemoved removes the message from every live query that contains
+// it. If channelID is set, only queries on that channel are checked.
+func (w *wasmModel) liveMessageRemoved(channelID *id.ID, messageID message.ID) {
+	for subscriptionID, lq := range w.liveQueries {
+		if channelID != nil && !lq.query.ChannelID.Cmp(channelID) {
+			continue
+		}
+		if _, exists := lq.rows[messageID]; !exists {
+			continue
+		}
+		delete(lq.rows, messageID)
+		lq.send(wChannels.LiveQueryUpdate{
+			SubscriptionID: subscriptionID,
+			Removed:        []message.ID{messageID},
+		})
+	}
+}
+
+// clearLiveQueries removes every message from the live queries on the channel.
+// It is used when a channel is left, which deletes its messages without
+// recording a change for each.
+func (w *wasmModel) clearLiveQueries(channelID *id.ID) {
+	w.liveMux.Lock()
+	defer w.liveMux.Unlock()
+	for subscriptionID, lq := range w.liveQueries {
+		if !lq.query.ChannelID.Cmp(channelID) || len(lq.rows) == 0 {
+			continue
+		}
+		update := wChannels.LiveQueryUpdate{
+			SubscriptionID: subscriptionID,
+			Removed:        make([]message.ID, 0, len(lq.rows)),
+		}
+		for messageID := range lq.rows {
+			update.Removed = append(update.Removed, messageID)
+		}
+		lq.rows = make(map[message.ID]struct{})
+		lq.send(update)
+	}
+}
+
+// queryMessages returns every message matching the live query, ordered from
+// newest to oldest by sort time and then UUID, like GetMessages.
+func (w *wasmModel) queryMessages(
+	query wChannels.LiveQuery) ([]*Message, error) {
+	// Prepare the Transaction
+	txn, err := w.db.Transaction(idb.TransactionReadOnly, messageStoreName)
+	if err != nil {
+		return nil, errors.Errorf("Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(messageStoreName)
+	if err != nil {
+		return nil, errors.Errorf("Unable to get ObjectStore: %+v", err)
+	}
+	index, err := store.Index(messageStoreChannelTimestampIndex)
+	if err != nil {
+		return nil, errors.Errorf("Unable to get Index: %+v", err)
+	}
+
+	// Set up the operation. The range is bounded to the millisecond, so
+	// messages at the edges of the window are filtered by matchesLiveQuery.
+	key := w.indexKey(query.ChannelID.Marshal())
+	lower, upper := math.Inf(-1), math.Inf(1)
+	if !query.Start.IsZero() {
+		lower = float64(query.Start.UnixMilli())
+	}
+	if !query.End.IsZero() {
+		upper = float64(query.End.UnixMilli())
+	}
+	keyRange, err := idb.NewKeyRangeBound(js.ValueOf([]any{key, lower}),
+		js.ValueOf([]any{key, upper}), false, false)
+	if err != nil {
+		return nil, errors.Errorf("Unable to NewKeyRangeBound: %+v", err)
+	}
+	cursorRequest, err := index.OpenCursorRange(keyRange, idb.CursorPrevious)
+	if err != nil {
+		return nil, errors.Errorf("Unable to open Cursor: %+v", err)
+	}
+
+	// Perform the operation
+	results := make([]*Message, 0)
+	err = impl.SendCursorRequest(cursorRequest,
+		func(cursor *idb.CursorWithValue) error {
+			value, err := cursor.Value()
+			if err != nil {
+				return err
+			}
+			msg, err := w.openMessage(value)
+			if err != nil {
+				return err
+			}
+			if matchesLiveQuery(query, msg) {
+				results = append(results, msg)
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, errors.Errorf("Unable to get Message data: %+v", err)
+	}
+
+	return results, nil
+}
+
+// matchesLiveQuery returns true if the opened Message matches the live query.
+func matchesLiveQuery(query wChannels.LiveQuery, msg *Message) bool {
+	if !bytes.Equal(msg.ChannelID, query.ChannelID.Marshal()) ||
+		(msg.Hidden && !query.IncludeHidden) ||
+		(query.PinnedOnly && !msg.Pinned) ||
+		(!query.Start.IsZero() && msg.Timestamp.Before(query.Start)) ||
+		(!query.End.IsZero() && !msg.Timestamp.Before(query.End)) {
+		return false
+	}
+
+	if len(query.Types) == 0 {
+		return true
+	}
+	for _, mType := range query.Types {
+		if channels.MessageType(msg.Type) == mType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,536 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+// This file contains the mentions index. Mentions are parsed from the text of
+// each message as it is received and stored keyed on the public key of the
+// mentioned identity. The syntax is described in the worker channels package.
+
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"syscall/js"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/client/v4/channels"
+	"gitlab.com/elixxir/crypto/codename"
+	"gitlab.com/elixxir/wasm-utils/utils"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	wChannels "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/channels"
+)
+
+// mentionToken is a single mention parsed from the text of a message. Exactly
+// one of its fields is set.
+type mentionToken struct {
+	pubKey   ed25519.PublicKey
+	codename string
+	dmToken  uint32
+}
+
+// mentionedMessage is a message found in the mentions index.
+type mentionedMessage struct {
+	mention *Mention
+	msg     *Message
+}
+
+// SetIdentity sets the identity of the local user, which is used to flag the
+// messages that mention them. The identity is added to the directory of known
+// senders so that it can be mentioned by codename before it sends a message.
+func (w *wasmModel) SetIdentity(pubKey ed25519.PublicKey, codeset uint8) error {
+	w.selfMux.Lock()
+	w.self = pubKey
+	w.selfMux.Unlock()
+
+	if err := w.registerSender(pubKey, codeset, 0); err != nil {
+		return errors.Errorf("failed to SetIdentity: %+v", err)
+	}
+	return nil
+}
+
+// GetMentions returns up to limit messages that mention the identity with the
+// given public key, ordered from newest to oldest, starting after the cursor.
+// If cursor is nil, the newest mentions are returned. Hidden messages are
+// excluded.
+//
+// To page through the mentions, call GetMentions again with the Next cursor of
+// the previous result until it is nil.
+func (w *wasmModel) GetMentions(pubKey ed25519.PublicKey,
+	cursor *wChannels.MentionCursor, limit int) (*wChannels.Mentions, error) {
+	parentErr := errors.New("failed to GetMentions")
+
+	if limit <= 0 {
+		return nil, errors.WithMessagef(parentErr,
+			"limit must be greater than zero, received %d", limit)
+	}
+
+	key := w.indexKey(pubKey)
+	upper := js.ValueOf([]any{key, math.Inf(1)})
+	if cursor != nil {
+		upper = js.ValueOf(
+			[]any{key, cursor.Timestamp.UnixMilli(), cursor.UUID})
+	}
+
+	// Mentions of hidden or deleted messages are skipped, so mentions are read
+	// in batches until one more than the limit is found. The messages are read
+	// after each batch since the cursor transaction commits once it has no
+	// pending requests.
+	found := make([]mentionedMessage, 0, limit+1)
+	for len(found) <= limit {
+		count := limit + 1 - len(found)
+		mentions, err := w.getMentionRange(key, upper, count)
+		if err != nil {
+			return nil, errors.WithMessagef(parentErr, "%+v", err)
+		}
+
+		for _, mention := range mentions {
+			msg, err := w.getMessageByUUID(mention.MessageUUID)
+			if err != nil {
+				return nil, errors.WithMessagef(parentErr, "%+v", err)
+			} else if msg != nil && !msg.Hidden {
+				found = append(found, mentionedMessage{mention, msg})
+			}
+		}
+
+		if len(mentions) < count {
+			break
+		}
+		last := mentions[len(mentions)-1]
+		upper = js.ValueOf([]any{key, last.Timestamp, last.MessageUUID})
+	}
+
+	page := &wChannels.Mentions{}
+	if len(found) > limit {
+		found = found[:limit]
+		last := found[limit-1].mention
+		page.Next = &wChannels.MentionCursor{
+			Timestamp: time.UnixMilli(last.Timestamp),
+			UUID:      last.MessageUUID,
+		}
+	}
+
+	page.Messages = make([]channels.ModelMessage, len(found))
+	for i, m := range found {
+		var err error
+		page.Messages[i], err = w.toDecryptedModelMessage(m.msg)
+		if err != nil {
+			return nil, errors.WithMessagef(parentErr,
+				"Unable to convert Message %d: %+v", m.msg.ID, err)
+		}
+	}
+
+	return page, nil
+}
+
+// getMentionRange returns up to limit mentions of the identity with the given
+// index key that are ordered before upper, from newest to oldest.
+func (w *wasmModel) getMentionRange(
+	key, upper js.Value, limit int) ([]*Mention, error) {
+	// Prepare the Transaction
+	txn, err := w.db.Transaction(idb.TransactionReadOnly, mentionStoreName)
+	if err != nil {
+		return nil, errors.Errorf("Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(mentionStoreName)
+	if err != nil {
+		return nil, errors.Errorf("Unable to get ObjectStore: %+v", err)
+	}
+	index, err := store.Index(mentionStorePubkeyIndex)
+	if err != nil {
+		return nil, errors.Errorf("Unable to get Index: %+v", err)
+	}
+
+	// Set up the operation
+	keyRange, err := idb.NewKeyRangeBound(
+		js.ValueOf([]any{key, math.Inf(-1)}), upper, false, true)
+	if err != nil {
+		return nil, errors.Errorf("Unable to NewKeyRangeBound: %+v", err)
+	}
+	cursorRequest, err := index.OpenCursorRange(keyRange, idb.CursorPrevious)
+	if err != nil {
+		return nil, errors.Errorf("Unable to open Cursor: %+v", err)
+	}
+
+	// Perform the operation
+	mentions := make([]*Mention, 0, limit)
+	err = impl.SendCursorRequest(cursorRequest,
+		func(cursor *idb.CursorWithValue) error {
+			value, err := cursor.Value()
+			if err != nil {
+				return err
+			}
+			mention := &Mention{}
+			err = json.Unmarshal([]byte(utils.JsToJson(value)), mention)
+			if err != nil {
+				return err
+			}
+			mentions = append(mentions, mention)
+			if len(mentions) >= limit {
+				return idb.ErrCursorStopIter
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, errors.Errorf("Unable to get Mention data: %+v", err)
+	}
+
+	return mentions, nil
+}
+
+// getMessageByUUID returns the opened Message with the given UUID. Returns nil
+// if it does not exist.
+func (w *wasmModel) getMessageByUUID(uuid uint64) (*Message, error) {
+	msgObj, err := impl.Get(w.db, messageStoreName, js.ValueOf(uuid))
+	if err != nil {
+		if strings.Contains(err.Error(), impl.ErrDoesNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return w.openMessage(msgObj)
+}
+
+// receiveMentions adds the sender of a received message to the directory of
+// known senders and returns the blinded public keys of the identities mentioned
+// in its plaintext. Errors are logged so that the message is still stored.
+func (w *wasmModel) receiveMentions(pubKey ed25519.PublicKey, dmToken uint32,
+	codeset uint8, mType channels.MessageType, plaintext string) [][]byte {
+	if err := w.registerSender(pubKey, codeset, dmToken); err != nil {
+		jww.ERROR.Printf("Failed to register sender: %+v", err)
+	}
+	if !isSearchable(mType) {
+		return nil
+	}
+
+	mentioned, err := w.resolveMentions(plaintext)
+	if err != nil {
+		jww.ERROR.Printf("Failed to resolve mentions: %+v", err)
+		return nil
+	}
+	return mentioned
+}
+
+// resolveMentions returns the blinded public keys of the identities mentioned
+// in the text. Mentions by codename or DM token of senders that are not in the
+// directory are ignored. Each identity is only returned once.
+func (w *wasmModel) resolveMentions(text string) ([][]byte, error) {
+	var mentioned [][]byte
+	for _, token := range parseMentions(text) {
+		var key []byte
+		var err error
+		switch {
+		case token.pubKey != nil:
+			key = w.blind(token.pubKey)
+		case token.codename != "":
+			key, err = w.lookupIdentity(
+				identityStoreCodenameIndex, []byte(token.codename))
+		default:
+			key, err = w.lookupIdentity(
+				identityStoreDmTokenIndex, dmTokenBytes(token.dmToken))
+		}
+		if err != nil {
+			return nil, err
+		} else if key == nil {
+			continue
+		}
+
+		var exists bool
+		for _, k := range mentioned {
+			exists = exists || bytes.Equal(k, key)
+		}
+		if !exists {
+			mentioned = append(mentioned, key)
+		}
+	}
+	return mentioned, nil
+}
+
+// lookupIdentity returns the stored public key of the sender with the value in
+// the given Identity index. Returns nil if no sender has the value. If more
+// than one sender has it, the first is returned.
+func (w *wasmModel) lookupIdentity(
+	indexName string, value []byte) ([]byte, error) {
+	identityObj, err := impl.GetIndex(
+		w.db, identityStoreName, indexName, w.indexKey(value))
+	if err != nil {
+		if strings.Contains(err.Error(), impl.ErrDoesNotExist) {
+			return nil, nil
+		}
+		return nil, errors.Errorf("Unable to look up Identity: %+v", err)
+	}
+
+	var identity Identity
+	err = json.Unmarshal([]byte(utils.JsToJson(identityObj)), &identity)
+	if err != nil {
+		return nil, errors.Errorf("Unable to unmarshal Identity: %+v", err)
+	}
+	return identity.Pubkey, nil
+}
+
+// registerSender adds the sender to the directory of known senders, which
+// resolves mentions by codename and DM token. The Identity is only written if
+// it is new or if the DM token changed. A zero dmToken leaves the stored DM
+// token unchanged.
+func (w *wasmModel) registerSender(
+	pubKey ed25519.PublicKey, codeset uint8, dmToken uint32) error {
+	if len(pubKey) != ed25519.PublicKeySize {
+		return nil
+	}
+
+	identityObj, err := impl.Get(w.db, identityStoreName, w.indexKey(pubKey))
+	if err == nil {
+		var stored Identity
+		err = json.Unmarshal([]byte(utils.JsToJson(identityObj)), &stored)
+		if err != nil {
+			return errors.Errorf("Unable to unmarshal Identity: %+v", err)
+		}
+		if dmToken == 0 ||
+			bytes.Equal(stored.DmToken, w.blind(dmTokenBytes(dmToken))) {
+			return nil
+		}
+	} else if !strings.Contains(err.Error(), impl.ErrDoesNotExist) {
+		return errors.Errorf("Unable to get Identity: %+v", err)
+	}
+
+	identityObj, err = w.identityToValue(pubKey, codeset, dmToken)
+	if err != nil {
+		return err
+	}
+	if _, err = impl.Put(w.db, identityStoreName, identityObj); err != nil {
+		return errors.Errorf("Unable to put Identity: %+v", err)
+	}
+	return nil
+}
+
+// identityToValue converts the sender to the js.Value of the Identity that is
+// stored.
+func (w *wasmModel) identityToValue(pubKey ed25519.PublicKey, codeset uint8,
+	dmToken uint32) (js.Value, error) {
+	identity, err := codename.ConstructIdentity(pubKey, codeset)
+	if err != nil {
+		return js.Undefined(), errors.Errorf(
+			"Unable to construct codename: %+v", err)
+	}
+
+	newIdentity := Identity{
+		Pubkey:   w.blind(pubKey),
+		Codename: w.blind([]byte(identity.Codename)),
+	}
+	if dmToken != 0 {
+		newIdentity.DmToken = w.blind(dmTokenBytes(dmToken))
+	}
+
+	identityJson, err := json.Marshal(newIdentity)
+	if err != nil {
+		return js.Undefined(), errors.Errorf(
+			"Unable to marshal Identity: %+v", err)
+	}
+	return utils.JsonToJS(identityJson)
+}
+
+// putMentions stores a Mention of each of the mentioned identities in the
+// opened Message with the given UUID as part of the transaction.
+func (w *wasmModel) putMentions(txn *impl.Transaction, uuid uint64,
+	msg *Message, mentioned [][]byte) error {
+	for _, key := range mentioned {
+		mentionJson, err := json.Marshal(Mention{
+			Pubkey:      key,
+			ChannelID:   w.blind(msg.ChannelID),
+			MessageUUID: uuid,
+			Timestamp:   msg.Timestamp.UnixMilli(),
+		})
+		if err != nil {
+			return errors.Errorf("Unable to marshal Mention: %+v", err)
+		}
+		mentionObj, err := utils.JsonToJS(mentionJson)
+		if err != nil {
+			return errors.Errorf("Unable to marshal Mention: %+v", err)
+		}
+		if _, err = txn.Put(mentionStoreName, mentionObj); err != nil {
+			return errors.Errorf("Unable to put Mention: %+v", err)
+		}
+	}
+	return nil
+}
+
+// mentionsSelf returns true if the local user is one of the mentioned
+// identities and is not the sender.
+func (w *wasmModel) mentionsSelf(
+	mentioned [][]byte, sender ed25519.PublicKey) bool {
+	w.selfMux.Lock()
+	self := w.self
+	w.selfMux.Unlock()
+
+	if self == nil || bytes.Equal(self, sender) {
+		return false
+	}
+	selfKey := w.blind(self)
+	for _, key := range mentioned {
+		if bytes.Equal(key, selfKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// rebuildMentions adds the sender of every message currently in storage to the
+// directory of known senders and then indexes the mentions in every message.
+// Progress is reported periodically with the number of messages processed and
+// the total. It is safe to call more than once.
+func (w *wasmModel) rebuildMentions(progress func(done, total uint)) error {
+	parentErr := errors.New("failed to rebuildMentions")
+
+	results, err := impl.GetAll(w.db, messageStoreName)
+	if err != nil {
+		return errors.WithMessagef(parentErr, "%+v", err)
+	}
+
+	// Every sender is known before mentions are resolved, so that mentions of
+	// senders whose first message is newer are found
+	msgs := make([]*Message, len(results))
+	for i, result := range results {
+		msgs[i], err = w.openMessage(result)
+		if err != nil {
+			return errors.WithMessagef(parentErr,
+				"Unable to unmarshal Message: %+v", err)
+		}
+		err = w.registerSender(
+			msgs[i].Pubkey, msgs[i].CodesetVersion, msgs[i].DmToken)
+		if err != nil {
+			return errors.WithMessagef(parentErr, "%+v", err)
+		}
+	}
+
+	total := uint(len(msgs))
+	var indexed int
+	for i, msg := range msgs {
+		if i > 0 && i%impl.MigrationProgressInterval == 0 {
+			progress(uint(i), total)
+		}
+		if !isSearchable(channels.MessageType(msg.Type)) || msg.Evicted {
+			continue
+		}
+
+		text := []byte(msg.Text)
+		if w.cipher != nil {
+			text, err = w.cipher.Decrypt(msg.Text)
+			if err != nil {
+				return errors.WithMessagef(parentErr,
+					"Unable to decrypt Message %d: %+v", msg.ID, err)
+			}
+		}
+		mentioned, err := w.resolveMentions(string(text))
+		if err != nil {
+			return errors.WithMessagef(parentErr, "%+v", err)
+		} else if len(mentioned) == 0 {
+			continue
+		}
+
+		// Existing mentions are replaced in case the rebuild was interrupted
+		err = impl.RunTransaction(w.db, func(txn *impl.Transaction) error {
+			err := txn.DeleteByIndex(mentionStoreName,
+				mentionStoreMessageIndex, js.ValueOf(msg.ID))
+			if err != nil {
+				return err
+			}
+			return w.putMentions(txn, msg.ID, msg, mentioned)
+		}, mentionStoreName)
+		if err != nil {
+			return errors.WithMessagef(parentErr,
+				"Unable to index mentions of Message %d: %+v", msg.ID, err)
+		}
+		indexed++
+	}
+
+	progress(total, total)
+	jww.INFO.Printf("Indexed mentions in %d messages", indexed)
+	return nil
+}
+
+// parseMentions returns every mention in the text. A mention is an @ followed
+// by a token, which is a base64 encoded public key, a decimal DM token, or a
+// codename. An @ that directly follows a letter or digit, such as in an email
+// address, does not start a mention.
+func parseMentions(text string) []mentionToken {
+	var tokens []mentionToken
+	var prev rune
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if r != '@' || isMentionRune(prev) {
+			prev = r
+			i += size
+			continue
+		}
+
+		end := i + size
+		for end < len(text) {
+			next, nextSize := utf8.DecodeRuneInString(text[end:])
+			if !isMentionRune(next) {
+				break
+			}
+			end += nextSize
+		}
+
+		if token, ok := parseMentionToken(text[i+size : end]); ok {
+			tokens = append(tokens, token)
+		}
+		prev, _ = utf8.DecodeLastRuneInString(text[:end])
+		i = end
+	}
+	return tokens
+}
+
+// parseMentionToken parses the token following an @. Returns false if it is not
+// a valid mention.
+func parseMentionToken(token string) (mentionToken, bool) {
+	if token == "" {
+		return mentionToken{}, false
+	}
+
+	pubKey, err := base64.StdEncoding.DecodeString(token)
+	if err == nil && len(pubKey) == ed25519.PublicKeySize {
+		return mentionToken{pubKey: pubKey}, true
+	}
+
+	dmToken, err := strconv.ParseUint(token, 10, 32)
+	if err == nil {
+		return mentionToken{dmToken: uint32(dmToken)}, dmToken != 0
+	}
+
+	if len(token) > codename.MaxCodenameLength ||
+		strings.ContainsAny(token, "+/=") {
+		return mentionToken{}, false
+	}
+	return mentionToken{codename: token}, true
+}
+
+// isMentionRune returns true if the rune can be part of a mention token.
+func isMentionRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) ||
+		r == '+' || r == '/' || r == '='
+}
+
+// dmTokenBytes returns the big-endian bytes of the DM token, as it is indexed.
+func dmTokenBytes(dmToken uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, dmToken)
+	return b
+}
@@ -22,12 +22,42 @@ const (
 	channelStoreName = "channels"
 	fileStoreName    = "files"
 
+	// retentionStoreName is the name of the [idb.ObjectStore] that holds the
+	// RetentionPolicy of each channel.
+	retentionStoreName = "retentionPolicies"
+
+	// mutedUserStoreName is the name of the [idb.ObjectStore] that holds the
+	// MutedUser of each muted sender.
+	mutedUserStoreName = "mutedUsers"
+
+	// identityStoreName is the name of the [idb.ObjectStore] that holds the
+	// Identity of each known sender, which is used to resolve mentions.
+	identityStoreName = "identities"
+
+	// mentionStoreName is the name of the [idb.ObjectStore] that holds the
+	// Mention of each identity mentioned in a message.
+	mentionStoreName = "mentions"
+
 	// Message index names.
 	messageStoreMessageIndex   = "message_id_index"
 	messageStoreChannelIndex   = "channel_id_index"
 	messageStoreParentIndex    = "parent_message_id_index"
 	messageStoreTimestampIndex = "timestamp_index"
 	messageStorePinnedIndex    = "pinned_index"
+	messageStorePubkeyIndex    = "pubkey_index"
+
+	// messageStoreChannelPinnedIndex is a compound index on the channel ID and
+	// pin time. Unpinned messages have no pin time, so only pinned messages
+	// are in it.
+	messageStoreChannelPinnedIndex = "channel_pinned_index"
+
+	// messageStoreChannelTimestampIndex is a compound index on the channel ID
+	// and timestamp, which orders the messages of each channel.
+	messageStoreChannelTimestampIndex = "channel_timestamp_index"
+
+	// messageStoreExpiryIndex is an index on the time the lease of a message
+	// elapses. Messages without a lease are not in it.
+	messageStoreExpiryIndex = "expiry_index"
 
 	// Message keyPath names (must match json struct tags).
 	messageStoreMessage   = "message_id"
@@ -35,6 +65,40 @@ const (
 	messageStoreParent    = "parent_message_id"
 	messageStoreTimestamp = "timestamp"
 	messageStorePinned    = "pinned"
+	messageStorePubkey    = "pubkey"
+	messageStorePinnedAt  = "pinned_at"
+	messageStoreSortTime  = "sort_time"
+	messageStoreExpiresAt = "expires_at"
+
+	// MutedUser index names.
+	mutedUserStoreChannelIndex = "channel_id_index"
+
+	// MutedUser keyPath names (must match json struct tags).
+	mutedUserStoreChannel = "channel_id"
+	mutedUserStorePubkey  = "pubkey"
+
+	// Identity index names.
+	identityStoreCodenameIndex = "codename_index"
+	identityStoreDmTokenIndex  = "dm_token_index"
+
+	// Identity keyPath names (must match json struct tags).
+	identityStoreCodename = "codename"
+	identityStoreDmToken  = "dm_token"
+
+	// Mention index names.
+	mentionStoreMessageIndex = "message_uuid_index"
+	mentionStoreChannelIndex = "channel_id_index"
+
+	// mentionStorePubkeyIndex is a compound index on the mentioned public key,
+	// the timestamp, and the message UUID, which orders the mentions of each
+	// identity.
+	mentionStorePubkeyIndex = "pubkey_timestamp_index"
+
+	// Mention keyPath names (must match json struct tags).
+	mentionStoreMessage   = "message_uuid"
+	mentionStoreChannel   = "channel_id"
+	mentionStorePubkey    = "pubkey"
+	mentionStoreTimestamp = "timestamp"
 )
 
 // Message defines the IndexedDb representation of a single Message.
@@ -60,10 +124,40 @@ type Message struct {
 	Type            uint16    `json:"type"`
 	Round           uint64    `json:"round"`
 
+	// ReplyCount is the number of replies to the Message that are not hidden.
+	ReplyCount uint `json:"reply_count"`
+
+	// Evicted is true if Text was removed to free storage space.
+	Evicted bool `json:"evicted,omitempty"`
+
+	// PinnedAt is the time, in Unix milliseconds, that the Message was pinned.
+	// It is only set while the Message is pinned, since it is part of
+	// messageStoreChannelPinnedIndex.
+	PinnedAt int64 `json:"pinned_at,omitempty"`
+
+	// SortTime is Timestamp in Unix milliseconds. It is part of
+	// messageStoreChannelTimestampIndex, since Timestamp is not stored in a
+	// form that sorts in time order.
+	SortTime int64 `json:"sort_time"`
+
+	// ExpiresAt is the time, in Unix milliseconds, that the lease of the
+	// Message elapses. It is only set if the Message has a lease, since it is
+	// indexed by messageStoreExpiryIndex.
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+
+	// MutedHidden is true if the Message is hidden only because its sender is
+	// muted. It is shown again when the sender is unmuted.
+	MutedHidden bool `json:"muted_hidden,omitempty"`
+
 	// User cryptographic Identity struct -- could be pulled out
-	Pubkey         []byte `json:"pubkey"`
+	Pubkey         []byte `json:"pubkey"` // Index
 	DmToken        uint32 `json:"dm_token"`
 	CodesetVersion uint8  `json:"codeset_version"`
+
+	// Sensitive holds the encrypted sensitiveFields when all sensitive fields
+	// are encrypted. The indexed fields then hold blinded values and the
+	// others are empty.
+	Sensitive []string `json:"sensitive,omitempty"`
 }
 
 // Channel defines the IndexedDb representation of a single Channel.
@@ -73,6 +167,62 @@ type Channel struct {
 	ID          []byte `json:"id"` // Matches pkeyName
 	Name        string `json:"name"`
 	Description string `json:"description"`
+
+	// Sensitive holds the encrypted channelFields when all sensitive fields
+	// are encrypted. The ID then holds the blinded channel ID and the others
+	// are empty.
+	Sensitive []string `json:"sensitive,omitempty"`
+}
+
+// RetentionPolicy defines the IndexedDb representation of the limits on the
+// messages kept in a single Channel. Zero values are unlimited.
+type RetentionPolicy struct {
+	// ChannelID is blinded if all sensitive fields are encrypted.
+	ChannelID []byte `json:"id"` // Matches pkeyName
+
+	MaxAge   time.Duration `json:"max_age"`
+	MaxCount uint          `json:"max_count"`
+	MaxBytes uint64        `json:"max_bytes"`
+}
+
+// MutedUser defines the IndexedDb representation of a single sender muted in a
+// single Channel. It is keyed on both the channel ID and public key.
+type MutedUser struct {
+	// ChannelID and Pubkey are blinded if all sensitive fields are encrypted.
+	ChannelID []byte `json:"channel_id"` // Index
+	Pubkey    []byte `json:"pubkey"`
+
+	// Timestamp is the time the sender was muted.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Identity defines the IndexedDb representation of a single known sender. It
+// maps the codename and DM token of the sender to their public key.
+type Identity struct {
+	// Pubkey, Codename, and DmToken are blinded if all sensitive fields are
+	// encrypted.
+	Pubkey   []byte `json:"id"`       // Matches pkeyName
+	Codename []byte `json:"codename"` // Index
+
+	// DmToken is the big-endian DM token. It is nil if the DM token of the
+	// sender is not known.
+	DmToken []byte `json:"dm_token"` // Index
+}
+
+// Mention defines the IndexedDb representation of a single identity mentioned
+// in a single Message.
+type Mention struct {
+	ID uint64 `json:"id,omitempty"` // Matches pkeyName
+
+	// Pubkey and ChannelID are blinded if all sensitive fields are encrypted.
+	Pubkey    []byte `json:"pubkey"`     // Index
+	ChannelID []byte `json:"channel_id"` // Index
+
+	// MessageUUID is the UUID of the Message.
+	MessageUUID uint64 `json:"message_uuid"` // Index
+
+	// Timestamp is the time, in Unix milliseconds, that the Message was sent.
+	Timestamp int64 `json:"timestamp"` // Index
 }
 
 // File defines the IndexedDb representation of a single File.
@@ -80,12 +230,20 @@ type File struct {
 	// Id is a unique identifier for a given File.
 	Id []byte `json:"id"` // Matches pkeyName
 
-	// Data stores the actual contents of the File.
+	// Data stores the actual contents of the File. It is nil if the database
+	// is encrypted.
 	Data []byte `json:"data"`
 
-	// Link contains all the information needed to download the file data.
+	// Link contains all the information needed to download the file data. It
+	// is nil if the database is encrypted.
 	Link []byte `json:"link"`
 
+	// EncryptedData is Data encrypted in chunks with the database cipher.
+	EncryptedData []string `json:"encryptedData,omitempty"`
+
+	// EncryptedLink is Link encrypted in chunks with the database cipher.
+	EncryptedLink []string `json:"encryptedLink,omitempty"`
+
 	// Timestamp is the last time the file data, link, or status was modified.
 	Timestamp time.Time `json:"timestamp"`
 
@@ -0,0 +1,271 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"strings"
+	"syscall/js"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/client/v4/bindings"
+	"gitlab.com/elixxir/client/v4/channels"
+	"gitlab.com/elixxir/wasm-utils/utils"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/netTime"
+)
+
+// mutedMessage is a message of a sender whose muted state changed.
+type mutedMessage struct {
+	before, after *Message
+
+	// value is the js.Value of after, which is stored.
+	value js.Value
+}
+
+// setUserMuted stores or deletes the MutedUser for the sender and, if the
+// sender was not already in that state, hides or shows their messages in the
+// channel. The MutedUser, the messages, their search tokens, and the changes
+// are all written in a single transaction.
+//
+// Muting hides every visible message and removes every message from the search
+// index. Unmuting only shows the messages that were hidden by the mute, so
+// that messages hidden for another reason stay hidden.
+func (w *wasmModel) setUserMuted(
+	channelID *id.ID, pubKey ed25519.PublicKey, muted bool) error {
+	parentErr := errors.New("failed to setUserMuted")
+	channelIDBytes := channelID.Marshal()
+
+	// All reads are made before the transaction, since it commits once it
+	// has no pending requests
+	wasMuted, err := w.isMuted(channelIDBytes, pubKey)
+	if err != nil {
+		return errors.WithMessagef(parentErr, "%+v", err)
+	}
+	var msgs []*Message
+	if wasMuted != muted {
+		msgs, err = w.getSenderMessages(channelIDBytes, pubKey)
+		if err != nil {
+			return errors.WithMessagef(parentErr, "%+v", err)
+		}
+	}
+
+	changed := make([]mutedMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		before := *msg
+		if muted && !msg.Hidden {
+			msg.Hidden = true
+			msg.MutedHidden = true
+		} else if !muted && msg.MutedHidden {
+			msg.Hidden = false
+			msg.MutedHidden = false
+		} else {
+			continue
+		}
+
+		value, err := w.messageToValue(msg)
+		if err != nil {
+			return errors.WithMessagef(parentErr, "%+v", err)
+		}
+		changed = append(changed, mutedMessage{&before, msg, value})
+	}
+
+	key := w.mutedUserKey(channelIDBytes, pubKey)
+	mutedUserObj, err := w.mutedUserToValue(channelIDBytes, pubKey)
+	if err != nil {
+		return errors.WithMessagef(parentErr, "%+v", err)
+	}
+
+	err = impl.RunTransaction(w.db, func(txn *impl.Transaction) error {
+		if muted {
+			if _, err := txn.Put(mutedUserStoreName, mutedUserObj); err != nil {
+				return errors.Errorf("Unable to put MutedUser: %+v", err)
+			}
+		} else if err := txn.Delete(mutedUserStoreName, key); err != nil {
+			return errors.Errorf("Unable to delete MutedUser: %+v", err)
+		}
+
+		if muted {
+			for _, msg := range msgs {
+				if err := w.search.RemoveTxn(txn, msg.ID); err != nil {
+					return errors.Errorf(
+						"Unable to remove Message %d from search index: %+v",
+						msg.ID, err)
+				}
+			}
+		}
+
+		for _, c := range changed {
+			if _, err := txn.Put(messageStoreName, c.value); err != nil {
+				return errors.Errorf(
+					"Unable to put Message %d: %+v", c.after.ID, err)
+			}
+			err := w.changes.Append(txn, bindings.MessageReceived,
+				bindings.MessageReceivedJSON{
+					UUID:      int64(c.after.ID),
+					ChannelID: channelID,
+					Update:    true,
+				})
+			if err != nil {
+				return err
+			}
+			if err = w.updateReplyCountTxn(txn, c.before, c.after); err != nil {
+				return err
+			}
+		}
+
+		return w.changes.Append(txn, bindings.UserMuted,
+			bindings.UserMutedJSON{
+				ChannelID: channelID,
+				PubKey:    pubKey,
+				Unmute:    !muted,
+			})
+	}, mutedUserStoreName, messageStoreName, impl.SearchStoreName,
+		impl.ChangeLogStoreName)
+	if err != nil {
+		return errors.WithMessagef(parentErr, "%+v", err)
+	}
+
+	w.changes.Publish()
+
+	// The search tokens are rebuilt from the text, which cannot be done in
+	// the transaction
+	if !muted {
+		for _, msg := range msgs {
+			if !isSearchable(channels.MessageType(msg.Type)) {
+				continue
+			}
+			if err = w.addToSearch(msg); err != nil {
+				jww.ERROR.Printf("Failed to index Message of unmuted user: "+
+					"%+v", err)
+			}
+		}
+	}
+
+	jww.DEBUG.Printf("Set muted to %t for %d messages in channel %s",
+		muted, len(changed), channelID)
+	return nil
+}
+
+// isMuted returns true if the sender is muted in the channel.
+func (w *wasmModel) isMuted(channelID, pubKey []byte) (bool, error) {
+	_, err := impl.Get(
+		w.db, mutedUserStoreName, w.mutedUserKey(channelID, pubKey))
+	if err != nil {
+		if strings.Contains(err.Error(), impl.ErrDoesNotExist) {
+			return false, nil
+		}
+		return false, errors.Errorf(
+			"Unable to check if sender is muted: %+v", err)
+	}
+	return true, nil
+}
+
+// isMutedTxn returns true if the sender is muted in the channel. It is read as
+// part of the Transaction, which must include the mutedUserStoreName object
+// store.
+func (w *wasmModel) isMutedTxn(
+	txn *impl.Transaction, channelID, pubKey []byte) (bool, error) {
+	_, err := txn.Get(mutedUserStoreName, w.mutedUserKey(channelID, pubKey))
+	if err != nil {
+		if strings.Contains(err.Error(), impl.ErrDoesNotExist) {
+			return false, nil
+		}
+		return false, errors.Errorf(
+			"Unable to check if sender is muted: %+v", err)
+	}
+	return true, nil
+}
+
+// getSenderMessages returns every message sent by the sender in the channel.
+func (w *wasmModel) getSenderMessages(
+	channelID, pubKey []byte) ([]*Message, error) {
+	parentErr := errors.New("failed to getSenderMessages")
+
+	// Prepare the Transaction
+	txn, err := w.db.Transaction(idb.TransactionReadOnly, messageStoreName)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(messageStoreName)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to get ObjectStore: %+v", err)
+	}
+	index, err := store.Index(messageStorePubkeyIndex)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to get Index: %+v", err)
+	}
+
+	// Set up the operation
+	keyRange, err := idb.NewKeyRangeOnly(w.indexKey(pubKey))
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to NewKeyRangeOnly: %+v", err)
+	}
+	cursorRequest, err := index.OpenCursorRange(keyRange, idb.CursorNext)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to open Cursor: %+v", err)
+	}
+
+	// Perform the operation
+	results := make([]*Message, 0)
+	err = impl.SendCursorRequest(cursorRequest,
+		func(cursor *idb.CursorWithValue) error {
+			value, err := cursor.Value()
+			if err != nil {
+				return err
+			}
+			msg, err := w.openMessage(value)
+			if err != nil {
+				return err
+			}
+			if bytes.Equal(msg.ChannelID, channelID) {
+				results = append(results, msg)
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to get Message data: %+v", err)
+	}
+
+	return results, nil
+}
+
+// mutedUserKey returns the key of the MutedUser for the sender in the channel.
+func (w *wasmModel) mutedUserKey(channelID, pubKey []byte) js.Value {
+	return js.ValueOf([]any{w.indexKey(channelID), w.indexKey(pubKey)})
+}
+
+// mutedUserToValue converts a new MutedUser for the sender in the channel to
+// the js.Value that is stored.
+func (w *wasmModel) mutedUserToValue(
+	channelID, pubKey []byte) (js.Value, error) {
+	mutedUserJson, err := json.Marshal(MutedUser{
+		ChannelID: w.blind(channelID),
+		Pubkey:    w.blind(pubKey),
+		Timestamp: netTime.Now(),
+	})
+	if err != nil {
+		return js.Undefined(), errors.Errorf(
+			"Unable to marshal MutedUser: %+v", err)
+	}
+	return utils.JsonToJS(mutedUserJson)
+}
@@ -0,0 +1,138 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package main
+
+import (
+	"crypto/ed25519"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+
+	"gitlab.com/elixxir/client/v4/channels"
+	"gitlab.com/elixxir/crypto/message"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	wChannels "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/channels"
+)
+
+// GetReactions returns the reactions to each of the messages, in the same
+// order as messageIDs. Each emoji is listed with the number of users that
+// reacted with it and whether the user with the public key self reacted.
+// Hidden reactions, reactions from muted users, and reactions that are not a
+// single supported emoji are not counted.
+func (w *wasmModel) GetReactions(messageIDs []message.ID,
+	self ed25519.PublicKey) ([]wChannels.MessageReactions, error) {
+	parentErr := errors.New("failed to GetReactions")
+
+	// Whether a sender is muted is looked up once for each channel
+	muted := make(map[string]bool)
+
+	results := make([]wChannels.MessageReactions, len(messageIDs))
+	for i, messageID := range messageIDs {
+		children, err := w.getChildren(messageID)
+		if err != nil {
+			return nil, errors.WithMessagef(parentErr, "%+v", err)
+		}
+
+		tally := impl.NewReactionTally(self)
+		for _, msg := range children {
+			if msg.Hidden ||
+				channels.MessageType(msg.Type) != channels.Reaction {
+				continue
+			}
+
+			key := string(msg.ChannelID) + string(msg.Pubkey)
+			isMuted, exists := muted[key]
+			if !exists {
+				isMuted, err = w.isMuted(msg.ChannelID, msg.Pubkey)
+				if err != nil {
+					return nil, errors.WithMessagef(parentErr, "%+v", err)
+				}
+				muted[key] = isMuted
+			}
+			if isMuted {
+				continue
+			}
+
+			reaction := []byte(msg.Text)
+			if w.cipher != nil {
+				reaction, err = w.cipher.Decrypt(msg.Text)
+				if err != nil {
+					return nil, errors.WithMessagef(parentErr,
+						"Unable to decrypt Message %d: %+v", msg.ID, err)
+				}
+			}
+			tally.Add(string(reaction), msg.Pubkey)
+		}
+
+		results[i] = wChannels.MessageReactions{
+			MessageID: messageID,
+			Reactions: []wChannels.Reaction{},
+		}
+		for _, count := range tally.Counts() {
+			results[i].Reactions = append(results[i].Reactions,
+				wChannels.Reaction{
+					Emoji:   count.Emoji,
+					Count:   count.Count,
+					Reacted: count.Reacted,
+				})
+		}
+	}
+
+	return results, nil
+}
+
+// getChildren returns every Message whose parent is the message with the given
+// ID.
+func (w *wasmModel) getChildren(parentID message.ID) ([]*Message, error) {
+	// Prepare the Transaction
+	txn, err := w.db.Transaction(idb.TransactionReadOnly, messageStoreName)
+	if err != nil {
+		return nil, errors.Errorf("Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(messageStoreName)
+	if err != nil {
+		return nil, errors.Errorf("Unable to get ObjectStore: %+v", err)
+	}
+	index, err := store.Index(messageStoreParentIndex)
+	if err != nil {
+		return nil, errors.Errorf("Unable to get Index: %+v", err)
+	}
+
+	// Set up the operation
+	keyRange, err := idb.NewKeyRangeOnly(w.indexKey(parentID.Marshal()))
+	if err != nil {
+		return nil, errors.Errorf("Unable to NewKeyRangeOnly: %+v", err)
+	}
+	cursorRequest, err := index.OpenCursorRange(keyRange, idb.CursorNext)
+	if err != nil {
+		return nil, errors.Errorf("Unable to open Cursor: %+v", err)
+	}
+
+	// Perform the operation
+	children := make([]*Message, 0)
+	err = impl.SendCursorRequest(cursorRequest,
+		func(cursor *idb.CursorWithValue) error {
+			value, err := cursor.Value()
+			if err != nil {
+				return err
+			}
+			msg, err := w.openMessage(value)
+			if err != nil {
+				return err
+			}
+			children = append(children, msg)
+			return nil
+		})
+	if err != nil {
+		return nil, errors.Errorf("Unable to get Message data: %+v", err)
+	}
+
+	return children, nil
+}
@@ -0,0 +1,360 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package main
+
+import (
+	"syscall/js"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+
+	"gitlab.com/elixxir/client/v4/channels"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	wChannels "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/channels"
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// MarkRead marks the message with the given UUID, and every message in its
+// channel sent before it, as read. The read position never moves backwards;
+// marking an older message does nothing.
+func (w *wasmModel) MarkRead(uuid uint64) error {
+	parentErr := errors.New("failed to MarkRead")
+
+	msgObj, err := impl.Get(w.db, messageStoreName, js.ValueOf(uuid))
+	if err != nil {
+		return errors.WithMessage(err, parentErr.Error())
+	}
+	msg, err := w.openMessage(msgObj)
+	if err != nil {
+		return errors.WithMessagef(parentErr, "%+v", err)
+	}
+
+	marker, _, err := w.getOrCreateReadMarker(msg.ChannelID)
+	if err != nil {
+		return errors.WithMessagef(parentErr, "%+v", err)
+	} else if marker.IsRead(msg.Timestamp) {
+		return nil
+	}
+
+	marker.LastRead = uuid
+	marker.LastReadTimestamp = msg.Timestamp
+	marker.Unread, err = w.countUnread(msg.ChannelID, marker)
+	if err != nil {
+		return errors.WithMessagef(parentErr, "%+v", err)
+	}
+	if err = w.putReadMarker(msg.ChannelID, marker); err != nil {
+		return errors.WithMessagef(parentErr, "%+v", err)
+	}
+	return nil
+}
+
+// GetUnreadCount returns the number of unread messages in the channel.
+func (w *wasmModel) GetUnreadCount(channelID *id.ID) (uint, error) {
+	marker, err := w.getReadMarker(channelID.Marshal())
+	if err != nil {
+		return 0, errors.Errorf("failed to GetUnreadCount: %+v", err)
+	}
+	return marker.Unread, nil
+}
+
+// GetUnreadSummary returns the unread count and last read message of every
+// joined channel.
+func (w *wasmModel) GetUnreadSummary() ([]wChannels.UnreadCount, error) {
+	parentErr := errors.New("failed to GetUnreadSummary")
+
+	results, err := impl.GetAll(w.db, channelStoreName)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr, "%+v", err)
+	}
+
+	summary := make([]wChannels.UnreadCount, len(results))
+	for i, result := range results {
+		channel, err := w.openChannel(result)
+		if err != nil {
+			return nil, errors.WithMessagef(parentErr, "%+v", err)
+		}
+		channelID, err := id.Unmarshal(channel.ID)
+		if err != nil {
+			return nil, errors.WithMessagef(parentErr,
+				"Unable to unmarshal channel ID: %+v", err)
+		}
+
+		marker, err := w.getReadMarker(channel.ID)
+		if err != nil {
+			return nil, errors.WithMessagef(parentErr, "%+v", err)
+		}
+		summary[i] = wChannels.UnreadCount{
+			ChannelID: channelID,
+			LastRead:  marker.LastRead,
+			Unread:    marker.Unread,
+		}
+	}
+
+	return summary, nil
+}
+
+// recountUnread counts the unread messages in the channel again, such as after
+// the messages of a sender are hidden or shown, and stores the count if it
+// changed.
+func (w *wasmModel) recountUnread(channelID []byte) error {
+	marker, created, err := w.getOrCreateReadMarker(channelID)
+	if err != nil || created {
+		return err
+	}
+
+	unread, err := w.countUnread(channelID, marker)
+	if err != nil {
+		return err
+	} else if unread == marker.Unread {
+		return nil
+	}
+
+	marker.Unread = unread
+	return w.putReadMarker(channelID, marker)
+}
+
+// updateUnreadTxn adjusts the unread count of the channel after a message is
+// inserted (before is nil), modified, or deleted (after is nil). The marker is
+// read and stored, and its change recorded, as part of the Transaction of the
+// change to the message, which must include the mutedUserStoreName,
+// impl.ReadMarkerStoreName, and impl.ChangeLogStoreName object stores.
+//
+// Markers are created when a channel is joined, so a channel without one has
+// no other unread messages and a new marker is stored if the count changes.
+func (w *wasmModel) updateUnreadTxn(txn *impl.Transaction, channelID []byte,
+	before, after *Message) error {
+	marker, err := impl.GetReadMarkerTxn(txn, w.blind(channelID))
+	if err != nil {
+		return err
+	} else if marker == nil {
+		marker = &impl.ReadMarker{ID: w.blind(channelID)}
+	}
+
+	wasUnread, err := w.isUnreadTxn(txn, marker, before)
+	if err != nil {
+		return err
+	}
+	isUnread, err := w.isUnreadTxn(txn, marker, after)
+	if err != nil {
+		return err
+	}
+
+	var delta int
+	if wasUnread {
+		delta--
+	}
+	if isUnread {
+		delta++
+	}
+	if delta == 0 {
+		return nil
+	}
+
+	marker.AddUnread(delta)
+	return w.putReadMarkerTxn(txn, channelID, marker)
+}
+
+// getReadMarker returns the ReadMarker for the channel. Markers are created
+// when a channel is joined or a message is received, so a channel without one
+// has nothing unread and an empty marker is returned without storing it.
+func (w *wasmModel) getReadMarker(channelID []byte) (*impl.ReadMarker, error) {
+	marker, err := impl.GetReadMarker(w.db, w.blind(channelID))
+	if err != nil || marker != nil {
+		return marker, err
+	}
+	return &impl.ReadMarker{ID: w.blind(channelID)}, nil
+}
+
+// getOrCreateReadMarker returns the ReadMarker for the channel. If the channel
+// has none, a new marker with every message unread is counted, stored, and
+// returned with created set to true.
+func (w *wasmModel) getOrCreateReadMarker(channelID []byte) (
+	marker *impl.ReadMarker, created bool, err error) {
+	marker, err = impl.GetReadMarker(w.db, w.blind(channelID))
+	if err != nil || marker != nil {
+		return marker, false, err
+	}
+
+	marker = &impl.ReadMarker{ID: w.blind(channelID)}
+	marker.Unread, err = w.countUnread(channelID, marker)
+	if err != nil {
+		return nil, false, err
+	}
+	if err = w.putReadMarker(channelID, marker); err != nil {
+		return nil, false, err
+	}
+	return marker, true, nil
+}
+
+// putReadMarker stores the ReadMarker for the channel and adds its unread
+// count to the change log in the same transaction, so that the count is sent
+// to the main thread in order with the other changes.
+func (w *wasmModel) putReadMarker(
+	channelID []byte, marker *impl.ReadMarker) error {
+	err := impl.RunTransaction(w.db, func(txn *impl.Transaction) error {
+		return w.putReadMarkerTxn(txn, channelID, marker)
+	}, impl.ReadMarkerStoreName, impl.ChangeLogStoreName)
+	if err != nil {
+		return err
+	}
+
+	w.changes.Publish()
+	return nil
+}
+
+// putReadMarkerTxn stores the ReadMarker for the channel and adds its unread
+// count to the change log as part of the Transaction, which must include the
+// impl.ReadMarkerStoreName and impl.ChangeLogStoreName object stores.
+func (w *wasmModel) putReadMarkerTxn(txn *impl.Transaction, channelID []byte,
+	marker *impl.ReadMarker) error {
+	chID, err := id.Unmarshal(channelID)
+	if err != nil {
+		return errors.Errorf(
+			"Unable to unmarshal channel ID for unread count: %+v", err)
+	}
+
+	if err = impl.PutReadMarkerTxn(txn, marker); err != nil {
+		return err
+	}
+	return w.changes.Append(txn, impl.UnreadCountEvent,
+		wChannels.UnreadCount{
+			ChannelID: chID,
+			LastRead:  marker.LastRead,
+			Unread:    marker.Unread,
+		})
+}
+
+// createReadMarkers creates the ReadMarker of every joined channel that has
+// none. It is used by the migration that added read markers, since channels
+// joined before then have none. Unread counts are not sent, since the main
+// thread is not listening yet.
+func (w *wasmModel) createReadMarkers(
+	db *idb.Database, progress func(done, total uint)) error {
+	results, err := impl.GetAll(db, channelStoreName)
+	if err != nil {
+		return err
+	}
+
+	for i, result := range results {
+		channel, err := w.openChannel(result)
+		if err != nil {
+			return err
+		}
+		marker, err := impl.GetReadMarker(db, w.blind(channel.ID))
+		if err != nil {
+			return err
+		} else if marker == nil {
+			marker = &impl.ReadMarker{ID: w.blind(channel.ID)}
+			marker.Unread, err = w.countUnread(channel.ID, marker)
+			if err != nil {
+				return err
+			}
+			if err = impl.PutReadMarker(db, marker); err != nil {
+				return err
+			}
+		}
+		progress(uint(i+1), uint(len(results)))
+	}
+	return nil
+}
+
+// countUnread returns the number of messages in the channel that are unread
+// according to the marker.
+func (w *wasmModel) countUnread(
+	channelID []byte, marker *impl.ReadMarker) (uint, error) {
+	parentErr := errors.New("failed to countUnread")
+
+	// Prepare the Transaction
+	txn, err := w.db.Transaction(idb.TransactionReadOnly, messageStoreName)
+	if err != nil {
+		return 0, errors.WithMessagef(parentErr,
+			"Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(messageStoreName)
+	if err != nil {
+		return 0, errors.WithMessagef(parentErr,
+			"Unable to get ObjectStore: %+v", err)
+	}
+	index, err := store.Index(messageStoreChannelIndex)
+	if err != nil {
+		return 0, errors.WithMessagef(parentErr,
+			"Unable to get Index: %+v", err)
+	}
+
+	// Set up the operation
+	keyRange, err := idb.NewKeyRangeOnly(w.indexKey(channelID))
+	if err != nil {
+		return 0, errors.WithMessagef(parentErr,
+			"Unable to NewKeyRangeOnly: %+v", err)
+	}
+	cursorRequest, err := index.OpenCursorRange(keyRange, idb.CursorNext)
+	if err != nil {
+		return 0, errors.WithMessagef(parentErr,
+			"Unable to open Cursor: %+v", err)
+	}
+
+	// Perform the operation. Unread messages are counted by sender, since
+	// whether a sender is muted cannot be looked up until the cursor is done.
+	bySender := make(map[string]uint)
+	err = impl.SendCursorRequest(cursorRequest,
+		func(cursor *idb.CursorWithValue) error {
+			value, err := cursor.Value()
+			if err != nil {
+				return err
+			}
+			msg, err := w.openMessage(value)
+			if err != nil {
+				return err
+			}
+			if countsAsUnread(marker, msg) {
+				bySender[string(msg.Pubkey)]++
+			}
+			return nil
+		})
+	if err != nil {
+		return 0, errors.WithMessagef(parentErr,
+			"Unable to count Message data: %+v", err)
+	}
+
+	var unread uint
+	for pubKey, count := range bySender {
+		muted, err := w.isMuted(channelID, []byte(pubKey))
+		if err != nil {
+			return 0, errors.WithMessagef(parentErr, "%+v", err)
+		} else if !muted {
+			unread += count
+		}
+	}
+
+	return unread, nil
+}
+
+// isUnreadTxn returns true if the message counts as unread according to the
+// marker. Hidden messages, messages from muted senders, and messages without
+// text are never counted. Returns false if msg is nil. Whether the sender is
+// muted is read as part of the Transaction, which must include the
+// mutedUserStoreName object store.
+func (w *wasmModel) isUnreadTxn(txn *impl.Transaction,
+	marker *impl.ReadMarker, msg *Message) (bool, error) {
+	if !countsAsUnread(marker, msg) {
+		return false, nil
+	}
+	muted, err := w.isMutedTxn(txn, msg.ChannelID, msg.Pubkey)
+	return !muted, err
+}
+
+// countsAsUnread returns true if the message counts as unread according to the
+// marker, without checking whether its sender is muted. Returns false if msg
+// is nil.
+func countsAsUnread(marker *impl.ReadMarker, msg *Message) bool {
+	return msg != nil && !msg.Hidden &&
+		isSearchable(channels.MessageType(msg.Type)) &&
+		!marker.IsRead(msg.Timestamp)
+}
@@ -0,0 +1,298 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"syscall/js"
+	"time"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/client/v4/channels"
+	"gitlab.com/elixxir/crypto/message"
+	"gitlab.com/elixxir/wasm-utils/utils"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	wChannels "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/channels"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/netTime"
+)
+
+// sweepInterval is the time between deletions of expired messages.
+const sweepInterval = 5 * time.Minute
+
+// SetRetentionPolicy sets the limits on the messages kept in the channel.
+// Messages outside the limits are deleted the next time the sweeper runs.
+// Pinned messages are not counted and are only deleted when their lease
+// expires. Setting an empty policy removes all limits.
+func (w *wasmModel) SetRetentionPolicy(
+	channelID *id.ID, policy wChannels.RetentionPolicy) error {
+	parentErr := errors.New("failed to SetRetentionPolicy")
+
+	if policy.MaxAge < 0 {
+		return errors.WithMessagef(parentErr,
+			"max age cannot be negative, received %s", policy.MaxAge)
+	}
+
+	key := w.blind(channelID.Marshal())
+	if policy == (wChannels.RetentionPolicy{}) {
+		err := impl.Delete(w.db, retentionStoreName, impl.EncodeBytes(key))
+		if err != nil {
+			return errors.WithMessagef(parentErr, "%+v", err)
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(RetentionPolicy{
+		ChannelID: key,
+		MaxAge:    policy.MaxAge,
+		MaxCount:  policy.MaxCount,
+		MaxBytes:  policy.MaxBytes,
+	})
+	if err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to marshal RetentionPolicy: %+v", err)
+	}
+	policyObj, err := utils.JsonToJS(data)
+	if err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to marshal RetentionPolicy: %+v", err)
+	}
+
+	_, err = impl.Put(w.db, retentionStoreName, policyObj)
+	if err != nil {
+		return errors.WithMessagef(parentErr, "%+v", err)
+	}
+	return nil
+}
+
+// runSweeper deletes expired messages and then repeats every interval. Each
+// sweep is passed to run so that it is serialized with the other changes to
+// the wasmModel. It never returns, so it must be run on its own goroutine.
+func (w *wasmModel) runSweeper(interval time.Duration, run func(fn func())) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		run(func() {
+			deleted, err := w.sweep(netTime.Now())
+			if err != nil {
+				jww.ERROR.Printf("Failed to delete expired messages: %+v", err)
+			} else if deleted > 0 {
+				jww.DEBUG.Printf("Deleted %d expired messages", deleted)
+			}
+		})
+
+		<-ticker.C
+	}
+}
+
+// storedMessage is a Message as it is stored, with its size in bytes.
+type storedMessage struct {
+	value js.Value
+	msg   *Message
+	size  uint64
+}
+
+// sweep deletes every message whose lease elapsed before now, and every
+// message outside the retention policy of its channel. Returns the number of
+// deleted messages.
+//
+// Expired messages are found with messageStoreExpiryIndex and only the
+// channels with a retention policy are read, so the rest of the messages are
+// never loaded.
+func (w *wasmModel) sweep(now time.Time) (int, error) {
+	parentErr := errors.New("failed to sweep")
+
+	keyRange, err := idb.NewKeyRangeUpperBound(
+		js.ValueOf(now.UnixMilli()), false)
+	if err != nil {
+		return 0, errors.WithMessagef(parentErr,
+			"Unable to NewKeyRangeUpperBound: %+v", err)
+	}
+	expired, err := w.getMessageRange(
+		messageStoreExpiryIndex, keyRange, idb.CursorNext)
+	if err != nil {
+		return 0, errors.WithMessagef(parentErr,
+			"Unable to get expired messages: %+v", err)
+	}
+
+	policies, err := w.getRetentionPolicies()
+	if err != nil {
+		return 0, errors.WithMessagef(parentErr, "%+v", err)
+	}
+	for _, policy := range policies {
+		retained, err := w.getRetainedMessages(policy.ChannelID, now)
+		if err != nil {
+			return 0, errors.WithMessagef(parentErr, "%+v", err)
+		}
+		expired = append(expired, policy.exceeded(retained, now)...)
+	}
+
+	for i, stored := range expired {
+		msg, err := w.openMessage(stored.value)
+		if err != nil {
+			return i, errors.WithMessagef(parentErr, "%+v", err)
+		}
+		messageID, err := message.UnmarshalID(msg.MessageID)
+		if err != nil {
+			return i, errors.WithMessagef(parentErr,
+				"Unable to unmarshal ID of Message %d: %+v", msg.ID, err)
+		}
+		if err = w.deleteMessage(messageID, msg); err != nil {
+			return i, errors.WithMessagef(parentErr, "%+v", err)
+		}
+	}
+
+	return len(expired), nil
+}
+
+// getRetainedMessages returns the messages in the channel that are subject to
+// its retention policy, ordered from newest to oldest. Pinned messages and
+// messages whose lease elapsed before now are excluded. The channel ID is as
+// stored, so it is blinded if all sensitive fields are encrypted.
+func (w *wasmModel) getRetainedMessages(
+	channelID []byte, now time.Time) ([]storedMessage, error) {
+	key := impl.EncodeBytes(channelID)
+	keyRange, err := idb.NewKeyRangeBound(
+		js.ValueOf([]any{key, math.Inf(-1)}),
+		js.ValueOf([]any{key, math.Inf(1)}), false, false)
+	if err != nil {
+		return nil, errors.Errorf("Unable to NewKeyRangeBound: %+v", err)
+	}
+	msgs, err := w.getMessageRange(
+		messageStoreChannelTimestampIndex, keyRange, idb.CursorPrevious)
+	if err != nil {
+		return nil, errors.Errorf(
+			"Unable to get messages of channel: %+v", err)
+	}
+
+	retained := msgs[:0]
+	for _, stored := range msgs {
+		if !stored.msg.Pinned && !leaseExpired(stored.msg, now) {
+			retained = append(retained, stored)
+		}
+	}
+	return retained, nil
+}
+
+// getMessageRange returns the stored messages in the key range of the given
+// index, in the order of the cursor direction.
+func (w *wasmModel) getMessageRange(indexName string, keyRange *idb.KeyRange,
+	direction idb.CursorDirection) ([]storedMessage, error) {
+	txn, err := w.db.Transaction(idb.TransactionReadOnly, messageStoreName)
+	if err != nil {
+		return nil, errors.Errorf("Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(messageStoreName)
+	if err != nil {
+		return nil, errors.Errorf("Unable to get ObjectStore: %+v", err)
+	}
+	index, err := store.Index(indexName)
+	if err != nil {
+		return nil, errors.Errorf("Unable to get Index: %+v", err)
+	}
+	cursorRequest, err := index.OpenCursorRange(keyRange, direction)
+	if err != nil {
+		return nil, errors.Errorf("Unable to open Cursor: %+v", err)
+	}
+
+	var msgs []storedMessage
+	err = impl.SendCursorRequest(cursorRequest,
+		func(c *idb.CursorWithValue) error {
+			value, err := c.Value()
+			if err != nil {
+				return err
+			}
+			msg, err := valueToMessage(value)
+			if err != nil {
+				return err
+			}
+			msgs = append(msgs, storedMessage{
+				value: value,
+				msg:   msg,
+				size:  uint64(len(utils.JsToJson(value))),
+			})
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
+
+// getRetentionPolicies returns every RetentionPolicy keyed on the stored
+// channel ID.
+func (w *wasmModel) getRetentionPolicies() (
+	map[string]*RetentionPolicy, error) {
+	results, err := impl.GetAll(w.db, retentionStoreName)
+	if err != nil {
+		return nil, err
+	}
+
+	policies := make(map[string]*RetentionPolicy, len(results))
+	for _, result := range results {
+		policy := &RetentionPolicy{}
+		err = json.Unmarshal([]byte(utils.JsToJson(result)), policy)
+		if err != nil {
+			return nil, errors.Errorf(
+				"Unable to unmarshal RetentionPolicy: %+v", err)
+		}
+		policies[string(policy.ChannelID)] = policy
+	}
+	return policies, nil
+}
+
+// exceeded returns the messages in the channel that are outside the limits of
+// the policy. The messages must be ordered from newest to oldest, since the
+// newest messages are kept first.
+func (p *RetentionPolicy) exceeded(
+	msgs []storedMessage, now time.Time) []storedMessage {
+	var exceeded []storedMessage
+	var count uint
+	var size uint64
+	for _, stored := range msgs {
+		count++
+		size += stored.size
+		if (p.MaxAge > 0 && now.Sub(stored.msg.Timestamp) > p.MaxAge) ||
+			(p.MaxCount > 0 && count > p.MaxCount) ||
+			(p.MaxBytes > 0 && size > p.MaxBytes) {
+			exceeded = append(exceeded, stored)
+		}
+	}
+	return exceeded
+}
+
+// leaseExpired returns true if the lease of the message elapsed before now.
+// Messages without a lease or with a lease of [channels.ValidForever] never
+// expire.
+func leaseExpired(msg *Message, now time.Time) bool {
+	expiry := leaseExpiry(msg)
+	return expiry != 0 && now.UnixMilli() >= expiry
+}
+
+// leaseExpiry returns the time, in Unix milliseconds, that the lease of the
+// message elapses. Returns 0 if the message has no lease or a lease of
+// [channels.ValidForever].
+func leaseExpiry(msg *Message) int64 {
+	if len(msg.Lease) == 0 {
+		return 0
+	}
+	lease, err := strconv.ParseInt(msg.Lease, 10, 64)
+	if err != nil || lease <= 0 ||
+		time.Duration(lease) == channels.ValidForever {
+		return 0
+	}
+	return msg.Timestamp.Add(time.Duration(lease)).UnixMilli()
+}
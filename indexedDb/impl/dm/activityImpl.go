@@ -0,0 +1,366 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package main
+
+import (
+	"encoding/json"
+	"syscall/js"
+	"time"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/client/v4/dm"
+	"gitlab.com/elixxir/wasm-utils/utils"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	wDm "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/dm"
+)
+
+// previewLength is the maximum number of characters of message text stored as
+// the preview of a Conversation.
+const previewLength = 100
+
+// GetConversationsByActivity returns up to limit conversations ordered from
+// most to least recently active, with the preview of their most recent
+// message. Conversations are ordered by last activity, to the millisecond, and
+// then by public key. Only conversations ordered after the cursor are
+// returned; pass nil to start with the most recently active.
+//
+// To page through the conversations, call GetConversationsByActivity again
+// with the last activity and public key of the last conversation in the
+// previous result.
+func (w *wasmModel) GetConversationsByActivity(limit int,
+	cursor *wDm.ConversationCursor) ([]wDm.ConversationSummary, error) {
+	parentErr := errors.New(
+		"[DM indexedDB] failed to GetConversationsByActivity")
+
+	if limit <= 0 {
+		return nil, errors.WithMessagef(parentErr,
+			"limit must be greater than zero, received %d", limit)
+	}
+
+	results, err := w.getConversationsByActivity(limit, cursor)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr, "%+v", err)
+	}
+
+	conversations := make([]wDm.ConversationSummary, len(results))
+	for i, convo := range results {
+		preview := convo.Preview
+		if w.cipher != nil && preview != "" {
+			decrypted, err := w.cipher.Decrypt(preview)
+			if err != nil {
+				return nil, errors.WithMessagef(parentErr,
+					"Unable to decrypt preview: %+v", err)
+			}
+			preview = string(decrypted)
+		}
+
+		conversations[i] = wDm.ConversationSummary{
+			ModelConversation: toModelConversation(convo),
+			LastMessageUUID:   convo.LastMessageUUID,
+			LastActivity:      convo.LastActivity,
+			Preview:           preview,
+		}
+	}
+
+	return conversations, nil
+}
+
+// streamConversations calls write with each page of up to pageSize
+// conversations, ordered from most to least recently active. Each page is read
+// from the activity index after the last conversation of the previous page, so
+// only one page is held at once. Stops and returns the error if write returns
+// one.
+func (w *wasmModel) streamConversations(
+	pageSize int, write func(page []dm.ModelConversation) error) error {
+	var cursor *wDm.ConversationCursor
+	for {
+		results, err := w.getConversationsByActivity(pageSize, cursor)
+		if err != nil {
+			return errors.WithMessage(err, "failed to stream Conversations")
+		} else if len(results) == 0 {
+			return nil
+		}
+
+		page := make([]dm.ModelConversation, len(results))
+		for i := range results {
+			page[i] = toModelConversation(results[i])
+		}
+		if err = write(page); err != nil {
+			return err
+		}
+
+		if len(results) < pageSize {
+			return nil
+		}
+		last := results[len(results)-1]
+		cursor = &wDm.ConversationCursor{
+			LastActivity: last.LastActivity,
+			PubKey:       last.Pubkey,
+		}
+	}
+}
+
+// getConversationsByActivity returns up to limit conversations ordered after
+// the cursor, from most to least recently active. If limit is zero, all
+// conversations are returned. If cursor is nil, conversations are returned
+// from the most recently active.
+func (w *wasmModel) getConversationsByActivity(
+	limit int, cursor *wDm.ConversationCursor) ([]*Conversation, error) {
+	// Prepare the Transaction
+	txn, err := w.db.Transaction(
+		idb.TransactionReadOnly, conversationStoreName)
+	if err != nil {
+		return nil, errors.Errorf("Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(conversationStoreName)
+	if err != nil {
+		return nil, errors.Errorf("Unable to get ObjectStore: %+v", err)
+	}
+	index, err := store.Index(conversationStoreActivityIndex)
+	if err != nil {
+		return nil, errors.Errorf("Unable to get Index: %+v", err)
+	}
+
+	// Set up the operation
+	var cursorRequest *idb.CursorWithValueRequest
+	if cursor == nil {
+		cursorRequest, err = index.OpenCursor(idb.CursorPrevious)
+	} else {
+		var keyRange *idb.KeyRange
+		keyRange, err = idb.NewKeyRangeUpperBound(js.ValueOf([]any{
+			cursor.LastActivity.UnixMilli(), w.indexKey(cursor.PubKey)}),
+			true)
+		if err != nil {
+			return nil, errors.Errorf(
+				"Unable to NewKeyRangeUpperBound: %+v", err)
+		}
+		cursorRequest, err = index.OpenCursorRange(keyRange, idb.CursorPrevious)
+	}
+	if err != nil {
+		return nil, errors.Errorf("Unable to open Cursor: %+v", err)
+	}
+
+	// Perform the operation
+	conversations := make([]*Conversation, 0, limit)
+	err = impl.SendCursorRequest(cursorRequest,
+		func(c *idb.CursorWithValue) error {
+			value, err := c.Value()
+			if err != nil {
+				return err
+			}
+			convo, err := w.openConversation(value)
+			if err != nil {
+				return err
+			}
+			conversations = append(conversations, convo)
+			if limit > 0 && len(conversations) >= limit {
+				return idb.ErrCursorStopIter
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, errors.Errorf("Unable to get Conversation data: %+v", err)
+	}
+
+	return conversations, nil
+}
+
+// activityTimeValue is the [impl.RewriteStore] function that sets the activity
+// time of a Conversation stored before the activity time existed. Returns
+// js.Undefined if the Conversation does not need to be rewritten.
+func activityTimeValue(convoObj js.Value) (js.Value, error) {
+	var convo Conversation
+	err := json.Unmarshal([]byte(utils.JsToJson(convoObj)), &convo)
+	if err != nil {
+		return js.Undefined(), err
+	} else if convo.ActivityTime == convo.LastActivity.UnixMilli() {
+		return js.Undefined(), nil
+	}
+
+	// The last activity is not a sensitive field, so the stored record is
+	// modified without decrypting it
+	convo.ActivityTime = convo.LastActivity.UnixMilli()
+	data, err := json.Marshal(convo)
+	if err != nil {
+		return js.Undefined(), err
+	}
+	return utils.JsonToJS(data)
+}
+
+// refreshActivityFor finds the most recent message of the Conversation again
+// if the given message was modified or deleted and was, or now is, the most
+// recent one. Errors are logged since they must not fail the change to the
+// message.
+func (w *wasmModel) refreshActivityFor(msg *Message) {
+	convo, err := w.getConversation(msg.ConversationPubKey)
+	if err == nil && (msg.ID == convo.LastMessageUUID ||
+		msg.Timestamp.After(convo.LastActivity)) {
+		err = w.refreshActivity(convo)
+	}
+	if err != nil {
+		jww.ERROR.Printf(
+			"[DM indexedDB] Failed to update conversation activity: %+v", err)
+	}
+}
+
+// refreshActivity finds the most recent message in the Conversation and stores
+// it as the last message. If there are no messages, the last message is
+// cleared but the last activity is kept.
+func (w *wasmModel) refreshActivity(convo *Conversation) error {
+	latest, err := w.getLatestMessage(convo.Pubkey)
+	if err != nil {
+		return err
+	} else if latest == nil {
+		if convo.LastMessageUUID == 0 {
+			return nil
+		}
+		convo.LastMessageUUID = 0
+		convo.Preview = ""
+		return w.upsertConversation(convo)
+	}
+
+	mType := dm.MessageType(latest.Type)
+	text := latest.Text
+	if w.cipher != nil && isSearchable(mType) {
+		decrypted, err := w.cipher.Decrypt(latest.Text)
+		if err != nil {
+			return errors.Errorf(
+				"Unable to decrypt Message %d: %+v", latest.ID, err)
+		}
+		text = string(decrypted)
+	}
+
+	err = w.setActivity(convo, latest.ID, latest.Timestamp, mType, text)
+	if err != nil {
+		return err
+	}
+	return w.upsertConversation(convo)
+}
+
+// setActivity sets the last message of the Conversation. The preview is
+// encrypted if the database is encrypted.
+func (w *wasmModel) setActivity(convo *Conversation, uuid uint64,
+	timestamp time.Time, mType dm.MessageType, text string) error {
+	convo.LastMessageUUID = uuid
+	convo.LastActivity = timestamp
+	convo.Preview = ""
+
+	if !isSearchable(mType) || text == "" {
+		return nil
+	}
+
+	preview := []rune(text)
+	if len(preview) > previewLength {
+		preview = preview[:previewLength]
+	}
+	convo.Preview = string(preview)
+	if w.cipher != nil {
+		var err error
+		convo.Preview, err = w.cipher.Encrypt([]byte(convo.Preview))
+		if err != nil {
+			return errors.Errorf("Unable to encrypt preview: %+v", err)
+		}
+	}
+
+	return nil
+}
+
+// getLatestMessage returns the Message in the conversation with the newest
+// timestamp. Returns nil if the conversation has no messages.
+func (w *wasmModel) getLatestMessage(partnerKey []byte) (*Message, error) {
+	parentErr := errors.New("[DM indexedDB] failed to getLatestMessage")
+
+	// Prepare the Transaction
+	txn, err := w.db.Transaction(idb.TransactionReadOnly, messageStoreName)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(messageStoreName)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to get ObjectStore: %+v", err)
+	}
+	index, err := store.Index(messageStoreConversationIndex)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to get Index: %+v", err)
+	}
+
+	// Set up the operation
+	keyRange, err := idb.NewKeyRangeOnly(w.indexKey(partnerKey))
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to NewKeyRangeOnly: %+v", err)
+	}
+	cursorRequest, err := index.OpenCursorRange(keyRange, idb.CursorNext)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to open Cursor: %+v", err)
+	}
+
+	// Perform the operation. Messages may arrive out of order, so every
+	// message in the conversation is inspected.
+	var latest *Message
+	err = impl.SendCursorRequest(cursorRequest,
+		func(cursor *idb.CursorWithValue) error {
+			value, err := cursor.Value()
+			if err != nil {
+				return err
+			}
+			msg, err := valueToMessage(value)
+			if err != nil {
+				return err
+			}
+			if latest == nil || !msg.Timestamp.Before(latest.Timestamp) {
+				latest = msg
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to get Message data: %+v", err)
+	}
+
+	return latest, nil
+}
+
+// rebuildActivity finds the most recent message of every Conversation.
+// Progress is reported periodically with the number of conversations processed
+// and the total. It is safe to call more than once.
+func (w *wasmModel) rebuildActivity(progress func(done, total uint)) error {
+	parentErr := errors.New("[DM indexedDB] failed to rebuildActivity")
+
+	results, err := impl.GetAll(w.db, conversationStoreName)
+	if err != nil {
+		return errors.WithMessagef(parentErr, "%+v", err)
+	}
+
+	total := uint(len(results))
+	for i, result := range results {
+		if i > 0 && i%impl.MigrationProgressInterval == 0 {
+			progress(uint(i), total)
+		}
+
+		convo, err := w.openConversation(result)
+		if err != nil {
+			return errors.WithMessagef(parentErr, "%+v", err)
+		}
+		if err = w.refreshActivity(convo); err != nil {
+			return errors.WithMessagef(parentErr, "%+v", err)
+		}
+	}
+
+	progress(total, total)
+	return nil
+}
@@ -10,16 +10,22 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"syscall/js"
 
+	"github.com/hack-pad/safejs"
 	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
 
 	"gitlab.com/elixxir/client/v4/dm"
 	"gitlab.com/elixxir/crypto/fastRNG"
 	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
+	"gitlab.com/elixxir/crypto/message"
 	"gitlab.com/elixxir/wasm-utils/exception"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
 	wDm "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/dm"
+	"gitlab.com/elixxir/xxdk-wasm/storage"
 	"gitlab.com/elixxir/xxdk-wasm/worker"
 	"gitlab.com/xx_network/crypto/csprng"
 )
@@ -30,7 +36,7 @@ var zeroUUID = []byte{0, 0, 0, 0, 0, 0, 0, 0}
 // send information between the event model and the main thread.
 type manager struct {
 	wtm   *worker.ThreadManager
-	model dm.EventModel
+	model *wasmModel
 }
 
 // registerCallbacks registers all the reception callbacks to manage messages
@@ -44,7 +50,21 @@ func (m *manager) registerCallbacks() {
 	m.wtm.RegisterCallback(wDm.UpdateSentStatusTag, m.updateSentStatusCB)
 	m.wtm.RegisterCallback(wDm.DeleteMessageTag, m.deleteMessageCB)
 	m.wtm.RegisterCallback(wDm.GetConversationTag, m.getConversationCB)
-	m.wtm.RegisterCallback(wDm.GetConversationsTag, m.getConversationsCB)
+	m.wtm.RegisterStreamCallback(wDm.GetConversationsTag, m.getConversationsCB)
+	m.wtm.RegisterCallback(wDm.GetConversationsByActivityTag,
+		m.getConversationsByActivityCB)
+	m.wtm.RegisterContextCallback(wDm.SearchMessagesTag, m.searchMessagesCB)
+	m.wtm.RegisterCallback(wDm.MarkReadTag, m.markReadCB)
+	m.wtm.RegisterCallback(wDm.GetUnreadCountTag, m.getUnreadCountCB)
+	m.wtm.RegisterCallback(wDm.GetUnreadSummaryTag, m.getUnreadSummaryCB)
+	m.wtm.RegisterCallback(wDm.GetReactionsTag, m.getReactionsCB)
+	m.wtm.RegisterCallback(wDm.GetThreadTag, m.getThreadCB)
+	m.wtm.RegisterCallback(wDm.GetReplyCountsTag, m.getReplyCountsCB)
+	m.wtm.RegisterCallback(wDm.GetChangesSinceTag, m.getChangesSinceCB)
+
+	// Live queries are made over a MessageChannel opened by the main thread
+	m.wtm.RegisterMessageChannelCallback(
+		wDm.LiveQueryKey, m.registerLiveQueryChannel)
 }
 
 // newWASMEventModelCB is the callback for NewWASMEventModel. Returns an empty
@@ -58,6 +78,12 @@ func (m *manager) newWASMEventModelCB(message []byte, reply func(message []byte)
 		return
 	}
 
+	// Apply the timeouts set on the main thread over the startup flags
+	if err = impl.SetTimeouts(msg.Timeouts); err != nil {
+		reply([]byte(err.Error()))
+		return
+	}
+
 	// Create new encryption cipher
 	rng := fastRNG.NewStreamGenerator(12, 1024, csprng.NewSystemRNG)
 	encryption, err := idbCrypto.NewCipherFromJSON(
@@ -68,8 +94,9 @@ func (m *manager) newWASMEventModelCB(message []byte, reply func(message []byte)
 		return
 	}
 
-	m.model, err = NewWASMEventModel(
-		msg.DatabaseName, encryption, m.eventUpdateCallback)
+	encryptAll := msg.EncryptionMode == storage.EncryptionAll
+	m.model, err = NewWASMEventModel(msg.DatabaseName, encryption,
+		encryptAll, msg.EvictionPolicy, m.eventUpdateCallback, m.wtm.Run)
 	if err != nil {
 		reply([]byte(err.Error()))
 		return
@@ -254,14 +281,356 @@ func (m *manager) getConversationCB(message []byte, reply func(message []byte))
 	reply(replyMessage)
 }
 
-// getConversationsCB is the callback for wasmModel.GetConversations.
-// Returns nil on error or the JSON marshalled list of Conversation on success.
-func (m *manager) getConversationsCB(_ []byte, reply func(message []byte)) {
-	result := m.model.GetConversations()
-	replyMessage, err := json.Marshal(result)
+// getConversationsCB is the callback for wasmModel.GetConversations. Streams
+// the conversations as JSON marshalled lists of up to
+// wDm.ConversationsChunkSize dm.ModelConversation, reading each chunk from
+// the database only once the previous one is sent.
+func (m *manager) getConversationsCB(
+	_ context.Context, _ []byte, w *worker.StreamWriter) {
+	err := m.model.streamConversations(wDm.ConversationsChunkSize,
+		func(page []dm.ModelConversation) error {
+			chunk, err := json.Marshal(page)
+			if err != nil {
+				return errors.Errorf("[DM] Could not JSON marshal %T for "+
+					"GetConversations: %+v", page, err)
+			}
+			return w.Write(chunk)
+		})
+
+	if err = w.Close(err); err != nil {
+		jww.ERROR.Printf("[DM] Failed to close stream for "+
+			"GetConversations: %+v", err)
+	}
+}
+
+// getConversationsByActivityCB is the callback for
+// wasmModel.GetConversationsByActivity. Returns JSON marshalled
+// dm.GetConversationsByActivityReply. If an error occurs, then Error will be
+// set with the error message. Otherwise, Conversations will be set.
+func (m *manager) getConversationsByActivityCB(
+	message []byte, reply func(message []byte)) {
+	var replyMsg wDm.GetConversationsByActivityReply
+	defer func() {
+		if replyMessage, err := json.Marshal(replyMsg); err != nil {
+			exception.Throwf("[DM] Failed to JSON marshal %T for "+
+				"GetConversationsByActivity: %+v", replyMsg, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	var msg wDm.GetConversationsByActivityMessage
+	err := json.Unmarshal(message, &msg)
 	if err != nil {
-		exception.Throwf("[DM] Could not JSON marshal %T for "+
-			"GetConversations: %+v", result, err)
+		replyMsg.Error = errors.Errorf("failed to JSON unmarshal %T from "+
+			"main thread: %+v", msg, err).Error()
+		return
+	}
+
+	conversations, err := m.model.GetConversationsByActivity(
+		msg.Limit, msg.Cursor)
+	if err != nil {
+		replyMsg.Error = err.Error()
+	} else {
+		replyMsg.Conversations = conversations
+	}
+}
+
+// searchMessagesCB is the callback for wasmModel.SearchMessages. Returns JSON
+// marshalled dm.SearchMessagesReply. If an error occurs, then Error will be set
+// with the error message. Otherwise, UUIDs will be set.
+func (m *manager) searchMessagesCB(
+	ctx context.Context, message []byte, reply func(message []byte)) {
+	var replyMsg wDm.SearchMessagesReply
+	defer func() {
+		if replyMessage, err := json.Marshal(replyMsg); err != nil {
+			exception.Throwf("[DM] Failed to JSON marshal %T for "+
+				"SearchMessages: %+v", replyMsg, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	var msg wDm.SearchMessagesMessage
+	err := json.Unmarshal(message, &msg)
+	if err != nil {
+		replyMsg.Error = errors.Errorf("failed to JSON unmarshal %T from "+
+			"main thread: %+v", msg, err).Error()
+		return
+	}
+
+	uuids, err := m.model.SearchMessages(
+		ctx, msg.Query, msg.PartnerKey, msg.Limit)
+	if err != nil {
+		replyMsg.Error = err.Error()
+	} else {
+		replyMsg.UUIDs = uuids
+	}
+}
+
+// markReadCB is the callback for wasmModel.MarkRead. Returns an empty slice on
+// success or an error message on failure.
+func (m *manager) markReadCB(message []byte, reply func(message []byte)) {
+	var uuid uint64
+	err := json.Unmarshal(message, &uuid)
+	if err != nil {
+		reply([]byte(errors.Errorf("failed to JSON unmarshal %T from main "+
+			"thread: %+v", uuid, err).Error()))
+		return
+	}
+
+	if err = m.model.MarkRead(uuid); err != nil {
+		reply([]byte(err.Error()))
+		return
+	}
+
+	reply(nil)
+}
+
+// getUnreadCountCB is the callback for wasmModel.GetUnreadCount. Returns JSON
+// marshalled dm.GetUnreadCountReply. If an error occurs, then Error will be
+// set with the error message. Otherwise, Unread will be set.
+func (m *manager) getUnreadCountCB(message []byte, reply func(message []byte)) {
+	var replyMsg wDm.GetUnreadCountReply
+	defer func() {
+		if replyMessage, err := json.Marshal(replyMsg); err != nil {
+			exception.Throwf("[DM] Failed to JSON marshal %T for "+
+				"GetUnreadCount: %+v", replyMsg, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	unread, err := m.model.GetUnreadCount(message)
+	if err != nil {
+		replyMsg.Error = err.Error()
+	} else {
+		replyMsg.Unread = unread
+	}
+}
+
+// getUnreadSummaryCB is the callback for wasmModel.GetUnreadSummary. Returns
+// JSON marshalled dm.GetUnreadSummaryReply. If an error occurs, then Error will
+// be set with the error message. Otherwise, Summary will be set.
+func (m *manager) getUnreadSummaryCB(_ []byte, reply func(message []byte)) {
+	var replyMsg wDm.GetUnreadSummaryReply
+	defer func() {
+		if replyMessage, err := json.Marshal(replyMsg); err != nil {
+			exception.Throwf("[DM] Failed to JSON marshal %T for "+
+				"GetUnreadSummary: %+v", replyMsg, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	summary, err := m.model.GetUnreadSummary()
+	if err != nil {
+		replyMsg.Error = err.Error()
+	} else {
+		replyMsg.Summary = summary
+	}
+}
+
+// getReactionsCB is the callback for wasmModel.GetReactions. Returns JSON
+// marshalled dm.GetReactionsReply. If an error occurs, then Error will be set
+// with the error message. Otherwise, Reactions will be set.
+func (m *manager) getReactionsCB(message []byte, reply func(message []byte)) {
+	var replyMsg wDm.GetReactionsReply
+	defer func() {
+		if replyMessage, err := json.Marshal(replyMsg); err != nil {
+			exception.Throwf("[DM] Failed to JSON marshal %T for "+
+				"GetReactions: %+v", replyMsg, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	var msg wDm.GetReactionsMessage
+	err := json.Unmarshal(message, &msg)
+	if err != nil {
+		replyMsg.Error = errors.Errorf("failed to JSON unmarshal %T from "+
+			"main thread: %+v", msg, err).Error()
+		return
+	}
+
+	reactions, err := m.model.GetReactions(msg.MessageIDs, msg.Self)
+	if err != nil {
+		replyMsg.Error = err.Error()
+	} else {
+		replyMsg.Reactions = reactions
+	}
+}
+
+// getThreadCB is the callback for wasmModel.GetThread. Returns JSON marshalled
+// dm.GetThreadReply. If an error occurs, then Error will be set with the error
+// message. Otherwise, Thread will be set.
+func (m *manager) getThreadCB(message []byte, reply func(message []byte)) {
+	var replyMsg wDm.GetThreadReply
+	defer func() {
+		if replyMessage, err := json.Marshal(replyMsg); err != nil {
+			exception.Throwf("[DM] Failed to JSON marshal %T for "+
+				"GetThread: %+v", replyMsg, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	var msg wDm.GetThreadMessage
+	err := json.Unmarshal(message, &msg)
+	if err != nil {
+		replyMsg.Error = errors.Errorf("failed to JSON unmarshal %T from "+
+			"main thread: %+v", msg, err).Error()
+		return
+	}
+
+	thread, err := m.model.GetThread(msg.RootMessageID, msg.Limit, msg.Cursor)
+	if err != nil {
+		replyMsg.Error = err.Error()
+	} else {
+		replyMsg.Thread = thread
+	}
+}
+
+// getReplyCountsCB is the callback for wasmModel.GetReplyCounts. Returns JSON
+// marshalled dm.GetReplyCountsReply. If an error occurs, then Error will be set
+// with the error message. Otherwise, ReplyCounts will be set.
+func (m *manager) getReplyCountsCB(
+	messageData []byte, reply func(message []byte)) {
+	var replyMsg wDm.GetReplyCountsReply
+	defer func() {
+		if replyMessage, err := json.Marshal(replyMsg); err != nil {
+			exception.Throwf("[DM] Failed to JSON marshal %T for "+
+				"GetReplyCounts: %+v", replyMsg, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	var messageIDs []message.ID
+	err := json.Unmarshal(messageData, &messageIDs)
+	if err != nil {
+		replyMsg.Error = errors.Errorf("failed to JSON unmarshal %T from "+
+			"main thread: %+v", messageIDs, err).Error()
+		return
+	}
+
+	counts, err := m.model.GetReplyCounts(messageIDs)
+	if err != nil {
+		replyMsg.Error = err.Error()
+	} else {
+		replyMsg.ReplyCounts = counts
+	}
+}
+
+// getChangesSinceCB is the callback for wasmModel.GetChangesSince. Returns
+// JSON marshalled dm.GetChangesSinceReply. If an error occurs, then Error
+// will be set with the error message. Otherwise, Changes will be set.
+func (m *manager) getChangesSinceCB(
+	message []byte, reply func(message []byte)) {
+	var replyMsg wDm.GetChangesSinceReply
+	defer func() {
+		if replyMessage, err := json.Marshal(replyMsg); err != nil {
+			exception.Throwf("[DM] Failed to JSON marshal %T for "+
+				"GetChangesSince: %+v", replyMsg, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	var msg wDm.GetChangesSinceMessage
+	err := json.Unmarshal(message, &msg)
+	if err != nil {
+		replyMsg.Error = errors.Errorf("failed to JSON unmarshal %T from "+
+			"main thread: %+v", msg, err).Error()
+		return
+	}
+
+	changes, err := m.model.GetChangesSince(msg.Seq, msg.Limit)
+	if err != nil {
+		replyMsg.Error = err.Error()
+	} else {
+		replyMsg.Changes = changes
+	}
+}
+
+// registerLiveQueryChannel is the callback for the live query MessageChannel
+// opened by the main thread. Subscriptions are made and their updates are
+// sent over it.
+func (m *manager) registerLiveQueryChannel(port js.Value, channelName string) {
+	mm, err := worker.NewMessageManager(
+		safejs.Safe(port), channelName+"-worker", worker.DefaultParams())
+	if err != nil {
+		jww.ERROR.Printf("[DM] Failed to create live query manager: %+v", err)
+		return
+	}
+
+	mm.RegisterCallback(wDm.SubscribeTag,
+		func(message []byte, reply func(message []byte)) {
+			m.subscribeCB(mm, message, reply)
+		})
+	mm.RegisterCallback(wDm.UnsubscribeTag, m.unsubscribeCB)
+}
+
+// subscribeCB is the callback for wasmModel.Subscribe. Updates to the query
+// are sent with the MessageManager of the live query MessageChannel. Returns
+// JSON marshalled dm.SubscribeReply. If an error occurs, then Error will
+// be set with the error message.
+func (m *manager) subscribeCB(mm *worker.MessageManager, message []byte,
+	reply func(message []byte)) {
+	var replyMsg wDm.SubscribeReply
+	defer func() {
+		if replyMessage, err := json.Marshal(replyMsg); err != nil {
+			exception.Throwf("[DM] Failed to JSON marshal %T for "+
+				"Subscribe: %+v", replyMsg, err)
+		} else {
+			reply(replyMessage)
+		}
+	}()
+
+	var msg wDm.SubscribeMessage
+	err := json.Unmarshal(message, &msg)
+	if err != nil {
+		replyMsg.Error = errors.Errorf("failed to JSON unmarshal %T from "+
+			"main thread: %+v", msg, err).Error()
+		return
+	} else if m.model == nil {
+		replyMsg.Error = "event model is not initialized"
+		return
+	}
+
+	err = m.model.Subscribe(msg.SubscriptionID, msg.Query,
+		func(update wDm.LiveQueryUpdate) {
+			data, err := json.Marshal(update)
+			if err != nil {
+				jww.ERROR.Printf("[DM] Failed to JSON marshal %T for live "+
+					"query %d: %+v", update, update.SubscriptionID, err)
+				return
+			}
+			err = mm.SendNoResponse(wDm.LiveQueryUpdateTag, data)
+			if err != nil {
+				jww.ERROR.Printf("[DM] Failed to send update for live query "+
+					"%d: %+v", update.SubscriptionID, err)
+			}
+		})
+	if err != nil {
+		replyMsg.Error = err.Error()
+	}
+}
+
+// unsubscribeCB is the callback for wasmModel.Unsubscribe. It does not return
+// a reply.
+func (m *manager) unsubscribeCB(message []byte, _ func([]byte)) {
+	var msg wDm.UnsubscribeMessage
+	err := json.Unmarshal(message, &msg)
+	if err != nil {
+		jww.ERROR.Printf("[DM] Could not JSON unmarshal %T for Unsubscribe "+
+			"from main thread: %+v", msg, err)
+		return
+	} else if m.model == nil {
+		return
+	}
+
+	if err = m.model.Unsubscribe(msg.SubscriptionID); err != nil {
+		jww.WARN.Printf("[DM] %+v", err)
 	}
-	reply(replyMessage)
 }
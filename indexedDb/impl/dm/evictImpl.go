@@ -0,0 +1,114 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package main
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/client/v4/bindings"
+	"gitlab.com/elixxir/client/v4/dm"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	"gitlab.com/elixxir/xxdk-wasm/storage"
+	"gitlab.com/xx_network/primitives/netTime"
+)
+
+// evict frees at least the given number of bytes by removing the text of the
+// oldest messages sent before the MinMessageAge of the policy. Returns the
+// number of bytes freed. It implements [impl.Evictor].
+func (w *wasmModel) evict(
+	policy storage.EvictionPolicy, bytes uint64) (uint64, error) {
+	parentErr := errors.New("[DM indexedDB] failed to evict messages")
+	cutoff := netTime.Now().Add(-policy.MinMessageAge)
+
+	results, err := impl.GetAll(w.db, messageStoreName)
+	if err != nil {
+		return 0, errors.WithMessagef(parentErr, "%+v", err)
+	}
+
+	// The stored records are modified without decrypting them
+	var msgs []*Message
+	for _, result := range results {
+		msg, err := valueToMessage(result)
+		if err != nil {
+			return 0, errors.WithMessagef(parentErr, "%+v", err)
+		}
+		if !msg.Evicted && msg.Timestamp.Before(cutoff) &&
+			isSearchable(dm.MessageType(msg.Type)) {
+			msgs = append(msgs, msg)
+		}
+	}
+	sort.SliceStable(msgs, func(i, j int) bool {
+		return msgs[i].Timestamp.Before(msgs[j].Timestamp)
+	})
+
+	// An empty text is encrypted if the database is encrypted, since every
+	// text is decrypted when read
+	var text string
+	if w.cipher != nil {
+		text, err = w.cipher.Encrypt([]byte{})
+		if err != nil {
+			return 0, errors.WithMessagef(parentErr, "%+v", err)
+		}
+	}
+
+	var freed uint64
+	for _, msg := range msgs {
+		if freed >= bytes {
+			break
+		}
+
+		// The partner key is needed for the event
+		partnerKey := msg.ConversationPubKey
+		if msg.Sensitive != nil {
+			var fields sensitiveMessageFields
+			err = w.decryptSensitive(msg.Sensitive, &fields)
+			if err != nil {
+				return freed, errors.WithMessagef(parentErr,
+					"Message %d: %+v", msg.ID, err)
+			}
+			partnerKey = fields.ConversationPubKey
+		}
+
+		size := uint64(len(msg.Text))
+		msg.Text = text
+		msg.Evicted = true
+		msgObj, err := storedMessageToValue(msg)
+		if err != nil {
+			return freed, errors.WithMessagef(parentErr, "%+v", err)
+		}
+		err = impl.RunTransaction(w.db, func(txn *impl.Transaction) error {
+			if _, err := txn.Put(messageStoreName, msgObj); err != nil {
+				return err
+			}
+			return w.changes.Append(txn, bindings.DmMessageReceived,
+				bindings.DmMessageReceivedJSON{
+					UUID:               msg.ID,
+					PubKey:             partnerKey,
+					MessageUpdate:      true,
+					ConversationUpdate: false,
+				})
+		}, messageStoreName, impl.ChangeLogStoreName)
+		if err != nil {
+			return freed, errors.WithMessagef(parentErr, "%+v", err)
+		}
+		freed += size
+
+		if err = w.search.Remove(msg.ID); err != nil {
+			jww.ERROR.Printf("[DM indexedDB] Failed to remove evicted "+
+				"Message %d from search index: %+v", msg.ID, err)
+		}
+		w.changes.Publish()
+	}
+
+	return freed, nil
+}
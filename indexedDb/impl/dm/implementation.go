@@ -11,9 +11,11 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/ed25519"
 	"encoding/json"
 	"strings"
+	"sync"
 	"syscall/js"
 	"time"
 
@@ -38,42 +40,62 @@ import (
 type wasmModel struct {
 	db            *idb.Database
 	cipher        idbCrypto.Cipher
+	search        *impl.SearchIndex
+	changes       *impl.ChangeLog
 	eventCallback eventUpdate
+
+	// blinder is set if all sensitive fields are encrypted. Indexed fields
+	// and keys then hold blinded values.
+	blinder *impl.Blinder
+
+	// liveQueries are the live queries registered by the main thread, keyed
+	// on their subscription ID.
+	liveQueries map[uint64]*liveQuery
+	liveMux     sync.Mutex
 }
 
-// upsertConversation is used for joining or updating a Conversation.
-func (w *wasmModel) upsertConversation(nickname string,
-	pubKey ed25519.PublicKey, partnerToken uint32, codeset uint8,
-	blockedTimestamp *time.Time) error {
+// upsertConversation is used for joining or updating a Conversation. The whole
+// Conversation is replaced, so an existing Conversation must be loaded and
+// modified to preserve its other fields.
+func (w *wasmModel) upsertConversation(convo *Conversation) error {
 	parentErr := errors.New("[DM indexedDB] failed to upsertConversation")
 
-	// Build object
-	newConvo := Conversation{
-		Pubkey:           pubKey,
-		Nickname:         nickname,
-		Token:            partnerToken,
-		CodesetVersion:   codeset,
-		BlockedTimestamp: blockedTimestamp,
+	convoObj, err := w.conversationToValue(convo)
+	if err != nil {
+		return errors.WithMessagef(parentErr, "%+v", err)
 	}
 
-	// Convert to jsObject
-	newConvoJson, err := json.Marshal(&newConvo)
+	_, err = impl.Put(w.db, conversationStoreName, convoObj)
 	if err != nil {
 		return errors.WithMessagef(parentErr,
-			"Unable to marshal Conversation: %+v", err)
+			"Unable to put Conversation: %+v", err)
 	}
-	convoObj, err := utils.JsonToJS(newConvoJson)
+	return nil
+}
+
+// conversationToValue converts the Conversation to the js.Value that is
+// stored, encrypting its sensitive fields if all sensitive fields are
+// encrypted.
+func (w *wasmModel) conversationToValue(convo *Conversation) (js.Value, error) {
+	convo.ActivityTime = convo.LastActivity.UnixMilli()
+	stored, err := w.sealConversation(convo)
 	if err != nil {
-		return errors.WithMessagef(parentErr,
-			"Unable to marshal Conversation: %+v", err)
+		return js.Undefined(), errors.Errorf(
+			"Unable to encrypt Conversation: %+v", err)
 	}
 
-	_, err = impl.Put(w.db, conversationStoreName, convoObj)
+	// Convert to jsObject
+	newConvoJson, err := json.Marshal(stored)
 	if err != nil {
-		return errors.WithMessagef(parentErr,
-			"Unable to put Conversation: %+v", err)
+		return js.Undefined(), errors.Errorf(
+			"Unable to marshal Conversation: %+v", err)
 	}
-	return nil
+	convoObj, err := utils.JsonToJS(newConvoJson)
+	if err != nil {
+		return js.Undefined(), errors.Errorf(
+			"Unable to marshal Conversation: %+v", err)
+	}
+	return convoObj, nil
 }
 
 // buildMessage is a private helper that converts typical dm.EventModel inputs
@@ -180,15 +202,24 @@ func (w *wasmModel) UpdateSentStatus(uuid uint64, messageID message.ID,
 	}
 
 	// Extract the existing Message and update the Status
-	newMessage, err := valueToMessage(currentMsg)
+	newMessage, err := w.openMessage(currentMsg)
 	if err != nil {
 		jww.ERROR.Printf("%+v", err)
 		return
 	}
+	before := *newMessage
 
 	newMessage.Status = uint8(status)
 	if !messageID.Equals(message.ID{}) {
 		newMessage.MessageID = messageID.Bytes()
+
+		// Replies to the new ID may have been received first
+		newMessage.ReplyCount, err = w.countReplies(newMessage.MessageID)
+		if err != nil {
+			jww.ERROR.Printf("%+v", errors.WithMessagef(parentErr,
+				"Unable to count replies: %+v", err))
+			return
+		}
 	}
 
 	if round.ID != 0 {
@@ -200,20 +231,16 @@ func (w *wasmModel) UpdateSentStatus(uuid uint64, messageID message.ID,
 	}
 
 	// Store the updated Message
-	_, err = w.upsertMessage(newMessage)
+	_, err = w.upsertMessage(&before, newMessage)
 	if err != nil {
 		jww.ERROR.Printf("%+v", errors.Wrap(parentErr, err.Error()))
 		return
 	}
+	w.refreshActivityFor(newMessage)
 
 	jww.TRACE.Printf("[DM indexedDB] Calling ReceiveMessageCB(%v, %v, t, f)",
 		uuid, newMessage.ConversationPubKey)
-	go w.eventCallback(bindings.DmMessageReceived, bindings.DmMessageReceivedJSON{
-		UUID:               uuid,
-		PubKey:             newMessage.ConversationPubKey,
-		MessageUpdate:      true,
-		ConversationUpdate: false,
-	})
+	w.changes.Publish()
 }
 
 // receiveWrapper is a higher-level wrapper of upsertMessage.
@@ -268,17 +295,8 @@ func (w *wasmModel) receiveWrapper(messageID message.ID, parentID *message.ID, n
 		}
 	}
 
-	// Update the conversation in storage, if needed
-	conversationUpdated := convoToUpdate != nil
-	if conversationUpdated {
-		err = w.upsertConversation(convoToUpdate.Nickname, convoToUpdate.Pubkey,
-			convoToUpdate.Token, convoToUpdate.CodesetVersion, convoToUpdate.BlockedTimestamp)
-		if err != nil {
-			return 0, err
-		}
-	}
-
 	// Handle encryption, if it is present
+	plaintext := data
 	if w.cipher != nil {
 		data, err = w.cipher.Encrypt([]byte(data))
 		if err != nil {
@@ -293,46 +311,160 @@ func (w *wasmModel) receiveWrapper(messageID message.ID, parentID *message.ID, n
 
 	msgToInsert := buildMessage(messageID.Bytes(), parentIdBytes, data,
 		partnerKey, senderKey, timestamp, round.ID, mType, codeset, status)
+	messageObj, err := w.prepareMessage(msgToInsert)
+	if err != nil {
+		return 0, err
+	}
 
-	uuid, err := w.upsertMessage(msgToInsert)
+	// The message is the most recent in the conversation unless a newer one
+	// has already been received
+	conversationUpdated := convoToUpdate != nil
+	if !conversationUpdated {
+		convoToUpdate = result
+	}
+	activityUpdated := convoToUpdate.LastMessageUUID == 0 ||
+		!timestamp.Before(convoToUpdate.LastActivity)
+
+	// Insert the message and update the conversation, if needed, at once, so
+	// that a conversation is never stored without its first message and its
+	// last message is never stale
+	var uuid uint64
+	err = impl.RunTransaction(w.db, func(txn *impl.Transaction) error {
+		msgIdObj, err := txn.Put(messageStoreName, messageObj)
+		if err != nil {
+			return errors.Errorf("Unable to put Message: %+v", err)
+		}
+		uuid = uint64(msgIdObj.Int())
+
+		if conversationUpdated || activityUpdated {
+			if activityUpdated {
+				err = w.setActivity(
+					convoToUpdate, uuid, timestamp, mType, plaintext)
+				if err != nil {
+					return err
+				}
+			}
+			convoObj, err := w.conversationToValue(convoToUpdate)
+			if err != nil {
+				return err
+			}
+			_, err = txn.Put(conversationStoreName, convoObj)
+			if err != nil {
+				return errors.Errorf("Unable to put Conversation: %+v", err)
+			}
+		}
+
+		err = w.changes.Append(txn, bindings.DmMessageReceived,
+			bindings.DmMessageReceivedJSON{
+				UUID:               uuid,
+				PubKey:             partnerKey,
+				MessageUpdate:      false,
+				ConversationUpdate: conversationUpdated,
+			})
+		if err != nil {
+			return err
+		}
+		err = w.updateUnreadTxn(txn, partnerKey, nil, msgToInsert)
+		if err != nil {
+			return err
+		}
+		return w.updateReplyCountTxn(txn, nil, msgToInsert)
+	}, conversationStoreName, messageStoreName, impl.ReadMarkerStoreName,
+		impl.ChangeLogStoreName)
 	if err != nil {
 		return 0, err
 	}
+	jww.DEBUG.Printf("[DM indexedDB] Successfully stored message %d", uuid)
+
+	if isSearchable(mType) {
+		err = w.search.Add(uuid, w.blind(partnerKey), timestamp, plaintext)
+		if err != nil {
+			jww.ERROR.Printf("[DM indexedDB] Failed to index message: %+v", err)
+		}
+	}
 
 	jww.TRACE.Printf("[DM indexedDB] Calling ReceiveMessageCB(%v, %v, f, %t)",
 		uuid, partnerKey, conversationUpdated)
-	go w.eventCallback(bindings.DmMessageReceived, bindings.DmMessageReceivedJSON{
-		UUID:               uuid,
-		PubKey:             partnerKey,
-		MessageUpdate:      false,
-		ConversationUpdate: conversationUpdated,
-	})
+	w.changes.Publish()
 	return uuid, nil
 }
 
 // upsertMessage is a helper function that will update an existing record
-// if Message.ID is specified. Otherwise, it will perform an insert.
-func (w *wasmModel) upsertMessage(msg *Message) (uint64, error) {
-	// Convert to jsObject
-	newMessageJson, err := json.Marshal(msg)
+// if Message.ID is specified. Otherwise, it will perform an insert. If it is
+// an update, before is the Message as it was stored, which is used to adjust
+// the unread count.
+func (w *wasmModel) upsertMessage(before, msg *Message) (uint64, error) {
+	messageObj, err := w.prepareMessage(msg)
 	if err != nil {
-		return 0, errors.Errorf("Unable to marshal Message: %+v", err)
-	}
-	messageObj, err := utils.JsonToJS(newMessageJson)
-	if err != nil {
-		return 0, errors.Errorf("Unable to marshal Message: %+v", err)
+		return 0, err
 	}
 
-	// Store message to database
-	msgIdObj, err := impl.Put(w.db, messageStoreName, messageObj)
+	// Store message to database along with its change
+	var uuid uint64
+	err = impl.RunTransaction(w.db, func(txn *impl.Transaction) error {
+		msgIdObj, err := txn.Put(messageStoreName, messageObj)
+		if err != nil {
+			return err
+		}
+		uuid = uint64(msgIdObj.Int())
+		err = w.changes.Append(txn, bindings.DmMessageReceived,
+			bindings.DmMessageReceivedJSON{
+				UUID:               uuid,
+				PubKey:             msg.ConversationPubKey,
+				MessageUpdate:      msg.ID != 0,
+				ConversationUpdate: false,
+			})
+		if err != nil {
+			return err
+		}
+		err = w.updateUnreadTxn(txn, msg.ConversationPubKey, before, msg)
+		if err != nil || msg.ID != 0 {
+			return err
+		}
+		return w.updateReplyCountTxn(txn, nil, msg)
+	}, conversationStoreName, messageStoreName, impl.ReadMarkerStoreName,
+		impl.ChangeLogStoreName)
 	if err != nil {
 		return 0, errors.Errorf("Unable to put Message: %+v\n%s",
-			err, newMessageJson)
+			err, utils.JsToJson(messageObj))
 	}
 
-	uuid := msgIdObj.Int()
 	jww.DEBUG.Printf("[DM indexedDB] Successfully stored message %d", uuid)
-	return uint64(uuid), nil
+	return uuid, nil
+}
+
+// prepareMessage converts the Message to the js.Value that is stored,
+// encrypting its sensitive fields if all sensitive fields are encrypted. The
+// reply count of a new Message is set first.
+func (w *wasmModel) prepareMessage(msg *Message) (js.Value, error) {
+	// Replies may be received before the message they reply to
+	if msg.ID == 0 {
+		replyCount, err := w.countReplies(msg.MessageID)
+		if err != nil {
+			return js.Undefined(), errors.Errorf(
+				"Unable to count replies: %+v", err)
+		}
+		msg.ReplyCount = replyCount
+	}
+
+	stored, err := w.sealMessage(msg)
+	if err != nil {
+		return js.Undefined(), errors.Errorf(
+			"Unable to encrypt Message: %+v", err)
+	}
+
+	// Convert to jsObject
+	newMessageJson, err := json.Marshal(stored)
+	if err != nil {
+		return js.Undefined(), errors.Errorf(
+			"Unable to marshal Message: %+v", err)
+	}
+	messageObj, err := utils.JsonToJS(newMessageJson)
+	if err != nil {
+		return js.Undefined(), errors.Errorf(
+			"Unable to marshal Message: %+v", err)
+	}
+	return messageObj, nil
 }
 
 // BlockSender silences messages sent by the indicated sender
@@ -368,9 +500,15 @@ func (w *wasmModel) setBlocked(senderPubKey ed25519.PublicKey, isBlocked bool) e
 		blockUser := netTime.Now()
 		timeBlocked = &blockUser
 	}
+	resultConvo.BlockedTimestamp = timeBlocked
+
+	err = w.upsertConversation(resultConvo)
+	if err != nil {
+		return err
+	}
 
-	return w.upsertConversation(resultConvo.Nickname, resultConvo.Pubkey,
-		resultConvo.Token, resultConvo.CodesetVersion, timeBlocked)
+	// Messages from blocked partners are not counted as unread
+	return w.recountUnread(senderPubKey)
 }
 
 // DeleteMessage deletes the message with the given message.ID belonging to
@@ -379,7 +517,7 @@ func (w *wasmModel) setBlocked(senderPubKey ed25519.PublicKey, isBlocked bool) e
 // false.
 func (w *wasmModel) DeleteMessage(messageID message.ID, senderPubKey ed25519.PublicKey) bool {
 	parentErr := "failed to DeleteMessage"
-	msgId := impl.EncodeBytes(messageID.Marshal())
+	msgId := w.indexKey(messageID.Marshal())
 
 	// Use the key to get the existing Message
 	currentMsg, err := impl.GetIndex(w.db, messageStoreName,
@@ -390,7 +528,7 @@ func (w *wasmModel) DeleteMessage(messageID message.ID, senderPubKey ed25519.Pub
 	}
 
 	// Convert the js.Value to a proper object
-	msgObj, err := valueToMessage(currentMsg)
+	msgObj, err := w.openMessage(currentMsg)
 	if err != nil {
 		jww.ERROR.Printf("%s: %+v", parentErr, err)
 		return false
@@ -402,17 +540,36 @@ func (w *wasmModel) DeleteMessage(messageID message.ID, senderPubKey ed25519.Pub
 		return false
 	}
 
-	// Perform the delete
-	err = impl.DeleteIndex(w.db, messageStoreName, messageStoreMessageIndex,
-		msgPkeyName, msgId)
+	// Perform the delete along with its change
+	err = impl.RunTransaction(w.db, func(txn *impl.Transaction) error {
+		err := txn.Delete(messageStoreName, js.ValueOf(msgObj.ID))
+		if err != nil {
+			return err
+		}
+		err = w.changes.Append(txn, bindings.DmMessageReceived,
+			bindings.DmMessageDeletedJSON{MessageID: messageID})
+		if err != nil {
+			return err
+		}
+		err = w.updateUnreadTxn(txn, msgObj.ConversationPubKey, msgObj, nil)
+		if err != nil {
+			return err
+		}
+		return w.updateReplyCountTxn(txn, msgObj, nil)
+	}, conversationStoreName, messageStoreName, impl.ReadMarkerStoreName,
+		impl.ChangeLogStoreName)
 	if err != nil {
 		jww.ERROR.Printf("%s: %+v", parentErr, err)
 		return false
 	}
+	w.refreshActivityFor(msgObj)
 
-	go w.eventCallback(bindings.DmMessageReceived, bindings.DmMessageDeletedJSON{
-		MessageID: messageID,
-	})
+	err = w.search.Remove(msgObj.ID)
+	if err != nil {
+		jww.ERROR.Printf("%s: %+v", parentErr, err)
+	}
+
+	w.changes.Publish()
 	return true
 }
 
@@ -425,35 +582,26 @@ func (w *wasmModel) GetConversation(senderPubKey ed25519.PublicKey) *dm.ModelCon
 		return nil
 	}
 
-	return &dm.ModelConversation{
-		Pubkey:           resultConvo.Pubkey,
-		Nickname:         resultConvo.Nickname,
-		Token:            resultConvo.Token,
-		CodesetVersion:   resultConvo.CodesetVersion,
-		BlockedTimestamp: resultConvo.BlockedTimestamp,
-	}
+	convo := toModelConversation(resultConvo)
+	return &convo
 }
 
 // getConversation is a helper that returns the Conversation with the given senderPubKey.
 func (w *wasmModel) getConversation(senderPubKey ed25519.PublicKey) (*Conversation, error) {
-	resultObj, err := impl.Get(w.db, conversationStoreName, impl.EncodeBytes(senderPubKey))
+	resultObj, err := impl.Get(w.db, conversationStoreName, w.indexKey(senderPubKey))
 	if err != nil {
 		return nil, err
 	}
 
-	resultConvo := &Conversation{}
-	err = json.Unmarshal([]byte(utils.JsToJson(resultObj)), resultConvo)
-	if err != nil {
-		return nil, err
-	}
-	return resultConvo, nil
+	return w.openConversation(resultObj)
 }
 
-// GetConversations returns any conversations held by the model (receiver).
+// GetConversations returns any conversations held by the model (receiver),
+// ordered from most to least recently active.
 func (w *wasmModel) GetConversations() []dm.ModelConversation {
 	parentErr := "failed to GetConversations"
 
-	results, err := impl.GetAll(w.db, conversationStoreName)
+	results, err := w.getConversationsByActivity(0, nil)
 	if err != nil {
 		jww.ERROR.Printf("%+v", errors.WithMessage(err, parentErr))
 		return nil
@@ -461,21 +609,247 @@ func (w *wasmModel) GetConversations() []dm.ModelConversation {
 
 	conversations := make([]dm.ModelConversation, len(results))
 	for i := range results {
-		resultConvo := &Conversation{}
-		err = json.Unmarshal([]byte(utils.JsToJson(results[i])), resultConvo)
+		conversations[i] = toModelConversation(results[i])
+	}
+	return conversations
+}
+
+// toModelConversation converts a stored Conversation into a
+// [dm.ModelConversation].
+func toModelConversation(convo *Conversation) dm.ModelConversation {
+	return dm.ModelConversation{
+		Pubkey:           convo.Pubkey,
+		Nickname:         convo.Nickname,
+		Token:            convo.Token,
+		CodesetVersion:   convo.CodesetVersion,
+		BlockedTimestamp: convo.BlockedTimestamp,
+	}
+}
+
+// SearchMessages returns the UUIDs of up to limit messages whose text contains
+// every word in the query, ordered from newest to oldest. If partnerKey is not
+// nil, only messages in the conversation with that partner are searched.
+func (w *wasmModel) SearchMessages(ctx context.Context, query string,
+	partnerKey ed25519.PublicKey, limit int) ([]uint64, error) {
+	return w.search.Search(ctx, query, w.blind(partnerKey), limit)
+}
+
+// GetChangesSince returns up to limit changes made after the change with the
+// given sequence number, ordered by sequence number. Changes older than
+// impl.ChangeLogMaxAge are not kept.
+func (w *wasmModel) GetChangesSince(seq uint64, limit int) (
+	[]impl.Change, error) {
+	return w.changes.GetChangesSince(seq, limit)
+}
+
+// rebuildSearchIndex adds every searchable message currently in storage to the
+// search index. Progress is reported periodically with the number of messages
+// processed and the total. It is safe to call more than once.
+func (w *wasmModel) rebuildSearchIndex(progress func(done, total uint)) error {
+	parentErr := errors.New("[DM indexedDB] failed to rebuildSearchIndex")
+
+	results, err := impl.GetAll(w.db, messageStoreName)
+	if err != nil {
+		return errors.WithMessagef(parentErr, "%+v", err)
+	}
+
+	total := uint(len(results))
+	var indexed int
+	for i, result := range results {
+		if i > 0 && i%impl.MigrationProgressInterval == 0 {
+			progress(uint(i), total)
+		}
+
+		msg, err := w.openMessage(result)
 		if err != nil {
-			jww.ERROR.Printf("%+v", errors.WithMessage(err, parentErr))
-			return nil
+			return errors.WithMessagef(parentErr,
+				"Unable to unmarshal Message: %+v", err)
 		}
-		conversations[i] = dm.ModelConversation{
-			Pubkey:           resultConvo.Pubkey,
-			Nickname:         resultConvo.Nickname,
-			Token:            resultConvo.Token,
-			CodesetVersion:   resultConvo.CodesetVersion,
-			BlockedTimestamp: resultConvo.BlockedTimestamp,
+		if !isSearchable(dm.MessageType(msg.Type)) {
+			continue
+		}
+
+		text := []byte(msg.Text)
+		if w.cipher != nil {
+			text, err = w.cipher.Decrypt(msg.Text)
+			if err != nil {
+				return errors.WithMessagef(parentErr,
+					"Unable to decrypt Message %d: %+v", msg.ID, err)
+			}
 		}
+
+		err = w.search.Add(msg.ID, w.blind(msg.ConversationPubKey),
+			msg.Timestamp, string(text))
+		if err != nil {
+			return errors.WithMessagef(parentErr, "%+v", err)
+		}
+		indexed++
 	}
-	return conversations
+
+	progress(total, total)
+	jww.INFO.Printf(
+		"[DM indexedDB] Added %d messages to the search index", indexed)
+	return nil
+}
+
+// isSearchable returns true if messages of the given type contain text that
+// should be added to the search index.
+func isSearchable(mType dm.MessageType) bool {
+	return mType == dm.TextType || mType == dm.ReplyType
+}
+
+// sensitiveMessageFields contains the fields of a Message that are encrypted
+// when all sensitive fields are encrypted. It is JSON marshalled and stored
+// encrypted in Message.Sensitive.
+type sensitiveMessageFields struct {
+	MessageID          []byte `json:"message_id"`
+	ConversationPubKey []byte `json:"conversation_pub_key"`
+	ParentMessageID    []byte `json:"parent_message_id"`
+	SenderPubKey       []byte `json:"sender_pub_key"`
+}
+
+// sensitiveConversationFields contains the fields of a Conversation that are
+// encrypted when all sensitive fields are encrypted. It is JSON marshalled and
+// stored encrypted in Conversation.Sensitive.
+type sensitiveConversationFields struct {
+	Pubkey   []byte `json:"pub_key"`
+	Nickname string `json:"nickname"`
+	Token    uint32 `json:"token"`
+}
+
+// blind returns the blinded value if all sensitive fields are encrypted.
+// Otherwise, the value is returned unchanged.
+func (w *wasmModel) blind(value []byte) []byte {
+	if w.blinder == nil {
+		return value
+	}
+	return w.blinder.Blind(value)
+}
+
+// indexKey returns the key used to look up the value in an index or as a
+// primary key.
+func (w *wasmModel) indexKey(value []byte) js.Value {
+	return impl.EncodeBytes(w.blind(value))
+}
+
+// sealMessage returns the Message as it is stored. If all sensitive fields are
+// encrypted, a copy is returned with the sensitive fields encrypted in
+// Sensitive and replaced with blinded values. Otherwise, the Message is
+// returned unchanged.
+func (w *wasmModel) sealMessage(msg *Message) (*Message, error) {
+	if w.blinder == nil {
+		return msg, nil
+	}
+
+	data, err := json.Marshal(sensitiveMessageFields{
+		MessageID:          msg.MessageID,
+		ConversationPubKey: msg.ConversationPubKey,
+		ParentMessageID:    msg.ParentMessageID,
+		SenderPubKey:       msg.SenderPubKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := *msg
+	sealed.Sensitive, err = impl.EncryptChunks(w.cipher, data)
+	if err != nil {
+		return nil, err
+	}
+	sealed.MessageID = w.blinder.Blind(msg.MessageID)
+	sealed.ConversationPubKey = w.blinder.Blind(msg.ConversationPubKey)
+	sealed.ParentMessageID = w.blinder.Blind(msg.ParentMessageID)
+	sealed.SenderPubKey = w.blinder.Blind(msg.SenderPubKey)
+	return &sealed, nil
+}
+
+// openMessage converts js.Value to Message and decrypts its sensitive
+// fields, if they are encrypted.
+func (w *wasmModel) openMessage(msgObj js.Value) (*Message, error) {
+	msg, err := valueToMessage(msgObj)
+	if err != nil || msg.Sensitive == nil {
+		return msg, err
+	}
+
+	var fields sensitiveMessageFields
+	if err = w.decryptSensitive(msg.Sensitive, &fields); err != nil {
+		return nil, errors.WithMessagef(err, "Message %d", msg.ID)
+	}
+
+	msg.MessageID = fields.MessageID
+	msg.ConversationPubKey = fields.ConversationPubKey
+	msg.ParentMessageID = fields.ParentMessageID
+	msg.SenderPubKey = fields.SenderPubKey
+	msg.Sensitive = nil
+	return msg, nil
+}
+
+// sealConversation returns the Conversation as it is stored. If all sensitive
+// fields are encrypted, a copy is returned with the sensitive fields encrypted
+// in Sensitive and the key replaced with a blinded value. Otherwise, the
+// Conversation is returned unchanged.
+func (w *wasmModel) sealConversation(
+	convo *Conversation) (*Conversation, error) {
+	if w.blinder == nil {
+		return convo, nil
+	}
+
+	data, err := json.Marshal(sensitiveConversationFields{
+		Pubkey:   convo.Pubkey,
+		Nickname: convo.Nickname,
+		Token:    convo.Token,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := *convo
+	sealed.Sensitive, err = impl.EncryptChunks(w.cipher, data)
+	if err != nil {
+		return nil, err
+	}
+	sealed.Pubkey = w.blinder.Blind(convo.Pubkey)
+	sealed.Nickname = ""
+	sealed.Token = 0
+	return &sealed, nil
+}
+
+// openConversation converts js.Value to Conversation and decrypts its
+// sensitive fields, if they are encrypted.
+func (w *wasmModel) openConversation(convoObj js.Value) (*Conversation, error) {
+	convo := &Conversation{}
+	err := json.Unmarshal([]byte(utils.JsToJson(convoObj)), convo)
+	if err != nil || convo.Sensitive == nil {
+		return convo, err
+	}
+
+	var fields sensitiveConversationFields
+	if err = w.decryptSensitive(convo.Sensitive, &fields); err != nil {
+		return nil, errors.WithMessage(err, "Conversation")
+	}
+
+	convo.Pubkey = fields.Pubkey
+	convo.Nickname = fields.Nickname
+	convo.Token = fields.Token
+	convo.Sensitive = nil
+	return convo, nil
+}
+
+// decryptSensitive decrypts the encrypted sensitive fields and JSON
+// unmarshalls them into fields.
+func (w *wasmModel) decryptSensitive(sensitive []string, fields any) error {
+	if w.cipher == nil {
+		return errors.New("cannot decrypt sensitive fields without a cipher")
+	}
+
+	data, err := impl.DecryptChunks(w.cipher, sensitive)
+	if err != nil {
+		return errors.Errorf("Unable to decrypt sensitive fields: %+v", err)
+	}
+	if err = json.Unmarshal(data, fields); err != nil {
+		return errors.Errorf("Unable to unmarshal sensitive fields: %+v", err)
+	}
+	return nil
 }
 
 // valueToMessage is a helper for converting js.Value to Message.
@@ -11,15 +11,22 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/ed25519"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/stretchr/testify/require"
+	"gitlab.com/elixxir/client/v4/bindings"
 	"gitlab.com/elixxir/client/v4/cmix/rounds"
 	"gitlab.com/elixxir/client/v4/dm"
+	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
 	"gitlab.com/elixxir/crypto/message"
 	"gitlab.com/elixxir/wasm-utils/utils"
 	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	wDm "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/dm"
+	"gitlab.com/xx_network/crypto/csprng"
 	"gitlab.com/xx_network/primitives/id"
 	"os"
 	"syscall/js"
@@ -38,7 +45,7 @@ func TestMain(m *testing.M) {
 
 // Test simple receive of a new message for a new conversation.
 func TestImpl_Receive(t *testing.T) {
-	m, err := newWASMModel("TestImpl_Receive", nil, dummyEU)
+	m, err := newWASMModel("TestImpl_Receive", nil, false, dummyEU)
 	if err != nil {
 		t.Fatal(err.Error())
 	}
@@ -90,7 +97,7 @@ func TestImpl_Receive(t *testing.T) {
 
 // Test happy path. Insert some conversations and check they exist.
 func TestImpl_GetConversations(t *testing.T) {
-	m, err := newWASMModel("TestImpl_GetConversations", nil, dummyEU)
+	m, err := newWASMModel("TestImpl_GetConversations", nil, false, dummyEU)
 	if err != nil {
 		t.Fatal(err.Error())
 	}
@@ -100,8 +107,12 @@ func TestImpl_GetConversations(t *testing.T) {
 	for i := 0; i < numTestConvo; i++ {
 		testBytes := []byte(fmt.Sprintf("%d", i))
 		testPubKey := ed25519.PublicKey(testBytes)
-		err = m.upsertConversation("test", testPubKey,
-			uint32(i), uint8(i), nil)
+		err = m.upsertConversation(&Conversation{
+			Pubkey:         testPubKey,
+			Nickname:       "test",
+			Token:          uint32(i),
+			CodesetVersion: uint8(i),
+		})
 		if err != nil {
 			t.Fatal(err.Error())
 		}
@@ -112,27 +123,70 @@ func TestImpl_GetConversations(t *testing.T) {
 		t.Fatalf("Expected %d convos, got %d", numTestConvo, len(results))
 	}
 
+	// Conversations with the same activity are ordered by descending public
+	// key, so they are returned in the reverse order they were inserted
 	for i, convo := range results {
-		if convo.Token != uint32(i) {
-			t.Fatalf("Expected %d convo token, got %d", i, convo.Token)
+		expected := numTestConvo - 1 - i
+		if convo.Token != uint32(expected) {
+			t.Fatalf("Expected %d convo token, got %d", expected, convo.Token)
 		}
-		if convo.CodesetVersion != uint8(i) {
+		if convo.CodesetVersion != uint8(expected) {
 			t.Fatalf("Expected %d convo codeset, got %d",
-				i, convo.CodesetVersion)
+				expected, convo.CodesetVersion)
 		}
 	}
 }
 
+// Tests that wasmModel.streamConversations writes every conversation in pages
+// of the given size, in the same order as wasmModel.GetConversations, and
+// stops at the first error returned by the writer.
+func TestWasmModel_streamConversations(t *testing.T) {
+	m, err := newWASMModel(
+		"TestWasmModel_streamConversations", nil, false, dummyEU)
+	require.NoError(t, err)
+
+	// Conversations with the same activity are paged by public key
+	start := time.Now().Round(0)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, m.upsertConversation(&Conversation{
+			Pubkey:       ed25519.PublicKey(fmt.Sprintf("%d", i)),
+			Nickname:     "test",
+			LastActivity: start.Add(time.Duration(i%3) * time.Minute),
+		}))
+	}
+
+	var pages int
+	var streamed []dm.ModelConversation
+	err = m.streamConversations(2, func(page []dm.ModelConversation) error {
+		pages++
+		streamed = append(streamed, page...)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, pages)
+	require.Equal(t, m.GetConversations(), streamed)
+
+	writeErr := errors.New("write failed")
+	pages = 0
+	err = m.streamConversations(2, func([]dm.ModelConversation) error {
+		pages++
+		return writeErr
+	})
+	require.ErrorIs(t, err, writeErr)
+	require.Equal(t, 1, pages)
+}
+
 // Test happy path toggling between blocked/unblocked in a Conversation.
 func TestWasmModel_BlockSender(t *testing.T) {
-	m, err := newWASMModel("TestWasmModel_BlockSender", nil, dummyEU)
+	m, err := newWASMModel("TestWasmModel_BlockSender", nil, false, dummyEU)
 	if err != nil {
 		t.Fatal(err.Error())
 	}
 
 	// Insert a test convo
 	testPubKey := ed25519.PublicKey{}
-	err = m.upsertConversation("test", testPubKey, 0, 0, nil)
+	err = m.upsertConversation(
+		&Conversation{Pubkey: testPubKey, Nickname: "test"})
 	if err != nil {
 		t.Fatal(err.Error())
 	}
@@ -160,7 +214,7 @@ func TestWasmModel_BlockSender(t *testing.T) {
 
 // Test failed and successful deletes
 func TestWasmModel_DeleteMessage(t *testing.T) {
-	m, err := newWASMModel("TestWasmModel_DeleteMessage", nil, dummyEU)
+	m, err := newWASMModel("TestWasmModel_DeleteMessage", nil, false, dummyEU)
 	if err != nil {
 		t.Fatal(err.Error())
 	}
@@ -181,7 +235,7 @@ func TestWasmModel_DeleteMessage(t *testing.T) {
 		Type:               5,
 		Round:              5,
 	}
-	_, err = m.upsertMessage(testMsg)
+	_, err = m.upsertMessage(nil, testMsg)
 	require.NoError(t, err)
 
 	// Non-matching pub key, should fail to delete
@@ -190,3 +244,520 @@ func TestWasmModel_DeleteMessage(t *testing.T) {
 	// Correct pub key, should have deleted
 	require.True(t, m.DeleteMessage(testMsgId, testBytes))
 }
+
+// Tests that wasmModel.SearchMessages finds text and reply messages within a
+// conversation and that deleted messages are removed from the index.
+func TestWasmModel_SearchMessages(t *testing.T) {
+	ctx := context.Background()
+	m, err := newWASMModel("TestWasmModel_SearchMessages", nil, false, dummyEU)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	partnerKey := ed25519.PublicKey("partner")
+	otherKey := ed25519.PublicKey("other")
+	start := time.Now().Round(0)
+
+	textID := message.DeriveChannelMessageID(&id.ID{1}, 1, []byte("text"))
+	textUUID := m.ReceiveText(textID, "nick", "Meet me at noon",
+		partnerKey, partnerKey, 0, 0, start, rounds.Round{ID: 1}, dm.Received)
+	require.NotZero(t, textUUID)
+
+	replyID := message.DeriveChannelMessageID(&id.ID{1}, 2, []byte("reply"))
+	replyUUID := m.ReceiveReply(replyID, textID, "nick", "noon works",
+		partnerKey, partnerKey, 0, 0, start.Add(time.Minute),
+		rounds.Round{ID: 2}, dm.Received)
+	require.NotZero(t, replyUUID)
+
+	otherID := message.DeriveChannelMessageID(&id.ID{1}, 3, []byte("other"))
+	otherUUID := m.ReceiveText(otherID, "nick", "noon?", otherKey, otherKey,
+		0, 0, start.Add(2*time.Minute), rounds.Round{ID: 3}, dm.Received)
+	require.NotZero(t, otherUUID)
+
+	results, err := m.SearchMessages(ctx, "NOON", partnerKey, 10)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{replyUUID, textUUID}, results)
+
+	results, err = m.SearchMessages(ctx, "noon", nil, 10)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{otherUUID, replyUUID, textUUID}, results)
+
+	require.True(t, m.DeleteMessage(replyID, partnerKey))
+	results, err = m.SearchMessages(ctx, "noon", partnerKey, 10)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{textUUID}, results)
+}
+
+// Tests that the unread count of a conversation only counts messages from the
+// partner, is updated as messages are received and deleted, is zero while the
+// partner is blocked, and is reset by wasmModel.MarkRead.
+func TestWasmModel_GetUnreadCount(t *testing.T) {
+	m, err := newWASMModel("TestWasmModel_GetUnreadCount", nil, false, dummyEU)
+	require.NoError(t, err)
+
+	partnerKey := ed25519.PublicKey("partner")
+	myKey := ed25519.PublicKey("me")
+	start := time.Now().Round(0)
+
+	receive := func(i int, senderKey ed25519.PublicKey) (uint64, message.ID) {
+		text := fmt.Sprintf("message %d", i)
+		msgID := message.DeriveChannelMessageID(&id.ID{1}, uint64(i),
+			[]byte(text))
+		uuid := m.ReceiveText(msgID, "nick", text, partnerKey, senderKey, 0,
+			0, start.Add(time.Duration(i)*time.Minute),
+			rounds.Round{ID: id.Round(i)}, dm.Received)
+		require.NotZero(t, uuid)
+		return uuid, msgID
+	}
+
+	receive(0, partnerKey)
+	second, _ := receive(1, partnerKey)
+	receive(2, myKey)
+	_, lastID := receive(3, partnerKey)
+
+	unread, err := m.GetUnreadCount(partnerKey)
+	require.NoError(t, err)
+	require.Equal(t, uint(3), unread)
+
+	// The new count is recorded with the message that changed it
+	changes, err := m.GetChangesSince(0, 100)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, len(changes), 2)
+	require.Equal(t,
+		bindings.DmMessageReceived, changes[len(changes)-2].EventType)
+	last := changes[len(changes)-1]
+	require.Equal(t, impl.UnreadCountEvent, last.EventType)
+	var count wDm.UnreadCount
+	require.NoError(t, json.Unmarshal(last.Data, &count))
+	require.Equal(t, uint(3), count.Unread)
+
+	require.NoError(t, m.MarkRead(second))
+	unread, err = m.GetUnreadCount(partnerKey)
+	require.NoError(t, err)
+	require.Equal(t, uint(1), unread)
+
+	// The new count is the last change in the change log
+	changes, err = m.GetChangesSince(0, 100)
+	require.NoError(t, err)
+	last = changes[len(changes)-1]
+	require.Equal(t, impl.UnreadCountEvent, last.EventType)
+	require.NoError(t, json.Unmarshal(last.Data, &count))
+	require.Equal(t, partnerKey, count.PubKey)
+	require.Equal(t, uint(1), count.Unread)
+
+	// Reading the count of a conversation without a marker does not create
+	// one
+	otherKey := ed25519.PublicKey("other")
+	unread, err = m.GetUnreadCount(otherKey)
+	require.NoError(t, err)
+	require.Zero(t, unread)
+	marker, err := impl.GetReadMarker(m.db, otherKey)
+	require.NoError(t, err)
+	require.Nil(t, marker)
+
+	summary, err := m.GetUnreadSummary()
+	require.NoError(t, err)
+	require.Len(t, summary, 1)
+	require.Equal(t, partnerKey, summary[0].PubKey)
+	require.Equal(t, second, summary[0].LastRead)
+	require.Equal(t, uint(1), summary[0].Unread)
+
+	// Blocked partners have no unread messages and are left out of the
+	// summary
+	m.BlockSender(partnerKey)
+	unread, err = m.GetUnreadCount(partnerKey)
+	require.NoError(t, err)
+	require.Zero(t, unread)
+	summary, err = m.GetUnreadSummary()
+	require.NoError(t, err)
+	require.Empty(t, summary)
+
+	m.UnblockSender(partnerKey)
+	unread, err = m.GetUnreadCount(partnerKey)
+	require.NoError(t, err)
+	require.Equal(t, uint(1), unread)
+
+	require.True(t, m.DeleteMessage(lastID, partnerKey))
+	unread, err = m.GetUnreadCount(partnerKey)
+	require.NoError(t, err)
+	require.Zero(t, unread)
+}
+
+// Tests that wasmModel.GetConversationsByActivity orders conversations by their
+// most recent message, including messages received out of order, pages with
+// a cursor, and updates the preview when the last message is deleted.
+func TestWasmModel_GetConversationsByActivity(t *testing.T) {
+	cipher, err := idbCrypto.NewCipher(
+		[]byte("testPass"), []byte("testSalt"), 128, csprng.NewSystemRNG())
+	require.NoError(t, err)
+	for _, c := range []idbCrypto.Cipher{nil, cipher} {
+		cs := ""
+		if c != nil {
+			cs = "_withCipher"
+		}
+		testString := "TestWasmModel_GetConversationsByActivity" + cs
+		t.Run(testString, func(t *testing.T) {
+			m, err := newWASMModel(testString, c, false, dummyEU)
+			require.NoError(t, err)
+
+			aliceKey := ed25519.PublicKey("alice")
+			bobKey := ed25519.PublicKey("bob")
+			start := time.Now().Round(0)
+
+			receive := func(i int, partnerKey ed25519.PublicKey, text string,
+				timestamp time.Time) message.ID {
+				msgID := message.DeriveChannelMessageID(&id.ID{1}, uint64(i),
+					[]byte(text))
+				uuid := m.ReceiveText(msgID, "nick", text, partnerKey,
+					partnerKey, 0, 0, timestamp, rounds.Round{ID: id.Round(i)},
+					dm.Received)
+				require.NotZero(t, uuid)
+				return msgID
+			}
+
+			receive(0, aliceKey, "first from alice", start)
+			receive(1, bobKey, "hello from bob", start.Add(time.Minute))
+			latestID := receive(2, aliceKey, "latest from alice",
+				start.Add(2*time.Minute))
+			// Older message received late does not replace the preview
+			receive(3, bobKey, "late from bob", start.Add(-time.Minute))
+
+			results, err := m.GetConversationsByActivity(10, nil)
+			require.NoError(t, err)
+			require.Len(t, results, 2)
+			require.Equal(t, []byte(aliceKey), results[0].Pubkey)
+			require.Equal(t, "latest from alice", results[0].Preview)
+			require.True(t,
+				start.Add(2*time.Minute).Equal(results[0].LastActivity))
+			require.Equal(t, []byte(bobKey), results[1].Pubkey)
+			require.Equal(t, "hello from bob", results[1].Preview)
+
+			// Page with the cursor of the first result
+			results, err = m.GetConversationsByActivity(
+				10, &wDm.ConversationCursor{
+					LastActivity: results[0].LastActivity,
+					PubKey:       results[0].Pubkey,
+				})
+			require.NoError(t, err)
+			require.Len(t, results, 1)
+			require.Equal(t, []byte(bobKey), results[0].Pubkey)
+
+			results, err = m.GetConversationsByActivity(1, nil)
+			require.NoError(t, err)
+			require.Len(t, results, 1)
+			require.Equal(t, []byte(aliceKey), results[0].Pubkey)
+
+			// Conversations last active at the same time are all paged through
+			carolKey := ed25519.PublicKey("carol")
+			daveKey := ed25519.PublicKey("dave")
+			receive(4, carolKey, "hello from carol", start.Add(time.Minute))
+			receive(5, daveKey, "hello from dave", start.Add(time.Minute))
+			var cursor *wDm.ConversationCursor
+			paged := make(map[string]bool)
+			for {
+				page, err := m.GetConversationsByActivity(1, cursor)
+				require.NoError(t, err)
+				if len(page) == 0 {
+					break
+				}
+				require.False(t, paged[string(page[0].Pubkey)])
+				paged[string(page[0].Pubkey)] = true
+				cursor = &wDm.ConversationCursor{
+					LastActivity: page[0].LastActivity,
+					PubKey:       page[0].Pubkey,
+				}
+			}
+			require.Len(t, paged, 4)
+
+			// Deleting the latest message falls back to the previous one
+			require.True(t, m.DeleteMessage(latestID, aliceKey))
+			results, err = m.GetConversationsByActivity(10, nil)
+			require.NoError(t, err)
+			require.Len(t, results, 4)
+			require.Equal(t, []byte(aliceKey), results[3].Pubkey)
+			require.Equal(t, "first from alice", results[3].Preview)
+
+			// Check that an invalid limit is rejected
+			_, err = m.GetConversationsByActivity(0, nil)
+			require.Error(t, err)
+		})
+	}
+}
+
+// Tests that wasmModel.GetReactions counts the reactions to DM messages, marks
+// the ones sent by the local identity, and ignores reactions from a blocked
+// partner.
+func TestWasmModel_GetReactions(t *testing.T) {
+	m, err := newWASMModel("TestWasmModel_GetReactions", nil, false, dummyEU)
+	require.NoError(t, err)
+
+	partnerKey := ed25519.PublicKey("partner")
+	myKey := ed25519.PublicKey("me")
+	now := time.Now().Round(0)
+
+	parentID := message.DeriveChannelMessageID(&id.ID{1}, 0, []byte("parent"))
+	require.NotZero(t, m.ReceiveText(parentID, "nick", "parent", partnerKey,
+		partnerKey, 0, 0, now, rounds.Round{ID: 0}, dm.Received))
+
+	reactions := []struct {
+		reaction  string
+		senderKey ed25519.PublicKey
+	}{
+		{"👍", partnerKey},
+		{"👍", myKey},
+		{"😀", partnerKey},
+		{"not an emoji", partnerKey},
+	}
+	for i, r := range reactions {
+		msgID := message.DeriveChannelMessageID(&id.ID{1}, uint64(i+1),
+			[]byte(r.reaction))
+		require.NotZero(t, m.ReceiveReaction(msgID, parentID, "nick",
+			r.reaction, partnerKey, r.senderKey, 0, 0, now,
+			rounds.Round{ID: id.Round(i + 1)}, dm.Received))
+	}
+
+	missingID := message.DeriveChannelMessageID(&id.ID{1}, 9, []byte("none"))
+	results, err := m.GetReactions([]message.ID{parentID, missingID}, myKey)
+	require.NoError(t, err)
+	require.Equal(t, []wDm.MessageReactions{{
+		MessageID: parentID,
+		Reactions: []wDm.Reaction{
+			{Emoji: "👍", Count: 2, Reacted: true},
+			{Emoji: "😀", Count: 1, Reacted: false},
+		},
+	}, {
+		MessageID: missingID,
+		Reactions: []wDm.Reaction{},
+	}}, results)
+
+	// Reactions from a blocked partner are not counted
+	m.BlockSender(partnerKey)
+	results, err = m.GetReactions([]message.ID{parentID}, myKey)
+	require.NoError(t, err)
+	require.Equal(t, []wDm.Reaction{{Emoji: "👍", Count: 1, Reacted: true}},
+		results[0].Reactions)
+}
+
+// Tests that wasmModel.GetThread pages through the replies to a message in
+// order and that the reply count of the message is kept up to date.
+func TestWasmModel_GetThread(t *testing.T) {
+	m, err := newWASMModel("TestWasmModel_GetThread", nil, false, dummyEU)
+	require.NoError(t, err)
+
+	partnerKey := ed25519.PublicKey("partner")
+	now := time.Now().Round(0)
+	rootID := message.DeriveChannelMessageID(&id.ID{1}, 0, []byte("root"))
+	replyCounts := func() uint {
+		counts, err := m.GetReplyCounts([]message.ID{rootID})
+		require.NoError(t, err)
+		return counts[0]
+	}
+
+	// Replies received before the root message are counted once it is
+	// received
+	replyIDs := make([]message.ID, 3)
+	for i := range replyIDs {
+		replyIDs[i] = message.DeriveChannelMessageID(&id.ID{1}, uint64(i+1),
+			[]byte(fmt.Sprintf("reply%d", i)))
+		require.NotZero(t, m.ReceiveReply(replyIDs[i], rootID, "nick",
+			fmt.Sprintf("reply%d", i), partnerKey, partnerKey, 0, 0,
+			now.Add(time.Duration(i)*time.Second),
+			rounds.Round{ID: id.Round(i + 1)}, dm.Received))
+	}
+	reactionID := message.DeriveChannelMessageID(&id.ID{1}, 4, []byte("👍"))
+	require.NotZero(t, m.ReceiveReaction(reactionID, rootID, "nick", "👍",
+		partnerKey, partnerKey, 0, 0, now, rounds.Round{ID: 4}, dm.Received))
+	require.Zero(t, replyCounts())
+
+	rootUUID := m.ReceiveText(rootID, "nick", "root", partnerKey,
+		partnerKey, 0, 0, now, rounds.Round{ID: 0}, dm.Received)
+	require.NotZero(t, rootUUID)
+	require.Equal(t, uint(3), replyCounts())
+
+	// Page through the thread
+	thread, err := m.GetThread(rootID, 2, nil)
+	require.NoError(t, err)
+	require.Equal(t, uint(3), thread.ReplyCount)
+	require.Len(t, thread.Replies, 2)
+	require.Equal(t, "reply0", string(thread.Replies[0].Content))
+	require.Equal(t, rootID, thread.Replies[0].ParentMessageID)
+	require.Equal(t, "reply1", string(thread.Replies[1].Content))
+	require.NotNil(t, thread.Next)
+
+	thread, err = m.GetThread(rootID, 2, thread.Next)
+	require.NoError(t, err)
+	require.Len(t, thread.Replies, 1)
+	require.Equal(t, "reply2", string(thread.Replies[0].Content))
+	require.Nil(t, thread.Next)
+
+	// Deleted replies are no longer counted
+	require.True(t, m.DeleteMessage(replyIDs[0], partnerKey))
+	require.Equal(t, uint(2), replyCounts())
+
+	// The update to the root is recorded, since only the deletion changed it
+	// after it was received
+	changes, err := m.GetChangesSince(0, 100)
+	require.NoError(t, err)
+	var rootUpdates int
+	for _, change := range changes {
+		if change.EventType != bindings.DmMessageReceived {
+			continue
+		}
+		var received bindings.DmMessageReceivedJSON
+		require.NoError(t, json.Unmarshal(change.Data, &received))
+		if received.UUID == rootUUID && received.MessageUpdate {
+			rootUpdates++
+		}
+	}
+	require.Equal(t, 1, rootUpdates)
+
+	_, err = m.GetThread(rootID, 0, nil)
+	require.Error(t, err)
+}
+
+// Tests that wasmModel.Subscribe sends the messages of the conversation and
+// then an update for each message inserted into, updated in, or removed from
+// it, and that no updates are sent after wasmModel.Unsubscribe.
+func TestWasmModel_Subscribe(t *testing.T) {
+	m, err := newWASMModel("TestWasmModel_Subscribe", nil, false, dummyEU)
+	require.NoError(t, err)
+
+	partnerKey := ed25519.PublicKey(bytes.Repeat([]byte{1}, ed25519.PublicKeySize))
+	otherKey := ed25519.PublicKey(bytes.Repeat([]byte{2}, ed25519.PublicKeySize))
+	now := time.Now().Round(0)
+	receive := func(partnerKey ed25519.PublicKey, i int) (uint64, message.ID) {
+		text := fmt.Sprintf("text%d", i)
+		messageID := message.DeriveChannelMessageID(
+			&id.ID{1}, uint64(i), []byte(text))
+		uuid := m.ReceiveText(messageID, "nick", text, partnerKey, partnerKey,
+			0, 0, now.Add(time.Duration(i)*time.Second),
+			rounds.Round{ID: id.Round(i)}, dm.Received)
+		require.NotZero(t, uuid)
+		return uuid, messageID
+	}
+
+	_, messageID0 := receive(partnerKey, 0)
+
+	query := wDm.LiveQuery{PartnerKey: partnerKey}
+	updates := make(chan wDm.LiveQueryUpdate, 10)
+	require.NoError(t, m.Subscribe(5, query,
+		func(update wDm.LiveQueryUpdate) { updates <- update }))
+
+	update := nextLiveQueryUpdate(t, updates)
+	require.True(t, update.Reset)
+	require.Equal(t, uint64(5), update.SubscriptionID)
+	require.Len(t, update.Inserted, 1)
+	require.Equal(t, messageID0, update.Inserted[0].MessageID)
+
+	// Messages in other conversations are not sent
+	receive(otherKey, 1)
+	uuid2, messageID2 := receive(partnerKey, 2)
+	update = nextLiveQueryUpdate(t, updates)
+	require.Len(t, update.Inserted, 1)
+	require.Equal(t, messageID2, update.Inserted[0].MessageID)
+
+	m.UpdateSentStatus(uuid2, messageID2, now, rounds.Round{ID: 2}, dm.Sent)
+	update = nextLiveQueryUpdate(t, updates)
+	require.Len(t, update.Updated, 1)
+	require.Equal(t, dm.Sent, update.Updated[0].Status)
+
+	require.True(t, m.DeleteMessage(messageID2, partnerKey))
+	update = nextLiveQueryUpdate(t, updates)
+	require.Equal(t, []message.ID{messageID2}, update.Removed)
+
+	// Once the update of the other query is received, any update for the
+	// cancelled query would have been sent
+	require.NoError(t, m.Unsubscribe(5))
+	require.Error(t, m.Unsubscribe(5))
+	otherUpdates := make(chan wDm.LiveQueryUpdate, 10)
+	require.NoError(t, m.Subscribe(6, query,
+		func(update wDm.LiveQueryUpdate) { otherUpdates <- update }))
+	require.True(t, nextLiveQueryUpdate(t, otherUpdates).Reset)
+	receive(partnerKey, 3)
+	require.Len(t, nextLiveQueryUpdate(t, otherUpdates).Inserted, 1)
+	require.Empty(t, updates)
+
+	// Check that an invalid query is rejected
+	require.Error(t, m.Subscribe(7, wDm.LiveQuery{},
+		func(wDm.LiveQueryUpdate) {}))
+}
+
+// nextLiveQueryUpdate returns the next update received on the channel or fails
+// the test if none is received in time.
+func nextLiveQueryUpdate(
+	t *testing.T, updates chan wDm.LiveQueryUpdate) wDm.LiveQueryUpdate {
+	select {
+	case update := <-updates:
+		return update
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for live query update.")
+		return wDm.LiveQueryUpdate{}
+	}
+}
+
+// Tests that when all sensitive fields are encrypted, the stored Message and
+// Conversation only contain blinded keys and encrypted nicknames and public
+// keys, and that they can still be looked up, updated, searched, and deleted.
+func TestWasmModel_EncryptAll(t *testing.T) {
+	ctx := context.Background()
+	testString := "TestWasmModel_EncryptAll"
+	c, err := idbCrypto.NewCipher(
+		[]byte("testPass"), []byte("testSalt"), 32, csprng.NewSystemRNG())
+	require.NoError(t, err)
+	m, err := newWASMModel(testString, c, true, dummyEU)
+	require.NoError(t, err)
+
+	partnerKey := ed25519.PublicKey("secretPartnerKey")
+	nickname := "secretNickname"
+	parentID := message.DeriveChannelMessageID(&id.ID{1}, 1, []byte("parent"))
+	msgID := message.DeriveChannelMessageID(&id.ID{1}, 2, []byte("reply"))
+	uuid := m.ReceiveReply(msgID, parentID, nickname, "hello world",
+		partnerKey, partnerKey, 42, 0, time.Now(), rounds.Round{ID: 2},
+		dm.Received)
+	require.NotZero(t, uuid)
+
+	// The stored rows must not contain any of the sensitive values
+	rawMsg, err := impl.Get(m.db, messageStoreName, js.ValueOf(uuid))
+	require.NoError(t, err)
+	rawConvos, err := impl.GetAll(m.db, conversationStoreName)
+	require.NoError(t, err)
+	require.Len(t, rawConvos, 1)
+	for _, raw := range []js.Value{rawMsg, rawConvos[0]} {
+		rawJson := utils.JsToJson(raw)
+		for _, b := range [][]byte{
+			partnerKey, parentID.Marshal(), msgID.Marshal()} {
+			require.NotContains(t,
+				rawJson, base64.StdEncoding.EncodeToString(b))
+		}
+		require.NotContains(t, rawJson, nickname)
+	}
+
+	// Lookups by the blinded keys still work
+	convo := m.GetConversation(partnerKey)
+	require.NotNil(t, convo)
+	require.Equal(t, nickname, convo.Nickname)
+	require.Equal(t, partnerKey, convo.Pubkey)
+	require.Equal(t, uint32(42), convo.Token)
+	require.Len(t, m.GetConversations(), 1)
+
+	m.BlockSender(partnerKey)
+	convo = m.GetConversation(partnerKey)
+	require.NotNil(t, convo)
+	require.NotNil(t, convo.BlockedTimestamp)
+	require.Equal(t, nickname, convo.Nickname)
+
+	m.UpdateSentStatus(uuid, msgID, time.Time{}, rounds.Round{}, dm.Sent)
+	rawMsg, err = impl.Get(m.db, messageStoreName, js.ValueOf(uuid))
+	require.NoError(t, err)
+	msg, err := m.openMessage(rawMsg)
+	require.NoError(t, err)
+	require.Equal(t, uint8(dm.Sent), msg.Status)
+	require.Equal(t, msgID.Marshal(), msg.MessageID)
+	require.Equal(t, parentID.Marshal(), msg.ParentMessageID)
+
+	results, err := m.SearchMessages(ctx, "hello", partnerKey, 10)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{uuid}, results)
+
+	require.True(t, m.DeleteMessage(msgID, partnerKey))
+}
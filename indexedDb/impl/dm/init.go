@@ -13,81 +13,153 @@ import (
 	"syscall/js"
 
 	"github.com/hack-pad/go-indexeddb/idb"
-	jww "github.com/spf13/jwalterweatherman"
+	"github.com/pkg/errors"
 
-	"gitlab.com/elixxir/client/v4/dm"
 	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
 	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	"gitlab.com/elixxir/xxdk-wasm/storage"
 )
 
-// currentVersion is the current version of the IndexedDb runtime. Used for
-// migration purposes.
-const currentVersion uint = 1
-
 // eventUpdate takes an event type and JSON object from bindings/dm.go.
 type eventUpdate func(eventType int64, jsonMarshallable any)
 
-// NewWASMEventModel returns a [channels.EventModel] backed by a wasmModel.
-// The name should be a base64 encoding of the users public key. Returns the
-// EventModel based on IndexedDb and the database name as reported by IndexedDb.
+// NewWASMEventModel returns a wasmModel, which implements [dm.EventModel]
+// backed by IndexedDb. The name should be a base64 encoding of the users public
+// key. If encryptAll is true, all sensitive fields are encrypted, which
+// requires a cipher. Data is evicted according to the policy as the storage
+// quota is approached.
+//
+// The wasmModel is not thread safe, so the background work is passed to run,
+// which must run it serially with every other call to the wasmModel.
 func NewWASMEventModel(databaseName string, encryption idbCrypto.Cipher,
-	eventCallback eventUpdate) (dm.EventModel, error) {
-	return newWASMModel(databaseName, encryption, eventCallback)
+	encryptAll bool, policy storage.EvictionPolicy,
+	eventCallback eventUpdate, run func(fn func())) (*wasmModel, error) {
+	model, err := newWASMModel(
+		databaseName, encryption, encryptAll, eventCallback)
+	if err != nil {
+		return nil, err
+	}
+
+	impl.SetEvictor(policy, model.evict)
+	go impl.MonitorStorage(impl.MonitorInterval, run)
+	return model, nil
 }
 
 // newWASMModel creates the given [idb.Database] and returns a wasmModel.
 func newWASMModel(databaseName string, encryption idbCrypto.Cipher,
-	eventCallback eventUpdate) (*wasmModel, error) {
-	// Attempt to open database object
-	ctx, cancel := impl.NewContext()
-	defer cancel()
-	openRequest, err := idb.Global().Open(ctx, databaseName, currentVersion,
-		func(db *idb.Database, oldVersion, newVersion uint) error {
-			if oldVersion == newVersion {
-				jww.INFO.Printf("IndexDb version for %s is current: v%d",
-					databaseName, newVersion)
-				return nil
-			}
+	encryptAll bool, eventCallback eventUpdate) (*wasmModel, error) {
+	wrapper := &wasmModel{
+		cipher:        encryption,
+		eventCallback: eventCallback,
+		liveQueries:   make(map[uint64]*liveQuery),
+	}
 
-			jww.INFO.Printf("IndexDb upgrade required for %s: v%d -> v%d",
-				databaseName, oldVersion, newVersion)
+	if encryptAll {
+		if encryption == nil {
+			return nil, errors.New(
+				"cannot encrypt all sensitive fields without a cipher")
+		}
+		blinder, err := impl.NewBlinder(encryption)
+		if err != nil {
+			return nil, err
+		}
+		wrapper.blinder = blinder
+	}
 
-			if oldVersion == 0 && newVersion >= 1 {
-				err := v1Upgrade(db)
-				if err != nil {
-					return err
-				}
-				oldVersion = 1
-			}
+	// Attempt to open database object
+	migrator := impl.NewMigrator(
+		databaseName, wrapper.migrations(), wrapper.migrationProgress)
+	db, err := migrator.Open()
+	if err != nil {
+		return nil, err
+	}
+	wrapper.db = db
 
-			// if oldVersion == 1 && newVersion >= 2 { v2Upgrade(), oldVersion = 2 }
-			return nil
-		})
+	wrapper.search, err = impl.NewSearchIndex(db, encryption)
 	if err != nil {
 		return nil, err
 	}
 
-	// Wait for database open to finish
-	db, err := openRequest.Await(ctx)
+	// Rewrite existing records for any migrations that were just applied or
+	// were interrupted
+	err = migrator.RunPendingRewrites(db)
 	if err != nil {
 		return nil, err
-	} else if ctx.Err() != nil {
-		return nil, ctx.Err()
 	}
 
-	wrapper := &wasmModel{
-		db:            db,
-		cipher:        encryption,
-		eventCallback: eventCallback,
+	// Live queries are updated with each change once it is committed
+	wrapper.changes, err = impl.NewChangeLog(db, encryption,
+		func(eventType int64, data any) {
+			eventCallback(eventType, data)
+			if change, ok := data.(impl.Change); ok {
+				wrapper.updateLiveQueries(change)
+			}
+		})
+	if err != nil {
+		return nil, err
 	}
+
 	return wrapper, nil
 }
 
+// migrations returns the ordered list of database migrations. The migration at
+// index i upgrades the database to version i+1.
+//
+// Migrations can never be changed or reordered without permanently breaking
+// backwards compatibility. New migrations must be appended to the end.
+func (w *wasmModel) migrations() []impl.Migration {
+	return []impl.Migration{
+		{Name: "initial schema", Schema: v1Upgrade},
+		{
+			Name:   "search index",
+			Schema: v2Upgrade,
+			// Messages stored before the search index existed must be indexed
+			Rewrite: func(_ *idb.Database, progress func(done, total uint)) error {
+				return w.rebuildSearchIndex(progress)
+			},
+		},
+		{
+			Name:   "read markers",
+			Schema: v3Upgrade,
+			// Conversations started before read markers existed must have one
+			Rewrite: w.createReadMarkers,
+		},
+		{
+			Name:   "conversation activity",
+			Schema: v4Upgrade,
+			// Conversations stored before their last message was tracked
+			// must find it and be added to the activity index
+			Rewrite: func(db *idb.Database, progress func(done, total uint)) error {
+				if err := w.rebuildActivity(progress); err != nil {
+					return err
+				}
+
+				// Conversations without messages are not rewritten above, so
+				// their activity time is set without reporting progress again
+				return impl.RewriteStore(db, conversationStoreName,
+					activityTimeValue, func(uint, uint) {})
+			},
+		},
+		{
+			Name:   "parent index",
+			Schema: v5Upgrade,
+			// Messages stored before replies were counted must be counted
+			Rewrite: w.rebuildReplyCounts,
+		},
+		{Name: "change log", Schema: v6Upgrade},
+	}
+}
+
+// migrationProgress sends migration progress to the main thread.
+func (w *wasmModel) migrationProgress(p impl.MigrationProgress) {
+	w.eventCallback(impl.MigrationProgressEvent, p)
+}
+
 // v1Upgrade performs the v0 -> v1 database upgrade.
 //
 // This can never be changed without permanently breaking backwards
 // compatibility.
-func v1Upgrade(db *idb.Database) error {
+func v1Upgrade(db *idb.Database, _ *idb.Transaction) error {
 	indexOpts := idb.IndexOptions{
 		Unique:     false,
 		MultiEntry: false,
@@ -134,3 +206,67 @@ func v1Upgrade(db *idb.Database) error {
 
 	return nil
 }
+
+// v2Upgrade performs the v1 -> v2 database upgrade, which adds the search
+// index.
+//
+// This can never be changed without permanently breaking backwards
+// compatibility.
+func v2Upgrade(db *idb.Database, _ *idb.Transaction) error {
+	return impl.CreateSearchStore(db)
+}
+
+// v3Upgrade performs the v2 -> v3 database upgrade, which adds the read marker
+// store.
+//
+// This can never be changed without permanently breaking backwards
+// compatibility.
+func v3Upgrade(db *idb.Database, _ *idb.Transaction) error {
+	return impl.CreateReadMarkerStore(db)
+}
+
+// v4Upgrade performs the v3 -> v4 database upgrade, which adds the index that
+// orders conversations by activity.
+//
+// This can never be changed without permanently breaking backwards
+// compatibility.
+func v4Upgrade(_ *idb.Database, txn *idb.Transaction) error {
+	conversationStore, err := txn.ObjectStore(conversationStoreName)
+	if err != nil {
+		return err
+	}
+	_, err = conversationStore.CreateIndex(conversationStoreActivityIndex,
+		js.ValueOf([]any{conversationStoreActivity, convoPkeyName}),
+		idb.IndexOptions{
+			Unique:     false,
+			MultiEntry: false,
+		})
+	return err
+}
+
+// v5Upgrade performs the v4 -> v5 database upgrade, which adds the parent
+// message ID index.
+//
+// This can never be changed without permanently breaking backwards
+// compatibility.
+func v5Upgrade(_ *idb.Database, txn *idb.Transaction) error {
+	messageStore, err := txn.ObjectStore(messageStoreName)
+	if err != nil {
+		return err
+	}
+	_, err = messageStore.CreateIndex(messageStoreParentIndex,
+		js.ValueOf(messageStoreParent), idb.IndexOptions{
+			Unique:     false,
+			MultiEntry: false,
+		})
+	return err
+}
+
+// v6Upgrade performs the v5 -> v6 database upgrade, which adds the change log
+// store.
+//
+// This can never be changed without permanently breaking backwards
+// compatibility.
+func v6Upgrade(db *idb.Database, _ *idb.Transaction) error {
+	return impl.CreateChangeLogStore(db)
+}
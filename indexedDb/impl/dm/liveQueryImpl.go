@@ -0,0 +1,282 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"sort"
+	"strings"
+	"syscall/js"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/client/v4/bindings"
+	"gitlab.com/elixxir/client/v4/dm"
+	"gitlab.com/elixxir/crypto/message"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	wDm "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/dm"
+)
+
+// liveQuery is a live query registered by the main thread.
+type liveQuery struct {
+	query wDm.LiveQuery
+
+	// send sends an update of the query to the main thread.
+	send func(update wDm.LiveQueryUpdate)
+
+	// rows contains the IDs of the messages currently in the query.
+	rows map[message.ID]struct{}
+}
+
+// liveEvent is the data of a DmMessageReceived change. Deleted messages are
+// recorded with the same event type, so it holds the fields of both
+// bindings.DmMessageReceivedJSON and bindings.DmMessageDeletedJSON.
+type liveEvent struct {
+	bindings.DmMessageReceivedJSON
+	MessageID *message.ID `json:"messageID"`
+}
+
+// Subscribe registers the live query with the given subscription ID, which is
+// chosen by the main thread. Every message of the query is sent at once with
+// Reset set, and then each change to them is sent as it is committed.
+//
+// If a subscription with the ID already exists, it is replaced. This happens
+// when the main thread reconnects after the worker is restarted.
+func (w *wasmModel) Subscribe(subscriptionID uint64, query wDm.LiveQuery,
+	send func(update wDm.LiveQueryUpdate)) error {
+	parentErr := errors.New("[DM indexedDB] failed to Subscribe")
+
+	if len(query.PartnerKey) != ed25519.PublicKeySize {
+		return errors.WithMessagef(parentErr,
+			"partner key must be %d bytes, received %d",
+			ed25519.PublicKeySize, len(query.PartnerKey))
+	} else if !query.Start.IsZero() && !query.End.IsZero() &&
+		!query.End.After(query.Start) {
+		return errors.WithMessagef(parentErr,
+			"end %s must be after start %s", query.End, query.Start)
+	}
+
+	// Changes are held back until the current messages are sent so that no
+	// change is missed
+	w.liveMux.Lock()
+	defer w.liveMux.Unlock()
+
+	results, err := w.queryMessages(query)
+	if err != nil {
+		return errors.WithMessagef(parentErr, "%+v", err)
+	}
+
+	lq := &liveQuery{
+		query: query,
+		send:  send,
+		rows:  make(map[message.ID]struct{}, len(results)),
+	}
+	update := wDm.LiveQueryUpdate{
+		SubscriptionID: subscriptionID,
+		Reset:          true,
+		Inserted:       make([]wDm.ModelMessage, len(results)),
+	}
+	for i, msg := range results {
+		update.Inserted[i], err = w.toDecryptedModelMessage(msg)
+		if err != nil {
+			return errors.WithMessagef(parentErr,
+				"Unable to convert Message %d: %+v", msg.ID, err)
+		}
+		lq.rows[update.Inserted[i].MessageID] = struct{}{}
+	}
+
+	w.liveQueries[subscriptionID] = lq
+	send(update)
+	return nil
+}
+
+// Unsubscribe cancels the live query with the given subscription ID.
+func (w *wasmModel) Unsubscribe(subscriptionID uint64) error {
+	w.liveMux.Lock()
+	defer w.liveMux.Unlock()
+	if _, exists := w.liveQueries[subscriptionID]; !exists {
+		return errors.Errorf("[DM indexedDB] no live query with "+
+			"subscription ID %d", subscriptionID)
+	}
+	delete(w.liveQueries, subscriptionID)
+	return nil
+}
+
+// updateLiveQueries sends the changes made by the committed change to every
+// live query it affects. It is called for each change in the order they were
+// committed.
+func (w *wasmModel) updateLiveQueries(change impl.Change) {
+	w.liveMux.Lock()
+	defer w.liveMux.Unlock()
+	if len(w.liveQueries) == 0 || change.EventType != bindings.DmMessageReceived {
+		return
+	}
+
+	var event liveEvent
+	err := json.Unmarshal(change.Data, &event)
+	if err == nil {
+		if event.MessageID != nil {
+			w.liveMessageRemoved(*event.MessageID)
+		} else {
+			err = w.liveMessageChanged(event.UUID, event.PubKey)
+		}
+	}
+	if err != nil {
+		jww.ERROR.Printf("[DM indexedDB] Failed to update live queries for "+
+			"change %d: %+v", change.Seq, err)
+	}
+}
+
+// liveMessageChanged sends the message with the given UUID to each live query
+// it is inserted into, updated in, or removed from. The partner key is used to
+// skip reading the message if no live query is on its conversation.
+func (w *wasmModel) liveMessageChanged(
+	uuid uint64, partnerKey ed25519.PublicKey) error {
+	if partnerKey != nil {
+		var found bool
+		for _, lq := range w.liveQueries {
+			found = found || bytes.Equal(lq.query.PartnerKey, partnerKey)
+		}
+		if !found {
+			return nil
+		}
+	}
+
+	msgObj, err := impl.Get(w.db, messageStoreName, js.ValueOf(uuid))
+	if err != nil {
+		// The message was deleted after the change, which is handled by a
+		// later change
+		if strings.Contains(err.Error(), impl.ErrDoesNotExist) {
+			return nil
+		}
+		return err
+	}
+	msg, err := w.openMessage(msgObj)
+	if err != nil {
+		return err
+	}
+	modelMsg, err := w.toDecryptedModelMessage(msg)
+	if err != nil {
+		return errors.Errorf("Unable to convert Message %d: %+v", uuid, err)
+	}
+
+	for subscriptionID, lq := range w.liveQueries {
+		_, exists := lq.rows[modelMsg.MessageID]
+		update := wDm.LiveQueryUpdate{SubscriptionID: subscriptionID}
+		if matchesLiveQuery(lq.query, msg) {
+			if exists {
+				update.Updated = []wDm.ModelMessage{modelMsg}
+			} else {
+				update.Inserted = []wDm.ModelMessage{modelMsg}
+				lq.rows[modelMsg.MessageID] = struct{}{}
+			}
+		} else if exists {
+			update.Removed = []message.ID{modelMsg.MessageID}
+			delete(lq.rows, modelMsg.MessageID)
+		} else {
+			continue
+		}
+		lq.send(update)
+	}
+
+	return nil
+}
+
+// liveMessageRemoved removes the message from every live query that contains
+// it.
+func (w *wasmModel) liveMessageRemoved(messageID message.ID) {
+	for subscriptionID, lq := range w.liveQueries {
+		if _, exists := lq.rows[messageID]; !exists {
+			continue
+		}
+		delete(lq.rows, messageID)
+		lq.send(wDm.LiveQueryUpdate{
+			SubscriptionID: subscriptionID,
+			Removed:        []message.ID{messageID},
+		})
+	}
+}
+
+// queryMessages returns every message matching the live query, ordered from
+// newest to oldest.
+func (w *wasmModel) queryMessages(query wDm.LiveQuery) ([]*Message, error) {
+	// Prepare the Transaction
+	txn, err := w.db.Transaction(idb.TransactionReadOnly, messageStoreName)
+	if err != nil {
+		return nil, errors.Errorf("Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(messageStoreName)
+	if err != nil {
+		return nil, errors.Errorf("Unable to get ObjectStore: %+v", err)
+	}
+	index, err := store.Index(messageStoreConversationIndex)
+	if err != nil {
+		return nil, errors.Errorf("Unable to get Index: %+v", err)
+	}
+
+	// Set up the operation
+	keyRange, err := idb.NewKeyRangeOnly(w.indexKey(query.PartnerKey))
+	if err != nil {
+		return nil, errors.Errorf("Unable to NewKeyRangeOnly: %+v", err)
+	}
+	cursorRequest, err := index.OpenCursorRange(keyRange, idb.CursorNext)
+	if err != nil {
+		return nil, errors.Errorf("Unable to open Cursor: %+v", err)
+	}
+
+	// Perform the operation
+	results := make([]*Message, 0)
+	err = impl.SendCursorRequest(cursorRequest,
+		func(cursor *idb.CursorWithValue) error {
+			value, err := cursor.Value()
+			if err != nil {
+				return err
+			}
+			msg, err := w.openMessage(value)
+			if err != nil {
+				return err
+			}
+			if matchesLiveQuery(query, msg) {
+				results = append(results, msg)
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, errors.Errorf("Unable to get Message data: %+v", err)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Timestamp.After(results[j].Timestamp)
+	})
+	return results, nil
+}
+
+// matchesLiveQuery returns true if the opened Message matches the live query.
+func matchesLiveQuery(query wDm.LiveQuery, msg *Message) bool {
+	if !bytes.Equal(msg.ConversationPubKey, query.PartnerKey) ||
+		(!query.Start.IsZero() && msg.Timestamp.Before(query.Start)) ||
+		(!query.End.IsZero() && !msg.Timestamp.Before(query.End)) {
+		return false
+	}
+
+	if len(query.Types) == 0 {
+		return true
+	}
+	for _, mType := range query.Types {
+		if dm.MessageType(msg.Type) == mType {
+			return true
+		}
+	}
+	return false
+}
@@ -26,11 +26,20 @@ const (
 	messageStoreMessageIndex      = "message_id_index"
 	messageStoreConversationIndex = "conversation_pub_key_index"
 	messageStoreSenderIndex       = "sender_pub_key_index"
+	messageStoreParentIndex       = "parent_message_id_index"
 
 	// Message keyPath names (must match json struct tags).
 	messageStoreMessage      = "message_id"
 	messageStoreConversation = "conversation_pub_key"
 	messageStoreSender       = "sender_pub_key"
+	messageStoreParent       = "parent_message_id"
+
+	// conversationStoreActivityIndex is a compound index on the last
+	// activity time and public key, which orders conversations by activity.
+	conversationStoreActivityIndex = "activity_index"
+
+	// Conversation keyPath names (must match json struct tags).
+	conversationStoreActivity = "activity_time"
 )
 
 // Message defines the IndexedDb representation of a single Message.
@@ -41,7 +50,7 @@ type Message struct {
 	ID                 uint64    `json:"id,omitempty"`         // Matches msgPkeyName
 	MessageID          []byte    `json:"message_id"`           // Index
 	ConversationPubKey []byte    `json:"conversation_pub_key"` // Index
-	ParentMessageID    []byte    `json:"parent_message_id"`
+	ParentMessageID    []byte    `json:"parent_message_id"`    // Index
 	Timestamp          time.Time `json:"timestamp"`
 	SenderPubKey       []byte    `json:"sender_pub_key"` // Index
 	CodesetVersion     uint8     `json:"codeset_version"`
@@ -49,6 +58,16 @@ type Message struct {
 	Text               string    `json:"text"`
 	Type               uint16    `json:"type"`
 	Round              uint64    `json:"round"`
+
+	// ReplyCount is the number of replies to the Message.
+	ReplyCount uint `json:"reply_count"`
+
+	// Evicted is true if Text was removed to free storage space.
+	Evicted bool `json:"evicted,omitempty"`
+
+	// Sensitive holds the encrypted sensitiveMessageFields when all sensitive
+	// fields are encrypted. The fields it contains then hold blinded values.
+	Sensitive []string `json:"sensitive,omitempty"`
 }
 
 // Conversation defines the IndexedDb representation of a single
@@ -60,4 +79,25 @@ type Conversation struct {
 	Token            uint32     `json:"token"`
 	CodesetVersion   uint8      `json:"codeset_version"`
 	BlockedTimestamp *time.Time `json:"blocked_timestamp"`
+
+	// LastMessageUUID is the UUID of the most recent Message in the
+	// Conversation. It is zero if there are no messages.
+	LastMessageUUID uint64 `json:"last_message_uuid"`
+
+	// LastActivity is the timestamp of the most recent Message.
+	LastActivity time.Time `json:"last_activity"`
+
+	// ActivityTime is LastActivity in Unix milliseconds. It is part of
+	// conversationStoreActivityIndex, since LastActivity is not stored in a
+	// form that sorts in time order.
+	ActivityTime int64 `json:"activity_time"`
+
+	// Preview is the start of the text of the most recent Message, if it has
+	// text. It is encrypted if the database is encrypted.
+	Preview string `json:"preview"`
+
+	// Sensitive holds the encrypted sensitiveConversationFields when all
+	// sensitive fields are encrypted. Pubkey then holds a blinded value and
+	// the others are empty.
+	Sensitive []string `json:"sensitive,omitempty"`
 }
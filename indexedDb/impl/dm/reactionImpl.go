@@ -0,0 +1,154 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"strings"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+
+	"gitlab.com/elixxir/client/v4/dm"
+	"gitlab.com/elixxir/crypto/message"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	wDm "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/dm"
+)
+
+// GetReactions returns the reactions to each of the messages, in the same
+// order as messageIDs. Each emoji is listed with the number of users that
+// reacted with it and whether the user with the public key self reacted.
+// Reactions from blocked partners and reactions that are not a single
+// supported emoji are not counted. Messages that do not exist have no
+// reactions.
+func (w *wasmModel) GetReactions(messageIDs []message.ID,
+	self ed25519.PublicKey) ([]wDm.MessageReactions, error) {
+	parentErr := errors.New("[DM indexedDB] failed to GetReactions")
+
+	// The reactions in each conversation are loaded once and grouped by the
+	// message they react to
+	reactions := make(map[string]map[string][]*Message)
+
+	results := make([]wDm.MessageReactions, len(messageIDs))
+	for i, messageID := range messageIDs {
+		results[i] = wDm.MessageReactions{
+			MessageID: messageID,
+			Reactions: []wDm.Reaction{},
+		}
+
+		msgObj, err := impl.GetIndex(w.db, messageStoreName,
+			messageStoreMessageIndex, w.indexKey(messageID.Marshal()))
+		if err != nil {
+			if strings.Contains(err.Error(), impl.ErrDoesNotExist) {
+				continue
+			}
+			return nil, errors.WithMessagef(parentErr, "%+v", err)
+		}
+		msg, err := w.openMessage(msgObj)
+		if err != nil {
+			return nil, errors.WithMessagef(parentErr, "%+v", err)
+		}
+
+		partnerKey := string(msg.ConversationPubKey)
+		if _, exists := reactions[partnerKey]; !exists {
+			reactions[partnerKey], err =
+				w.getReactionsByParent(msg.ConversationPubKey)
+			if err != nil {
+				return nil, errors.WithMessagef(parentErr, "%+v", err)
+			}
+		}
+
+		tally := impl.NewReactionTally(self)
+		for _, reaction := range reactions[partnerKey][string(msg.MessageID)] {
+			text := []byte(reaction.Text)
+			if w.cipher != nil {
+				text, err = w.cipher.Decrypt(reaction.Text)
+				if err != nil {
+					return nil, errors.WithMessagef(parentErr,
+						"Unable to decrypt Message %d: %+v", reaction.ID, err)
+				}
+			}
+			tally.Add(string(text), reaction.SenderPubKey)
+		}
+
+		for _, count := range tally.Counts() {
+			results[i].Reactions = append(results[i].Reactions, wDm.Reaction{
+				Emoji:   count.Emoji,
+				Count:   count.Count,
+				Reacted: count.Reacted,
+			})
+		}
+	}
+
+	return results, nil
+}
+
+// getReactionsByParent returns the reactions in the conversation keyed on the
+// ID of the message they react to. Reactions from the partner are left out if
+// the partner is blocked.
+func (w *wasmModel) getReactionsByParent(
+	partnerKey []byte) (map[string][]*Message, error) {
+	convo, err := w.getConversation(partnerKey)
+	if err != nil {
+		return nil, err
+	}
+	blocked := convo.BlockedTimestamp != nil
+
+	// Prepare the Transaction
+	txn, err := w.db.Transaction(idb.TransactionReadOnly, messageStoreName)
+	if err != nil {
+		return nil, errors.Errorf("Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(messageStoreName)
+	if err != nil {
+		return nil, errors.Errorf("Unable to get ObjectStore: %+v", err)
+	}
+	index, err := store.Index(messageStoreConversationIndex)
+	if err != nil {
+		return nil, errors.Errorf("Unable to get Index: %+v", err)
+	}
+
+	// Set up the operation
+	keyRange, err := idb.NewKeyRangeOnly(w.indexKey(partnerKey))
+	if err != nil {
+		return nil, errors.Errorf("Unable to NewKeyRangeOnly: %+v", err)
+	}
+	cursorRequest, err := index.OpenCursorRange(keyRange, idb.CursorNext)
+	if err != nil {
+		return nil, errors.Errorf("Unable to open Cursor: %+v", err)
+	}
+
+	// Perform the operation
+	reactions := make(map[string][]*Message)
+	err = impl.SendCursorRequest(cursorRequest,
+		func(cursor *idb.CursorWithValue) error {
+			value, err := cursor.Value()
+			if err != nil {
+				return err
+			}
+			msg, err := w.openMessage(value)
+			if err != nil {
+				return err
+			}
+			if dm.MessageType(msg.Type) != dm.ReactionType ||
+				(blocked && bytes.Equal(msg.SenderPubKey, partnerKey)) {
+				return nil
+			}
+			parentID := string(msg.ParentMessageID)
+			reactions[parentID] = append(reactions[parentID], msg)
+			return nil
+		})
+	if err != nil {
+		return nil, errors.Errorf("Unable to get Message data: %+v", err)
+	}
+
+	return reactions, nil
+}
@@ -0,0 +1,349 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"strings"
+	"syscall/js"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+
+	"gitlab.com/elixxir/client/v4/dm"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	wDm "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/dm"
+)
+
+// MarkRead marks the message with the given UUID, and every message in its
+// conversation sent before it, as read. The read position never moves
+// backwards; marking an older message does nothing.
+func (w *wasmModel) MarkRead(uuid uint64) error {
+	parentErr := errors.New("[DM indexedDB] failed to MarkRead")
+
+	msgObj, err := impl.Get(w.db, messageStoreName, js.ValueOf(uuid))
+	if err != nil {
+		return errors.WithMessage(err, parentErr.Error())
+	}
+	msg, err := w.openMessage(msgObj)
+	if err != nil {
+		return errors.WithMessagef(parentErr, "%+v", err)
+	}
+
+	marker, _, err := w.getOrCreateReadMarker(msg.ConversationPubKey)
+	if err != nil {
+		return errors.WithMessagef(parentErr, "%+v", err)
+	} else if marker.IsRead(msg.Timestamp) {
+		return nil
+	}
+
+	marker.LastRead = uuid
+	marker.LastReadTimestamp = msg.Timestamp
+	marker.Unread, err = w.countUnread(msg.ConversationPubKey, marker)
+	if err != nil {
+		return errors.WithMessagef(parentErr, "%+v", err)
+	}
+	if err = w.putReadMarker(msg.ConversationPubKey, marker); err != nil {
+		return errors.WithMessagef(parentErr, "%+v", err)
+	}
+	return nil
+}
+
+// GetUnreadCount returns the number of unread messages in the conversation
+// with the partner. Returns zero if the partner is blocked.
+func (w *wasmModel) GetUnreadCount(partnerKey ed25519.PublicKey) (uint, error) {
+	marker, err := w.getReadMarker(partnerKey)
+	if err != nil {
+		return 0, errors.Errorf(
+			"[DM indexedDB] failed to GetUnreadCount: %+v", err)
+	}
+	return marker.Unread, nil
+}
+
+// GetUnreadSummary returns the unread count and last read message of every
+// conversation with a partner that is not blocked.
+func (w *wasmModel) GetUnreadSummary() ([]wDm.UnreadCount, error) {
+	parentErr := errors.New("[DM indexedDB] failed to GetUnreadSummary")
+
+	results, err := impl.GetAll(w.db, conversationStoreName)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr, "%+v", err)
+	}
+
+	summary := make([]wDm.UnreadCount, 0, len(results))
+	for _, result := range results {
+		convo, err := w.openConversation(result)
+		if err != nil {
+			return nil, errors.WithMessagef(parentErr, "%+v", err)
+		} else if convo.BlockedTimestamp != nil {
+			continue
+		}
+
+		marker, err := w.getReadMarker(convo.Pubkey)
+		if err != nil {
+			return nil, errors.WithMessagef(parentErr, "%+v", err)
+		}
+		summary = append(summary, wDm.UnreadCount{
+			PubKey:   convo.Pubkey,
+			LastRead: marker.LastRead,
+			Unread:   marker.Unread,
+		})
+	}
+
+	return summary, nil
+}
+
+// recountUnread counts the unread messages in the conversation again. It must
+// be called when the partner is blocked or unblocked.
+func (w *wasmModel) recountUnread(partnerKey ed25519.PublicKey) error {
+	marker, created, err := w.getOrCreateReadMarker(partnerKey)
+	if err != nil || created {
+		return err
+	}
+
+	marker.Unread, err = w.countUnread(partnerKey, marker)
+	if err != nil {
+		return err
+	}
+	return w.putReadMarker(partnerKey, marker)
+}
+
+// updateUnreadTxn adjusts the unread count of the conversation after a
+// message is inserted (before is nil), modified, or deleted (after is nil).
+// The marker is read and stored, and its change recorded, as part of the
+// Transaction of the change to the message, which must include the
+// conversationStoreName, impl.ReadMarkerStoreName, and impl.ChangeLogStoreName
+// object stores.
+//
+// Markers are created when a message is received, so a conversation without
+// one has no other unread messages and a new marker is stored if the count
+// changes.
+func (w *wasmModel) updateUnreadTxn(txn *impl.Transaction, partnerKey []byte,
+	before, after *Message) error {
+	blocked, err := w.isBlockedTxn(txn, partnerKey)
+	if err != nil || blocked {
+		return err
+	}
+
+	marker, err := impl.GetReadMarkerTxn(txn, w.blind(partnerKey))
+	if err != nil {
+		return err
+	} else if marker == nil {
+		marker = &impl.ReadMarker{ID: w.blind(partnerKey)}
+	}
+
+	var delta int
+	if isUnread(marker, before) {
+		delta--
+	}
+	if isUnread(marker, after) {
+		delta++
+	}
+	if delta == 0 {
+		return nil
+	}
+
+	marker.AddUnread(delta)
+	return w.putReadMarkerTxn(txn, partnerKey, marker)
+}
+
+// isBlockedTxn returns true if the partner of the conversation is blocked. The
+// Conversation is read as part of the Transaction, which must include the
+// conversationStoreName object store. Returns false if there is no such
+// Conversation.
+func (w *wasmModel) isBlockedTxn(
+	txn *impl.Transaction, partnerKey []byte) (bool, error) {
+	convoObj, err := txn.Get(conversationStoreName, w.indexKey(partnerKey))
+	if err != nil {
+		if strings.Contains(err.Error(), impl.ErrDoesNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	convo, err := w.openConversation(convoObj)
+	if err != nil {
+		return false, err
+	}
+	return convo.BlockedTimestamp != nil, nil
+}
+
+// getReadMarker returns the ReadMarker for the conversation. Markers are
+// created when a message is received, so a conversation without one has
+// nothing unread and an empty marker is returned without storing it.
+func (w *wasmModel) getReadMarker(partnerKey []byte) (*impl.ReadMarker, error) {
+	marker, err := impl.GetReadMarker(w.db, w.blind(partnerKey))
+	if err != nil || marker != nil {
+		return marker, err
+	}
+	return &impl.ReadMarker{ID: w.blind(partnerKey)}, nil
+}
+
+// getOrCreateReadMarker returns the ReadMarker for the conversation. If the
+// conversation has none, a new marker with every message unread is counted,
+// stored, and returned with created set to true.
+func (w *wasmModel) getOrCreateReadMarker(partnerKey []byte) (
+	marker *impl.ReadMarker, created bool, err error) {
+	marker, err = impl.GetReadMarker(w.db, w.blind(partnerKey))
+	if err != nil || marker != nil {
+		return marker, false, err
+	}
+
+	marker = &impl.ReadMarker{ID: w.blind(partnerKey)}
+	marker.Unread, err = w.countUnread(partnerKey, marker)
+	if err != nil {
+		return nil, false, err
+	}
+	if err = w.putReadMarker(partnerKey, marker); err != nil {
+		return nil, false, err
+	}
+	return marker, true, nil
+}
+
+// putReadMarker stores the ReadMarker for the conversation and adds its unread
+// count to the change log in the same transaction, so that the count is sent
+// to the main thread in order with the other changes.
+func (w *wasmModel) putReadMarker(
+	partnerKey []byte, marker *impl.ReadMarker) error {
+	err := impl.RunTransaction(w.db, func(txn *impl.Transaction) error {
+		return w.putReadMarkerTxn(txn, partnerKey, marker)
+	}, impl.ReadMarkerStoreName, impl.ChangeLogStoreName)
+	if err != nil {
+		return err
+	}
+
+	w.changes.Publish()
+	return nil
+}
+
+// putReadMarkerTxn stores the ReadMarker for the conversation and adds its
+// unread count to the change log as part of the Transaction, which must include
+// the impl.ReadMarkerStoreName and impl.ChangeLogStoreName object stores.
+func (w *wasmModel) putReadMarkerTxn(txn *impl.Transaction, partnerKey []byte,
+	marker *impl.ReadMarker) error {
+	if err := impl.PutReadMarkerTxn(txn, marker); err != nil {
+		return err
+	}
+	return w.changes.Append(txn, impl.UnreadCountEvent, wDm.UnreadCount{
+		PubKey:   partnerKey,
+		LastRead: marker.LastRead,
+		Unread:   marker.Unread,
+	})
+}
+
+// createReadMarkers creates the ReadMarker of every conversation that has
+// none. It is used by the migration that added read markers, since
+// conversations started before then have none. Unread counts are not sent,
+// since the main thread is not listening yet.
+func (w *wasmModel) createReadMarkers(
+	db *idb.Database, progress func(done, total uint)) error {
+	results, err := impl.GetAll(db, conversationStoreName)
+	if err != nil {
+		return err
+	}
+
+	for i, result := range results {
+		convo, err := w.openConversation(result)
+		if err != nil {
+			return err
+		}
+		marker, err := impl.GetReadMarker(db, w.blind(convo.Pubkey))
+		if err != nil {
+			return err
+		} else if marker == nil {
+			marker = &impl.ReadMarker{ID: w.blind(convo.Pubkey)}
+			marker.Unread, err = w.countUnread(convo.Pubkey, marker)
+			if err != nil {
+				return err
+			}
+			if err = impl.PutReadMarker(db, marker); err != nil {
+				return err
+			}
+		}
+		progress(uint(i+1), uint(len(results)))
+	}
+	return nil
+}
+
+// countUnread returns the number of messages in the conversation that are
+// unread according to the marker. Returns zero if the partner is blocked.
+func (w *wasmModel) countUnread(
+	partnerKey []byte, marker *impl.ReadMarker) (uint, error) {
+	parentErr := errors.New("[DM indexedDB] failed to countUnread")
+
+	convo, err := w.getConversation(partnerKey)
+	if err != nil {
+		return 0, errors.WithMessagef(parentErr, "%+v", err)
+	} else if convo.BlockedTimestamp != nil {
+		return 0, nil
+	}
+
+	// Prepare the Transaction
+	txn, err := w.db.Transaction(idb.TransactionReadOnly, messageStoreName)
+	if err != nil {
+		return 0, errors.WithMessagef(parentErr,
+			"Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(messageStoreName)
+	if err != nil {
+		return 0, errors.WithMessagef(parentErr,
+			"Unable to get ObjectStore: %+v", err)
+	}
+	index, err := store.Index(messageStoreConversationIndex)
+	if err != nil {
+		return 0, errors.WithMessagef(parentErr,
+			"Unable to get Index: %+v", err)
+	}
+
+	// Set up the operation
+	keyRange, err := idb.NewKeyRangeOnly(w.indexKey(partnerKey))
+	if err != nil {
+		return 0, errors.WithMessagef(parentErr,
+			"Unable to NewKeyRangeOnly: %+v", err)
+	}
+	cursorRequest, err := index.OpenCursorRange(keyRange, idb.CursorNext)
+	if err != nil {
+		return 0, errors.WithMessagef(parentErr,
+			"Unable to open Cursor: %+v", err)
+	}
+
+	// Perform the operation
+	var unread uint
+	err = impl.SendCursorRequest(cursorRequest,
+		func(cursor *idb.CursorWithValue) error {
+			value, err := cursor.Value()
+			if err != nil {
+				return err
+			}
+			msg, err := w.openMessage(value)
+			if err != nil {
+				return err
+			}
+			if isUnread(marker, msg) {
+				unread++
+			}
+			return nil
+		})
+	if err != nil {
+		return 0, errors.WithMessagef(parentErr,
+			"Unable to count Message data: %+v", err)
+	}
+
+	return unread, nil
+}
+
+// isUnread returns true if the message counts as unread according to the
+// marker. Only messages with text sent by the partner are counted.
+// Returns false if msg is nil.
+func isUnread(marker *impl.ReadMarker, msg *Message) bool {
+	return msg != nil && isSearchable(dm.MessageType(msg.Type)) &&
+		bytes.Equal(msg.SenderPubKey, msg.ConversationPubKey) &&
+		!marker.IsRead(msg.Timestamp)
+}
@@ -0,0 +1,369 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"syscall/js"
+	"time"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+
+	"gitlab.com/elixxir/client/v4/bindings"
+	"gitlab.com/elixxir/client/v4/dm"
+	"gitlab.com/elixxir/crypto/message"
+	"gitlab.com/elixxir/wasm-utils/utils"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	wDm "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/dm"
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// GetThread returns up to limit replies to the root message, ordered from
+// oldest to newest. If cursor is nil, the thread is read from the first reply.
+// Otherwise, only replies after the cursor are returned.
+//
+// To page through the thread, call GetThread again with the Next cursor of the
+// previous result until it is nil.
+func (w *wasmModel) GetThread(rootMessageID message.ID, limit int,
+	cursor *wDm.ThreadCursor) (*wDm.Thread, error) {
+	parentErr := errors.New("[DM indexedDB] failed to GetThread")
+
+	if limit <= 0 {
+		return nil, errors.WithMessagef(parentErr,
+			"limit must be greater than zero, received %d", limit)
+	}
+
+	children, err := w.getChildren(rootMessageID.Marshal())
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr, "%+v", err)
+	}
+
+	replies := make([]*Message, 0, len(children))
+	for _, msg := range children {
+		if isReply(msg) {
+			replies = append(replies, msg)
+		}
+	}
+	sort.SliceStable(replies, func(i, j int) bool {
+		return replyBefore(replies[i], replies[j].Timestamp, replies[j].ID)
+	})
+
+	thread := &wDm.Thread{ReplyCount: uint(len(replies))}
+	if cursor != nil {
+		start := sort.Search(len(replies), func(i int) bool {
+			return !replyBefore(replies[i], cursor.Timestamp, cursor.UUID) &&
+				replies[i].ID != cursor.UUID
+		})
+		replies = replies[start:]
+	}
+	if len(replies) > limit {
+		replies = replies[:limit]
+		last := replies[limit-1]
+		thread.Next = &wDm.ThreadCursor{
+			Timestamp: last.Timestamp,
+			UUID:      last.ID,
+		}
+	}
+
+	thread.Replies = make([]wDm.ModelMessage, len(replies))
+	for i, msg := range replies {
+		thread.Replies[i], err = w.toDecryptedModelMessage(msg)
+		if err != nil {
+			return nil, errors.WithMessagef(parentErr,
+				"Unable to convert Message %d: %+v", msg.ID, err)
+		}
+	}
+
+	return thread, nil
+}
+
+// GetReplyCounts returns the number of replies to each of the messages, in the
+// same order as messageIDs. The count is stored with each message, so the
+// replies are not read. Messages that do not exist have no replies.
+func (w *wasmModel) GetReplyCounts(messageIDs []message.ID) ([]uint, error) {
+	parentErr := errors.New("[DM indexedDB] failed to GetReplyCounts")
+
+	counts := make([]uint, len(messageIDs))
+	for i, messageID := range messageIDs {
+		msgObj, err := impl.GetIndex(w.db, messageStoreName,
+			messageStoreMessageIndex, w.indexKey(messageID.Marshal()))
+		if err != nil {
+			if strings.Contains(err.Error(), impl.ErrDoesNotExist) {
+				continue
+			}
+			return nil, errors.WithMessagef(parentErr, "%+v", err)
+		}
+
+		msg, err := valueToMessage(msgObj)
+		if err != nil {
+			return nil, errors.WithMessagef(parentErr, "%+v", err)
+		}
+		counts[i] = msg.ReplyCount
+	}
+
+	return counts, nil
+}
+
+// toModelMessage converts a Message with the decrypted content to a
+// wDm.ModelMessage.
+func toModelMessage(msg *Message, content []byte) (wDm.ModelMessage, error) {
+	var parentID message.ID
+	if len(msg.ParentMessageID) > 0 {
+		var err error
+		parentID, err = message.UnmarshalID(msg.ParentMessageID)
+		if err != nil {
+			return wDm.ModelMessage{}, err
+		}
+	}
+
+	messageID, err := message.UnmarshalID(msg.MessageID)
+	if err != nil {
+		return wDm.ModelMessage{}, err
+	}
+
+	return wDm.ModelMessage{
+		UUID:               msg.ID,
+		MessageID:          messageID,
+		ParentMessageID:    parentID,
+		ConversationPubKey: msg.ConversationPubKey,
+		SenderPubKey:       msg.SenderPubKey,
+		Timestamp:          msg.Timestamp,
+		Status:             dm.Status(msg.Status),
+		Content:            content,
+		Type:               dm.MessageType(msg.Type),
+		Round:              id.Round(msg.Round),
+		CodesetVersion:     msg.CodesetVersion,
+	}, nil
+}
+
+// toDecryptedModelMessage converts an opened Message to a wDm.ModelMessage
+// with the decrypted content.
+func (w *wasmModel) toDecryptedModelMessage(
+	msg *Message) (wDm.ModelMessage, error) {
+	content := []byte(msg.Text)
+	if w.cipher != nil {
+		var err error
+		content, err = w.cipher.Decrypt(msg.Text)
+		if err != nil {
+			return wDm.ModelMessage{}, errors.Errorf(
+				"Unable to decrypt Message %d: %+v", msg.ID, err)
+		}
+	}
+	return toModelMessage(msg, content)
+}
+
+// replyBefore returns true if the reply is ordered before a reply with the
+// given timestamp and UUID. Replies are ordered by timestamp and then by UUID.
+func replyBefore(reply *Message, timestamp time.Time, uuid uint64) bool {
+	if !reply.Timestamp.Equal(timestamp) {
+		return reply.Timestamp.Before(timestamp)
+	}
+	return reply.ID < uuid
+}
+
+// isReply returns true if the message is a reply that is counted in the reply
+// count of its parent. Reactions are not counted. Returns false if msg is nil.
+func isReply(msg *Message) bool {
+	return msg != nil && len(msg.ParentMessageID) > 0 &&
+		isSearchable(dm.MessageType(msg.Type))
+}
+
+// getChildren returns every Message whose parent is the message with the given
+// ID.
+func (w *wasmModel) getChildren(parentID []byte) ([]*Message, error) {
+	// Prepare the Transaction
+	txn, err := w.db.Transaction(idb.TransactionReadOnly, messageStoreName)
+	if err != nil {
+		return nil, errors.Errorf("Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(messageStoreName)
+	if err != nil {
+		return nil, errors.Errorf("Unable to get ObjectStore: %+v", err)
+	}
+	index, err := store.Index(messageStoreParentIndex)
+	if err != nil {
+		return nil, errors.Errorf("Unable to get Index: %+v", err)
+	}
+
+	// Set up the operation
+	keyRange, err := idb.NewKeyRangeOnly(w.indexKey(parentID))
+	if err != nil {
+		return nil, errors.Errorf("Unable to NewKeyRangeOnly: %+v", err)
+	}
+	cursorRequest, err := index.OpenCursorRange(keyRange, idb.CursorNext)
+	if err != nil {
+		return nil, errors.Errorf("Unable to open Cursor: %+v", err)
+	}
+
+	// Perform the operation
+	children := make([]*Message, 0)
+	err = impl.SendCursorRequest(cursorRequest,
+		func(cursor *idb.CursorWithValue) error {
+			value, err := cursor.Value()
+			if err != nil {
+				return err
+			}
+			msg, err := w.openMessage(value)
+			if err != nil {
+				return err
+			}
+			children = append(children, msg)
+			return nil
+		})
+	if err != nil {
+		return nil, errors.Errorf("Unable to get Message data: %+v", err)
+	}
+
+	return children, nil
+}
+
+// countReplies returns the number of replies to the message. It is used to set
+// the reply count of a message that is received after its replies.
+func (w *wasmModel) countReplies(messageID []byte) (uint, error) {
+	if len(messageID) == 0 {
+		return 0, nil
+	}
+	children, err := w.getChildren(messageID)
+	if err != nil {
+		return 0, err
+	}
+
+	var count uint
+	for _, msg := range children {
+		if isReply(msg) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// updateReplyCountTxn adjusts the reply count of the parent after a message is
+// inserted (before is nil) or deleted (after is nil). The parent is read and
+// stored, and its change recorded, as part of the Transaction of the change to
+// the message, which must include the messageStoreName and
+// impl.ChangeLogStoreName object stores.
+func (w *wasmModel) updateReplyCountTxn(
+	txn *impl.Transaction, before, after *Message) error {
+	var delta int
+	var reply *Message
+	if isReply(before) {
+		delta--
+		reply = before
+	}
+	if isReply(after) {
+		delta++
+		reply = after
+	}
+	if delta == 0 {
+		return nil
+	}
+
+	parentObj, err := txn.GetIndex(messageStoreName, messageStoreMessageIndex,
+		w.indexKey(reply.ParentMessageID))
+	if err != nil {
+		// The parent may be received after its replies
+		if strings.Contains(err.Error(), impl.ErrDoesNotExist) {
+			return nil
+		}
+		return errors.Errorf("Unable to get parent Message: %+v", err)
+	}
+
+	// The reply count is not a sensitive field, so the stored record is
+	// modified without decrypting it
+	parent, err := valueToMessage(parentObj)
+	if err != nil {
+		return err
+	}
+	if delta < 0 && parent.ReplyCount == 0 {
+		return nil
+	}
+	parent.ReplyCount = uint(int(parent.ReplyCount) + delta)
+
+	parentObj, err = storedMessageToValue(parent)
+	if err != nil {
+		return err
+	}
+	if _, err = txn.Put(messageStoreName, parentObj); err != nil {
+		return errors.Errorf("Unable to put parent Message: %+v", err)
+	}
+
+	// The parent is in the same conversation as its reply
+	return w.changes.Append(txn, bindings.DmMessageReceived,
+		bindings.DmMessageReceivedJSON{
+			UUID:               parent.ID,
+			PubKey:             reply.ConversationPubKey,
+			MessageUpdate:      true,
+			ConversationUpdate: false,
+		})
+}
+
+// storedMessageToValue converts the stored record of the Message to a
+// js.Value as is, without encrypting it.
+func storedMessageToValue(msg *Message) (js.Value, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return js.Undefined(), errors.Errorf(
+			"Unable to marshal Message: %+v", err)
+	}
+	msgObj, err := utils.JsonToJS(data)
+	if err != nil {
+		return js.Undefined(), errors.Errorf(
+			"Unable to marshal Message: %+v", err)
+	}
+	return msgObj, nil
+}
+
+// rebuildReplyCounts sets the reply count of every message currently in
+// storage. Progress is reported periodically with the number of messages
+// processed and the total. It is safe to call more than once.
+func (w *wasmModel) rebuildReplyCounts(
+	db *idb.Database, progress func(done, total uint)) error {
+	results, err := impl.GetAll(db, messageStoreName)
+	if err != nil {
+		return errors.Errorf(
+			"[DM indexedDB] failed to rebuildReplyCounts: %+v", err)
+	}
+
+	// The parent and message IDs are compared as stored, since they are
+	// blinded consistently if all sensitive fields are encrypted
+	counts := make(map[string]uint)
+	for _, result := range results {
+		msg, err := valueToMessage(result)
+		if err != nil {
+			return errors.Errorf(
+				"[DM indexedDB] failed to rebuildReplyCounts: %+v", err)
+		}
+		if isReply(msg) {
+			counts[string(msg.ParentMessageID)]++
+		}
+	}
+
+	return impl.RewriteStore(db, messageStoreName,
+		func(value js.Value) (js.Value, error) {
+			msg, err := valueToMessage(value)
+			if err != nil {
+				return js.Undefined(), err
+			}
+			count := counts[string(msg.MessageID)]
+			if msg.ReplyCount == count {
+				return js.Undefined(), nil
+			}
+			msg.ReplyCount = count
+
+			data, err := json.Marshal(msg)
+			if err != nil {
+				return js.Undefined(), err
+			}
+			return utils.JsonToJS(data)
+		}, progress)
+}
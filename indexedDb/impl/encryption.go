@@ -0,0 +1,159 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package impl
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
+)
+
+// blindKeyContext is the context used to derive the Blinder key from the
+// cipher secret.
+const blindKeyContext = "xxdkWasmBlindIndexKey"
+
+// Blinder computes keyed hashes of values stored in indexed fields so that
+// records can still be looked up by those values without storing them.
+type Blinder struct {
+	key []byte
+}
+
+// NewBlinder returns a Blinder with a key derived from the cipher secret.
+func NewBlinder(cipher idbCrypto.Cipher) (*Blinder, error) {
+	key, err := deriveKey(cipher, blindKeyContext)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to derive blinding key")
+	}
+	return &Blinder{key: key}, nil
+}
+
+// Blind returns the HMAC-SHA256 of the value. Returns nil if the value is nil
+// so that unset fields remain unset.
+func (b *Blinder) Blind(value []byte) []byte {
+	if value == nil {
+		return nil
+	}
+	mac := hmac.New(sha256.New, b.key)
+	mac.Write(value)
+	return mac.Sum(nil)
+}
+
+// EncryptChunks encrypts data that may be larger than the cipher's block size
+// by splitting it into chunks of up to the block size and encrypting each one.
+// Returns nil if data is nil. Use DecryptChunks to decrypt the result.
+func EncryptChunks(cipher idbCrypto.Cipher, data []byte) ([]string, error) {
+	if data == nil {
+		return nil, nil
+	}
+
+	blockSize, err := cipherBlockSize(cipher)
+	if err != nil {
+		return nil, err
+	}
+
+	// Empty data still produces one chunk so that it can be told apart from
+	// nil data
+	chunks := make([]string, 0, len(data)/blockSize+1)
+	for start := 0; start == 0 || start < len(data); start += blockSize {
+		end := start + blockSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		chunk, err := cipher.Encrypt(data[start:end])
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to encrypt chunk %d",
+				len(chunks))
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks, nil
+}
+
+// DecryptChunks decrypts and joins chunks encrypted with EncryptChunks.
+// Returns nil if there are no chunks.
+func DecryptChunks(cipher idbCrypto.Cipher, chunks []string) ([]byte, error) {
+	if len(chunks) == 0 {
+		return nil, nil
+	}
+
+	data := make([]byte, 0)
+	for i, chunk := range chunks {
+		plaintext, err := cipher.Decrypt(chunk)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decrypt chunk %d", i)
+		}
+		data = append(data, plaintext...)
+	}
+
+	return data, nil
+}
+
+// cipherParams are the parameters of an [idbCrypto.Cipher] that are needed to
+// derive keys from it and to split data into blocks it can encrypt.
+type cipherParams struct {
+	Secret    []byte `json:"secret"`
+	BlockSize int    `json:"blockSize"`
+}
+
+// getCipherParams returns the secret and block size of the cipher. The
+// [idbCrypto.Cipher] interface has no accessors for them, so they are read
+// from the cipher's JSON. Returns an error if either is unset so that keys are
+// never derived from an empty secret.
+func getCipherParams(cipher idbCrypto.Cipher) (cipherParams, error) {
+	if cipher == nil {
+		return cipherParams{}, errors.New("cipher is nil")
+	}
+
+	data, err := json.Marshal(cipher)
+	if err != nil {
+		return cipherParams{}, errors.Wrap(err, "failed to JSON marshal cipher")
+	}
+
+	var params cipherParams
+	if err = json.Unmarshal(data, &params); err != nil {
+		return cipherParams{},
+			errors.Wrap(err, "failed to JSON unmarshal cipher")
+	} else if len(params.Secret) == 0 {
+		return cipherParams{}, errors.New("cipher has no secret")
+	} else if params.BlockSize <= 0 {
+		return cipherParams{},
+			errors.Errorf("invalid cipher block size %d", params.BlockSize)
+	}
+
+	return params, nil
+}
+
+// cipherBlockSize returns the largest plaintext the cipher can encrypt.
+func cipherBlockSize(cipher idbCrypto.Cipher) (int, error) {
+	params, err := getCipherParams(cipher)
+	if err != nil {
+		return 0, err
+	}
+	return params.BlockSize, nil
+}
+
+// deriveKey returns a key for the given context derived from the cipher
+// secret.
+func deriveKey(cipher idbCrypto.Cipher, context string) ([]byte, error) {
+	params, err := getCipherParams(cipher)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, params.Secret)
+	mac.Write([]byte(context))
+	return mac.Sum(nil), nil
+}
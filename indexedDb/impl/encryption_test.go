@@ -0,0 +1,142 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package impl
+
+import (
+	"bytes"
+	"testing"
+
+	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
+	"gitlab.com/xx_network/crypto/csprng"
+)
+
+// Tests that data of various sizes encrypted with EncryptChunks is split into
+// the expected number of chunks and decrypted by DecryptChunks.
+func TestEncryptChunks_DecryptChunks(t *testing.T) {
+	const blockSize = 64
+	cipher, err := idbCrypto.NewCipher(
+		[]byte("testPass"), []byte("testSalt"), blockSize,
+		csprng.NewSystemRNG())
+	if err != nil {
+		t.Fatalf("Failed to create cipher: %+v", err)
+	}
+
+	tests := []struct {
+		data   []byte
+		chunks int
+	}{
+		{nil, 0},
+		{[]byte{}, 1},
+		{[]byte("short"), 1},
+		{bytes.Repeat([]byte{7}, blockSize), 1},
+		{bytes.Repeat([]byte{7}, blockSize+1), 2},
+		{bytes.Repeat([]byte("0123456789"), 100), 16},
+	}
+
+	for i, tt := range tests {
+		chunks, err := EncryptChunks(cipher, tt.data)
+		if err != nil {
+			t.Errorf("Failed to encrypt data %d: %+v", i, err)
+			continue
+		}
+		if len(chunks) != tt.chunks {
+			t.Errorf("Unexpected number of chunks for data %d."+
+				"\nexpected: %d\nreceived: %d", i, tt.chunks, len(chunks))
+		}
+
+		decrypted, err := DecryptChunks(cipher, chunks)
+		if err != nil {
+			t.Errorf("Failed to decrypt data %d: %+v", i, err)
+		} else if !bytes.Equal(tt.data, decrypted) ||
+			(tt.data == nil) != (decrypted == nil) {
+			t.Errorf("Unexpected decrypted data %d."+
+				"\nexpected: %v\nreceived: %v", i, tt.data, decrypted)
+		}
+	}
+}
+
+// Tests that Blinder.Blind is deterministic for the same cipher, differs
+// between ciphers and values, and preserves nil values.
+func TestBlinder_Blind(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	cipherA, err := idbCrypto.NewCipher(
+		[]byte("passA"), []byte("saltA"), 64, rng)
+	if err != nil {
+		t.Fatalf("Failed to create cipher: %+v", err)
+	}
+	cipherB, err := idbCrypto.NewCipher(
+		[]byte("passB"), []byte("saltB"), 64, rng)
+	if err != nil {
+		t.Fatalf("Failed to create cipher: %+v", err)
+	}
+
+	blinderA, err := NewBlinder(cipherA)
+	if err != nil {
+		t.Fatalf("Failed to create Blinder: %+v", err)
+	}
+	blinderA2, err := NewBlinder(cipherA)
+	if err != nil {
+		t.Fatalf("Failed to create Blinder: %+v", err)
+	}
+	blinderB, err := NewBlinder(cipherB)
+	if err != nil {
+		t.Fatalf("Failed to create Blinder: %+v", err)
+	}
+
+	value := []byte("channel ID")
+	blinded := blinderA.Blind(value)
+	if bytes.Equal(value, blinded) {
+		t.Errorf("Value not blinded: %v", blinded)
+	}
+	if !bytes.Equal(blinded, blinderA2.Blind(value)) {
+		t.Errorf("Blinded value differs for the same cipher.")
+	}
+	if bytes.Equal(blinded, blinderB.Blind(value)) {
+		t.Errorf("Blinded value matches for different ciphers.")
+	}
+	if bytes.Equal(blinded, blinderA.Blind([]byte("other ID"))) {
+		t.Errorf("Blinded value matches for different values.")
+	}
+	if blinderA.Blind(nil) != nil {
+		t.Errorf("Blinded nil value is not nil.")
+	}
+}
+
+// Tests that NewBlinder and EncryptChunks return an error for a cipher without
+// a secret or block size instead of deriving a key from an empty secret.
+func Test_getCipherParams_Invalid(t *testing.T) {
+	tests := []*jsonCipher{
+		{`{"secret":null,"blockSize":64}`},
+		{`{"secret":"","blockSize":64}`},
+		{`{"secret":"c2VjcmV0","blockSize":0}`},
+		{`{}`},
+	}
+
+	for i, c := range tests {
+		if _, err := NewBlinder(c); err == nil {
+			t.Errorf("NewBlinder did not fail for cipher %d: %s", i, c.data)
+		}
+		if _, err := EncryptChunks(c, []byte("data")); err == nil {
+			t.Errorf("EncryptChunks did not fail for cipher %d: %s", i, c.data)
+		}
+	}
+
+	if _, err := NewBlinder(nil); err == nil {
+		t.Errorf("NewBlinder did not fail for a nil cipher.")
+	}
+}
+
+// jsonCipher is an [idbCrypto.Cipher] that only marshals to the given JSON.
+type jsonCipher struct{ data string }
+
+func (c *jsonCipher) Encrypt([]byte) (string, error) { return "", nil }
+func (c *jsonCipher) Decrypt(string) ([]byte, error) { return nil, nil }
+func (c *jsonCipher) MarshalJSON() ([]byte, error)   { return []byte(c.data), nil }
+func (c *jsonCipher) UnmarshalJSON([]byte) error     { return nil }
@@ -0,0 +1,343 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package impl
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"syscall/js"
+	"time"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/wasm-utils/storage"
+)
+
+const (
+	// pendingRewritesKey is the localStorage key prefix used to store the
+	// versions of migrations whose Rewrite has not yet completed.
+	pendingRewritesKey = "xxdkWasmPendingMigrationRewrites/"
+
+	// rewriteTimeout is the maximum amount of time a single store rewrite is
+	// allowed to take. It is longer than the request timeout because it
+	// iterates over every record in the store.
+	rewriteTimeout = 5 * time.Minute
+
+	// MigrationProgressInterval is the number of records rewritten between
+	// progress reports.
+	MigrationProgressInterval = 100
+
+	// MigrationProgressEvent is the event type sent on the event update
+	// callback when reporting migration progress. The data is
+	// [MigrationProgress]. It is outside the range used by bindings event
+	// types.
+	MigrationProgressEvent int64 = 100000
+)
+
+// Migration is a single, named step that upgrades a database from the version
+// before it to its own version. A Migration can never be changed once
+// released without permanently breaking backwards compatibility.
+type Migration struct {
+	// Name describes the migration. It is used in logs and progress events.
+	Name string
+
+	// Schema creates or deletes object stores and indexes. It is called during
+	// the IndexedDb upgrade with the versionchange transaction, which must be
+	// used to access existing object stores (e.g., to create an index). It may
+	// be nil if the migration only rewrites records.
+	Schema func(db *idb.Database, txn *idb.Transaction) error
+
+	// Rewrite optionally rewrites existing records after the database is
+	// opened (e.g., with RewriteStore). If it is interrupted, it is run again
+	// the next time the database is opened, so it must be safe to run more
+	// than once. It is not run for newly created databases.
+	Rewrite func(db *idb.Database, progress func(done, total uint)) error
+}
+
+// MigrationProgress describes the progress of a single migration. It is sent to
+// the main thread as JSON.
+type MigrationProgress struct {
+	DatabaseName string `json:"databaseName"`
+	Name         string `json:"name"`
+	Version      uint   `json:"version"`
+	Done         uint   `json:"done"`
+	Total        uint   `json:"total"`
+	Complete     bool   `json:"complete"`
+}
+
+// MigrationProgressCallback is called to report migration progress.
+type MigrationProgressCallback func(p MigrationProgress)
+
+// Migrator opens an IndexedDb database and upgrades it using an ordered list
+// of migrations. The migration at index i upgrades the database to version
+// i+1.
+type Migrator struct {
+	databaseName string
+	migrations   []Migration
+	progress     MigrationProgressCallback
+}
+
+// NewMigrator returns a Migrator for the given database and migrations. The
+// progress callback may be nil.
+func NewMigrator(databaseName string, migrations []Migration,
+	progress MigrationProgressCallback) *Migrator {
+	if progress == nil {
+		progress = func(MigrationProgress) {}
+	}
+	return &Migrator{
+		databaseName: databaseName,
+		migrations:   migrations,
+		progress:     progress,
+	}
+}
+
+// Version returns the version of the database after all migrations are
+// applied.
+func (m *Migrator) Version() uint {
+	return uint(len(m.migrations))
+}
+
+// Open opens the database and applies the Schema of every migration newer than
+// the stored version. Any Rewrite for those migrations is recorded as pending
+// and must be run with RunPendingRewrites once the database is ready for use.
+func (m *Migrator) Open() (*idb.Database, error) {
+	ctx, cancel := NewContext()
+	defer cancel()
+	var openRequest *idb.OpenDBRequest
+	openRequest, err := idb.Global().Open(ctx, m.databaseName, m.Version(),
+		func(db *idb.Database, oldVersion, newVersion uint) error {
+			if oldVersion == newVersion {
+				jww.INFO.Printf("IndexDb version for %s is current: v%d",
+					m.databaseName, newVersion)
+				return nil
+			}
+
+			jww.INFO.Printf("IndexDb upgrade required for %s: v%d -> v%d",
+				m.databaseName, oldVersion, newVersion)
+
+			pending, err := m.loadPending()
+			if err != nil {
+				return err
+			}
+
+			// The upgrade is only called once the request has been returned
+			txn, err := openRequest.Transaction()
+			if err != nil {
+				return errors.Wrap(err, "failed to get upgrade transaction")
+			}
+
+			for v := oldVersion + 1; v <= newVersion; v++ {
+				migration := m.migrations[v-1]
+				jww.INFO.Printf("Applying IndexDb migration %d (%s) to %s",
+					v, migration.Name, m.databaseName)
+				if migration.Schema != nil {
+					if err = migration.Schema(db, txn); err != nil {
+						return errors.Wrapf(err,
+							"failed migration %d (%s)", v, migration.Name)
+					}
+				}
+
+				// New databases have no records to rewrite
+				if migration.Rewrite != nil && oldVersion > 0 {
+					pending = appendVersion(pending, v)
+				}
+			}
+
+			return m.storePending(pending)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	// Wait for database open to finish
+	db, err := openRequest.Await(ctx)
+	if err != nil {
+		return nil, err
+	} else if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	return db, nil
+}
+
+// RunPendingRewrites runs the Rewrite of every migration recorded as pending,
+// in order. Each is removed from the pending list once it completes so that an
+// interrupted migration resumes on the next open.
+func (m *Migrator) RunPendingRewrites(db *idb.Database) error {
+	pending, err := m.loadPending()
+	if err != nil {
+		return err
+	}
+
+	for len(pending) > 0 {
+		v := pending[0]
+		if v == 0 || v > m.Version() {
+			return errors.Errorf("pending migration %d for %s does not exist",
+				v, m.databaseName)
+		}
+		migration := m.migrations[v-1]
+
+		jww.INFO.Printf("Rewriting records for IndexDb migration %d (%s) in %s",
+			v, migration.Name, m.databaseName)
+		p := MigrationProgress{
+			DatabaseName: m.databaseName,
+			Name:         migration.Name,
+			Version:      v,
+		}
+		m.progress(p)
+
+		err = migration.Rewrite(db, func(done, total uint) {
+			p.Done, p.Total = done, total
+			m.progress(p)
+		})
+		if err != nil {
+			return errors.Wrapf(err, "failed to rewrite records for "+
+				"migration %d (%s)", v, migration.Name)
+		}
+
+		pending = pending[1:]
+		if err = m.storePending(pending); err != nil {
+			return err
+		}
+
+		p.Complete = true
+		m.progress(p)
+	}
+
+	return nil
+}
+
+// loadPending returns the versions of migrations with pending rewrites.
+func (m *Migrator) loadPending() ([]uint, error) {
+	data, err := storage.GetLocalStorage().Get(
+		pendingRewritesKey + m.databaseName)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var pending []uint
+	if err = json.Unmarshal(data, &pending); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal pending migrations")
+	}
+	return pending, nil
+}
+
+// storePending saves the versions of migrations with pending rewrites.
+func (m *Migrator) storePending(pending []uint) error {
+	ls := storage.GetLocalStorage()
+	key := pendingRewritesKey + m.databaseName
+	if len(pending) == 0 {
+		ls.RemoveItem(key)
+		return nil
+	}
+
+	data, err := json.Marshal(pending)
+	if err != nil {
+		return err
+	}
+	if err = ls.Set(key, data); err != nil {
+		return errors.Wrapf(err, "localStorage: failed to set %q", key)
+	}
+	return nil
+}
+
+// appendVersion adds the version to the list if it is not already present.
+func appendVersion(versions []uint, v uint) []uint {
+	for _, existing := range versions {
+		if existing == v {
+			return versions
+		}
+	}
+	return append(versions, v)
+}
+
+// RewriteStore calls rewrite on every record in the given [idb.ObjectStore]
+// and replaces the record with the returned value. If rewrite returns
+// js.Undefined, the record is left unchanged. Progress is reported
+// periodically with the number of records processed and the total.
+func RewriteStore(db *idb.Database, objectStoreName string,
+	rewrite func(value js.Value) (js.Value, error),
+	progress func(done, total uint)) error {
+	parentErr := errors.Errorf("failed to rewrite %s", objectStoreName)
+
+	// Prepare the Transaction
+	txn, err := db.Transaction(idb.TransactionReadWrite, objectStoreName)
+	if err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(objectStoreName)
+	if err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to get ObjectStore: %+v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rewriteTimeout)
+	defer cancel()
+
+	// Get the total for progress reports
+	countRequest, err := store.Count()
+	if err != nil {
+		return errors.WithMessagef(parentErr, "Unable to Count: %+v", err)
+	}
+	total, err := countRequest.Await(ctx)
+	if err != nil {
+		return errors.WithMessagef(parentErr, "Unable to Count: %+v", err)
+	}
+
+	cursorRequest, err := store.OpenCursor(idb.CursorNext)
+	if err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to open Cursor: %+v", err)
+	}
+
+	// Perform the operation
+	var done uint
+	err = cursorRequest.Iter(ctx, func(cursor *idb.CursorWithValue) error {
+		value, err := cursor.Value()
+		if err != nil {
+			return err
+		}
+		newValue, err := rewrite(value)
+		if err != nil {
+			return err
+		}
+		if !newValue.IsUndefined() {
+			if _, err = cursor.Update(newValue); err != nil {
+				return err
+			}
+		}
+
+		done++
+		if done%MigrationProgressInterval == 0 {
+			progress(done, total)
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.WithMessagef(parentErr, "%+v", err)
+	} else if ctx.Err() != nil {
+		return errors.WithMessagef(parentErr, "%+v", ctx.Err())
+	}
+
+	if err = txn.Await(ctx); err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to commit Transaction: %+v", err)
+	}
+
+	progress(done, total)
+	return nil
+}
@@ -0,0 +1,198 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package impl
+
+import (
+	"reflect"
+	"strconv"
+	"syscall/js"
+	"testing"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+)
+
+const (
+	testMigrationStore = "records"
+	testMigrationIndex = "name"
+)
+
+// testMigrations returns the v1 schema and a v2 migration that adds an index
+// and rewrites every record to populate the indexed field. If failRewrite is
+// true, the v2 Rewrite returns an error.
+func testMigrations(failRewrite bool) []Migration {
+	return []Migration{
+		{
+			Name: "initial schema",
+			Schema: func(db *idb.Database, _ *idb.Transaction) error {
+				_, err := db.CreateObjectStore(testMigrationStore,
+					idb.ObjectStoreOptions{
+						KeyPath:       js.ValueOf("id"),
+						AutoIncrement: true,
+					})
+				return err
+			},
+		},
+		{
+			Name: "name index",
+			Schema: func(_ *idb.Database, txn *idb.Transaction) error {
+				store, err := txn.ObjectStore(testMigrationStore)
+				if err != nil {
+					return err
+				}
+				_, err = store.CreateIndex(testMigrationIndex,
+					js.ValueOf(testMigrationIndex), idb.IndexOptions{})
+				return err
+			},
+			Rewrite: func(db *idb.Database, progress func(done, total uint)) error {
+				if failRewrite {
+					return errors.New("rewrite interrupted")
+				}
+				return RewriteStore(db, testMigrationStore,
+					func(value js.Value) (js.Value, error) {
+						value.Set(testMigrationIndex,
+							"record"+strconv.Itoa(value.Get("id").Int()))
+						return value, nil
+					}, progress)
+			},
+		},
+	}
+}
+
+// newV1Fixture creates a v1 database with the given number of records and
+// closes it.
+func newV1Fixture(databaseName string, records int, t *testing.T) {
+	migrator := NewMigrator(databaseName, testMigrations(false)[:1], nil)
+	db, err := migrator.Open()
+	if err != nil {
+		t.Fatalf("Failed to open v1 database: %+v", err)
+	}
+
+	for i := 0; i < records; i++ {
+		_, err = Put(db, testMigrationStore,
+			js.ValueOf(map[string]any{"value": i}))
+		if err != nil {
+			t.Fatalf("Failed to put record %d: %+v", i, err)
+		}
+	}
+
+	if err = db.Close(); err != nil {
+		t.Fatalf("Failed to close v1 database: %+v", err)
+	}
+}
+
+// Tests that a v1 database is upgraded to v2 by Migrator.Open and
+// Migrator.RunPendingRewrites, that every existing record is rewritten, and
+// that progress is reported.
+func TestMigrator_Upgrade(t *testing.T) {
+	const databaseName = "TestMigrator_Upgrade"
+	const records = 250
+	newV1Fixture(databaseName, records, t)
+
+	var events []MigrationProgress
+	migrator := NewMigrator(databaseName, testMigrations(false),
+		func(p MigrationProgress) { events = append(events, p) })
+	if migrator.Version() != 2 {
+		t.Errorf("Unexpected version.\nexpected: %d\nreceived: %d",
+			2, migrator.Version())
+	}
+
+	db, err := migrator.Open()
+	if err != nil {
+		t.Fatalf("Failed to open v2 database: %+v", err)
+	}
+	if version, err2 := db.Version(); err2 != nil || version != 2 {
+		t.Errorf("Unexpected database version.\nexpected: %d\nreceived: %d"+
+			"\nerror: %+v", 2, version, err2)
+	}
+
+	if err = migrator.RunPendingRewrites(db); err != nil {
+		t.Fatalf("Failed to run pending rewrites: %+v", err)
+	}
+
+	// Every record must be reachable by the new index
+	for i := 1; i <= records; i++ {
+		_, err = GetIndex(db, testMigrationStore, testMigrationIndex,
+			js.ValueOf("record"+strconv.Itoa(i)))
+		if err != nil {
+			t.Errorf("Failed to get record %d from index: %+v", i, err)
+		}
+	}
+
+	expected := []MigrationProgress{
+		{DatabaseName: databaseName, Name: "name index", Version: 2},
+		{databaseName, "name index", 2, 100, records, false},
+		{databaseName, "name index", 2, 200, records, false},
+		{databaseName, "name index", 2, records, records, false},
+		{databaseName, "name index", 2, records, records, true},
+	}
+	if !reflect.DeepEqual(expected, events) {
+		t.Errorf("Unexpected progress events.\nexpected: %+v\nreceived: %+v",
+			expected, events)
+	}
+
+	pending, err := migrator.loadPending()
+	if err != nil || len(pending) != 0 {
+		t.Errorf("Pending rewrites not cleared: %v (%+v)", pending, err)
+	}
+}
+
+// Tests that a Rewrite that fails is run again on the next open and that
+// newly created databases have no pending rewrites.
+func TestMigrator_RunPendingRewrites_Resume(t *testing.T) {
+	const databaseName = "TestMigrator_RunPendingRewrites_Resume"
+	newV1Fixture(databaseName, 5, t)
+
+	migrator := NewMigrator(databaseName, testMigrations(true), nil)
+	db, err := migrator.Open()
+	if err != nil {
+		t.Fatalf("Failed to open v2 database: %+v", err)
+	}
+	if err = migrator.RunPendingRewrites(db); err == nil {
+		t.Fatalf("Failed to get error for interrupted rewrite.")
+	}
+	if err = db.Close(); err != nil {
+		t.Fatalf("Failed to close database: %+v", err)
+	}
+
+	// Reopen at the same version; the rewrite must still be pending
+	migrator = NewMigrator(databaseName, testMigrations(false), nil)
+	db, err = migrator.Open()
+	if err != nil {
+		t.Fatalf("Failed to reopen v2 database: %+v", err)
+	}
+	pending, err := migrator.loadPending()
+	if err != nil {
+		t.Fatalf("Failed to load pending rewrites: %+v", err)
+	} else if !reflect.DeepEqual([]uint{2}, pending) {
+		t.Errorf("Unexpected pending rewrites.\nexpected: %v\nreceived: %v",
+			[]uint{2}, pending)
+	}
+
+	if err = migrator.RunPendingRewrites(db); err != nil {
+		t.Fatalf("Failed to run pending rewrites: %+v", err)
+	}
+	_, err = GetIndex(db, testMigrationStore, testMigrationIndex,
+		js.ValueOf("record5"))
+	if err != nil {
+		t.Errorf("Failed to get record from index: %+v", err)
+	}
+
+	// A new database is created at the latest version with nothing to rewrite
+	const newDatabaseName = "TestMigrator_RunPendingRewrites_Resume_New"
+	migrator = NewMigrator(newDatabaseName, testMigrations(true), nil)
+	db, err = migrator.Open()
+	if err != nil {
+		t.Fatalf("Failed to open new database: %+v", err)
+	}
+	if err = migrator.RunPendingRewrites(db); err != nil {
+		t.Errorf("Rewrite run for new database: %+v", err)
+	}
+}
@@ -0,0 +1,152 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package impl
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/xxdk-wasm/storage"
+)
+
+const (
+	// MonitorInterval is the time between storage usage checks.
+	MonitorInterval = time.Minute
+
+	// minEvictionBytes is the number of bytes freed when a write exceeds the
+	// quota while the usage is below the low-water mark.
+	minEvictionBytes = 1 << 20
+)
+
+// ErrQuotaExceeded is returned when a write fails because the storage quota
+// of the origin is exceeded and not enough data could be evicted.
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// Evictor removes the least valuable data from a database, as allowed by the
+// policy, until at least the given number of bytes are freed or nothing more
+// can be removed. Returns the approximate number of bytes freed.
+type Evictor func(policy storage.EvictionPolicy, bytes uint64) (uint64, error)
+
+// The Evictor is kept for the worker rather than for each database, since
+// each worker opens exactly one event model and so one database. SetEvictor
+// must only be called by that model.
+var (
+	// evictor and evictionPolicy are the Evictor of the database opened in
+	// this worker and the policy it applies.
+	evictor        Evictor
+	evictionPolicy storage.EvictionPolicy
+	evictorMux     sync.Mutex
+
+	// evicting is true while the Evictor is running. Writes made by the
+	// Evictor must not start another eviction.
+	evicting atomic.Bool
+)
+
+// SetEvictor sets the Evictor used to free space when the storage usage
+// exceeds the high-water mark of the policy or a write exceeds the quota. A
+// zero policy is replaced with the [storage.DefaultEvictionPolicy]. Calling it
+// again replaces the Evictor of the worker.
+//
+// The Evictor is run during a write that exceeds the quota, and by
+// MonitorStorage through the run function it is given, so it is only ever run
+// serially with the other changes to the database.
+func SetEvictor(policy storage.EvictionPolicy, e Evictor) {
+	if policy == (storage.EvictionPolicy{}) {
+		policy = storage.DefaultEvictionPolicy()
+	}
+
+	evictorMux.Lock()
+	defer evictorMux.Unlock()
+	evictor = e
+	evictionPolicy = policy
+}
+
+// Evict frees space if the storage usage of the origin is above the
+// high-water mark until it is below the low-water mark. Returns the
+// approximate number of bytes freed.
+func Evict() (uint64, error) {
+	return evict(false)
+}
+
+// evict runs the Evictor if the usage is above the high-water mark or if force
+// is true. Does nothing if there is no Evictor, eviction is disabled, or an
+// eviction is already running.
+func evict(force bool) (uint64, error) {
+	evictorMux.Lock()
+	e, policy := evictor, evictionPolicy
+	evictorMux.Unlock()
+	if e == nil || policy.Disabled {
+		return 0, nil
+	}
+
+	if !evicting.CompareAndSwap(false, true) {
+		return 0, nil
+	}
+	defer evicting.Store(false)
+
+	estimate, err := storage.EstimateStorage()
+	if err != nil {
+		return 0, err
+	}
+
+	quota := float64(estimate.Quota)
+	usage := float64(estimate.Usage)
+	if !force && usage < policy.HighWaterMark*quota {
+		return 0, nil
+	}
+
+	var bytes uint64
+	if target := policy.LowWaterMark * quota; usage > target {
+		bytes = uint64(usage - target)
+	}
+	if force && bytes < minEvictionBytes {
+		// A write exceeded the quota even though the estimate is below the
+		// low-water mark, so free enough for the write to be retried
+		bytes = minEvictionBytes
+	}
+
+	freed, err := e(policy, bytes)
+	if err != nil {
+		return freed, errors.Wrap(err, "failed to evict data")
+	}
+	jww.INFO.Printf("Evicted %d bytes from storage (usage %d of %d bytes)",
+		freed, estimate.Usage, estimate.Quota)
+	return freed, nil
+}
+
+// MonitorStorage checks the storage usage every interval and evicts data if it
+// is above the high-water mark. Each check is passed to run, which must run it
+// serially with every other change to the database. It never returns, so it
+// must be run on its own goroutine.
+func MonitorStorage(interval time.Duration, run func(fn func())) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		run(func() {
+			if _, err := Evict(); err != nil {
+				jww.ERROR.Printf("Failed to monitor storage usage: %+v", err)
+			}
+		})
+
+		<-ticker.C
+	}
+}
+
+// isQuotaExceeded returns true if the error was caused by the browser's
+// QuotaExceededError.
+func isQuotaExceeded(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "QuotaExceededError")
+}
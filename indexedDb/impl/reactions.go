@@ -0,0 +1,87 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package impl
+
+import (
+	"bytes"
+	"sort"
+
+	"gitlab.com/elixxir/client/v4/emoji"
+)
+
+// ReactionCount is the number of distinct senders that reacted to a message
+// with a single emoji.
+type ReactionCount struct {
+	// Emoji is the reaction.
+	Emoji string
+
+	// Count is the number of distinct senders that reacted with the emoji.
+	Count uint
+
+	// Reacted is true if the local identity reacted with the emoji.
+	Reacted bool
+}
+
+// ReactionTally groups the reactions to a single message by emoji. Each sender
+// is only counted once per emoji.
+type ReactionTally struct {
+	self    []byte
+	senders map[string]map[string]struct{}
+	reacted map[string]bool
+}
+
+// NewReactionTally returns an empty ReactionTally. Reactions sent with the
+// self public key are reported as reacted by the local identity.
+func NewReactionTally(self []byte) *ReactionTally {
+	return &ReactionTally{
+		self:    self,
+		senders: make(map[string]map[string]struct{}),
+		reacted: make(map[string]bool),
+	}
+}
+
+// Add counts the reaction from the sender. Reactions that are not a single
+// supported emoji, as defined by [emoji.ValidateReaction], are ignored.
+// Returns true if the reaction was counted.
+func (t *ReactionTally) Add(reaction string, sender []byte) bool {
+	if emoji.ValidateReaction(reaction) != nil {
+		return false
+	}
+
+	if _, exists := t.senders[reaction]; !exists {
+		t.senders[reaction] = make(map[string]struct{})
+	}
+	t.senders[reaction][string(sender)] = struct{}{}
+	if len(t.self) > 0 && bytes.Equal(sender, t.self) {
+		t.reacted[reaction] = true
+	}
+	return true
+}
+
+// Counts returns the count of each emoji, ordered from most to least used.
+// Emojis with the same count are ordered by their string value.
+func (t *ReactionTally) Counts() []ReactionCount {
+	counts := make([]ReactionCount, 0, len(t.senders))
+	for reaction, senders := range t.senders {
+		counts = append(counts, ReactionCount{
+			Emoji:   reaction,
+			Count:   uint(len(senders)),
+			Reacted: t.reacted[reaction],
+		})
+	}
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Emoji < counts[j].Emoji
+	})
+	return counts
+}
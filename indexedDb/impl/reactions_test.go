@@ -0,0 +1,52 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package impl
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Tests that ReactionTally.Counts counts each sender once per emoji, marks the
+// emojis the local identity reacted with, ignores invalid reactions, and
+// orders the emojis by count.
+func TestReactionTally_Counts(t *testing.T) {
+	self := []byte("self")
+	tally := NewReactionTally(self)
+
+	reactions := []struct {
+		reaction string
+		sender   string
+		valid    bool
+	}{
+		{"👍", "alice", true},
+		{"👍", "bob", true},
+		{"👍", "alice", true},
+		{"😀", "self", true},
+		{"👍", "self", true},
+		{"not an emoji", "bob", false},
+		{"👍👍", "bob", false},
+	}
+	for i, r := range reactions {
+		if added := tally.Add(r.reaction, []byte(r.sender)); added != r.valid {
+			t.Errorf("Unexpected result adding reaction %q (%d)."+
+				"\nexpected: %t\nreceived: %t", r.reaction, i, r.valid, added)
+		}
+	}
+
+	expected := []ReactionCount{
+		{Emoji: "👍", Count: 3, Reacted: true},
+		{Emoji: "😀", Count: 1, Reacted: true},
+	}
+	if counts := tally.Counts(); !reflect.DeepEqual(expected, counts) {
+		t.Errorf("Unexpected counts.\nexpected: %+v\nreceived: %+v",
+			expected, counts)
+	}
+}
@@ -0,0 +1,170 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+// This file contains the read marker store, which tracks the last read message
+// and the number of unread messages in each channel or conversation.
+
+package impl
+
+import (
+	"encoding/json"
+	"strings"
+	"syscall/js"
+	"time"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+
+	"gitlab.com/elixxir/wasm-utils/utils"
+)
+
+const (
+	// ReadMarkerStoreName is the name of the [idb.ObjectStore] that holds the
+	// read markers.
+	ReadMarkerStoreName = "readMarkers"
+
+	// readMarkerStorePkey is the keyPath of the read marker store (must match
+	// the json struct tag).
+	readMarkerStorePkey = "id"
+
+	// UnreadCountEvent is the event type sent on the event update callback
+	// when the unread count of a channel or conversation changes. It is
+	// outside the range used by bindings event types.
+	UnreadCountEvent int64 = 100001
+)
+
+// ReadMarker defines the IndexedDb representation of the read position in a
+// single channel or conversation.
+type ReadMarker struct {
+	// ID is the channel ID or conversation partner public key. It is blinded
+	// if all sensitive fields are encrypted.
+	ID []byte `json:"id"` // Matches readMarkerStorePkey
+
+	// LastRead is the UUID of the last message marked as read.
+	LastRead uint64 `json:"last_read"`
+
+	// LastReadTimestamp is the timestamp of the last message marked as read.
+	// Messages sent at or before this time are read.
+	LastReadTimestamp time.Time `json:"last_read_timestamp"`
+
+	// Unread is the number of unread messages.
+	Unread uint `json:"unread"`
+}
+
+// IsRead returns true if a message sent at the timestamp has been read.
+func (m *ReadMarker) IsRead(timestamp time.Time) bool {
+	return !timestamp.After(m.LastReadTimestamp)
+}
+
+// AddUnread adds delta to the unread count. The count never drops below zero.
+func (m *ReadMarker) AddUnread(delta int) {
+	if delta < 0 && uint(-delta) > m.Unread {
+		m.Unread = 0
+	} else {
+		m.Unread = uint(int(m.Unread) + delta)
+	}
+}
+
+// CreateReadMarkerStore builds the read marker [idb.ObjectStore]. It must be
+// called during a database upgrade.
+func CreateReadMarkerStore(db *idb.Database) error {
+	_, err := db.CreateObjectStore(ReadMarkerStoreName,
+		idb.ObjectStoreOptions{
+			KeyPath:       js.ValueOf(readMarkerStorePkey),
+			AutoIncrement: false,
+		})
+	return err
+}
+
+// GetReadMarker returns the ReadMarker with the given ID. Returns nil and no
+// error if none exists.
+func GetReadMarker(db *idb.Database, id []byte) (*ReadMarker, error) {
+	obj, err := Get(db, ReadMarkerStoreName, EncodeBytes(id))
+	if err != nil {
+		if strings.Contains(err.Error(), ErrDoesNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return valueToReadMarker(obj)
+}
+
+// GetReadMarkerTxn returns the ReadMarker with the given ID as part of the
+// Transaction, which must include the ReadMarkerStoreName object store.
+// Returns nil and no error if none exists.
+func GetReadMarkerTxn(txn *Transaction, id []byte) (*ReadMarker, error) {
+	obj, err := txn.Get(ReadMarkerStoreName, EncodeBytes(id))
+	if err != nil {
+		if strings.Contains(err.Error(), ErrDoesNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return valueToReadMarker(obj)
+}
+
+// PutReadMarker inserts or replaces the ReadMarker.
+func PutReadMarker(db *idb.Database, marker *ReadMarker) error {
+	obj, err := readMarkerToValue(marker)
+	if err != nil {
+		return err
+	}
+
+	_, err = Put(db, ReadMarkerStoreName, obj)
+	return err
+}
+
+// PutReadMarkerTxn inserts or replaces the ReadMarker as part of the
+// Transaction, which must include the ReadMarkerStoreName object store.
+func PutReadMarkerTxn(txn *Transaction, marker *ReadMarker) error {
+	obj, err := readMarkerToValue(marker)
+	if err != nil {
+		return err
+	}
+
+	_, err = txn.Put(ReadMarkerStoreName, obj)
+	return err
+}
+
+// readMarkerToValue converts the ReadMarker to a js.Value.
+func readMarkerToValue(marker *ReadMarker) (js.Value, error) {
+	data, err := json.Marshal(marker)
+	if err != nil {
+		return js.Undefined(),
+			errors.Errorf("Unable to marshal ReadMarker: %+v", err)
+	}
+	obj, err := utils.JsonToJS(data)
+	if err != nil {
+		return js.Undefined(),
+			errors.Errorf("Unable to marshal ReadMarker: %+v", err)
+	}
+	return obj, nil
+}
+
+// valueToReadMarker converts the js.Value to a ReadMarker.
+func valueToReadMarker(obj js.Value) (*ReadMarker, error) {
+	marker := &ReadMarker{}
+	err := json.Unmarshal([]byte(utils.JsToJson(obj)), marker)
+	if err != nil {
+		return nil, errors.Errorf("Unable to unmarshal ReadMarker: %+v", err)
+	}
+	return marker, nil
+}
+
+// DeleteReadMarker removes the ReadMarker with the given ID, if it exists.
+func DeleteReadMarker(db *idb.Database, id []byte) error {
+	return Delete(db, ReadMarkerStoreName, EncodeBytes(id))
+}
+
+// DeleteReadMarkerTxn removes the ReadMarker with the given ID as part of the
+// Transaction, which must include the ReadMarkerStoreName object store.
+func DeleteReadMarkerTxn(txn *Transaction, id []byte) error {
+	return txn.Delete(ReadMarkerStoreName, EncodeBytes(id))
+}
@@ -0,0 +1,51 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package impl
+
+import (
+	"testing"
+	"time"
+)
+
+// Tests that ReadMarker.IsRead treats messages sent at or before the last read
+// timestamp as read.
+func TestReadMarker_IsRead(t *testing.T) {
+	now := time.Now()
+	marker := &ReadMarker{LastReadTimestamp: now}
+
+	if !marker.IsRead(now.Add(-time.Second)) {
+		t.Errorf("Older message should be read.")
+	}
+	if !marker.IsRead(now) {
+		t.Errorf("Message at the last read timestamp should be read.")
+	}
+	if marker.IsRead(now.Add(time.Second)) {
+		t.Errorf("Newer message should not be read.")
+	}
+}
+
+// Tests that ReadMarker.AddUnread never drops the count below zero.
+func TestReadMarker_AddUnread(t *testing.T) {
+	marker := &ReadMarker{}
+
+	tests := []struct {
+		delta    int
+		expected uint
+	}{{1, 1}, {2, 3}, {-1, 2}, {-5, 0}, {1, 1}}
+
+	for i, tt := range tests {
+		marker.AddUnread(tt.delta)
+		if marker.Unread != tt.expected {
+			t.Errorf("Unexpected unread count after adding %d (%d)."+
+				"\nexpected: %d\nreceived: %d",
+				tt.delta, i, tt.expected, marker.Unread)
+		}
+	}
+}
@@ -0,0 +1,365 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+// This file contains an encrypted inverted index that allows searching the
+// text of messages stored by the IndexedDb implementations without storing
+// any of the plaintext.
+
+package impl
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strings"
+	"syscall/js"
+	"time"
+	"unicode"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
+	"gitlab.com/elixxir/wasm-utils/utils"
+)
+
+const (
+	// SearchStoreName is the name of the [idb.ObjectStore] that holds the
+	// search index.
+	SearchStoreName = "search"
+
+	// Search index names.
+	searchStoreTokenIndex   = "token_index"
+	searchStoreMessageIndex = "message_uuid_index"
+	searchStoreScopeIndex   = "scope_index"
+
+	// Search keyPath names (must match json struct tags).
+	searchStorePkey    = "id"
+	searchStoreToken   = "token"
+	searchStoreMessage = "message_uuid"
+	searchStoreScope   = "scope"
+
+	// searchKeyContext is the HMAC context used to derive the search key from
+	// the database cipher secret.
+	searchKeyContext = "xxdkWasmSearchIndexKey"
+
+	// maxSearchTokenLength is the maximum number of runes in a single token.
+	// Longer words are truncated before being hashed.
+	maxSearchTokenLength = 64
+)
+
+// SearchToken defines the IndexedDb representation of a single token in the
+// search index. One SearchToken exists for each unique token in a message.
+type SearchToken struct {
+	ID          uint64    `json:"id,omitempty"` // Matches searchStorePkey
+	Token       string    `json:"token"`        // Index
+	MessageUUID uint64    `json:"message_uuid"` // Index
+	Scope       []byte    `json:"scope"`        // Index
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// SearchIndex manages an inverted index of message tokens. Tokens are keyed
+// with an HMAC so that the index reveals nothing about the message contents
+// when the database is encrypted.
+//
+// Each message is indexed with a scope (e.g., a channel ID or conversation
+// public key) so that searches can be restricted to a single channel or
+// conversation.
+type SearchIndex struct {
+	db  *idb.Database
+	key []byte
+}
+
+// CreateSearchStore builds the search [idb.ObjectStore] and its indexes. It
+// must be called during a database upgrade.
+func CreateSearchStore(db *idb.Database) error {
+	indexOpts := idb.IndexOptions{
+		Unique:     false,
+		MultiEntry: false,
+	}
+
+	searchStore, err := db.CreateObjectStore(SearchStoreName,
+		idb.ObjectStoreOptions{
+			KeyPath:       js.ValueOf(searchStorePkey),
+			AutoIncrement: true,
+		})
+	if err != nil {
+		return err
+	}
+	_, err = searchStore.CreateIndex(searchStoreTokenIndex,
+		js.ValueOf(searchStoreToken), indexOpts)
+	if err != nil {
+		return err
+	}
+	_, err = searchStore.CreateIndex(searchStoreMessageIndex,
+		js.ValueOf(searchStoreMessage), indexOpts)
+	if err != nil {
+		return err
+	}
+	_, err = searchStore.CreateIndex(searchStoreScopeIndex,
+		js.ValueOf(searchStoreScope), indexOpts)
+	return err
+}
+
+// NewSearchIndex returns a SearchIndex for the given database. If the
+// database is encrypted, the HMAC key is derived from the cipher secret.
+// Otherwise, tokens are hashed with an empty key.
+func NewSearchIndex(db *idb.Database, cipher idbCrypto.Cipher) (*SearchIndex, error) {
+	s := &SearchIndex{db: db}
+	if cipher == nil {
+		return s, nil
+	}
+
+	key, err := deriveKey(cipher, searchKeyContext)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to derive search key")
+	}
+	s.key = key
+	return s, nil
+}
+
+// Add indexes the given text for the message with the given UUID. Any tokens
+// previously indexed for the message are replaced.
+func (s *SearchIndex) Add(uuid uint64, scope []byte, timestamp time.Time,
+	text string) error {
+	parentErr := errors.Errorf("failed to add message %d to search index", uuid)
+
+	err := s.Remove(uuid)
+	if err != nil {
+		return errors.WithMessagef(parentErr, "%+v", err)
+	}
+
+	tokens := s.tokenize(text)
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	// Prepare the Transaction
+	txn, err := s.db.Transaction(idb.TransactionReadWrite, SearchStoreName)
+	if err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(SearchStoreName)
+	if err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to get ObjectStore: %+v", err)
+	}
+
+	// Queue a put for every token and wait for all of them to complete
+	for _, token := range tokens {
+		tokenJson, err := json.Marshal(&SearchToken{
+			Token:       token,
+			MessageUUID: uuid,
+			Scope:       scope,
+			Timestamp:   timestamp,
+		})
+		if err != nil {
+			return errors.WithMessagef(parentErr,
+				"Unable to marshal SearchToken: %+v", err)
+		}
+		tokenObj, err := utils.JsonToJS(tokenJson)
+		if err != nil {
+			return errors.WithMessagef(parentErr,
+				"Unable to marshal SearchToken: %+v", err)
+		}
+		if _, err = store.Put(tokenObj); err != nil {
+			return errors.WithMessagef(parentErr, "Unable to Put: %+v", err)
+		}
+	}
+
+	ctx, cancel, timeout := newCommitContext()
+	defer cancel()
+	err = txn.Await(ctx)
+	if ctxErr := contextErr(ctx, CommitOperation, timeout); ctxErr != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to store tokens: %+v", ctxErr)
+	} else if err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to store tokens: %+v", err)
+	}
+
+	jww.DEBUG.Printf("Indexed %d tokens for message %d", len(tokens), uuid)
+	return nil
+}
+
+// Remove deletes all tokens indexed for the message with the given UUID.
+func (s *SearchIndex) Remove(uuid uint64) error {
+	return s.deleteByIndex(searchStoreMessageIndex, js.ValueOf(uuid))
+}
+
+// RemoveTxn deletes all tokens indexed for the message with the given UUID as
+// part of the Transaction, which must include the SearchStoreName object store.
+func (s *SearchIndex) RemoveTxn(txn *Transaction, uuid uint64) error {
+	return txn.DeleteByIndex(
+		SearchStoreName, searchStoreMessageIndex, js.ValueOf(uuid))
+}
+
+// RemoveScope deletes all tokens indexed in the given scope.
+func (s *SearchIndex) RemoveScope(scope []byte) error {
+	return s.deleteByIndex(searchStoreScopeIndex, EncodeBytes(scope))
+}
+
+// RemoveScopeTxn deletes all tokens indexed in the given scope as part of the
+// Transaction, which must include the SearchStoreName object store.
+func (s *SearchIndex) RemoveScopeTxn(txn *Transaction, scope []byte) error {
+	return txn.DeleteByIndex(
+		SearchStoreName, searchStoreScopeIndex, EncodeBytes(scope))
+}
+
+// deleteByIndex deletes every token matching the key in the given index.
+func (s *SearchIndex) deleteByIndex(indexName string, key js.Value) error {
+	err := RunTransaction(s.db, func(txn *Transaction) error {
+		return txn.DeleteByIndex(SearchStoreName, indexName, key)
+	}, SearchStoreName)
+	if err != nil {
+		return errors.WithMessagef(err,
+			"failed to delete search tokens by %s", indexName)
+	}
+	return nil
+}
+
+// Search returns the UUIDs of up to limit messages that contain every word in
+// the query, ordered from newest to oldest. If scope is not nil, only messages
+// indexed in that scope are returned. The search stops early if the context is
+// done.
+func (s *SearchIndex) Search(ctx context.Context, query string, scope []byte,
+	limit int) ([]uint64, error) {
+	parentErr := errors.New("failed to search messages")
+
+	if limit <= 0 {
+		return nil, errors.WithMessagef(parentErr,
+			"limit must be greater than zero, received %d", limit)
+	}
+
+	tokens := s.tokenize(query)
+	if len(tokens) == 0 {
+		return []uint64{}, nil
+	}
+
+	// Find the messages that match every token. The matches for each token are
+	// intersected with the matches for all previous tokens.
+	var matches map[uint64]time.Time
+	for _, token := range tokens {
+		tokenMatches := make(map[uint64]time.Time)
+		err := s.iterToken(ctx, token, func(st *SearchToken) {
+			if scope != nil && !bytes.Equal(st.Scope, scope) {
+				return
+			}
+			if matches != nil {
+				if _, exists := matches[st.MessageUUID]; !exists {
+					return
+				}
+			}
+			tokenMatches[st.MessageUUID] = st.Timestamp
+		})
+		if err != nil {
+			return nil, errors.WithMessagef(parentErr, "%+v", err)
+		}
+
+		matches = tokenMatches
+		if len(matches) == 0 {
+			return []uint64{}, nil
+		}
+	}
+
+	// Rank the matches by recency
+	uuids := make([]uint64, 0, len(matches))
+	for uuid := range matches {
+		uuids = append(uuids, uuid)
+	}
+	sort.Slice(uuids, func(i, j int) bool {
+		ti, tj := matches[uuids[i]], matches[uuids[j]]
+		if ti.Equal(tj) {
+			return uuids[i] > uuids[j]
+		}
+		return ti.After(tj)
+	})
+	if len(uuids) > limit {
+		uuids = uuids[:limit]
+	}
+
+	return uuids, nil
+}
+
+// iterToken calls the given function for every SearchToken that matches the
+// given hashed token.
+func (s *SearchIndex) iterToken(
+	ctx context.Context, token string, fn func(st *SearchToken)) error {
+	// Prepare the Transaction
+	txn, err := s.db.Transaction(idb.TransactionReadOnly, SearchStoreName)
+	if err != nil {
+		return errors.Errorf("Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(SearchStoreName)
+	if err != nil {
+		return errors.Errorf("Unable to get ObjectStore: %+v", err)
+	}
+	index, err := store.Index(searchStoreTokenIndex)
+	if err != nil {
+		return errors.Errorf("Unable to get Index: %+v", err)
+	}
+
+	// Set up the operation
+	keyRange, err := idb.NewKeyRangeOnly(js.ValueOf(token))
+	if err != nil {
+		return errors.Errorf("Unable to NewKeyRangeOnly: %+v", err)
+	}
+	cursorRequest, err := index.OpenCursorRange(keyRange, idb.CursorNext)
+	if err != nil {
+		return errors.Errorf("Unable to open Cursor: %+v", err)
+	}
+
+	// Perform the operation
+	return SendCursorRequestContext(ctx, cursorRequest,
+		func(cursor *idb.CursorWithValue) error {
+			value, err := cursor.Value()
+			if err != nil {
+				return err
+			}
+			st := &SearchToken{}
+			err = json.Unmarshal([]byte(utils.JsToJson(value)), st)
+			if err != nil {
+				return err
+			}
+			fn(st)
+			return nil
+		})
+}
+
+// tokenize splits the text into lowercase words, removes duplicates, and
+// returns the keyed hash of each word.
+func (s *SearchIndex) tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	seen := make(map[string]struct{}, len(words))
+	tokens := make([]string, 0, len(words))
+	for _, word := range words {
+		if runes := []rune(word); len(runes) > maxSearchTokenLength {
+			word = string(runes[:maxSearchTokenLength])
+		}
+
+		mac := hmac.New(sha256.New, s.key)
+		mac.Write([]byte(word))
+		token := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+		if _, exists := seen[token]; !exists {
+			seen[token] = struct{}{}
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
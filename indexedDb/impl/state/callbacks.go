@@ -13,10 +13,13 @@ import (
 	"encoding/json"
 	"github.com/pkg/errors"
 
+	"gitlab.com/elixxir/crypto/fastRNG"
+	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
 	"gitlab.com/elixxir/wasm-utils/exception"
 	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
 	stateWorker "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/state"
 	"gitlab.com/elixxir/xxdk-wasm/worker"
+	"gitlab.com/xx_network/crypto/csprng"
 )
 
 // manager handles the message callbacks, which is used to
@@ -32,6 +35,9 @@ func (m *manager) registerCallbacks() {
 	m.wtm.RegisterCallback(stateWorker.NewStateTag, m.newStateCB)
 	m.wtm.RegisterCallback(stateWorker.SetTag, m.setCB)
 	m.wtm.RegisterCallback(stateWorker.GetTag, m.getCB)
+	m.wtm.RegisterCallback(stateWorker.DeleteTag, m.deleteCB)
+	m.wtm.RegisterCallback(stateWorker.KeysTag, m.keysCB)
+	m.wtm.RegisterCallback(stateWorker.ClearTag, m.clearCB)
 }
 
 // newStateCB is the callback for NewState. Returns an empty
@@ -45,7 +51,26 @@ func (m *manager) newStateCB(message []byte, reply func(message []byte)) {
 		return
 	}
 
-	m.model, err = NewState(msg.DatabaseName)
+	// Apply the timeouts set on the main thread over the startup flags
+	if err = impl.SetTimeouts(msg.Timeouts); err != nil {
+		reply([]byte(err.Error()))
+		return
+	}
+
+	// Create new encryption cipher
+	var encryption idbCrypto.Cipher
+	if msg.EncryptionJSON != "" && msg.EncryptionJSON != "null" {
+		rng := fastRNG.NewStreamGenerator(12, 1024, csprng.NewSystemRNG)
+		encryption, err = idbCrypto.NewCipherFromJSON(
+			[]byte(msg.EncryptionJSON), rng.GetStream())
+		if err != nil {
+			reply([]byte(errors.Wrap(err,
+				"failed to JSON unmarshal Cipher from main thread").Error()))
+			return
+		}
+	}
+
+	m.model, err = NewState(msg.DatabaseName, encryption)
 	if err != nil {
 		reply([]byte(err.Error()))
 		return
@@ -82,7 +107,9 @@ func (m *manager) getCB(message []byte, reply func(message []byte)) {
 	msg := stateWorker.TransferMessage{
 		Key:   key,
 		Value: result,
-		Error: err.Error(),
+	}
+	if err != nil {
+		msg.Error = err.Error()
 	}
 
 	replyMessage, err := json.Marshal(msg)
@@ -92,3 +119,44 @@ func (m *manager) getCB(message []byte, reply func(message []byte)) {
 
 	reply(replyMessage)
 }
+
+// deleteCB is the callback for stateModel.Delete.
+// Returns nil on success or an error message on failure.
+func (m *manager) deleteCB(message []byte, reply func(message []byte)) {
+	err := m.model.Delete(string(message))
+	if err != nil {
+		reply([]byte(err.Error()))
+		return
+	}
+
+	reply(nil)
+}
+
+// keysCB is the callback for stateModel.Keys.
+// Returns the JSON marshalled stateWorker.KeysMessage.
+func (m *manager) keysCB(_ []byte, reply func(message []byte)) {
+	keys, err := m.model.Keys()
+	msg := stateWorker.KeysMessage{Keys: keys}
+	if err != nil {
+		msg.Error = err.Error()
+	}
+
+	replyMessage, err := json.Marshal(msg)
+	if err != nil {
+		exception.Throwf("Could not JSON marshal %T for Keys: %+v", msg, err)
+	}
+
+	reply(replyMessage)
+}
+
+// clearCB is the callback for stateModel.Clear.
+// Returns nil on success or an error message on failure.
+func (m *manager) clearCB(_ []byte, reply func(message []byte)) {
+	err := m.model.Clear()
+	if err != nil {
+		reply([]byte(err.Error()))
+		return
+	}
+
+	reply(nil)
+}
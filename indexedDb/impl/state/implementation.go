@@ -13,6 +13,7 @@ import (
 	"encoding/json"
 	"github.com/hack-pad/go-indexeddb/idb"
 	"github.com/pkg/errors"
+	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
 	"gitlab.com/elixxir/wasm-utils/utils"
 	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
 	"syscall/js"
@@ -22,9 +23,12 @@ import (
 // NOTE: This model is NOT thread safe - it is the responsibility of the
 // caller to ensure that its methods are called sequentially.
 type stateModel struct {
-	db *idb.Database
+	db     *idb.Database
+	cipher idbCrypto.Cipher
 }
 
+// Get returns the value stored at the given key. If encryption is enabled, the
+// value is decrypted before it is returned.
 func (s *stateModel) Get(key string) ([]byte, error) {
 	result, err := impl.Get(s.db, stateStoreName, js.ValueOf(key))
 	if err != nil {
@@ -37,13 +41,33 @@ func (s *stateModel) Get(key string) ([]byte, error) {
 		return nil, err
 	}
 
+	// Handle decryption, if it is present
+	if s.cipher != nil {
+		value, err := impl.DecryptChunks(s.cipher, stateObj.EncryptedValue)
+		if err != nil {
+			return nil, errors.Errorf("Unable to decrypt State: %+v", err)
+		}
+		return value, nil
+	}
+
 	return stateObj.Value, err
 }
 
+// Set stores the value at the given key, replacing any existing value. If
+// encryption is enabled, the value is encrypted in chunks of the cipher's block
+// size before it is stored. Keys are always stored in plaintext.
 func (s *stateModel) Set(key string, value []byte) error {
-	state := &State{
-		Id:    key,
-		Value: value,
+	state := &State{Id: key}
+
+	// Handle encryption, if it is present
+	if s.cipher != nil {
+		var err error
+		state.EncryptedValue, err = impl.EncryptChunks(s.cipher, value)
+		if err != nil {
+			return errors.Errorf("Unable to encrypt State: %+v", err)
+		}
+	} else {
+		state.Value = value
 	}
 
 	// Convert to jsObject
@@ -64,3 +88,28 @@ func (s *stateModel) Set(key string, value []byte) error {
 	}
 	return nil
 }
+
+// Delete removes the value stored at the given key. Deleting a key that does
+// not exist is not an error.
+func (s *stateModel) Delete(key string) error {
+	return impl.Delete(s.db, stateStoreName, js.ValueOf(key))
+}
+
+// Keys returns all keys in the store in ascending order.
+func (s *stateModel) Keys() ([]string, error) {
+	results, err := impl.GetAllKeys(s.db, stateStoreName)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, len(results))
+	for i, result := range results {
+		keys[i] = result.String()
+	}
+	return keys, nil
+}
+
+// Clear removes all values from the store.
+func (s *stateModel) Clear() error {
+	return impl.Clear(s.db, stateStoreName)
+}
@@ -0,0 +1,49 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"syscall/js"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
+	"gitlab.com/elixxir/wasm-utils/utils"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	"gitlab.com/xx_network/crypto/csprng"
+)
+
+// Tests that a value larger than the cipher's block size is encrypted at rest
+// and decrypted by stateModel.Get.
+func TestStateModel_Set_Encrypted(t *testing.T) {
+	c, err := idbCrypto.NewCipher(
+		[]byte("testPass"), []byte("testSalt"), 32, csprng.NewSystemRNG())
+	require.NoError(t, err)
+	s, err := newState("TestStateModel_Set_Encrypted", c)
+	require.NoError(t, err)
+
+	value := bytes.Repeat([]byte("TestStateModel_Set_Encrypted"), 10)
+	require.Greater(t, len(value), 32)
+	require.NoError(t, s.Set("key", value))
+
+	raw, err := impl.Get(s.db, stateStoreName, js.ValueOf("key"))
+	require.NoError(t, err)
+	var stored State
+	require.NoError(t, json.Unmarshal([]byte(utils.JsToJson(raw)), &stored))
+	require.Empty(t, stored.Value)
+	require.Greater(t, len(stored.EncryptedValue), 1)
+
+	received, err := s.Get("key")
+	require.NoError(t, err)
+	require.Equal(t, value, received)
+}
@@ -11,69 +11,52 @@ package main
 
 import (
 	"github.com/hack-pad/go-indexeddb/idb"
-	jww "github.com/spf13/jwalterweatherman"
+	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
 	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
 	"syscall/js"
 )
 
-// currentVersion is the current version of the IndexedDb runtime. Used for
-// migration purposes.
-const currentVersion uint = 1
-
 // NewState returns a [utility.WebState] backed by IndexedDb.
-// The name should be a base64 encoding of the users public key.
-func NewState(databaseName string) (impl.WebState, error) {
-	return newState(databaseName)
+// The name should be a base64 encoding of the users public key. If encryption
+// is nil, values are stored in plaintext.
+func NewState(
+	databaseName string, encryption idbCrypto.Cipher) (impl.WebState, error) {
+	return newState(databaseName, encryption)
 }
 
 // newState creates the given [idb.Database] and returns a stateModel.
-func newState(databaseName string) (*stateModel, error) {
+func newState(
+	databaseName string, encryption idbCrypto.Cipher) (*stateModel, error) {
 	// Attempt to open database object
-	ctx, cancel := impl.NewContext()
-	defer cancel()
-	openRequest, err := idb.Global().Open(ctx, databaseName, currentVersion,
-		func(db *idb.Database, oldVersion, newVersion uint) error {
-			if oldVersion == newVersion {
-				jww.INFO.Printf("IndexDb version for %s is current: v%d",
-					databaseName, newVersion)
-				return nil
-			}
-
-			jww.INFO.Printf("IndexDb upgrade required for %s: v%d -> v%d",
-				databaseName, oldVersion, newVersion)
-
-			if oldVersion == 0 && newVersion >= 1 {
-				err := v1Upgrade(db)
-				if err != nil {
-					return err
-				}
-				oldVersion = 1
-			}
-
-			// if oldVersion == 1 && newVersion >= 2 { v2Upgrade(), oldVersion = 2 }
-			return nil
-		})
+	migrator := impl.NewMigrator(databaseName, migrations, nil)
+	db, err := migrator.Open()
 	if err != nil {
 		return nil, err
 	}
 
-	// Wait for database open to finish
-	db, err := openRequest.Await(ctx)
+	err = migrator.RunPendingRewrites(db)
 	if err != nil {
 		return nil, err
-	} else if ctx.Err() != nil {
-		return nil, ctx.Err()
 	}
 
-	wrapper := &stateModel{db: db}
+	wrapper := &stateModel{db: db, cipher: encryption}
 	return wrapper, nil
 }
 
+// migrations is the ordered list of database migrations. The migration at index
+// i upgrades the database to version i+1.
+//
+// Migrations can never be changed or reordered without permanently breaking
+// backwards compatibility. New migrations must be appended to the end.
+var migrations = []impl.Migration{
+	{Name: "initial schema", Schema: v1Upgrade},
+}
+
 // v1Upgrade performs the v0 -> v1 database upgrade.
 //
 // This can never be changed without permanently breaking backwards
 // compatibility.
-func v1Upgrade(db *idb.Database) error {
+func v1Upgrade(db *idb.Database, _ *idb.Transaction) error {
 	storeOpts := idb.ObjectStoreOptions{
 		KeyPath:       js.ValueOf(pkeyName),
 		AutoIncrement: false,
@@ -13,11 +13,13 @@ import (
 	"fmt"
 	"os"
 	"syscall/js"
+	"time"
 
 	"github.com/spf13/cobra"
 	jww "github.com/spf13/jwalterweatherman"
 
 	"gitlab.com/elixxir/wasm-utils/exception"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
 	"gitlab.com/elixxir/xxdk-wasm/logging"
 	"gitlab.com/elixxir/xxdk-wasm/worker"
 )
@@ -52,6 +54,15 @@ var stateCmd = &cobra.Command{
 		jww.INFO.Printf("xxDK state web worker version: v%s", SEMVER)
 
 		jww.INFO.Print("[WW] Starting xxDK WebAssembly State Database Worker.")
+		err = impl.SetTimeouts(impl.Timeouts{
+			Request: requestTimeout,
+			Cursor:  cursorTimeout,
+			Commit:  commitTimeout,
+		})
+		if err != nil {
+			exception.ThrowTrace(err)
+		}
+
 		tm, err := worker.NewThreadManager("DmIndexedDbWorker", true)
 		if err != nil {
 			exception.ThrowTrace(err)
@@ -88,6 +99,9 @@ var stateCmd = &cobra.Command{
 var (
 	logLevel       jww.Threshold
 	threadLogLevel jww.Threshold
+	requestTimeout time.Duration
+	cursorTimeout  time.Duration
+	commitTimeout  time.Duration
 )
 
 func init() {
@@ -102,4 +116,14 @@ func init() {
 		"The log level when outputting to the worker file buffer. "+
 			"0 = TRACE, 1 = DEBUG, 2 = INFO, 3 = WARN, 4 = ERROR, "+
 			"5 = CRITICAL, 6 = FATAL, -1 = disabled.")
+
+	stateCmd.Flags().DurationVar(&requestTimeout, "requestTimeout", 0,
+		"The timeout for a single database request. 0 uses the default.")
+	stateCmd.Flags().DurationVar(&cursorTimeout, "cursorTimeout", 0,
+		"The time allowed between steps of a database cursor. Iteration "+
+			"continues as long as each step completes in time. "+
+			"0 uses the default.")
+	stateCmd.Flags().DurationVar(&commitTimeout, "commitTimeout", 0,
+		"The timeout for a database transaction to commit. "+
+			"0 uses the default.")
 }
@@ -22,6 +22,11 @@ type State struct {
 	// Id is a unique identifier for a given State.
 	Id string `json:"id"` // Matches pkeyName
 
-	// Value stores the data contents of the State.
+	// Value stores the data contents of the State. It is empty if the value is
+	// encrypted.
 	Value []byte `json:"value"`
+
+	// EncryptedValue stores the data contents of the State when encryption is
+	// enabled, encrypted in chunks of the cipher's block size.
+	EncryptedValue []string `json:"encryptedValue,omitempty"`
 }
@@ -0,0 +1,155 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package impl
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+)
+
+// ErrTimeout is an error string found in every [TimeoutError]. It allows
+// timeouts to be detected after the error has been formatted into another
+// error.
+const ErrTimeout = "IndexedDB operation timed out"
+
+// Operation classes that have their own timeout.
+const (
+	// RequestOperation is a single request, such as a Get or Put.
+	RequestOperation = "request"
+
+	// CursorOperation is a cursor iteration, such as GetAll or Dump. Its
+	// timeout is the maximum time allowed between two steps of the cursor.
+	CursorOperation = "cursor"
+
+	// CommitOperation is the commit of a multi-request transaction.
+	CommitOperation = "commit"
+)
+
+// Timeouts are the timeouts for each class of IndexedDB operation. A zero
+// timeout means the timeout is left unchanged.
+type Timeouts struct {
+	// Request is the timeout for a single request.
+	Request time.Duration `json:"request,omitempty"`
+
+	// Cursor is the time allowed for a cursor to make progress. The deadline
+	// is extended each time the cursor moves, so large stores can be iterated
+	// as long as every step completes within this time.
+	Cursor time.Duration `json:"cursor,omitempty"`
+
+	// Commit is the timeout for a transaction to commit.
+	Commit time.Duration `json:"commit,omitempty"`
+}
+
+// DefaultTimeouts returns the default timeouts.
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		Request: time.Second,
+		Cursor:  time.Second,
+		Commit:  time.Second,
+	}
+}
+
+var (
+	// timeouts are the timeouts currently in use.
+	timeouts = DefaultTimeouts()
+
+	// configured are the timeouts explicitly set with SetTimeouts.
+	configured Timeouts
+
+	timeoutsMux sync.RWMutex
+)
+
+// SetTimeouts sets the timeouts used for all IndexedDB operations. Only the
+// non-zero timeouts are changed. Returns an error if any timeout is negative.
+func SetTimeouts(t Timeouts) error {
+	if t.Request < 0 || t.Cursor < 0 || t.Commit < 0 {
+		return errors.Errorf("timeouts cannot be negative: %+v", t)
+	}
+
+	timeoutsMux.Lock()
+	defer timeoutsMux.Unlock()
+	if t.Request > 0 {
+		timeouts.Request, configured.Request = t.Request, t.Request
+	}
+	if t.Cursor > 0 {
+		timeouts.Cursor, configured.Cursor = t.Cursor, t.Cursor
+	}
+	if t.Commit > 0 {
+		timeouts.Commit, configured.Commit = t.Commit, t.Commit
+	}
+	jww.INFO.Printf("IndexedDB timeouts set to %+v", timeouts)
+	return nil
+}
+
+// GetTimeouts returns the timeouts currently in use.
+func GetTimeouts() Timeouts {
+	timeoutsMux.RLock()
+	defer timeoutsMux.RUnlock()
+	return timeouts
+}
+
+// ConfiguredTimeouts returns only the timeouts explicitly set with
+// SetTimeouts. The rest are zero. It is sent to workers so that they only
+// override their own defaults with timeouts set on the main thread.
+func ConfiguredTimeouts() Timeouts {
+	timeoutsMux.RLock()
+	defer timeoutsMux.RUnlock()
+	return configured
+}
+
+// TimeoutError is returned when an IndexedDB operation does not complete
+// before its timeout. The operation may be retried.
+type TimeoutError struct {
+	// Operation is the class of the operation that timed out.
+	Operation string
+
+	// Timeout is the timeout that was exceeded.
+	Timeout time.Duration
+}
+
+// Error returns the error message. It contains ErrTimeout.
+func (e *TimeoutError) Error() string {
+	return ErrTimeout + ": " + e.Operation + " did not complete within " +
+		e.Timeout.String()
+}
+
+// IsTimeout returns true if the error is or contains a [TimeoutError].
+func IsTimeout(err error) bool {
+	if err == nil {
+		return false
+	}
+	var timeoutErr *TimeoutError
+	return errors.As(err, &timeoutErr) ||
+		strings.Contains(err.Error(), ErrTimeout)
+}
+
+// contextErr returns a TimeoutError if the context exceeded its deadline and
+// otherwise returns the error of the context, which is nil if the context is
+// not done.
+func contextErr(ctx context.Context, operation string,
+	timeout time.Duration) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &TimeoutError{operation, timeout}
+	}
+	return ctx.Err()
+}
+
+// newCommitContext builds a context for committing a transaction. Returns the
+// timeout used.
+func newCommitContext() (context.Context, context.CancelFunc, time.Duration) {
+	timeout := GetTimeouts().Commit
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	return ctx, cancel, timeout
+}
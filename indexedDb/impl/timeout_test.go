@@ -0,0 +1,88 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package impl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Tests that SetTimeouts only changes the non-zero timeouts and that
+// ConfiguredTimeouts only returns the timeouts that were set.
+func TestSetTimeouts(t *testing.T) {
+	defer resetTimeouts()
+
+	err := SetTimeouts(Timeouts{Cursor: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("Failed to set timeouts: %+v", err)
+	}
+
+	expected := DefaultTimeouts()
+	expected.Cursor = 5 * time.Second
+	if received := GetTimeouts(); received != expected {
+		t.Errorf("Unexpected timeouts.\nexpected: %+v\nreceived: %+v",
+			expected, received)
+	}
+
+	expectedConfigured := Timeouts{Cursor: 5 * time.Second}
+	if received := ConfiguredTimeouts(); received != expectedConfigured {
+		t.Errorf("Unexpected configured timeouts."+
+			"\nexpected: %+v\nreceived: %+v", expectedConfigured, received)
+	}
+}
+
+// Error path: Tests that SetTimeouts returns an error for negative timeouts
+// and does not change any timeout.
+func TestSetTimeouts_Negative(t *testing.T) {
+	defer resetTimeouts()
+
+	err := SetTimeouts(Timeouts{Request: 2 * time.Second, Commit: -1})
+	if err == nil {
+		t.Error("Did not receive error for negative timeout.")
+	}
+
+	if received := GetTimeouts(); received != DefaultTimeouts() {
+		t.Errorf("Timeouts changed.\nexpected: %+v\nreceived: %+v",
+			DefaultTimeouts(), received)
+	}
+}
+
+// Tests that IsTimeout detects a TimeoutError, even after it has been
+// formatted into another error.
+func TestIsTimeout(t *testing.T) {
+	timeoutErr := &TimeoutError{CursorOperation, time.Second}
+
+	tests := map[error]bool{
+		timeoutErr: true,
+		errors.WithMessage(timeoutErr, "wrapped"):   true,
+		errors.Errorf("formatted: %+v", timeoutErr): true,
+		errors.New("other error"):                   false,
+		context.Canceled:                            false,
+		nil:                                         false,
+	}
+
+	for err, expected := range tests {
+		if IsTimeout(err) != expected {
+			t.Errorf("Unexpected result for %v.\nexpected: %t\nreceived: %t",
+				err, expected, !expected)
+		}
+	}
+}
+
+// resetTimeouts restores the default timeouts.
+func resetTimeouts() {
+	timeoutsMux.Lock()
+	defer timeoutsMux.Unlock()
+	timeouts = DefaultTimeouts()
+	configured = Timeouts{}
+}
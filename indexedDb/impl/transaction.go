@@ -0,0 +1,253 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package impl
+
+import (
+	"syscall/js"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/wasm-utils/utils"
+)
+
+// Transaction runs several operations across object stores atomically. Either
+// every change made through it is committed or, if any operation fails, none
+// are.
+//
+// The browser commits a transaction as soon as it has no pending requests, so
+// operations must be made one after another without waiting on anything other
+// than previous operations of the same Transaction. Any other reads, such as
+// those made by the helpers in this package, must be made before the
+// Transaction is started.
+type Transaction struct {
+	txn *idb.Transaction
+}
+
+// RunTransaction runs fn in a new read-write transaction on the given object
+// stores and waits for it to commit. If fn returns an error, the transaction
+// is aborted, all of its changes are rolled back, and the error is returned.
+//
+// If the storage quota is exceeded, data is evicted and fn is run once more in
+// a new transaction, so fn must be safe to run more than once.
+func RunTransaction(db *idb.Database, fn func(txn *Transaction) error,
+	objectStoreName string, objectStoreNames ...string) error {
+	err := runTransaction(db, fn, objectStoreName, objectStoreNames...)
+	if !isQuotaExceeded(err) {
+		return err
+	}
+
+	freed, evictErr := evict(true)
+	if evictErr != nil {
+		jww.ERROR.Printf("Failed to evict data after exceeding the storage "+
+			"quota: %+v", evictErr)
+	}
+	if freed > 0 {
+		err = runTransaction(db, fn, objectStoreName, objectStoreNames...)
+		if !isQuotaExceeded(err) {
+			return err
+		}
+	}
+	return errors.Wrapf(ErrQuotaExceeded, "%+v", err)
+}
+
+// runTransaction runs fn in a new read-write transaction and waits for it to
+// commit.
+func runTransaction(db *idb.Database, fn func(txn *Transaction) error,
+	objectStoreName string, objectStoreNames ...string) error {
+	txn, err := db.Transaction(
+		idb.TransactionReadWrite, objectStoreName, objectStoreNames...)
+	if err != nil {
+		return errors.Errorf("Unable to create Transaction: %+v", err)
+	}
+
+	if err = fn(&Transaction{txn}); err != nil {
+		// A failed request may have already aborted the transaction
+		if abortErr := txn.Abort(); abortErr != nil {
+			jww.DEBUG.Printf("Transaction already aborted: %+v", abortErr)
+		}
+		return err
+	}
+
+	if err = txn.Commit(); err != nil {
+		return errors.Errorf("Unable to commit Transaction: %+v", err)
+	}
+	ctx, cancel, timeout := newCommitContext()
+	defer cancel()
+	err = txn.Await(ctx)
+	if ctxErr := contextErr(ctx, CommitOperation, timeout); ctxErr != nil {
+		return errors.WithMessage(ctxErr, "Unable to commit Transaction")
+	} else if err != nil {
+		return errors.Errorf("Unable to commit Transaction: %+v", err)
+	}
+	return nil
+}
+
+// Get returns the value with the given primary key from the object store.
+// Returns an error containing ErrDoesNotExist if there is no such value.
+func (t *Transaction) Get(objectStoreName string, key js.Value) (js.Value, error) {
+	parentErr := errors.Errorf("failed to Get %s", objectStoreName)
+
+	store, err := t.txn.ObjectStore(objectStoreName)
+	if err != nil {
+		return js.Undefined(), errors.WithMessagef(parentErr,
+			"Unable to get ObjectStore: %+v", err)
+	}
+	getRequest, err := store.Get(key)
+	if err != nil {
+		return js.Undefined(), errors.WithMessagef(parentErr,
+			"Unable to Get from ObjectStore: %+v", err)
+	}
+
+	resultObj, err := SendRequest(getRequest)
+	if err != nil {
+		return js.Undefined(), errors.WithMessagef(parentErr,
+			"Unable to get from ObjectStore: %+v", err)
+	} else if resultObj.IsUndefined() {
+		return js.Undefined(), errors.WithMessagef(parentErr,
+			"Unable to get from ObjectStore: %s", ErrDoesNotExist)
+	}
+	return resultObj, nil
+}
+
+// GetIndex returns the first value matching the key in the given index of the
+// object store. Returns an error containing ErrDoesNotExist if there is no
+// such value.
+func (t *Transaction) GetIndex(
+	objectStoreName, indexName string, key js.Value) (js.Value, error) {
+	parentErr := errors.Errorf("failed to GetIndex %s/%s",
+		objectStoreName, indexName)
+
+	store, err := t.txn.ObjectStore(objectStoreName)
+	if err != nil {
+		return js.Undefined(), errors.WithMessagef(parentErr,
+			"Unable to get ObjectStore: %+v", err)
+	}
+	idx, err := store.Index(indexName)
+	if err != nil {
+		return js.Undefined(), errors.WithMessagef(parentErr,
+			"Unable to get Index: %+v", err)
+	}
+	getRequest, err := idx.Get(key)
+	if err != nil {
+		return js.Undefined(), errors.WithMessagef(parentErr,
+			"Unable to Get from ObjectStore: %+v", err)
+	}
+
+	resultObj, err := SendRequest(getRequest)
+	if err != nil {
+		return js.Undefined(), errors.WithMessagef(parentErr,
+			"Unable to get from ObjectStore: %+v", err)
+	} else if resultObj.IsUndefined() {
+		return js.Undefined(), errors.WithMessagef(parentErr,
+			"Unable to get from ObjectStore: %s", ErrDoesNotExist)
+	}
+	return resultObj, nil
+}
+
+// Put inserts or replaces the value in the object store. Returns the primary
+// key of the stored value.
+func (t *Transaction) Put(objectStoreName string, value js.Value) (js.Value, error) {
+	store, err := t.txn.ObjectStore(objectStoreName)
+	if err != nil {
+		return js.Undefined(), errors.Errorf("Unable to get ObjectStore: %+v", err)
+	}
+	request, err := store.Put(value)
+	if err != nil {
+		return js.Undefined(), errors.Errorf("Unable to Put: %+v", err)
+	}
+
+	resultObj, err := SendRequest(request)
+	if err != nil {
+		return js.Undefined(), errors.Errorf("Putting value failed: %+v\n%s",
+			err, utils.JsToJson(value))
+	}
+	jww.DEBUG.Printf("Successfully put value in %s: %s",
+		objectStoreName, utils.JsToJson(value))
+	return resultObj, nil
+}
+
+// Delete removes the value with the given primary key from the object store.
+func (t *Transaction) Delete(objectStoreName string, key js.Value) error {
+	parentErr := errors.Errorf("failed to Delete %s", objectStoreName)
+
+	store, err := t.txn.ObjectStore(objectStoreName)
+	if err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to get ObjectStore: %+v", err)
+	}
+	deleteRequest, err := store.Delete(key)
+	if err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to Delete from ObjectStore: %+v", err)
+	}
+
+	_, err = SendRequest(deleteRequest.Request)
+	if err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to Delete from ObjectStore: %+v", err)
+	}
+	jww.DEBUG.Printf("Successfully deleted value at %s/%s",
+		objectStoreName, utils.JsToJson(key))
+	return nil
+}
+
+// DeleteIndex removes the first value matching the key in the given index of
+// the object store. Requires passing in the name of the primary key for the
+// store.
+func (t *Transaction) DeleteIndex(objectStoreName,
+	indexName, pkeyName string, key js.Value) error {
+	value, err := t.GetIndex(objectStoreName, indexName, key)
+	if err != nil {
+		return err
+	}
+	return t.Delete(objectStoreName, value.Get(pkeyName))
+}
+
+// DeleteByIndex removes every value matching the key in the given index of
+// the object store.
+func (t *Transaction) DeleteByIndex(
+	objectStoreName, indexName string, key js.Value) error {
+	parentErr := errors.Errorf("failed to DeleteByIndex %s/%s",
+		objectStoreName, indexName)
+
+	store, err := t.txn.ObjectStore(objectStoreName)
+	if err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to get ObjectStore: %+v", err)
+	}
+	index, err := store.Index(indexName)
+	if err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to get Index: %+v", err)
+	}
+	keyRange, err := idb.NewKeyRangeOnly(key)
+	if err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to NewKeyRangeOnly: %+v", err)
+	}
+	cursorRequest, err := index.OpenCursorRange(keyRange, idb.CursorNext)
+	if err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to open Cursor: %+v", err)
+	}
+
+	err = SendCursorRequest(cursorRequest,
+		func(cursor *idb.CursorWithValue) error {
+			_, err := cursor.Delete()
+			return err
+		})
+	if err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to delete values: %+v", err)
+	}
+	return nil
+}
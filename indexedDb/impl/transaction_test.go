@@ -0,0 +1,119 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package impl
+
+import (
+	"strings"
+	"syscall/js"
+	"testing"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+)
+
+// Tests that RunTransaction commits every operation across object stores.
+func TestRunTransaction(t *testing.T) {
+	db := newTransactionTestDB("TestRunTransaction", t)
+
+	err := RunTransaction(db, func(txn *Transaction) error {
+		if _, err := txn.Put("first", newTestValue(1, "a")); err != nil {
+			return err
+		}
+		if _, err := txn.Put("second", newTestValue(2, "a")); err != nil {
+			return err
+		}
+		if _, err := txn.Put("second", newTestValue(3, "b")); err != nil {
+			return err
+		}
+		return txn.DeleteByIndex("second", "group", js.ValueOf("b"))
+	}, "first", "second")
+	if err != nil {
+		t.Fatalf("Failed to run transaction: %+v", err)
+	}
+
+	for store, key := range map[string]int{"first": 1, "second": 2} {
+		if _, err = Get(db, store, js.ValueOf(key)); err != nil {
+			t.Errorf("Failed to get value %d from %s: %+v", key, store, err)
+		}
+	}
+	_, err = Get(db, "second", js.ValueOf(3))
+	if err == nil || !strings.Contains(err.Error(), ErrDoesNotExist) {
+		t.Errorf("Value deleted in transaction exists: %+v", err)
+	}
+}
+
+// Error path: Tests that RunTransaction rolls back every operation when the
+// function returns an error.
+func TestRunTransaction_Rollback(t *testing.T) {
+	db := newTransactionTestDB("TestRunTransaction_Rollback", t)
+	if _, err := Put(db, "first", newTestValue(1, "a")); err != nil {
+		t.Fatalf("Failed to put value: %+v", err)
+	}
+
+	expectedErr := errors.New("test error")
+	err := RunTransaction(db, func(txn *Transaction) error {
+		if err := txn.Delete("first", js.ValueOf(1)); err != nil {
+			return err
+		}
+		if _, err := txn.Put("second", newTestValue(2, "a")); err != nil {
+			return err
+		}
+		return expectedErr
+	}, "first", "second")
+	if !errors.Is(err, expectedErr) {
+		t.Errorf("Unexpected error.\nexpected: %v\nreceived: %+v",
+			expectedErr, err)
+	}
+
+	if _, err = Get(db, "first", js.ValueOf(1)); err != nil {
+		t.Errorf("Deleted value was not restored: %+v", err)
+	}
+	_, err = Get(db, "second", js.ValueOf(2))
+	if err == nil || !strings.Contains(err.Error(), ErrDoesNotExist) {
+		t.Errorf("Inserted value was not rolled back: %+v", err)
+	}
+}
+
+// newTestValue returns an object with the given key and group.
+func newTestValue(id int, group string) js.Value {
+	return js.ValueOf(map[string]any{"id": id, "group": group})
+}
+
+// newTransactionTestDB creates a new idb.Database with two object stores that
+// each have an index on the group field.
+func newTransactionTestDB(name string, t *testing.T) *idb.Database {
+	ctx, cancel := NewContext()
+	defer cancel()
+	openRequest, err := idb.Global().Open(ctx, name, 0,
+		func(db *idb.Database, _ uint, _ uint) error {
+			for _, storeName := range []string{"first", "second"} {
+				store, err := db.CreateObjectStore(storeName,
+					idb.ObjectStoreOptions{KeyPath: js.ValueOf("id")})
+				if err != nil {
+					return err
+				}
+				_, err = store.CreateIndex(
+					"group", js.ValueOf("group"), idb.IndexOptions{})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("Failed to open database: %+v", err)
+	}
+
+	db, err := openRequest.Await(ctx)
+	if err != nil {
+		t.Fatalf("Failed to open database: %+v", err)
+	}
+	return db
+}
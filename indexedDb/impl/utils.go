@@ -19,15 +19,12 @@ import (
 	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
 	"gitlab.com/elixxir/wasm-utils/utils"
+	"sync/atomic"
 	"syscall/js"
 	"time"
 )
 
 const (
-	// dbTimeout is the global timeout for operations with the storage
-	// [context.Context].
-	dbTimeout = time.Second
-
 	// ErrDoesNotExist is an error string for got undefined on Get operations.
 	ErrDoesNotExist = "result is undefined"
 )
@@ -37,11 +34,15 @@ const (
 type WebState interface {
 	Get(key string) ([]byte, error)
 	Set(key string, value []byte) error
+	Delete(key string) error
+	Keys() ([]string, error)
+	Clear() error
 }
 
-// NewContext builds a context for indexedDb operations.
+// NewContext builds a context for indexedDb operations using the request
+// timeout.
 func NewContext() (context.Context, context.CancelFunc) {
-	return context.WithTimeout(context.Background(), dbTimeout)
+	return context.WithTimeout(context.Background(), GetTimeouts().Request)
 }
 
 // EncodeBytes returns the proper IndexedDb encoding for a byte slice into js.Value.
@@ -50,14 +51,17 @@ func EncodeBytes(input []byte) js.Value {
 }
 
 // SendRequest is a wrapper for the request.Await() method providing a timeout.
+// Returns a [TimeoutError] if the request does not complete within the request
+// timeout.
 func SendRequest(request *idb.Request) (js.Value, error) {
-	ctx, cancel := NewContext()
+	timeout := GetTimeouts().Request
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 	result, err := request.Await(ctx)
-	if err != nil {
+	if ctxErr := contextErr(ctx, RequestOperation, timeout); ctxErr != nil {
+		return js.Undefined(), ctxErr
+	} else if err != nil {
 		return js.Undefined(), err
-	} else if ctx.Err() != nil {
-		return js.Undefined(), ctx.Err()
 	}
 	return result, nil
 }
@@ -65,10 +69,36 @@ func SendRequest(request *idb.Request) (js.Value, error) {
 // SendCursorRequest is a wrapper for the cursorRequest.Await() method providing a timeout.
 func SendCursorRequest(cur *idb.CursorWithValueRequest,
 	iterFunc func(cursor *idb.CursorWithValue) error) error {
-	ctx, cancel := NewContext()
+	return SendCursorRequestContext(context.Background(), cur, iterFunc)
+}
+
+// SendCursorRequestContext is a wrapper for the cursorRequest.Iter() method
+// providing a timeout. Iteration stops early if the given context is done.
+//
+// The timeout is extended each time the cursor moves, so iteration only times
+// out once no progress is made within the cursor timeout. Returns a
+// [TimeoutError] on timeout.
+func SendCursorRequestContext(parent context.Context,
+	cur *idb.CursorWithValueRequest,
+	iterFunc func(cursor *idb.CursorWithValue) error) error {
+	timeout := GetTimeouts().Cursor
+	ctx, cancel := context.WithCancel(parent)
 	defer cancel()
-	err := cur.Iter(ctx, iterFunc)
-	if ctx.Err() != nil {
+
+	var timedOut atomic.Bool
+	timer := time.AfterFunc(timeout, func() {
+		timedOut.Store(true)
+		cancel()
+	})
+	defer timer.Stop()
+
+	err := cur.Iter(ctx, func(cursor *idb.CursorWithValue) error {
+		defer timer.Reset(timeout)
+		return iterFunc(cursor)
+	})
+	if timedOut.Load() {
+		return &TimeoutError{CursorOperation, timeout}
+	} else if ctx.Err() != nil {
 		return ctx.Err()
 	}
 	return err
@@ -153,6 +183,45 @@ func GetAll(db *idb.Database, objectStoreName string) ([]js.Value, error) {
 	return result, nil
 }
 
+// GetAllKeys is a generic helper for getting all primary keys from the given
+// [idb.ObjectStore].
+func GetAllKeys(db *idb.Database, objectStoreName string) ([]js.Value, error) {
+	parentErr := errors.Errorf("failed to GetAllKeys %s", objectStoreName)
+
+	// Prepare the Transaction
+	txn, err := db.Transaction(idb.TransactionReadOnly, objectStoreName)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(objectStoreName)
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to get ObjectStore: %+v", err)
+	}
+
+	// Set up the operation
+	keysRequest, err := store.GetAllKeys()
+	if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to GetAllKeys from ObjectStore: %+v", err)
+	}
+
+	// Perform the operation
+	timeout := GetTimeouts().Request
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	keys, err := keysRequest.Await(ctx)
+	if ctxErr := contextErr(ctx, RequestOperation, timeout); ctxErr != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to GetAllKeys from ObjectStore: %+v", ctxErr)
+	} else if err != nil {
+		return nil, errors.WithMessagef(parentErr,
+			"Unable to GetAllKeys from ObjectStore: %+v", err)
+	}
+	return keys, nil
+}
+
 // GetIndex is a generic helper for getting values from the given
 // [idb.ObjectStore] using the given [idb.Index].
 func GetIndex(db *idb.Database, objectStoreName,
@@ -203,7 +272,31 @@ func GetIndex(db *idb.Database, objectStoreName,
 // Put is a generic helper for putting values into the given [idb.ObjectStore].
 // Equivalent to insert if not exists else update. Returns the primary key of
 // the stored object as a js.Value.
+//
+// If the storage quota is exceeded, data is evicted and the put is retried
+// once. Returns an error wrapping [ErrQuotaExceeded] if it still fails.
 func Put(db *idb.Database, objectStoreName string, value js.Value) (js.Value, error) {
+	resultObj, err := put(db, objectStoreName, value)
+	if !isQuotaExceeded(err) {
+		return resultObj, err
+	}
+
+	freed, evictErr := evict(true)
+	if evictErr != nil {
+		jww.ERROR.Printf("Failed to evict data after exceeding the storage "+
+			"quota: %+v", evictErr)
+	}
+	if freed > 0 {
+		resultObj, err = put(db, objectStoreName, value)
+		if !isQuotaExceeded(err) {
+			return resultObj, err
+		}
+	}
+	return js.Undefined(), errors.Wrapf(ErrQuotaExceeded, "%+v", err)
+}
+
+// put puts the value into the given [idb.ObjectStore].
+func put(db *idb.Database, objectStoreName string, value js.Value) (js.Value, error) {
 	// Prepare the Transaction
 	txn, err := db.Transaction(idb.TransactionReadWrite, objectStoreName)
 	if err != nil {
@@ -266,19 +359,49 @@ func Delete(db *idb.Database, objectStoreName string, key js.Value) error {
 	return nil
 }
 
+// Clear is a generic helper for removing all values from the given
+// [idb.ObjectStore].
+func Clear(db *idb.Database, objectStoreName string) error {
+	parentErr := errors.Errorf("failed to Clear %s", objectStoreName)
+
+	// Prepare the Transaction
+	txn, err := db.Transaction(idb.TransactionReadWrite, objectStoreName)
+	if err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(objectStoreName)
+	if err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to get ObjectStore: %+v", err)
+	}
+
+	// Perform the operation
+	clearRequest, err := store.Clear()
+	if err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to Clear ObjectStore: %+v", err)
+	}
+	_, err = SendRequest(clearRequest.Request)
+	if err != nil {
+		return errors.WithMessagef(parentErr,
+			"Unable to Clear ObjectStore: %+v", err)
+	}
+	jww.DEBUG.Printf("Successfully cleared %s", objectStoreName)
+	return nil
+}
+
 // DeleteIndex is a generic helper for removing values from the
 // given [idb.ObjectStore] using the given [idb.Index]. Requires passing
-// in the name of the primary key for the store.
+// in the name of the primary key for the store. The value is found and deleted
+// in a single transaction.
 func DeleteIndex(db *idb.Database, objectStoreName,
 	indexName, pkeyName string, key js.Value) error {
 	parentErr := errors.Errorf("failed to DeleteIndex %s/%s", objectStoreName, key)
 
-	value, err := GetIndex(db, objectStoreName, indexName, key)
-	if err != nil {
-		return errors.WithMessagef(parentErr, "%+v", err)
-	}
-
-	err = Delete(db, objectStoreName, value.Get(pkeyName))
+	err := RunTransaction(db, func(txn *Transaction) error {
+		return txn.DeleteIndex(objectStoreName, indexName, pkeyName, key)
+	}, objectStoreName)
 	if err != nil {
 		return errors.WithMessagef(parentErr, "%+v", err)
 	}
@@ -10,6 +10,7 @@
 package channels
 
 import (
+	"context"
 	"crypto/ed25519"
 	"encoding/json"
 	"time"
@@ -21,15 +22,107 @@ import (
 	"gitlab.com/elixxir/client/v4/cmix/rounds"
 	cryptoBroadcast "gitlab.com/elixxir/crypto/broadcast"
 	"gitlab.com/elixxir/crypto/message"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
 	"gitlab.com/elixxir/xxdk-wasm/worker"
 	"gitlab.com/xx_network/primitives/id"
 )
 
+// EventModel is the [channels.EventModel] backed by IndexedDb. In addition to
+// the methods required by the channels system, it exposes queries on the
+// stored messages that are not part of the [channels.EventModel] interface.
+// Methods that take a context return the context's error if it is done before
+// the worker replies; if the context has no deadline, the default response
+// timeout is used.
+type EventModel interface {
+	channels.EventModel
+
+	// GetMessages returns up to limit messages in the given channel that
+	// are ordered before the cursor, ordered from newest to oldest. The query
+	// is aborted if the context is done first.
+	GetMessages(ctx context.Context, channelID *id.ID, cursor *MessageCursor,
+		limit int, includeHidden bool) ([]channels.ModelMessage, error)
+
+	// GetPinnedMessages returns the pinned messages in the given channel,
+	// ordered from most to least recently pinned. Hidden messages are
+	// excluded.
+	GetPinnedMessages(ctx context.Context, channelID *id.ID) (
+		[]channels.ModelMessage, error)
+
+	// SearchMessages returns the UUIDs of up to limit messages that contain
+	// every word in the query, ordered from newest to oldest. If channelID is
+	// nil, then all channels are searched. The search is aborted if the
+	// context is done first.
+	SearchMessages(ctx context.Context, query string, channelID *id.ID,
+		limit int) ([]uint64, error)
+
+	// MarkRead marks the message with the given UUID, and every message in its
+	// channel sent before it, as read.
+	MarkRead(ctx context.Context, uuid uint64) error
+
+	// GetUnreadCount returns the number of unread messages in the channel.
+	GetUnreadCount(ctx context.Context, channelID *id.ID) (uint, error)
+
+	// GetUnreadSummary returns the unread count and last read message of
+	// every joined channel.
+	GetUnreadSummary(ctx context.Context) ([]UnreadCount, error)
+
+	// GetReactions returns the reactions to each of the messages, in the same
+	// order as messageIDs. Reactions sent with the public key self are marked
+	// as reacted by the local identity.
+	GetReactions(ctx context.Context, messageIDs []message.ID,
+		self ed25519.PublicKey) ([]MessageReactions, error)
+
+	// GetThread returns up to limit replies to the root message, ordered from
+	// oldest to newest, starting after the cursor. If cursor is nil, the
+	// thread is read from the first reply.
+	GetThread(ctx context.Context, rootMessageID message.ID, limit int,
+		cursor *ThreadCursor) (*Thread, error)
+
+	// GetReplyCounts returns the number of replies to each of the messages,
+	// in the same order as messageIDs.
+	GetReplyCounts(
+		ctx context.Context, messageIDs []message.ID) ([]uint, error)
+
+	// SetRetentionPolicy sets the limits on the messages kept in the channel.
+	// Setting an empty policy removes all limits.
+	SetRetentionPolicy(
+		ctx context.Context, channelID *id.ID, policy RetentionPolicy) error
+
+	// GetChangesSince returns up to limit changes made after the change with
+	// the given sequence number, ordered by sequence number. Each change is
+	// also sent on the EventUpdate callback with the event type
+	// impl.ChangeEvent once it is committed.
+	GetChangesSince(
+		ctx context.Context, seq uint64, limit int) ([]impl.Change, error)
+
+	// Subscribe registers a live query. The callback is called with every
+	// message of the query and then with each change to them. Returns the ID
+	// used to cancel the subscription.
+	Subscribe(query LiveQuery, cb func(update LiveQueryUpdate)) (uint64, error)
+
+	// Unsubscribe cancels the subscription to a live query.
+	Unsubscribe(subscriptionID uint64) error
+
+	// SetIdentity sets the identity of the local user, which is used to flag
+	// the messages that mention them in the MessageReceived event.
+	SetIdentity(pubKey ed25519.PublicKey, codesetVersion uint8) error
+
+	// GetMentions returns up to limit messages that mention the identity,
+	// ordered from newest to oldest, starting after the cursor. If cursor is
+	// nil, the newest mentions are returned.
+	GetMentions(ctx context.Context, pubKey ed25519.PublicKey,
+		cursor *MentionCursor, limit int) (*Mentions, error)
+}
+
 // wasmModel implements [channels.EventModel] interface, which uses the channels
 // system passed an object that adheres to in order to get events on the
 // channel.
 type wasmModel struct {
-	wm *worker.Manager
+	wm   *worker.Manager
+	live *liveQueries
+
+	// identity is the identity of the local user set on the worker.
+	identity identity
 }
 
 // JoinChannel is called whenever a channel is joined locally.
@@ -42,7 +135,7 @@ func (w *wasmModel) JoinChannel(channel *cryptoBroadcast.Channel) {
 	}
 
 	if err = w.wm.SendNoResponse(JoinChannelTag, data); err != nil {
-		jww.FATAL.Panicf("[CH] Failed to send to %q: %+v", JoinChannelTag, err)
+		jww.ERROR.Printf("[CH] Failed to send to %q: %+v", JoinChannelTag, err)
 	}
 }
 
@@ -50,7 +143,7 @@ func (w *wasmModel) JoinChannel(channel *cryptoBroadcast.Channel) {
 func (w *wasmModel) LeaveChannel(channelID *id.ID) {
 	err := w.wm.SendNoResponse(LeaveChannelTag, channelID.Marshal())
 	if err != nil {
-		jww.FATAL.Panicf("[CH] Failed to send to %q: %+v", LeaveChannelTag, err)
+		jww.ERROR.Printf("[CH] Failed to send to %q: %+v", LeaveChannelTag, err)
 	}
 }
 
@@ -88,8 +181,9 @@ func (w *wasmModel) ReceiveMessage(channelID *id.ID, messageID message.ID,
 
 	response, err := w.wm.SendMessage(ReceiveMessageTag, data)
 	if err != nil {
-		jww.FATAL.Panicf(
+		jww.ERROR.Printf(
 			"[CH] Failed to send to %q: %+v", ReceiveMessageTag, err)
+		return 0
 	}
 
 	var uuid uint64
@@ -149,8 +243,8 @@ func (w *wasmModel) ReceiveReply(channelID *id.ID, messageID,
 
 	response, err := w.wm.SendMessage(ReceiveReplyTag, data)
 	if err != nil {
-		jww.FATAL.Panicf(
-			"[CH] Failed to send to %q: %+v", ReceiveReplyTag, err)
+		jww.ERROR.Printf("[CH] Failed to send to %q: %+v", ReceiveReplyTag, err)
+		return 0
 	}
 
 	var uuid uint64
@@ -204,8 +298,9 @@ func (w *wasmModel) ReceiveReaction(channelID *id.ID, messageID,
 
 	response, err := w.wm.SendMessage(ReceiveReactionTag, data)
 	if err != nil {
-		jww.FATAL.Panicf(
+		jww.ERROR.Printf(
 			"[CH] Failed to send to %q: %+v", ReceiveReactionTag, err)
+		return 0
 	}
 
 	var uuid uint64
@@ -287,8 +382,7 @@ func (w *wasmModel) UpdateFromUUID(uuid uint64, messageID *message.ID,
 
 	response, err := w.wm.SendMessage(UpdateFromUUIDTag, data)
 	if err != nil {
-		jww.FATAL.Panicf(
-			"[CH] Failed to send to %q: %+v", UpdateFromUUIDTag, err)
+		return errors.Wrapf(err, "[CH] failed to send to %q", UpdateFromUUIDTag)
 	} else if len(response) > 0 {
 		return errors.New(string(response))
 	}
@@ -346,8 +440,8 @@ func (w *wasmModel) UpdateFromMessageID(messageID message.ID,
 
 	response, err := w.wm.SendMessage(UpdateFromMessageIDTag, data)
 	if err != nil {
-		jww.FATAL.Panicf(
-			"[CH] Failed to send to %q: %+v", UpdateFromMessageIDTag, err)
+		return 0, errors.Wrapf(err,
+			"[CH] failed to send to %q", UpdateFromMessageIDTag)
 	}
 
 	var ue UuidError
@@ -374,8 +468,8 @@ func (w *wasmModel) GetMessage(
 
 	response, err := w.wm.SendMessage(GetMessageTag, messageID.Marshal())
 	if err != nil {
-		jww.FATAL.Panicf(
-			"[CH] Failed to send to %q: %+v", GetMessageTag, err)
+		return channels.ModelMessage{}, errors.Wrapf(err,
+			"[CH] failed to send to %q", GetMessageTag)
 	}
 
 	var msg GetMessageMessage
@@ -391,12 +485,478 @@ func (w *wasmModel) GetMessage(
 	return msg.Message, nil
 }
 
+// MessageCursor marks the position of a message in the history of a channel.
+// Messages are ordered by timestamp and then by UUID. To read the next page of
+// [EventModel.GetMessages], pass the timestamp and UUID of the oldest message
+// in the previous page; the JSON of a [channels.ModelMessage] has the same
+// fields.
+type MessageCursor struct {
+	// Timestamp is the timestamp of the message. Only the millisecond is used.
+	Timestamp time.Time `json:"timestamp"`
+
+	// UUID is the UUID of the message.
+	UUID uint64 `json:"uuid"`
+}
+
+// GetMessagesMessage is JSON marshalled and sent to the worker for
+// [wasmModel.GetMessages].
+type GetMessagesMessage struct {
+	ChannelID     *id.ID         `json:"channelID"`
+	Cursor        *MessageCursor `json:"cursor"`
+	Limit         int            `json:"limit"`
+	IncludeHidden bool           `json:"includeHidden"`
+}
+
+// GetMessagesReply is JSON marshalled and received from the worker in response
+// to [GetMessagesMessage] and [GetPinnedMessagesTag].
+type GetMessagesReply struct {
+	Messages []channels.ModelMessage `json:"messages"`
+	Error    string                  `json:"error"`
+}
+
+// GetMessages returns up to limit messages in the given channel that are
+// ordered before the cursor, ordered from newest to oldest. If cursor is nil,
+// then the newest messages are returned. Hidden messages are excluded unless
+// includeHidden is set. If the context is done before the worker replies, the
+// query is aborted and the context's error is returned.
+func (w *wasmModel) GetMessages(ctx context.Context, channelID *id.ID,
+	cursor *MessageCursor, limit int, includeHidden bool) (
+	[]channels.ModelMessage, error) {
+	msg := GetMessagesMessage{
+		ChannelID:     channelID,
+		Cursor:        cursor,
+		Limit:         limit,
+		IncludeHidden: includeHidden,
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, errors.Errorf(
+			"[CH] Could not JSON marshal %T: %+v", msg, err)
+	}
+
+	response, err := w.wm.SendContext(ctx, GetMessagesTag, data)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"[CH] failed to send to %q", GetMessagesTag)
+	}
+
+	var reply GetMessagesReply
+	if err = json.Unmarshal(response, &reply); err != nil {
+		return nil, errors.Wrapf(err,
+			"[CH] Could not JSON unmarshal response to %q", GetMessagesTag)
+	}
+
+	if reply.Error != "" {
+		return nil, errors.New(reply.Error)
+	}
+
+	return reply.Messages, nil
+}
+
+// GetPinnedMessages returns the pinned messages in the given channel, ordered
+// from most to least recently pinned. Hidden messages are excluded.
+func (w *wasmModel) GetPinnedMessages(ctx context.Context,
+	channelID *id.ID) ([]channels.ModelMessage, error) {
+	response, err := w.wm.SendContext(
+		ctx, GetPinnedMessagesTag, channelID.Marshal())
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"[CH] failed to send to %q", GetPinnedMessagesTag)
+	}
+
+	var reply GetMessagesReply
+	if err = json.Unmarshal(response, &reply); err != nil {
+		return nil, errors.Wrapf(err, "[CH] Could not JSON unmarshal "+
+			"response to %q", GetPinnedMessagesTag)
+	}
+
+	if reply.Error != "" {
+		return nil, errors.New(reply.Error)
+	}
+
+	return reply.Messages, nil
+}
+
+// SearchMessagesMessage is JSON marshalled and sent to the worker for
+// [wasmModel.SearchMessages].
+type SearchMessagesMessage struct {
+	Query     string `json:"query"`
+	ChannelID *id.ID `json:"channelID"`
+	Limit     int    `json:"limit"`
+}
+
+// SearchMessagesReply is JSON marshalled and received from the worker in
+// response to [SearchMessagesMessage].
+type SearchMessagesReply struct {
+	UUIDs []uint64 `json:"uuids"`
+	Error string   `json:"error"`
+}
+
+// SearchMessages returns the UUIDs of up to limit messages that contain every
+// word in the query, ordered from newest to oldest. If channelID is nil, then
+// all channels are searched. If the context is done before the worker replies,
+// the search is aborted and the context's error is returned.
+func (w *wasmModel) SearchMessages(ctx context.Context, query string,
+	channelID *id.ID, limit int) ([]uint64, error) {
+	msg := SearchMessagesMessage{
+		Query:     query,
+		ChannelID: channelID,
+		Limit:     limit,
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, errors.Errorf(
+			"[CH] Could not JSON marshal %T: %+v", msg, err)
+	}
+
+	response, err := w.wm.SendContext(ctx, SearchMessagesTag, data)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"[CH] failed to send to %q", SearchMessagesTag)
+	}
+
+	var reply SearchMessagesReply
+	if err = json.Unmarshal(response, &reply); err != nil {
+		return nil, errors.Wrapf(err,
+			"[CH] Could not JSON unmarshal response to %q", SearchMessagesTag)
+	}
+
+	if reply.Error != "" {
+		return nil, errors.New(reply.Error)
+	}
+
+	return reply.UUIDs, nil
+}
+
+// UnreadCount describes the unread messages in a single channel. It is
+// returned by [EventModel.GetUnreadSummary] and is sent on the EventUpdate
+// callback with the event type impl.UnreadCountEvent whenever the count
+// changes.
+type UnreadCount struct {
+	// ChannelID is the ID of the channel.
+	ChannelID *id.ID `json:"channelID"`
+
+	// LastRead is the UUID of the last message marked as read. It is zero if
+	// no message has been marked as read.
+	LastRead uint64 `json:"lastRead"`
+
+	// Unread is the number of unread messages.
+	Unread uint `json:"unread"`
+}
+
+// MarkRead marks the message with the given UUID, and every message in its
+// channel sent before it, as read.
+func (w *wasmModel) MarkRead(ctx context.Context, uuid uint64) error {
+	data, err := json.Marshal(uuid)
+	if err != nil {
+		return errors.Errorf("[CH] Could not JSON marshal UUID: %+v", err)
+	}
+
+	response, err := w.wm.SendContext(ctx, MarkReadTag, data)
+	if err != nil {
+		return errors.Wrapf(err, "[CH] failed to send to %q", MarkReadTag)
+	} else if len(response) > 0 {
+		return errors.New(string(response))
+	}
+
+	return nil
+}
+
+// GetUnreadCountReply is JSON marshalled and received from the worker in
+// response to [wasmModel.GetUnreadCount].
+type GetUnreadCountReply struct {
+	Unread uint   `json:"unread"`
+	Error  string `json:"error"`
+}
+
+// GetUnreadCount returns the number of unread messages in the channel.
+func (w *wasmModel) GetUnreadCount(
+	ctx context.Context, channelID *id.ID) (uint, error) {
+	response, err := w.wm.SendContext(
+		ctx, GetUnreadCountTag, channelID.Marshal())
+	if err != nil {
+		return 0, errors.Wrapf(err,
+			"[CH] failed to send to %q", GetUnreadCountTag)
+	}
+
+	var reply GetUnreadCountReply
+	if err = json.Unmarshal(response, &reply); err != nil {
+		return 0, errors.Wrapf(err,
+			"[CH] Could not JSON unmarshal response to %q", GetUnreadCountTag)
+	}
+
+	if reply.Error != "" {
+		return 0, errors.New(reply.Error)
+	}
+
+	return reply.Unread, nil
+}
+
+// GetUnreadSummaryReply is JSON marshalled and received from the worker in
+// response to [wasmModel.GetUnreadSummary].
+type GetUnreadSummaryReply struct {
+	Summary []UnreadCount `json:"summary"`
+	Error   string        `json:"error"`
+}
+
+// GetUnreadSummary returns the unread count and last read message of every
+// joined channel.
+func (w *wasmModel) GetUnreadSummary(
+	ctx context.Context) ([]UnreadCount, error) {
+	response, err := w.wm.SendContext(ctx, GetUnreadSummaryTag, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"[CH] failed to send to %q", GetUnreadSummaryTag)
+	}
+
+	var reply GetUnreadSummaryReply
+	if err = json.Unmarshal(response, &reply); err != nil {
+		return nil, errors.Wrapf(err, "[CH] Could not JSON unmarshal "+
+			"response to %q", GetUnreadSummaryTag)
+	}
+
+	if reply.Error != "" {
+		return nil, errors.New(reply.Error)
+	}
+
+	return reply.Summary, nil
+}
+
+// MessageReactions lists the reactions to a single message. It is returned by
+// [EventModel.GetReactions].
+type MessageReactions struct {
+	// MessageID is the ID of the message reacted to.
+	MessageID message.ID `json:"messageID"`
+
+	// Reactions lists each emoji reacted with, ordered from most to least
+	// used.
+	Reactions []Reaction `json:"reactions"`
+}
+
+// Reaction is the number of users that reacted to a message with an emoji.
+type Reaction struct {
+	// Emoji is the reaction.
+	Emoji string `json:"emoji"`
+
+	// Count is the number of users that reacted with the emoji.
+	Count uint `json:"count"`
+
+	// Reacted is true if the local identity reacted with the emoji.
+	Reacted bool `json:"reacted"`
+}
+
+// GetReactionsMessage is JSON marshalled and sent to the worker for
+// [wasmModel.GetReactions].
+type GetReactionsMessage struct {
+	MessageIDs []message.ID      `json:"messageIDs"`
+	Self       ed25519.PublicKey `json:"self"`
+}
+
+// GetReactionsReply is JSON marshalled and received from the worker in
+// response to [GetReactionsMessage].
+type GetReactionsReply struct {
+	Reactions []MessageReactions `json:"reactions"`
+	Error     string             `json:"error"`
+}
+
+// GetReactions returns the reactions to each of the messages, in the same
+// order as messageIDs. Reactions sent with the public key self are marked as
+// reacted by the local identity.
+func (w *wasmModel) GetReactions(ctx context.Context, messageIDs []message.ID,
+	self ed25519.PublicKey) ([]MessageReactions, error) {
+	msg := GetReactionsMessage{
+		MessageIDs: messageIDs,
+		Self:       self,
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, errors.Errorf(
+			"[CH] Could not JSON marshal %T: %+v", msg, err)
+	}
+
+	response, err := w.wm.SendContext(ctx, GetReactionsTag, data)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"[CH] failed to send to %q", GetReactionsTag)
+	}
+
+	var reply GetReactionsReply
+	if err = json.Unmarshal(response, &reply); err != nil {
+		return nil, errors.Wrapf(err,
+			"[CH] Could not JSON unmarshal response to %q", GetReactionsTag)
+	}
+
+	if reply.Error != "" {
+		return nil, errors.New(reply.Error)
+	}
+
+	return reply.Reactions, nil
+}
+
+// ThreadCursor marks the position of a reply in a thread. It is returned by
+// [EventModel.GetThread] to read the next page of replies.
+type ThreadCursor struct {
+	// Timestamp is the timestamp of the last reply read.
+	Timestamp time.Time `json:"timestamp"`
+
+	// UUID is the UUID of the last reply read.
+	UUID uint64 `json:"uuid"`
+}
+
+// Thread is a page of replies to a message. It is returned by
+// [EventModel.GetThread].
+type Thread struct {
+	// ReplyCount is the total number of replies to the message.
+	ReplyCount uint `json:"replyCount"`
+
+	// Replies lists the replies in the page, ordered from oldest to newest.
+	Replies []channels.ModelMessage `json:"replies"`
+
+	// Next is the cursor used to read the next page. It is nil if there are
+	// no more replies.
+	Next *ThreadCursor `json:"next,omitempty"`
+}
+
+// GetThreadMessage is JSON marshalled and sent to the worker for
+// [wasmModel.GetThread].
+type GetThreadMessage struct {
+	RootMessageID message.ID    `json:"rootMessageID"`
+	Limit         int           `json:"limit"`
+	Cursor        *ThreadCursor `json:"cursor"`
+}
+
+// GetThreadReply is JSON marshalled and received from the worker in response
+// to [GetThreadMessage].
+type GetThreadReply struct {
+	Thread *Thread `json:"thread"`
+	Error  string  `json:"error"`
+}
+
+// GetThread returns up to limit replies to the root message, ordered from
+// oldest to newest, starting after the cursor. If cursor is nil, the thread is
+// read from the first reply.
+func (w *wasmModel) GetThread(ctx context.Context, rootMessageID message.ID,
+	limit int, cursor *ThreadCursor) (*Thread, error) {
+	msg := GetThreadMessage{
+		RootMessageID: rootMessageID,
+		Limit:         limit,
+		Cursor:        cursor,
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, errors.Errorf(
+			"[CH] Could not JSON marshal %T: %+v", msg, err)
+	}
+
+	response, err := w.wm.SendContext(ctx, GetThreadTag, data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "[CH] failed to send to %q", GetThreadTag)
+	}
+
+	var reply GetThreadReply
+	if err = json.Unmarshal(response, &reply); err != nil {
+		return nil, errors.Wrapf(err,
+			"[CH] Could not JSON unmarshal response to %q", GetThreadTag)
+	}
+
+	if reply.Error != "" {
+		return nil, errors.New(reply.Error)
+	}
+
+	return reply.Thread, nil
+}
+
+// GetReplyCountsReply is JSON marshalled and received from the worker in
+// response to [GetReplyCountsTag].
+type GetReplyCountsReply struct {
+	ReplyCounts []uint `json:"replyCounts"`
+	Error       string `json:"error"`
+}
+
+// GetReplyCounts returns the number of replies to each of the messages, in the
+// same order as messageIDs.
+func (w *wasmModel) GetReplyCounts(
+	ctx context.Context, messageIDs []message.ID) ([]uint, error) {
+	data, err := json.Marshal(messageIDs)
+	if err != nil {
+		return nil, errors.Errorf(
+			"[CH] Could not JSON marshal message IDs: %+v", err)
+	}
+
+	response, err := w.wm.SendContext(ctx, GetReplyCountsTag, data)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"[CH] failed to send to %q", GetReplyCountsTag)
+	}
+
+	var reply GetReplyCountsReply
+	if err = json.Unmarshal(response, &reply); err != nil {
+		return nil, errors.Wrapf(err,
+			"[CH] Could not JSON unmarshal response to %q", GetReplyCountsTag)
+	}
+
+	if reply.Error != "" {
+		return nil, errors.New(reply.Error)
+	}
+
+	return reply.ReplyCounts, nil
+}
+
+// RetentionPolicy limits the messages kept in a channel. Messages outside the
+// limits are deleted, oldest first. Pinned messages are not counted. Zero
+// values are unlimited.
+type RetentionPolicy struct {
+	// MaxAge is the maximum age of a message.
+	MaxAge time.Duration `json:"maxAge"`
+
+	// MaxCount is the maximum number of messages.
+	MaxCount uint `json:"maxCount"`
+
+	// MaxBytes is the maximum total size of the stored messages.
+	MaxBytes uint64 `json:"maxBytes"`
+}
+
+// SetRetentionPolicyMessage is JSON marshalled and sent to the worker for
+// [wasmModel.SetRetentionPolicy].
+type SetRetentionPolicyMessage struct {
+	ChannelID *id.ID          `json:"channelID"`
+	Policy    RetentionPolicy `json:"policy"`
+}
+
+// SetRetentionPolicy sets the limits on the messages kept in the channel.
+// Setting an empty policy removes all limits.
+func (w *wasmModel) SetRetentionPolicy(ctx context.Context,
+	channelID *id.ID, policy RetentionPolicy) error {
+	msg := SetRetentionPolicyMessage{
+		ChannelID: channelID,
+		Policy:    policy,
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return errors.Errorf("[CH] Could not JSON marshal %T: %+v", msg, err)
+	}
+
+	response, err := w.wm.SendContext(ctx, SetRetentionPolicyTag, data)
+	if err != nil {
+		return errors.Wrapf(err,
+			"[CH] failed to send to %q", SetRetentionPolicyTag)
+	} else if len(response) > 0 {
+		return errors.New(string(response))
+	}
+
+	return nil
+}
+
 // DeleteMessage removes a message with the given messageID from storage.
 func (w *wasmModel) DeleteMessage(messageID message.ID) error {
 	response, err := w.wm.SendMessage(DeleteMessageTag, messageID.Marshal())
 	if err != nil {
-		jww.FATAL.Panicf(
-			"[CH] Failed to send to %q: %+v", DeleteMessageTag, err)
+		return errors.Wrapf(err, "[CH] failed to send to %q", DeleteMessageTag)
 	} else if len(response) > 0 {
 		return errors.New(string(response))
 	}
@@ -429,6 +989,54 @@ func (w *wasmModel) MuteUser(
 
 	err = w.wm.SendNoResponse(MuteUserTag, data)
 	if err != nil {
-		jww.FATAL.Panicf("[CH] Failed to send to %q: %+v", MuteUserTag, err)
+		jww.ERROR.Printf("[CH] Failed to send to %q: %+v", MuteUserTag, err)
 	}
 }
+
+// GetChangesSinceMessage is JSON marshalled and sent to the worker for
+// [wasmModel.GetChangesSince].
+type GetChangesSinceMessage struct {
+	Seq   uint64 `json:"seq"`
+	Limit int    `json:"limit"`
+}
+
+// GetChangesSinceReply is JSON marshalled and received from the worker in
+// response to [GetChangesSinceMessage].
+type GetChangesSinceReply struct {
+	Changes []impl.Change `json:"changes"`
+	Error   string        `json:"error"`
+}
+
+// GetChangesSince returns up to limit changes made after the change with the
+// given sequence number, ordered by sequence number.
+func (w *wasmModel) GetChangesSince(
+	ctx context.Context, seq uint64, limit int) ([]impl.Change, error) {
+	msg := GetChangesSinceMessage{
+		Seq:   seq,
+		Limit: limit,
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, errors.Errorf(
+			"[CH] Could not JSON marshal %T: %+v", msg, err)
+	}
+
+	response, err := w.wm.SendContext(ctx, GetChangesSinceTag, data)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"[CH] failed to send to %q", GetChangesSinceTag)
+	}
+
+	var reply GetChangesSinceReply
+	if err = json.Unmarshal(response, &reply); err != nil {
+		return nil, errors.Wrapf(err,
+			"[CH] Could not JSON unmarshal response to %q", GetChangesSinceTag)
+	}
+
+	if reply.Error != "" {
+		return nil, errors.New(reply.Error)
+	}
+
+	return reply.Changes, nil
+}
@@ -18,13 +18,14 @@ import (
 	"gitlab.com/elixxir/client/v4/bindings"
 	"gitlab.com/elixxir/client/v4/channels"
 	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
 	"gitlab.com/elixxir/xxdk-wasm/logging"
 	"gitlab.com/elixxir/xxdk-wasm/storage"
 	"gitlab.com/elixxir/xxdk-wasm/worker"
 )
 
 // databaseSuffix is the suffix to be appended to the name of the database.
-const databaseSuffix = "_speakeasy"
+const databaseSuffix = storage.ChannelsDatabaseSuffix
 
 // NewWASMEventModelBuilder returns an EventModelBuilder which allows
 // the channel manager to define the path but the callback is the same
@@ -43,12 +44,22 @@ func NewWASMEventModelBuilder(wasmJsPath string, encryption idbCrypto.Cipher,
 type NewWASMEventModelMessage struct {
 	DatabaseName   string `json:"databaseName"`
 	EncryptionJSON string `json:"encryptionJSON"`
+
+	// EncryptionMode is the encryption mode stored for the database.
+	EncryptionMode storage.EncryptionMode `json:"encryptionMode"`
+
+	// EvictionPolicy is the policy used to free space as the storage quota
+	// is approached.
+	EvictionPolicy storage.EvictionPolicy `json:"evictionPolicy"`
+
+	// Timeouts are the database operation timeouts set on the main thread.
+	Timeouts impl.Timeouts `json:"timeouts"`
 }
 
-// NewWASMEventModel returns a [channels.EventModel] backed by a wasmModel.
+// NewWASMEventModel returns an [EventModel] backed by a wasmModel.
 // The name should be a base64 encoding of the users public key.
 func NewWASMEventModel(path, wasmJsPath string, encryption idbCrypto.Cipher,
-	cbs bindings.ChannelUICallbacks) (channels.EventModel, error) {
+	cbs bindings.ChannelUICallbacks) (EventModel, error) {
 	databaseName := path + databaseSuffix
 
 	wm, err := worker.NewManager(wasmJsPath, "channelsIndexedDb", true)
@@ -61,11 +72,8 @@ func NewWASMEventModel(path, wasmJsPath string, encryption idbCrypto.Cipher,
 
 	// Create MessageChannel between worker and logger so that the worker logs
 	// are saved
-	err = worker.CreateMessageChannel(logging.GetLogger().Worker(), wm,
-		"channelsIndexedDbLogger", worker.LoggerTag)
-	if err != nil {
-		return nil, errors.Wrap(err, "Failed to create message channel "+
-			"between channel indexedDb worker and logger")
+	if err = connectLogger(wm); err != nil {
+		return nil, err
 	}
 
 	// Store the database name
@@ -75,8 +83,8 @@ func NewWASMEventModel(path, wasmJsPath string, encryption idbCrypto.Cipher,
 	}
 
 	// Check that the encryption status
-	encryptionStatus := encryption != nil
-	err = checkDbEncryptionStatus(databaseName, encryptionStatus)
+	encryptionMode, err :=
+		checkDbEncryptionStatus(databaseName, encryption != nil)
 	if err != nil {
 		return nil, err
 	}
@@ -86,9 +94,19 @@ func NewWASMEventModel(path, wasmJsPath string, encryption idbCrypto.Cipher,
 		return nil, err
 	}
 
+	// The policy is read on the main thread since workers have no
+	// localStorage
+	evictionPolicy, err := storage.GetEvictionPolicy()
+	if err != nil {
+		return nil, err
+	}
+
 	msg := NewWASMEventModelMessage{
 		DatabaseName:   databaseName,
 		EncryptionJSON: string(encryptionJSON),
+		EncryptionMode: encryptionMode,
+		EvictionPolicy: evictionPolicy,
+		Timeouts:       impl.ConfiguredTimeouts(),
 	}
 
 	payload, err := json.Marshal(msg)
@@ -96,15 +114,55 @@ func NewWASMEventModel(path, wasmJsPath string, encryption idbCrypto.Cipher,
 		return nil, err
 	}
 
-	response, err := wm.SendMessage(NewWASMEventModelTag, payload)
+	if err = initWorker(wm.SendMessage, payload); err != nil {
+		return nil, err
+	}
+
+	model := &wasmModel{wm: wm, live: newLiveQueries(wm)}
+
+	// Restart the worker and reopen the database if the worker crashes or
+	// stops responding. The identity and live queries are registered on the
+	// new worker.
+	wm.Supervise(func(send func(worker.Tag, []byte) ([]byte, error)) error {
+		if err := connectLogger(wm); err != nil {
+			return err
+		}
+		if err := initWorker(send, payload); err != nil {
+			return err
+		}
+		if err := model.resendIdentity(send); err != nil {
+			return err
+		}
+		model.live.reconnect()
+		return nil
+	})
+
+	return model, nil
+}
+
+// connectLogger creates a MessageChannel between the worker and the logger so
+// that the worker logs are saved.
+func connectLogger(wm *worker.Manager) error {
+	err := worker.CreateMessageChannel(logging.GetLogger().Worker(), wm,
+		"channelsIndexedDbLogger", worker.LoggerTag)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create message channel "+
+			"between channel indexedDb worker and logger")
+	}
+	return nil
+}
+
+// initWorker sends the NewWASMEventModelMessage payload to the worker to open the
+// database.
+func initWorker(
+	send func(worker.Tag, []byte) ([]byte, error), payload []byte) error {
+	response, err := send(NewWASMEventModelTag, payload)
 	if err != nil {
-		return nil, errors.Wrapf(err,
-			"failed to send message %q", NewWASMEventModelTag)
+		return errors.Wrapf(err, "failed to send message %q", NewWASMEventModelTag)
 	} else if len(response) > 0 {
-		return nil, errors.New(string(response))
+		return errors.New(string(response))
 	}
-
-	return &wasmModel{wm}, nil
+	return nil
 }
 
 // EventUpdateCallbackMessage is JSON marshalled and received from the worker
@@ -144,24 +202,30 @@ type EncryptionStatusReply struct {
 	Error            string `json:"error"`
 }
 
-// checkDbEncryptionStatus returns an error if the encryption status provided
-// does not match the stored status for this database name.
-func checkDbEncryptionStatus(databaseName string, encryptionStatus bool) error {
+// checkDbEncryptionStatus returns the encryption mode stored for this
+// database name. New encrypted databases encrypt all sensitive fields. Returns
+// an error if the database was created with a different encryption status.
+func checkDbEncryptionStatus(databaseName string, encrypted bool) (
+	storage.EncryptionMode, error) {
+	mode := storage.EncryptionNone
+	if encrypted {
+		mode = storage.EncryptionAll
+	}
 
 	// Pass message values to storage
-	loadedEncryptionStatus, err := storage.StoreIndexedDbEncryptionStatus(
-		databaseName, encryptionStatus)
+	loadedMode, err := storage.StoreIndexedDbEncryptionStatus(
+		databaseName, mode)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	// Verify encryption status does not change
-	if encryptionStatus != loadedEncryptionStatus {
-		return errors.New(
-			"cannot load database with different encryption status")
-	} else if !encryptionStatus {
+	if encrypted != (loadedMode != storage.EncryptionNone) {
+		return 0, errors.Errorf("cannot load database with encryption mode "+
+			"%q with different encryption status", loadedMode)
+	} else if !encrypted {
 		jww.WARN.Printf("IndexedDb encryption disabled!")
 	}
 
-	return nil
+	return loadedMode, nil
 }
@@ -0,0 +1,295 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package channels
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/client/v4/channels"
+	"gitlab.com/elixxir/crypto/message"
+	"gitlab.com/elixxir/xxdk-wasm/worker"
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// LiveQuery describes a view of the messages in a channel that is kept up to
+// date by the worker.
+type LiveQuery struct {
+	// ChannelID is the channel the messages are in.
+	ChannelID *id.ID `json:"channelID"`
+
+	// Start and End bound the timestamps of the messages. Start is inclusive
+	// and End is exclusive. A zero time leaves that side of the window open.
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	// Types limits the messages to the given types. If it is empty, messages
+	// of every type are included.
+	Types []channels.MessageType `json:"types,omitempty"`
+
+	// IncludeHidden includes hidden messages.
+	IncludeHidden bool `json:"includeHidden"`
+
+	// PinnedOnly limits the messages to pinned messages.
+	PinnedOnly bool `json:"pinnedOnly"`
+}
+
+// LiveQueryUpdate is a change to the messages of a [LiveQuery].
+type LiveQueryUpdate struct {
+	// SubscriptionID is the ID of the subscription to the query.
+	SubscriptionID uint64 `json:"subscriptionID"`
+
+	// Reset is true if Inserted lists every message of the query, ordered from
+	// newest to oldest, and replaces all messages previously received. It is
+	// set on the first update of a subscription and after the worker is
+	// restarted.
+	Reset bool `json:"reset"`
+
+	// Inserted lists the messages added to the query.
+	Inserted []channels.ModelMessage `json:"inserted,omitempty"`
+
+	// Updated lists the messages of the query that were modified.
+	Updated []channels.ModelMessage `json:"updated,omitempty"`
+
+	// Removed lists the IDs of the messages removed from the query, either
+	// because they were deleted or because they no longer match it.
+	Removed []message.ID `json:"removed,omitempty"`
+}
+
+// SubscribeMessage is JSON marshalled and sent to the worker over the live
+// query MessageChannel for [wasmModel.Subscribe].
+type SubscribeMessage struct {
+	SubscriptionID uint64    `json:"subscriptionID"`
+	Query          LiveQuery `json:"query"`
+}
+
+// SubscribeReply is JSON marshalled and received from the worker in response
+// to [SubscribeMessage].
+type SubscribeReply struct {
+	Error string `json:"error"`
+}
+
+// UnsubscribeMessage is JSON marshalled and sent to the worker over the live
+// query MessageChannel for [wasmModel.Unsubscribe].
+type UnsubscribeMessage struct {
+	SubscriptionID uint64 `json:"subscriptionID"`
+}
+
+// Subscribe registers a live query on the worker. The callback is first called
+// with every message of the query (with Reset set) and then with each change
+// to them until the subscription is cancelled with [wasmModel.Unsubscribe].
+// Returns the ID of the subscription.
+func (w *wasmModel) Subscribe(
+	query LiveQuery, cb func(update LiveQueryUpdate)) (uint64, error) {
+	return w.live.subscribe(query, cb)
+}
+
+// Unsubscribe cancels the subscription with the given ID. No updates are
+// received for it afterward.
+func (w *wasmModel) Unsubscribe(subscriptionID uint64) error {
+	return w.live.unsubscribe(subscriptionID)
+}
+
+// subscription is a LiveQuery registered on the worker.
+type subscription struct {
+	query LiveQuery
+	cb    func(update LiveQueryUpdate)
+}
+
+// liveQueries manages the subscriptions to live queries. Updates are received
+// over a MessageChannel dedicated to live queries, which is opened with the
+// first subscription.
+type liveQueries struct {
+	wm *worker.Manager
+
+	// mm sends and receives messages over the live query MessageChannel. It
+	// is nil until the first subscription.
+	mm *worker.MessageManager
+
+	subscriptions map[uint64]*subscription
+
+	// nextID is the ID of the next subscription. IDs are chosen on the main
+	// thread so that the callback is registered before updates are received.
+	nextID uint64
+
+	mux sync.Mutex
+}
+
+// newLiveQueries returns a new liveQueries for the worker.
+func newLiveQueries(wm *worker.Manager) *liveQueries {
+	return &liveQueries{
+		wm:            wm,
+		subscriptions: make(map[uint64]*subscription),
+	}
+}
+
+// subscribe registers the query and its callback. Refer to
+// [wasmModel.Subscribe] for more information.
+func (lq *liveQueries) subscribe(
+	query LiveQuery, cb func(update LiveQueryUpdate)) (uint64, error) {
+	lq.mux.Lock()
+	if err := lq.connect(); err != nil {
+		lq.mux.Unlock()
+		return 0, err
+	}
+	subscriptionID := lq.nextID
+	lq.nextID++
+	lq.subscriptions[subscriptionID] = &subscription{query, cb}
+	mm := lq.mm
+	lq.mux.Unlock()
+
+	// The lock is released first since the worker sends the first update
+	// before replying
+	err := sendSubscribe(mm, subscriptionID, query)
+	if err != nil {
+		lq.mux.Lock()
+		delete(lq.subscriptions, subscriptionID)
+		lq.mux.Unlock()
+		return 0, err
+	}
+
+	return subscriptionID, nil
+}
+
+// unsubscribe cancels the subscription. Refer to [wasmModel.Unsubscribe] for
+// more information.
+func (lq *liveQueries) unsubscribe(subscriptionID uint64) error {
+	lq.mux.Lock()
+	defer lq.mux.Unlock()
+	if _, exists := lq.subscriptions[subscriptionID]; !exists {
+		return errors.Errorf(
+			"[CH] no live query with subscription ID %d", subscriptionID)
+	}
+	delete(lq.subscriptions, subscriptionID)
+
+	data, err := json.Marshal(UnsubscribeMessage{subscriptionID})
+	if err != nil {
+		return errors.Errorf(
+			"[CH] Could not JSON marshal %T: %+v", UnsubscribeMessage{}, err)
+	}
+
+	err = lq.mm.SendNoResponse(UnsubscribeTag, data)
+	if err != nil {
+		return errors.Wrapf(err, "[CH] failed to send to %q", UnsubscribeTag)
+	}
+	return nil
+}
+
+// reconnect opens a new live query MessageChannel to the restarted worker and
+// registers every subscription on it again. The worker resends every message
+// of each query with Reset set. Errors are logged since they must not fail the
+// restart.
+func (lq *liveQueries) reconnect() {
+	lq.mux.Lock()
+	if lq.mm == nil {
+		lq.mux.Unlock()
+		return
+	}
+	lq.mm.Stop()
+	lq.mm = nil
+	if err := lq.connect(); err != nil {
+		lq.mux.Unlock()
+		jww.ERROR.Printf("[CH] Failed to reconnect live queries: %+v", err)
+		return
+	}
+	subscriptions := make(map[uint64]LiveQuery, len(lq.subscriptions))
+	for subscriptionID, s := range lq.subscriptions {
+		subscriptions[subscriptionID] = s.query
+	}
+	mm := lq.mm
+	lq.mux.Unlock()
+
+	for subscriptionID, query := range subscriptions {
+		if err := sendSubscribe(mm, subscriptionID, query); err != nil {
+			jww.ERROR.Printf("[CH] Failed to register live query %d again: "+
+				"%+v", subscriptionID, err)
+		}
+	}
+}
+
+// connect opens the live query MessageChannel if it is not already open. It
+// must be called while holding the lock.
+func (lq *liveQueries) connect() error {
+	if lq.mm != nil {
+		return nil
+	}
+
+	port, err := lq.wm.OpenMessageChannel(
+		"channelsIndexedDbLiveQuery", LiveQueryKey)
+	if err != nil {
+		return errors.Wrap(err, "[CH] Failed to create message channel "+
+			"between channel indexedDb worker and main thread")
+	}
+	mm, err := worker.NewMessageManager(
+		port.Value, "channelsIndexedDbLiveQuery", worker.DefaultParams())
+	if err != nil {
+		return errors.Wrap(err, "[CH] Failed to create live query manager")
+	}
+	mm.RegisterCallback(LiveQueryUpdateTag, lq.receiveUpdate)
+
+	lq.mm = mm
+	return nil
+}
+
+// receiveUpdate is the callback for updates to live queries. Updates are
+// received in order, so the callback of each subscription is called in the
+// order the changes were made.
+func (lq *liveQueries) receiveUpdate(data []byte, _ func([]byte)) {
+	var update LiveQueryUpdate
+	if err := json.Unmarshal(data, &update); err != nil {
+		jww.ERROR.Printf(
+			"[CH] Failed to JSON unmarshal %T from worker: %+v", update, err)
+		return
+	}
+
+	lq.mux.Lock()
+	s, exists := lq.subscriptions[update.SubscriptionID]
+	lq.mux.Unlock()
+	if !exists {
+		jww.DEBUG.Printf("[CH] Dropping update for cancelled live query %d",
+			update.SubscriptionID)
+		return
+	}
+
+	s.cb(update)
+}
+
+// sendSubscribe registers the query on the worker with the subscription ID.
+func sendSubscribe(
+	mm *worker.MessageManager, subscriptionID uint64, query LiveQuery) error {
+	msg := SubscribeMessage{
+		SubscriptionID: subscriptionID,
+		Query:          query,
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return errors.Errorf("[CH] Could not JSON marshal %T: %+v", msg, err)
+	}
+
+	response, err := mm.Send(SubscribeTag, data)
+	if err != nil {
+		return errors.Wrapf(err, "[CH] failed to send to %q", SubscribeTag)
+	}
+
+	var reply SubscribeReply
+	if err = json.Unmarshal(response, &reply); err != nil {
+		return errors.Wrapf(err,
+			"[CH] Could not JSON unmarshal response to %q", SubscribeTag)
+	}
+
+	if reply.Error != "" {
+		return errors.New(reply.Error)
+	}
+	return nil
+}
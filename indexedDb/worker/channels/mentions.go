@@ -0,0 +1,184 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+// This file contains the mentions API. The worker parses the text of each
+// received text message for mentions, which are an @ followed by one of:
+//   - the base64 encoded public key of the mentioned identity,
+//   - their DM token, in decimal, or
+//   - their codename.
+//
+// A mention ends at the first character that is not a letter, a digit, or in
+// the base64 alphabet, so codenames that contain spaces cannot be mentioned by
+// codename. An @ that directly follows a letter or digit, such as in an email
+// address, does not start a mention. DM tokens and codenames are resolved
+// using the senders of previously received messages, so they are ignored if
+// the mentioned identity has not sent a message yet.
+
+package channels
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"gitlab.com/elixxir/client/v4/bindings"
+	"gitlab.com/elixxir/client/v4/channels"
+	"gitlab.com/elixxir/xxdk-wasm/worker"
+)
+
+// MessageReceivedJSON is the data of the [bindings.MessageReceived] event sent
+// when a message is stored.
+type MessageReceivedJSON struct {
+	bindings.MessageReceivedJSON
+
+	// MentionsMe is true if the message is new and mentions the local user,
+	// who is set with [EventModel.SetIdentity]. It is false for messages sent
+	// by the local user and for hidden messages.
+	MentionsMe bool `json:"mentionsMe"`
+}
+
+// MentionCursor marks the position of a message in the mentions of an
+// identity. It is returned by [EventModel.GetMentions] to read the next page of
+// mentions.
+type MentionCursor struct {
+	// Timestamp is the timestamp of the last message read. Only the
+	// millisecond is used.
+	Timestamp time.Time `json:"timestamp"`
+
+	// UUID is the UUID of the last message read.
+	UUID uint64 `json:"uuid"`
+}
+
+// Mentions is a page of messages that mention an identity. It is returned by
+// [EventModel.GetMentions].
+type Mentions struct {
+	// Messages lists the messages in the page, ordered from newest to oldest.
+	Messages []channels.ModelMessage `json:"messages"`
+
+	// Next is the cursor used to read the next page. It is nil if there are
+	// no more mentions.
+	Next *MentionCursor `json:"next,omitempty"`
+}
+
+// SetIdentityMessage is JSON marshalled and sent to the worker for
+// [wasmModel.SetIdentity].
+type SetIdentityMessage struct {
+	PubKey         ed25519.PublicKey `json:"pubKey"`
+	CodesetVersion uint8             `json:"codesetVersion"`
+}
+
+// GetMentionsMessage is JSON marshalled and sent to the worker for
+// [wasmModel.GetMentions].
+type GetMentionsMessage struct {
+	PubKey ed25519.PublicKey `json:"pubKey"`
+	Cursor *MentionCursor    `json:"cursor"`
+	Limit  int               `json:"limit"`
+}
+
+// GetMentionsReply is JSON marshalled and received from the worker in response
+// to [GetMentionsMessage].
+type GetMentionsReply struct {
+	Mentions *Mentions `json:"mentions"`
+	Error    string    `json:"error"`
+}
+
+// identity holds the SetIdentityMessage last sent to the worker so that it can
+// be sent again when the worker is restarted.
+type identity struct {
+	data []byte
+	mux  sync.Mutex
+}
+
+// SetIdentity sets the identity of the local user on the worker, which is used
+// to flag the messages that mention them. Messages received before it is set
+// are never flagged.
+func (w *wasmModel) SetIdentity(
+	pubKey ed25519.PublicKey, codesetVersion uint8) error {
+	msg := SetIdentityMessage{
+		PubKey:         pubKey,
+		CodesetVersion: codesetVersion,
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return errors.Errorf("[CH] Could not JSON marshal %T: %+v", msg, err)
+	}
+
+	w.identity.mux.Lock()
+	w.identity.data = data
+	w.identity.mux.Unlock()
+
+	return sendIdentity(w.wm.SendMessage, data)
+}
+
+// resendIdentity sends the identity to the restarted worker, if it was set.
+func (w *wasmModel) resendIdentity(
+	send func(worker.Tag, []byte) ([]byte, error)) error {
+	w.identity.mux.Lock()
+	data := w.identity.data
+	w.identity.mux.Unlock()
+
+	if data == nil {
+		return nil
+	}
+	return sendIdentity(send, data)
+}
+
+// sendIdentity sends the JSON of the SetIdentityMessage to the worker.
+func sendIdentity(
+	send func(worker.Tag, []byte) ([]byte, error), data []byte) error {
+	response, err := send(SetIdentityTag, data)
+	if err != nil {
+		return errors.Wrapf(err, "[CH] failed to send to %q", SetIdentityTag)
+	} else if len(response) > 0 {
+		return errors.New(string(response))
+	}
+	return nil
+}
+
+// GetMentions returns up to limit messages that mention the identity with the
+// given public key, ordered from newest to oldest, starting after the cursor.
+// If cursor is nil, the newest mentions are returned. Hidden messages are
+// excluded.
+func (w *wasmModel) GetMentions(ctx context.Context, pubKey ed25519.PublicKey,
+	cursor *MentionCursor, limit int) (*Mentions, error) {
+	msg := GetMentionsMessage{
+		PubKey: pubKey,
+		Cursor: cursor,
+		Limit:  limit,
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, errors.Errorf(
+			"[CH] Could not JSON marshal %T: %+v", msg, err)
+	}
+
+	response, err := w.wm.SendContext(ctx, GetMentionsTag, data)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"[CH] failed to send to %q", GetMentionsTag)
+	}
+
+	var reply GetMentionsReply
+	if err = json.Unmarshal(response, &reply); err != nil {
+		return nil, errors.Wrapf(err,
+			"[CH] Could not JSON unmarshal response to %q", GetMentionsTag)
+	}
+
+	if reply.Error != "" {
+		return nil, errors.New(reply.Error)
+	}
+
+	return reply.Mentions, nil
+}
@@ -25,6 +25,29 @@ const (
 	UpdateFromUUIDTag      worker.Tag = "UpdateFromUUID"
 	UpdateFromMessageIDTag worker.Tag = "UpdateFromMessageID"
 	GetMessageTag          worker.Tag = "GetMessage"
+	GetMessagesTag         worker.Tag = "GetMessages"
+	GetPinnedMessagesTag   worker.Tag = "GetPinnedMessages"
+	SearchMessagesTag      worker.Tag = "SearchMessages"
 	DeleteMessageTag       worker.Tag = "DeleteMessage"
 	MuteUserTag            worker.Tag = "MuteUser"
+	MarkReadTag            worker.Tag = "MarkRead"
+	GetUnreadCountTag      worker.Tag = "GetUnreadCount"
+	GetUnreadSummaryTag    worker.Tag = "GetUnreadSummary"
+	GetReactionsTag        worker.Tag = "GetReactions"
+	GetThreadTag           worker.Tag = "GetThread"
+	GetReplyCountsTag      worker.Tag = "GetReplyCounts"
+	SetRetentionPolicyTag  worker.Tag = "SetRetentionPolicy"
+	GetChangesSinceTag     worker.Tag = "GetChangesSince"
+	SetIdentityTag         worker.Tag = "SetIdentity"
+	GetMentionsTag         worker.Tag = "GetMentions"
+)
+
+// LiveQueryKey is the key of the MessageChannel used for live queries.
+const LiveQueryKey = "liveQuery"
+
+// List of tags of the messages sent over the live query MessageChannel.
+const (
+	SubscribeTag       worker.Tag = "Subscribe"
+	UnsubscribeTag     worker.Tag = "Unsubscribe"
+	LiveQueryUpdateTag worker.Tag = "LiveQueryUpdate"
 )
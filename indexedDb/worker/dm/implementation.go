@@ -10,21 +10,93 @@
 package dm
 
 import (
+	"context"
 	"crypto/ed25519"
 	"encoding/json"
+	"io"
 	"time"
 
+	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
 	"gitlab.com/elixxir/client/v4/cmix/rounds"
 	"gitlab.com/elixxir/client/v4/dm"
 	"gitlab.com/elixxir/crypto/message"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
 	"gitlab.com/elixxir/xxdk-wasm/worker"
+	"gitlab.com/xx_network/primitives/id"
 )
 
+// EventModel is a [dm.EventModel] that additionally supports searching the
+// messages stored in the database. Methods that take a context return the
+// context's error if it is done before the worker replies; if the context has
+// no deadline, the default response timeout is used.
+type EventModel interface {
+	dm.EventModel
+
+	// SearchMessages returns the UUIDs of up to limit messages that contain
+	// every word in the query, ordered from newest to oldest. If partnerKey is
+	// nil, then all conversations are searched. The search is aborted if the
+	// context is done first.
+	SearchMessages(ctx context.Context, query string,
+		partnerKey ed25519.PublicKey, limit int) ([]uint64, error)
+
+	// MarkRead marks the message with the given UUID, and every message in its
+	// conversation sent before it, as read.
+	MarkRead(ctx context.Context, uuid uint64) error
+
+	// GetUnreadCount returns the number of unread messages in the
+	// conversation with the partner.
+	GetUnreadCount(
+		ctx context.Context, partnerKey ed25519.PublicKey) (uint, error)
+
+	// GetUnreadSummary returns the unread count and last read message of
+	// every conversation with a partner that is not blocked.
+	GetUnreadSummary(ctx context.Context) ([]UnreadCount, error)
+
+	// GetConversationsByActivity returns up to limit conversations ordered
+	// after the cursor, from most to least recently active. Pass nil to start
+	// with the most recently active conversation.
+	GetConversationsByActivity(ctx context.Context, limit int,
+		cursor *ConversationCursor) ([]ConversationSummary, error)
+
+	// GetReactions returns the reactions to each of the messages, in the same
+	// order as messageIDs. Reactions sent with the public key self are marked
+	// as reacted by the local identity.
+	GetReactions(ctx context.Context, messageIDs []message.ID,
+		self ed25519.PublicKey) ([]MessageReactions, error)
+
+	// GetThread returns up to limit replies to the root message, ordered from
+	// oldest to newest, starting after the cursor. If cursor is nil, the
+	// thread is read from the first reply.
+	GetThread(ctx context.Context, rootMessageID message.ID, limit int,
+		cursor *ThreadCursor) (*Thread, error)
+
+	// GetReplyCounts returns the number of replies to each of the messages,
+	// in the same order as messageIDs.
+	GetReplyCounts(
+		ctx context.Context, messageIDs []message.ID) ([]uint, error)
+
+	// GetChangesSince returns up to limit changes made after the change with
+	// the given sequence number, ordered by sequence number. Each change is
+	// also sent on the EventUpdate callback with the event type
+	// impl.ChangeEvent once it is committed.
+	GetChangesSince(
+		ctx context.Context, seq uint64, limit int) ([]impl.Change, error)
+
+	// Subscribe registers a live query. The callback is called with every
+	// message of the query and then with each change to them. Returns the ID
+	// used to cancel the subscription.
+	Subscribe(query LiveQuery, cb func(update LiveQueryUpdate)) (uint64, error)
+
+	// Unsubscribe cancels the subscription to a live query.
+	Unsubscribe(subscriptionID uint64) error
+}
+
 // wasmModel implements dm.EventModel interface, which uses the channels system
 // passed an object that adheres to in order to get events on the channel.
 type wasmModel struct {
-	wh *worker.Manager
+	wh   *worker.Manager
+	live *liveQueries
 }
 
 // TransferMessage is JSON marshalled and sent to the worker.
@@ -70,7 +142,8 @@ func (w *wasmModel) Receive(messageID message.ID, nickname string, text []byte,
 
 	response, err := w.wh.SendMessage(ReceiveTag, data)
 	if err != nil {
-		jww.FATAL.Panicf("[DM] Failed to send to %q: %+v", ReceiveTag, err)
+		jww.ERROR.Printf("[DM] Failed to send to %q: %+v", ReceiveTag, err)
+		return 0
 	}
 
 	var uuid uint64
@@ -108,7 +181,8 @@ func (w *wasmModel) ReceiveText(messageID message.ID, nickname, text string,
 
 	response, err := w.wh.SendMessage(ReceiveTextTag, data)
 	if err != nil {
-		jww.FATAL.Panicf("[DM] Failed to send to %q: %+v", ReceiveTextTag, err)
+		jww.ERROR.Printf("[DM] Failed to send to %q: %+v", ReceiveTextTag, err)
+		return 0
 	}
 
 	var uuid uint64
@@ -147,7 +221,8 @@ func (w *wasmModel) ReceiveReply(messageID, reactionTo message.ID, nickname,
 
 	response, err := w.wh.SendMessage(ReceiveReplyTag, data)
 	if err != nil {
-		jww.FATAL.Panicf("[DM] Failed to send to %q: %+v", ReceiveReplyTag, err)
+		jww.ERROR.Printf("[DM] Failed to send to %q: %+v", ReceiveReplyTag, err)
+		return 0
 	}
 
 	var uuid uint64
@@ -186,7 +261,9 @@ func (w *wasmModel) ReceiveReaction(messageID, reactionTo message.ID, nickname,
 
 	response, err := w.wh.SendMessage(ReceiveReactionTag, data)
 	if err != nil {
-		jww.FATAL.Panicf("[DM] Failed to send to %q: %+v", ReceiveReactionTag, err)
+		jww.ERROR.Printf(
+			"[DM] Failed to send to %q: %+v", ReceiveReactionTag, err)
+		return 0
 	}
 
 	var uuid uint64
@@ -216,7 +293,8 @@ func (w *wasmModel) UpdateSentStatus(uuid uint64, messageID message.ID,
 	}
 
 	if err = w.wh.SendNoResponse(UpdateSentStatusTag, data); err != nil {
-		jww.FATAL.Panicf("[DM] Failed to send to %q: %+v", UpdateSentStatusTag, err)
+		jww.ERROR.Printf(
+			"[DM] Failed to send to %q: %+v", UpdateSentStatusTag, err)
 	}
 }
 
@@ -235,10 +313,13 @@ func (w *wasmModel) DeleteMessage(
 
 	response, err := w.wh.SendMessage(DeleteMessageTag, data)
 	if err != nil {
-		jww.FATAL.Panicf("[DM] Failed to send to %q: %+v", DeleteMessageTag, err)
+		jww.ERROR.Printf(
+			"[DM] Failed to send to %q: %+v", DeleteMessageTag, err)
+		return false
 	} else if len(response) == 0 {
-		jww.FATAL.Panicf(
+		jww.ERROR.Printf(
 			"[DM] Received empty response from %q", DeleteMessageTag)
+		return false
 	}
 
 	return response[0] == 1
@@ -247,7 +328,9 @@ func (w *wasmModel) DeleteMessage(
 func (w *wasmModel) GetConversation(senderPubKey ed25519.PublicKey) *dm.ModelConversation {
 	response, err := w.wh.SendMessage(GetConversationTag, senderPubKey)
 	if err != nil {
-		jww.FATAL.Panicf("[DM] Failed to send to %q: %+v", GetConversationTag, err)
+		jww.ERROR.Printf(
+			"[DM] Failed to send to %q: %+v", GetConversationTag, err)
+		return nil
 	}
 
 	var result dm.ModelConversation
@@ -260,18 +343,557 @@ func (w *wasmModel) GetConversation(senderPubKey ed25519.PublicKey) *dm.ModelCon
 	return &result
 }
 
+// ConversationsChunkSize is the maximum number of conversations sent by the
+// worker in each chunk of the response to [GetConversationsTag].
+const ConversationsChunkSize = 100
+
+// GetConversations returns all conversations. The worker streams them in
+// chunks of up to [ConversationsChunkSize] so that large lists are not sent in
+// a single message. Use [wasmModel.IterateConversations] to read them without
+// holding the whole list.
 func (w *wasmModel) GetConversations() []dm.ModelConversation {
-	response, err := w.wh.SendMessage(GetConversationsTag, nil)
+	it, err := w.IterateConversations(context.Background())
 	if err != nil {
-		jww.FATAL.Panicf("[DM] Failed to send to %q: %+v", GetConversationsTag, err)
+		jww.ERROR.Printf("%+v", err)
+		return nil
 	}
 
-	var result []dm.ModelConversation
-	if err = json.Unmarshal(response, &result); err != nil {
-		jww.ERROR.Printf("[DM] Failed to JSON unmarshal %T from worker for "+
-			"%q: %+v", result, GetConversationsTag, err)
-		return nil
+	result := make([]dm.ModelConversation, 0)
+	for {
+		convo, err := it.Next()
+		if err == io.EOF {
+			return result
+		} else if err != nil {
+			jww.ERROR.Printf("%+v", err)
+			return nil
+		}
+		result = append(result, convo)
+	}
+}
+
+// ConversationIterator returns the conversations streamed by the worker one at
+// a time, ordered from most to least recently active. Only one chunk of
+// conversations is held at once. It is not safe for concurrent use.
+type ConversationIterator struct {
+	stream *worker.StreamReader
+	chunk  []dm.ModelConversation
+}
+
+// IterateConversations returns a ConversationIterator over all conversations.
+// If the context is done, the worker stops reading conversations and the
+// iterator returns the context's error.
+func (w *wasmModel) IterateConversations(
+	ctx context.Context) (*ConversationIterator, error) {
+	stream, err := w.wh.SendStream(ctx, GetConversationsTag, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"[DM] failed to send to %q", GetConversationsTag)
+	}
+	return &ConversationIterator{stream: stream}, nil
+}
+
+// Next returns the next conversation. It blocks until the worker sends it.
+// Returns [io.EOF] once every conversation has been returned.
+func (it *ConversationIterator) Next() (dm.ModelConversation, error) {
+	for len(it.chunk) == 0 {
+		data, err := it.stream.Next()
+		if err == io.EOF {
+			return dm.ModelConversation{}, io.EOF
+		} else if err != nil {
+			return dm.ModelConversation{}, errors.Wrapf(err,
+				"[DM] failed to receive conversations from %q",
+				GetConversationsTag)
+		}
+
+		// An older worker replies with every conversation in one chunk
+		if err = json.Unmarshal(data, &it.chunk); err != nil {
+			it.stream.Close()
+			return dm.ModelConversation{}, errors.Wrapf(err,
+				"[DM] failed to JSON unmarshal %T from worker for %q",
+				it.chunk, GetConversationsTag)
+		}
+	}
+
+	convo := it.chunk[0]
+	it.chunk = it.chunk[1:]
+	return convo, nil
+}
+
+// Close stops receiving conversations. It must be called if the iterator is
+// not read until it returns [io.EOF].
+func (it *ConversationIterator) Close() {
+	it.stream.Close()
+}
+
+// SearchMessagesMessage is JSON marshalled and sent to the worker for
+// [wasmModel.SearchMessages].
+type SearchMessagesMessage struct {
+	Query      string            `json:"query"`
+	PartnerKey ed25519.PublicKey `json:"partnerKey"`
+	Limit      int               `json:"limit"`
+}
+
+// SearchMessagesReply is JSON marshalled and received from the worker in
+// response to [SearchMessagesMessage].
+type SearchMessagesReply struct {
+	UUIDs []uint64 `json:"uuids"`
+	Error string   `json:"error"`
+}
+
+// SearchMessages returns the UUIDs of up to limit messages that contain every
+// word in the query, ordered from newest to oldest. If partnerKey is nil, then
+// all conversations are searched. If the context is done before the worker
+// replies, the search is aborted and the context's error is returned.
+func (w *wasmModel) SearchMessages(ctx context.Context, query string,
+	partnerKey ed25519.PublicKey, limit int) ([]uint64, error) {
+	msg := SearchMessagesMessage{
+		Query:      query,
+		PartnerKey: partnerKey,
+		Limit:      limit,
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, errors.Errorf(
+			"[DM] Could not JSON marshal %T: %+v", msg, err)
+	}
+
+	response, err := w.wh.SendContext(ctx, SearchMessagesTag, data)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"[DM] failed to send to %q", SearchMessagesTag)
+	}
+
+	var reply SearchMessagesReply
+	if err = json.Unmarshal(response, &reply); err != nil {
+		return nil, errors.Wrapf(err,
+			"[DM] Could not JSON unmarshal response to %q", SearchMessagesTag)
+	}
+
+	if reply.Error != "" {
+		return nil, errors.New(reply.Error)
+	}
+
+	return reply.UUIDs, nil
+}
+
+// UnreadCount describes the unread messages in a single conversation. It is
+// returned by [EventModel.GetUnreadSummary] and is sent on the EventUpdate
+// callback with the event type impl.UnreadCountEvent whenever the count
+// changes.
+type UnreadCount struct {
+	// PubKey is the public key of the conversation partner.
+	PubKey ed25519.PublicKey `json:"pubKey"`
+
+	// LastRead is the UUID of the last message marked as read. It is zero if
+	// no message has been marked as read.
+	LastRead uint64 `json:"lastRead"`
+
+	// Unread is the number of unread messages.
+	Unread uint `json:"unread"`
+}
+
+// MarkRead marks the message with the given UUID, and every message in its
+// conversation sent before it, as read.
+func (w *wasmModel) MarkRead(ctx context.Context, uuid uint64) error {
+	data, err := json.Marshal(uuid)
+	if err != nil {
+		return errors.Errorf("[DM] Could not JSON marshal UUID: %+v", err)
+	}
+
+	response, err := w.wh.SendContext(ctx, MarkReadTag, data)
+	if err != nil {
+		return errors.Wrapf(err, "[DM] failed to send to %q", MarkReadTag)
+	} else if len(response) > 0 {
+		return errors.New(string(response))
+	}
+
+	return nil
+}
+
+// GetUnreadCountReply is JSON marshalled and received from the worker in
+// response to [wasmModel.GetUnreadCount].
+type GetUnreadCountReply struct {
+	Unread uint   `json:"unread"`
+	Error  string `json:"error"`
+}
+
+// GetUnreadCount returns the number of unread messages in the conversation
+// with the partner.
+func (w *wasmModel) GetUnreadCount(
+	ctx context.Context, partnerKey ed25519.PublicKey) (uint, error) {
+	response, err := w.wh.SendContext(ctx, GetUnreadCountTag, partnerKey)
+	if err != nil {
+		return 0, errors.Wrapf(err,
+			"[DM] failed to send to %q", GetUnreadCountTag)
+	}
+
+	var reply GetUnreadCountReply
+	if err = json.Unmarshal(response, &reply); err != nil {
+		return 0, errors.Wrapf(err,
+			"[DM] Could not JSON unmarshal response to %q", GetUnreadCountTag)
+	}
+
+	if reply.Error != "" {
+		return 0, errors.New(reply.Error)
+	}
+
+	return reply.Unread, nil
+}
+
+// GetUnreadSummaryReply is JSON marshalled and received from the worker in
+// response to [wasmModel.GetUnreadSummary].
+type GetUnreadSummaryReply struct {
+	Summary []UnreadCount `json:"summary"`
+	Error   string        `json:"error"`
+}
+
+// GetUnreadSummary returns the unread count and last read message of every
+// conversation with a partner that is not blocked.
+func (w *wasmModel) GetUnreadSummary(
+	ctx context.Context) ([]UnreadCount, error) {
+	response, err := w.wh.SendContext(ctx, GetUnreadSummaryTag, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"[DM] failed to send to %q", GetUnreadSummaryTag)
+	}
+
+	var reply GetUnreadSummaryReply
+	if err = json.Unmarshal(response, &reply); err != nil {
+		return nil, errors.Wrapf(err, "[DM] Could not JSON unmarshal "+
+			"response to %q", GetUnreadSummaryTag)
+	}
+
+	if reply.Error != "" {
+		return nil, errors.New(reply.Error)
+	}
+
+	return reply.Summary, nil
+}
+
+// ConversationSummary is a [dm.ModelConversation] with its most recent
+// message. It is returned by [EventModel.GetConversationsByActivity].
+type ConversationSummary struct {
+	dm.ModelConversation
+
+	// LastMessageUUID is the UUID of the most recent message. It is zero if
+	// there are no messages.
+	LastMessageUUID uint64 `json:"last_message_uuid"`
+
+	// LastActivity is the timestamp of the most recent message.
+	LastActivity time.Time `json:"last_activity"`
+
+	// Preview is the start of the text of the most recent message. It is
+	// empty if the message has no text.
+	Preview string `json:"preview"`
+}
+
+// ConversationCursor marks the position of a conversation in the order of
+// [EventModel.GetConversationsByActivity]. Conversations are ordered by last
+// activity and then by public key. To read the next page, pass the last
+// activity and public key of the last conversation in the previous page; the
+// JSON of a [ConversationSummary] has the same fields.
+type ConversationCursor struct {
+	// LastActivity is the last activity of the conversation. Only the
+	// millisecond is used.
+	LastActivity time.Time `json:"last_activity"`
+
+	// PubKey is the public key of the conversation partner.
+	PubKey ed25519.PublicKey `json:"pub_key"`
+}
+
+// GetConversationsByActivityMessage is JSON marshalled and sent to the worker
+// for [wasmModel.GetConversationsByActivity].
+type GetConversationsByActivityMessage struct {
+	Limit  int                 `json:"limit"`
+	Cursor *ConversationCursor `json:"cursor"`
+}
+
+// GetConversationsByActivityReply is JSON marshalled and received from the
+// worker in response to [GetConversationsByActivityMessage].
+type GetConversationsByActivityReply struct {
+	Conversations []ConversationSummary `json:"conversations"`
+	Error         string                `json:"error"`
+}
+
+// GetConversationsByActivity returns up to limit conversations ordered after
+// the cursor, from most to least recently active. Pass nil to start with the
+// most recently active conversation.
+func (w *wasmModel) GetConversationsByActivity(ctx context.Context, limit int,
+	cursor *ConversationCursor) ([]ConversationSummary, error) {
+	msg := GetConversationsByActivityMessage{
+		Limit:  limit,
+		Cursor: cursor,
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, errors.Errorf(
+			"[DM] Could not JSON marshal %T: %+v", msg, err)
+	}
+
+	response, err := w.wh.SendContext(
+		ctx, GetConversationsByActivityTag, data)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"[DM] failed to send to %q", GetConversationsByActivityTag)
+	}
+
+	var reply GetConversationsByActivityReply
+	if err = json.Unmarshal(response, &reply); err != nil {
+		return nil, errors.Wrapf(err, "[DM] Could not JSON unmarshal "+
+			"response to %q", GetConversationsByActivityTag)
+	}
+
+	if reply.Error != "" {
+		return nil, errors.New(reply.Error)
+	}
+
+	return reply.Conversations, nil
+}
+
+// MessageReactions lists the reactions to a single message. It is returned by
+// [EventModel.GetReactions].
+type MessageReactions struct {
+	// MessageID is the ID of the message reacted to.
+	MessageID message.ID `json:"messageID"`
+
+	// Reactions lists each emoji reacted with, ordered from most to least
+	// used.
+	Reactions []Reaction `json:"reactions"`
+}
+
+// Reaction is the number of users that reacted to a message with an emoji.
+type Reaction struct {
+	// Emoji is the reaction.
+	Emoji string `json:"emoji"`
+
+	// Count is the number of users that reacted with the emoji.
+	Count uint `json:"count"`
+
+	// Reacted is true if the local identity reacted with the emoji.
+	Reacted bool `json:"reacted"`
+}
+
+// GetReactionsMessage is JSON marshalled and sent to the worker for
+// [wasmModel.GetReactions].
+type GetReactionsMessage struct {
+	MessageIDs []message.ID      `json:"messageIDs"`
+	Self       ed25519.PublicKey `json:"self"`
+}
+
+// GetReactionsReply is JSON marshalled and received from the worker in
+// response to [GetReactionsMessage].
+type GetReactionsReply struct {
+	Reactions []MessageReactions `json:"reactions"`
+	Error     string             `json:"error"`
+}
+
+// GetReactions returns the reactions to each of the messages, in the same
+// order as messageIDs. Reactions sent with the public key self are marked as
+// reacted by the local identity.
+func (w *wasmModel) GetReactions(ctx context.Context, messageIDs []message.ID,
+	self ed25519.PublicKey) ([]MessageReactions, error) {
+	msg := GetReactionsMessage{
+		MessageIDs: messageIDs,
+		Self:       self,
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, errors.Errorf(
+			"[DM] Could not JSON marshal %T: %+v", msg, err)
+	}
+
+	response, err := w.wh.SendContext(ctx, GetReactionsTag, data)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"[DM] failed to send to %q", GetReactionsTag)
+	}
+
+	var reply GetReactionsReply
+	if err = json.Unmarshal(response, &reply); err != nil {
+		return nil, errors.Wrapf(err,
+			"[DM] Could not JSON unmarshal response to %q", GetReactionsTag)
+	}
+
+	if reply.Error != "" {
+		return nil, errors.New(reply.Error)
+	}
+
+	return reply.Reactions, nil
+}
+
+// ModelMessage is a single message in a conversation. It is returned by
+// [EventModel.GetThread].
+type ModelMessage struct {
+	UUID               uint64            `json:"uuid"`
+	MessageID          message.ID        `json:"messageID"`
+	ParentMessageID    message.ID        `json:"parentMessageID"`
+	ConversationPubKey ed25519.PublicKey `json:"conversationPubKey"`
+	SenderPubKey       ed25519.PublicKey `json:"senderPubKey"`
+	Timestamp          time.Time         `json:"timestamp"`
+	Status             dm.Status         `json:"status"`
+	Content            []byte            `json:"content"`
+	Type               dm.MessageType    `json:"type"`
+	Round              id.Round          `json:"round"`
+	CodesetVersion     uint8             `json:"codesetVersion"`
+}
+
+// ThreadCursor marks the position of a reply in a thread. It is returned by
+// [EventModel.GetThread] to read the next page of replies.
+type ThreadCursor struct {
+	// Timestamp is the timestamp of the last reply read.
+	Timestamp time.Time `json:"timestamp"`
+
+	// UUID is the UUID of the last reply read.
+	UUID uint64 `json:"uuid"`
+}
+
+// Thread is a page of replies to a message. It is returned by
+// [EventModel.GetThread].
+type Thread struct {
+	// ReplyCount is the total number of replies to the message.
+	ReplyCount uint `json:"replyCount"`
+
+	// Replies lists the replies in the page, ordered from oldest to newest.
+	Replies []ModelMessage `json:"replies"`
+
+	// Next is the cursor used to read the next page. It is nil if there are
+	// no more replies.
+	Next *ThreadCursor `json:"next,omitempty"`
+}
+
+// GetThreadMessage is JSON marshalled and sent to the worker for
+// [wasmModel.GetThread].
+type GetThreadMessage struct {
+	RootMessageID message.ID    `json:"rootMessageID"`
+	Limit         int           `json:"limit"`
+	Cursor        *ThreadCursor `json:"cursor"`
+}
+
+// GetThreadReply is JSON marshalled and received from the worker in response
+// to [GetThreadMessage].
+type GetThreadReply struct {
+	Thread *Thread `json:"thread"`
+	Error  string  `json:"error"`
+}
+
+// GetThread returns up to limit replies to the root message, ordered from
+// oldest to newest, starting after the cursor. If cursor is nil, the thread is
+// read from the first reply.
+func (w *wasmModel) GetThread(ctx context.Context, rootMessageID message.ID,
+	limit int, cursor *ThreadCursor) (*Thread, error) {
+	msg := GetThreadMessage{
+		RootMessageID: rootMessageID,
+		Limit:         limit,
+		Cursor:        cursor,
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, errors.Errorf(
+			"[DM] Could not JSON marshal %T: %+v", msg, err)
+	}
+
+	response, err := w.wh.SendContext(ctx, GetThreadTag, data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "[DM] failed to send to %q", GetThreadTag)
+	}
+
+	var reply GetThreadReply
+	if err = json.Unmarshal(response, &reply); err != nil {
+		return nil, errors.Wrapf(err,
+			"[DM] Could not JSON unmarshal response to %q", GetThreadTag)
+	}
+
+	if reply.Error != "" {
+		return nil, errors.New(reply.Error)
+	}
+
+	return reply.Thread, nil
+}
+
+// GetReplyCountsReply is JSON marshalled and received from the worker in
+// response to [GetReplyCountsTag].
+type GetReplyCountsReply struct {
+	ReplyCounts []uint `json:"replyCounts"`
+	Error       string `json:"error"`
+}
+
+// GetReplyCounts returns the number of replies to each of the messages, in the
+// same order as messageIDs.
+func (w *wasmModel) GetReplyCounts(
+	ctx context.Context, messageIDs []message.ID) ([]uint, error) {
+	data, err := json.Marshal(messageIDs)
+	if err != nil {
+		return nil, errors.Errorf(
+			"[DM] Could not JSON marshal message IDs: %+v", err)
+	}
+
+	response, err := w.wh.SendContext(ctx, GetReplyCountsTag, data)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"[DM] failed to send to %q", GetReplyCountsTag)
+	}
+
+	var reply GetReplyCountsReply
+	if err = json.Unmarshal(response, &reply); err != nil {
+		return nil, errors.Wrapf(err,
+			"[DM] Could not JSON unmarshal response to %q", GetReplyCountsTag)
+	}
+
+	if reply.Error != "" {
+		return nil, errors.New(reply.Error)
+	}
+
+	return reply.ReplyCounts, nil
+}
+
+// GetChangesSinceMessage is JSON marshalled and sent to the worker for
+// [wasmModel.GetChangesSince].
+type GetChangesSinceMessage struct {
+	Seq   uint64 `json:"seq"`
+	Limit int    `json:"limit"`
+}
+
+// GetChangesSinceReply is JSON marshalled and received from the worker in
+// response to [GetChangesSinceMessage].
+type GetChangesSinceReply struct {
+	Changes []impl.Change `json:"changes"`
+	Error   string        `json:"error"`
+}
+
+// GetChangesSince returns up to limit changes made after the change with the
+// given sequence number, ordered by sequence number.
+func (w *wasmModel) GetChangesSince(
+	ctx context.Context, seq uint64, limit int) ([]impl.Change, error) {
+	msg := GetChangesSinceMessage{
+		Seq:   seq,
+		Limit: limit,
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, errors.Errorf(
+			"[DM] Could not JSON marshal %T: %+v", msg, err)
+	}
+
+	response, err := w.wh.SendContext(ctx, GetChangesSinceTag, data)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"[DM] failed to send to %q", GetChangesSinceTag)
+	}
+
+	var reply GetChangesSinceReply
+	if err = json.Unmarshal(response, &reply); err != nil {
+		return nil, errors.Wrapf(err,
+			"[DM] Could not JSON unmarshal response to %q", GetChangesSinceTag)
+	}
+
+	if reply.Error != "" {
+		return nil, errors.New(reply.Error)
 	}
 
-	return result
+	return reply.Changes, nil
 }
@@ -24,6 +24,26 @@ const (
 	UpdateSentStatusTag worker.Tag = "UpdateSentStatus"
 	DeleteMessageTag    worker.Tag = "DeleteMessage"
 
-	GetConversationTag  worker.Tag = "GetConversation"
-	GetConversationsTag worker.Tag = "GetConversations"
+	GetConversationTag            worker.Tag = "GetConversation"
+	GetConversationsTag           worker.Tag = "GetConversations"
+	GetConversationsByActivityTag worker.Tag = "GetConversationsByActivity"
+	SearchMessagesTag             worker.Tag = "SearchMessages"
+
+	MarkReadTag         worker.Tag = "MarkRead"
+	GetUnreadCountTag   worker.Tag = "GetUnreadCount"
+	GetUnreadSummaryTag worker.Tag = "GetUnreadSummary"
+	GetReactionsTag     worker.Tag = "GetReactions"
+	GetThreadTag        worker.Tag = "GetThread"
+	GetReplyCountsTag   worker.Tag = "GetReplyCounts"
+	GetChangesSinceTag  worker.Tag = "GetChangesSince"
+)
+
+// LiveQueryKey is the key of the MessageChannel used for live queries.
+const LiveQueryKey = "liveQuery"
+
+// List of tags of the messages sent over the live query MessageChannel.
+const (
+	SubscribeTag       worker.Tag = "Subscribe"
+	UnsubscribeTag     worker.Tag = "Unsubscribe"
+	LiveQueryUpdateTag worker.Tag = "LiveQueryUpdate"
 )
@@ -7,13 +7,12 @@
 
 //go:build js && wasm
 
-package dm
+package state
 
 import (
 	"encoding/json"
 
 	"github.com/pkg/errors"
-	jww "github.com/spf13/jwalterweatherman"
 
 	"gitlab.com/elixxir/xxdk-wasm/worker"
 )
@@ -43,7 +42,7 @@ func (w *wasmModel) Set(key string, value []byte) error {
 
 	response, err := w.wh.SendMessage(SetTag, data)
 	if err != nil {
-		jww.FATAL.Panicf("Failed to send message to %q: %+v", SetTag, err)
+		return errors.Wrapf(err, "failed to send message to %q", SetTag)
 	} else if len(response) > 0 {
 		return errors.New(string(response))
 	}
@@ -55,7 +54,7 @@ func (w *wasmModel) Get(key string) ([]byte, error) {
 
 	response, err := w.wh.SendMessage(GetTag, []byte(key))
 	if err != nil {
-		jww.FATAL.Panicf("Failed to send message to %q: %+v", GetTag, err)
+		return nil, errors.Wrapf(err, "failed to send message to %q", GetTag)
 	}
 
 	var msg TransferMessage
@@ -70,3 +69,54 @@ func (w *wasmModel) Get(key string) ([]byte, error) {
 
 	return msg.Value, nil
 }
+
+// Delete removes the value stored at the given key.
+func (w *wasmModel) Delete(key string) error {
+	response, err := w.wh.SendMessage(DeleteTag, []byte(key))
+	if err != nil {
+		return errors.Wrapf(err, "failed to send message to %q", DeleteTag)
+	} else if len(response) > 0 {
+		return errors.New(string(response))
+	}
+
+	return nil
+}
+
+// KeysMessage is JSON marshalled and received from the worker in response to
+// [wasmModel.Keys].
+type KeysMessage struct {
+	Keys  []string `json:"keys"`
+	Error string   `json:"error"`
+}
+
+// Keys returns all keys in the store in ascending order.
+func (w *wasmModel) Keys() ([]string, error) {
+	response, err := w.wh.SendMessage(KeysTag, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to send message to %q", KeysTag)
+	}
+
+	var msg KeysMessage
+	if err = json.Unmarshal(response, &msg); err != nil {
+		return nil, errors.Errorf(
+			"failed to JSON unmarshal %T from worker: %+v", msg, err)
+	}
+
+	if len(msg.Error) > 0 {
+		return nil, errors.New(msg.Error)
+	}
+
+	return msg.Keys, nil
+}
+
+// Clear removes all values from the store.
+func (w *wasmModel) Clear() error {
+	response, err := w.wh.SendMessage(ClearTag, nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed to send message to %q", ClearTag)
+	} else if len(response) > 0 {
+		return errors.New(string(response))
+	}
+
+	return nil
+}
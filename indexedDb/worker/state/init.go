@@ -7,7 +7,7 @@
 
 //go:build js && wasm
 
-package dm
+package state
 
 import (
 	"encoding/json"
@@ -15,6 +15,7 @@ import (
 	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
 
+	idbCrypto "gitlab.com/elixxir/crypto/indexedDb"
 	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
 	"gitlab.com/elixxir/xxdk-wasm/logging"
 	"gitlab.com/elixxir/xxdk-wasm/storage"
@@ -22,12 +23,16 @@ import (
 )
 
 // databaseSuffix is the suffix to be appended to the name of the database.
-const databaseSuffix = "_speakeasy_state"
+const databaseSuffix = storage.StateDatabaseSuffix
 
 // NewStateMessage is JSON marshalled and sent to the worker for
 // [NewState].
 type NewStateMessage struct {
-	DatabaseName string `json:"databaseName"`
+	DatabaseName   string `json:"databaseName"`
+	EncryptionJSON string `json:"encryptionJSON"`
+
+	// Timeouts are the database operation timeouts set on the main thread.
+	Timeouts impl.Timeouts `json:"timeouts"`
 }
 
 // WebState defines an interface for setting persistent state in a KV format
@@ -35,11 +40,16 @@ type NewStateMessage struct {
 type WebState interface {
 	Get(key string) ([]byte, error)
 	Set(key string, value []byte) error
+	Delete(key string) error
+	Keys() ([]string, error)
+	Clear() error
 }
 
 // NewState returns a [utility.WebState] backed by indexeddb.
-// The name should be a base64 encoding of the users public key.
-func NewState(path, wasmJsPath string) (impl.WebState, error) {
+// The name should be a base64 encoding of the users public key. If encryption
+// is nil, values are stored in plaintext.
+func NewState(path, wasmJsPath string, encryption idbCrypto.Cipher) (
+	impl.WebState, error) {
 	databaseName := path + databaseSuffix
 
 	wh, err := worker.NewManager(wasmJsPath, "stateIndexedDb", true)
@@ -49,11 +59,8 @@ func NewState(path, wasmJsPath string) (impl.WebState, error) {
 
 	// Create MessageChannel between worker and logger so that the worker logs
 	// are saved
-	err = worker.CreateMessageChannel(logging.GetLogger().Worker(), wh,
-		"stateIndexedDbLogger", worker.LoggerTag)
-	if err != nil {
-		return nil, errors.Wrap(err, "Failed to create message channel "+
-			"between state indexedDb worker and logger")
+	if err = connectLogger(wh); err != nil {
+		return nil, err
 	}
 
 	// Store the database name
@@ -62,8 +69,21 @@ func NewState(path, wasmJsPath string) (impl.WebState, error) {
 		return nil, err
 	}
 
+	// Check that the encryption status
+	err = checkDbEncryptionStatus(databaseName, encryption != nil)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptionJSON, err := json.Marshal(encryption)
+	if err != nil {
+		return nil, err
+	}
+
 	msg := NewStateMessage{
-		DatabaseName: databaseName,
+		DatabaseName:   databaseName,
+		EncryptionJSON: string(encryptionJSON),
+		Timeouts:       impl.ConfiguredTimeouts(),
 	}
 
 	payload, err := json.Marshal(msg)
@@ -71,12 +91,69 @@ func NewState(path, wasmJsPath string) (impl.WebState, error) {
 		return nil, err
 	}
 
-	response, err := wh.SendMessage(NewStateTag, payload)
+	if err = initWorker(wh.SendMessage, payload); err != nil {
+		return nil, err
+	}
+
+	// Restart the worker and reopen the database if the worker crashes or
+	// stops responding
+	wh.Supervise(func(send func(worker.Tag, []byte) ([]byte, error)) error {
+		if err := connectLogger(wh); err != nil {
+			return err
+		}
+		return initWorker(send, payload)
+	})
+
+	return &wasmModel{wh}, nil
+}
+
+// connectLogger creates a MessageChannel between the worker and the logger so
+// that the worker logs are saved.
+func connectLogger(wm *worker.Manager) error {
+	err := worker.CreateMessageChannel(logging.GetLogger().Worker(), wm,
+		"stateIndexedDbLogger", worker.LoggerTag)
 	if err != nil {
-		jww.FATAL.Panicf("Failed to send message to %q: %+v", NewStateTag, err)
+		return errors.Wrap(err, "Failed to create message channel "+
+			"between state indexedDb worker and logger")
+	}
+	return nil
+}
+
+// initWorker sends the NewStateMessage payload to the worker to open the
+// database.
+func initWorker(
+	send func(worker.Tag, []byte) ([]byte, error), payload []byte) error {
+	response, err := send(NewStateTag, payload)
+	if err != nil {
+		return errors.Wrapf(err, "failed to send message %q", NewStateTag)
 	} else if len(response) > 0 {
-		return nil, errors.New(string(response))
+		return errors.New(string(response))
 	}
+	return nil
+}
 
-	return &wasmModel{wh}, nil
+// checkDbEncryptionStatus returns an error if the encryption status provided
+// does not match the stored status for this database name.
+func checkDbEncryptionStatus(databaseName string, encrypted bool) error {
+	mode := storage.EncryptionNone
+	if encrypted {
+		mode = storage.EncryptionAll
+	}
+
+	// Pass message values to storage
+	loadedMode, err := storage.StoreIndexedDbEncryptionStatus(
+		databaseName, mode)
+	if err != nil {
+		return err
+	}
+
+	// Verify encryption status does not change
+	if encrypted != (loadedMode != storage.EncryptionNone) {
+		return errors.Errorf("cannot load database with encryption mode "+
+			"%q with different encryption status", loadedMode)
+	} else if !encrypted {
+		jww.WARN.Printf("IndexedDb encryption disabled!")
+	}
+
+	return nil
 }
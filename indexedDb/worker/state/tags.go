@@ -7,7 +7,7 @@
 
 //go:build js && wasm
 
-package dm
+package state
 
 import "gitlab.com/elixxir/xxdk-wasm/worker"
 
@@ -17,4 +17,7 @@ const (
 	NewStateTag worker.Tag = "NewState"
 	SetTag      worker.Tag = "Set"
 	GetTag      worker.Tag = "Get"
+	DeleteTag   worker.Tag = "Delete"
+	KeysTag     worker.Tag = "Keys"
+	ClearTag    worker.Tag = "Clear"
 )
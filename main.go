@@ -55,6 +55,9 @@ var wasmCmd = &cobra.Command{
 			jww.FATAL.Panicf("WASM binary version error: %+v", err)
 		}
 
+		// Ask the browser not to evict the databases under storage pressure
+		go storage.RequestPersistentStorageOnStart()
+
 		// Enable all top level bindings functions
 		setGlobals()
 
@@ -90,6 +93,10 @@ func setGlobals() {
 	// storage/purge.go
 	js.Global().Set("Purge", js.FuncOf(storage.Purge))
 
+	// storage/quota.go
+	js.Global().Set("GetStorageUsage", js.FuncOf(storage.GetStorageUsage))
+	js.Global().Set("SetEvictionPolicy", js.FuncOf(storage.SetEvictionPolicy))
+
 	// utils/array.go
 	js.Global().Set("Uint8ArrayToBase64", js.FuncOf(utils.Uint8ArrayToBase64))
 	js.Global().Set("Base64ToUint8Array", js.FuncOf(utils.Base64ToUint8Array))
@@ -212,6 +219,9 @@ func setGlobals() {
 	js.Global().Set("GetFactsFromContact",
 		js.FuncOf(wasm.GetFactsFromContact))
 
+	// wasm/indexedDb.go
+	js.Global().Set("SetDatabaseTimeouts", js.FuncOf(wasm.SetDatabaseTimeouts))
+
 	// wasm/logging.go
 	js.Global().Set("RegisterLogWriter", js.FuncOf(wasm.RegisterLogWriter))
 	js.Global().Set("EnableGrpcLogs", js.FuncOf(wasm.EnableGrpcLogs))
@@ -249,6 +259,9 @@ func setGlobals() {
 	js.Global().Set("TransmitSingleUse", js.FuncOf(wasm.TransmitSingleUse))
 	js.Global().Set("Listen", js.FuncOf(wasm.Listen))
 
+	// wasm/state.go
+	js.Global().Set("NewStateStore", js.FuncOf(wasm.NewStateStore))
+
 	// wasm/sync.go
 
 	// wasm/timeNow.go
@@ -10,34 +10,90 @@
 package storage
 
 import (
-	"github.com/pkg/errors"
 	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
 
 	"gitlab.com/elixxir/wasm-utils/storage"
 )
 
-// Key to store if the database is encrypted or not
-const databaseEncryptionToggleKey = "xxdkWasmDatabaseEncryptionToggle/"
+// Keys to store the encryption mode of the database.
+const (
+	// databaseEncryptionToggleKey is the legacy key that recorded if a
+	// database was created. Its value is not reliable since it was always set
+	// to true.
+	databaseEncryptionToggleKey = "xxdkWasmDatabaseEncryptionToggle/"
+
+	// databaseEncryptionModeKey stores the EncryptionMode of the database.
+	databaseEncryptionModeKey = "xxdkWasmDatabaseEncryptionMode/"
+)
+
+// EncryptionMode describes which fields of a database are encrypted.
+type EncryptionMode uint8
+
+const (
+	// EncryptionNone indicates that the database is not encrypted.
+	EncryptionNone EncryptionMode = iota
+
+	// EncryptionText indicates that only message text and file data are
+	// encrypted. Databases created before EncryptionAll use this mode.
+	EncryptionText
+
+	// EncryptionAll indicates that all sensitive fields are encrypted and
+	// indexed fields only hold blinded values.
+	EncryptionAll
+)
+
+// String returns a human-readable name for the EncryptionMode. This functions
+// satisfies the [fmt.Stringer] interface.
+func (m EncryptionMode) String() string {
+	switch m {
+	case EncryptionNone:
+		return "none"
+	case EncryptionText:
+		return "text"
+	case EncryptionAll:
+		return "all"
+	default:
+		return "INVALID ENCRYPTION MODE: " + strconv.Itoa(int(m))
+	}
+}
 
-// StoreIndexedDbEncryptionStatus stores the encryption status if it has not
-// been previously saved. If it has, then it returns its value.
+// StoreIndexedDbEncryptionStatus stores the encryption mode if it has not
+// been previously saved. If it has, then it returns the stored mode.
+//
+// Databases created before the mode was stored are recorded as
+// [EncryptionText] if the requested mode is encrypted, since no other fields
+// were encrypted then.
 func StoreIndexedDbEncryptionStatus(
-	databaseName string, encryptionStatus bool) (
-	loadedEncryptionStatus bool, err error) {
+	databaseName string, mode EncryptionMode) (EncryptionMode, error) {
 	ls := storage.GetLocalStorage()
-	data, err := ls.Get(databaseEncryptionToggleKey + databaseName)
-	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			keyName := databaseEncryptionToggleKey + databaseName
-			if err = ls.Set(keyName, []byte{1}); err != nil {
-				return false,
-					errors.Wrapf(err, "localStorage: failed to set %q", keyName)
-			}
-			return encryptionStatus, nil
-		} else {
-			return false, err
+	modeKey := databaseEncryptionModeKey + databaseName
+	data, err := ls.Get(modeKey)
+	if err == nil {
+		if len(data) != 1 || EncryptionMode(data[0]) > EncryptionAll {
+			return 0, errors.Errorf("invalid encryption mode %v stored for "+
+				"database %q", data, databaseName)
 		}
+		return EncryptionMode(data[0]), nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+
+	// Check if the database was created before the mode was stored
+	_, err = ls.Get(databaseEncryptionToggleKey + databaseName)
+	if err == nil {
+		if mode != EncryptionNone {
+			mode = EncryptionText
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+
+	if err = ls.Set(modeKey, []byte{byte(mode)}); err != nil {
+		return 0, errors.Wrapf(err, "localStorage: failed to set %q", modeKey)
 	}
 
-	return data[0] == 1, nil
+	return mode, nil
 }
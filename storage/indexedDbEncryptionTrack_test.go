@@ -11,30 +11,66 @@ package storage
 
 import (
 	"testing"
+
+	"gitlab.com/elixxir/wasm-utils/storage"
 )
 
-// Tests that StoreIndexedDbEncryptionStatus stores the initial encryption value
-// and return that value on subsequent checks.
+// Tests that StoreIndexedDbEncryptionStatus stores the initial encryption mode
+// and return that mode on subsequent checks.
 func TestStoreIndexedDbEncryptionStatus(t *testing.T) {
-	databaseName := "databaseA"
+	storage.GetLocalStorage().Clear()
+	for _, mode := range []EncryptionMode{EncryptionNone, EncryptionAll} {
+		databaseName := "database_" + mode.String()
 
-	encryptionStatus, err := StoreIndexedDbEncryptionStatus(databaseName, true)
-	if err != nil {
-		t.Errorf("Failed to store/get encryption status: %+v", err)
-	}
+		loaded, err := StoreIndexedDbEncryptionStatus(databaseName, mode)
+		if err != nil {
+			t.Errorf("Failed to store/get encryption mode: %+v", err)
+		}
 
-	if encryptionStatus != true {
-		t.Errorf("Incorrect encryption values.\nexpected: %t\nreceived: %t",
-			true, encryptionStatus)
-	}
+		if loaded != mode {
+			t.Errorf("Incorrect encryption mode.\nexpected: %s\nreceived: %s",
+				mode, loaded)
+		}
+
+		for _, other := range []EncryptionMode{EncryptionNone, EncryptionAll} {
+			loaded, err = StoreIndexedDbEncryptionStatus(databaseName, other)
+			if err != nil {
+				t.Errorf("Failed to store/get encryption mode: %+v", err)
+			}
 
-	encryptionStatus, err = StoreIndexedDbEncryptionStatus(databaseName, false)
-	if err != nil {
-		t.Errorf("Failed to store/get encryption status: %+v", err)
+			if loaded != mode {
+				t.Errorf("Incorrect encryption mode.\nexpected: %s"+
+					"\nreceived: %s", mode, loaded)
+			}
+		}
 	}
+}
+
+// Tests that StoreIndexedDbEncryptionStatus records databases created before
+// the encryption mode was stored as EncryptionText when encrypted.
+func TestStoreIndexedDbEncryptionStatus_Legacy(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+	for _, mode := range []EncryptionMode{EncryptionNone, EncryptionAll} {
+		databaseName := "legacy_" + mode.String()
+		err := ls.Set(databaseEncryptionToggleKey+databaseName, []byte{1})
+		if err != nil {
+			t.Fatalf("Failed to set legacy key: %+v", err)
+		}
+
+		expected := EncryptionNone
+		if mode != EncryptionNone {
+			expected = EncryptionText
+		}
+
+		loaded, err := StoreIndexedDbEncryptionStatus(databaseName, mode)
+		if err != nil {
+			t.Errorf("Failed to store/get encryption mode: %+v", err)
+		}
 
-	if encryptionStatus != true {
-		t.Errorf("Incorrect encryption values.\nexpected: %t\nreceived: %t",
-			true, encryptionStatus)
+		if loaded != expected {
+			t.Errorf("Incorrect encryption mode.\nexpected: %s\nreceived: %s",
+				expected, loaded)
+		}
 	}
 }
@@ -90,16 +90,29 @@ const (
 // Any password saved to local storage is encrypted using the user-provided
 // password.
 //
+// In synchronized environments (see [wasm.NewSynchronizedCmix]), pass in the
+// same remote store used for synchronization. If the password was changed on
+// another device with [ChangeExternalPassword], the internal password is then
+// loaded from the remote store so that it matches across devices.
+//
 // Parameters:
 //   - args[0] - The user supplied password (string).
+//   - args[1] - Javascript [wasm.RemoteStore] implementation. Only Read and
+//     Write are used. Read must resolve with null or reject with an Error
+//     named "NotFoundError" if the file does not exist. Pass in null or
+//     undefined if not using a remote store (optional).
+//   - args[2] - The remote "directory" or path prefix used by the RemoteStore
+//     when reading/writing files (string, optional).
 //
 // Returns a promise:
 //   - Internal password (Uint8Array).
 //   - Throws TypeError on failure.
 func GetOrInitPassword(_ js.Value, args []js.Value) any {
 	externalPassword := args[0].String()
+	rs, remotePath := remoteStoreFromArgs(args, 1)
 	promiseFn := func(resolve, reject func(args ...any) js.Value) {
-		internalPassword, err := getOrInit(externalPassword)
+		internalPassword, err :=
+			getOrInitWithRemote(externalPassword, rs, remotePath)
 		if err != nil {
 			reject(exception.NewTrace(err))
 		} else {
@@ -112,20 +125,47 @@ func GetOrInitPassword(_ js.Value, args []js.Value) any {
 
 // ChangeExternalPassword allows a user to change their external password.
 //
+// The internal password does not change; it is re-encrypted with a key derived
+// from the new password. Databases encrypted with a [wasm.DbCipher] created
+// from the internal password therefore remain readable.
+//
+// In synchronized environments (see [wasm.NewSynchronizedCmix]), pass in the
+// same remote store used for synchronization so that the re-encrypted internal
+// password is shared with other devices. Those devices must then call
+// [GetOrInitPassword] with the new password and the remote store.
+//
+// This function used to be synchronous and throw on failure. It now returns a
+// promise that is rejected on failure, so callers must await it; a try/catch
+// around the call alone no longer catches errors.
+//
 // Parameters:
 //   - args[0] - The user's old password (string).
 //   - args[1] - The user's new password (string).
+//   - args[2] - Javascript [wasm.RemoteStore] implementation. Only Read and
+//     Write are used. Pass in null or undefined if not using a remote store
+//     (optional).
+//   - args[3] - The remote "directory" or path prefix used by the RemoteStore
+//     when reading/writing files (string, optional).
 //
-// Returns:
-//   - Throws TypeError on failure.
+// Returns a promise:
+//   - Resolves on success.
+//   - Rejected with an error if the old password is incorrect or if storing
+//     the re-encrypted password fails.
 func ChangeExternalPassword(_ js.Value, args []js.Value) any {
-	err := changeExternalPassword(args[0].String(), args[1].String())
-	if err != nil {
-		exception.ThrowTrace(err)
-		return nil
+	oldExternalPassword := args[0].String()
+	newExternalPassword := args[1].String()
+	rs, remotePath := remoteStoreFromArgs(args, 2)
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		err := changeExternalPassword(
+			oldExternalPassword, newExternalPassword, rs, remotePath)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve()
+		}
 	}
 
-	return nil
+	return utils.CreatePromise(promiseFn)
 }
 
 // VerifyPassword determines if the user-provided password is correct.
@@ -157,36 +197,81 @@ func getOrInit(externalPassword string) ([]byte, error) {
 	return internalPassword, nil
 }
 
+// getOrInitWithRemote is the private function for GetOrInitPassword. If a
+// remote store is provided and it holds an encrypted internal password, then
+// that password is decrypted and saved to local storage. Otherwise, this falls
+// back to getOrInit and publishes the encrypted internal password to the remote
+// store so that other devices use the same one.
+func getOrInitWithRemote(
+	externalPassword string, rs remoteStore, remotePath string) ([]byte, error) {
+	if rs == nil {
+		return getOrInit(externalPassword)
+	}
+
+	internalPassword, err := syncFromRemote(externalPassword, rs, remotePath)
+	if err == nil {
+		return internalPassword, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	internalPassword, err = getOrInit(externalPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	wp, err := loadWrappedPassword(storage.GetLocalStorage())
+	if err != nil {
+		return nil, err
+	}
+	if err = wp.storeRemote(rs, remotePath); err != nil {
+		return nil, err
+	}
+
+	return internalPassword, nil
+}
+
 // changeExternalPassword is the private function for ChangeExternalPassword
 // that is used for testing.
-func changeExternalPassword(oldExternalPassword, newExternalPassword string) error {
-	// NOTE: the following no longer works in synchronized environments, so
-	// disabled in produciton.
-	jww.FATAL.Panicf("cannot change password, unimplemented")
+func changeExternalPassword(oldExternalPassword, newExternalPassword string,
+	rs remoteStore, remotePath string) error {
 	localStorage := storage.GetLocalStorage()
+
+	// Make sure the local copy is not older than one changed on another device
+	if rs != nil {
+		_, err := syncFromRemote(oldExternalPassword, rs, remotePath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
 	internalPassword, err := getInternalPassword(
 		oldExternalPassword, localStorage)
 	if err != nil {
 		return err
 	}
 
-	salt, err := makeSalt(csprng.NewSystemRNG())
+	rng := csprng.NewSystemRNG()
+	salt, err := makeSalt(rng)
 	if err != nil {
 		return err
 	}
-	if err = localStorage.Set(saltKey, salt); err != nil {
-		return errors.Wrapf(err, "localStorage: failed to set %q", saltKey)
+	params := defaultParams()
+	key := deriveKey(newExternalPassword, salt, params)
+	wp := wrappedPassword{
+		Salt:                      salt,
+		Params:                    params,
+		EncryptedInternalPassword: encryptPassword(internalPassword, key, rng),
 	}
 
-	key := deriveKey(newExternalPassword, salt, defaultParams())
-
-	encryptedInternalPassword := encryptPassword(
-		internalPassword, key, csprng.NewSystemRNG())
-	if err = localStorage.Set(passwordKey, encryptedInternalPassword); err != nil {
-		return errors.Wrapf(err, "localStorage: failed to set %q", passwordKey)
+	// Write to the remote first so that a failure leaves both copies unchanged
+	if rs != nil {
+		if err = wp.storeRemote(rs, remotePath); err != nil {
+			return err
+		}
 	}
 
-	return nil
+	return wp.storeLocal(localStorage)
 }
 
 // verifyPassword is the private function for VerifyPassword that is used for
@@ -0,0 +1,244 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path"
+	"syscall/js"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/wasm-utils/storage"
+	"gitlab.com/elixxir/wasm-utils/utils"
+)
+
+// Error messages.
+const (
+	// syncFromRemote
+	remoteReadErr         = "could not read encrypted internal password from remote store: %+v"
+	remoteUnmarshalErr    = "failed to unmarshal encrypted internal password from remote store: %+v"
+	remoteDecryptErr      = "could not decrypt internal password from remote store: %+v"
+	remoteStoreLocalErr   = "could not save internal password from remote store: %+v"
+	remoteWriteErr        = "could not write encrypted internal password to remote store: %+v"
+	loadLocalErr          = "could not load encrypted internal password from local storage: %+v"
+	localStoreRollbackErr = "failed to set %q (changes rolled back): %+v"
+)
+
+// remoteStore is the subset of [bindings.RemoteStore] used to share the
+// encrypted internal password between synchronized devices.
+type remoteStore interface {
+	Read(path string) ([]byte, error)
+	Write(path string, data []byte) error
+}
+
+// jsRemoteStore wraps a Javascript object that implements
+// [bindings.RemoteStore] to adhere to the remoteStore interface.
+type jsRemoteStore struct {
+	read  func(args ...any) js.Value
+	write func(args ...any) js.Value
+}
+
+// remoteStoreFromArgs returns the remote store and path prefix found at the
+// given index in the arguments. Returns nil if no remote store was provided.
+func remoteStoreFromArgs(args []js.Value, i int) (remoteStore, string) {
+	if len(args) <= i || args[i].IsUndefined() || args[i].IsNull() {
+		return nil, ""
+	}
+
+	var remotePath string
+	if len(args) > i+1 && args[i+1].Type() == js.TypeString {
+		remotePath = args[i+1].String()
+	}
+
+	return &jsRemoteStore{
+		read:  utils.WrapCB(args[i], "Read"),
+		write: utils.WrapCB(args[i], "Write"),
+	}, remotePath
+}
+
+// Read calls the Javascript Read function and returns the file data. Returns
+// an error wrapping [os.ErrNotExist] if the file does not exist, which is
+// signalled by resolving with null or undefined, or by rejecting with an Error
+// whose name is "NotFoundError" or whose code is "ENOENT".
+func (rs *jsRemoteStore) Read(path string) ([]byte, error) {
+	v, awaitErr := utils.Await(rs.read(path))
+	if awaitErr != nil {
+		if isNotFoundError(awaitErr[0]) {
+			return nil, errors.WithMessage(
+				os.ErrNotExist, js.Error{Value: awaitErr[0]}.Error())
+		}
+		return nil, js.Error{Value: awaitErr[0]}
+	}
+	if len(v) == 0 || v[0].IsUndefined() || v[0].IsNull() {
+		return nil, errors.WithMessagef(os.ErrNotExist, "%q", path)
+	}
+	return utils.CopyBytesToGo(v[0]), nil
+}
+
+// isNotFoundError returns true if the Javascript error thrown by the remote
+// store indicates that the file does not exist.
+func isNotFoundError(jsErr js.Value) bool {
+	if jsErr.Type() != js.TypeObject {
+		return false
+	}
+	name, code := jsErr.Get("name"), jsErr.Get("code")
+	return (name.Type() == js.TypeString && name.String() == "NotFoundError") ||
+		(code.Type() == js.TypeString && code.String() == "ENOENT")
+}
+
+// Write calls the Javascript Write function with the file data.
+func (rs *jsRemoteStore) Write(path string, data []byte) error {
+	_, awaitErr := utils.Await(rs.write(path, utils.CopyBytesToJS(data)))
+	if awaitErr != nil {
+		return js.Error{Value: awaitErr[0]}
+	}
+	return nil
+}
+
+// wrappedPassword is the internal password encrypted with a key derived from
+// the external password, along with the parameters needed to derive that key.
+// It is stored in the remote store as JSON.
+type wrappedPassword struct {
+	Salt                      []byte      `json:"salt"`
+	Params                    argonParams `json:"params"`
+	EncryptedInternalPassword []byte      `json:"encryptedInternalPassword"`
+}
+
+// remotePasswordPath returns the path of the encrypted internal password in
+// the remote store.
+func remotePasswordPath(remotePath string) string {
+	return path.Join(remotePath, passwordKey)
+}
+
+// syncFromRemote loads the encrypted internal password from the remote store,
+// decrypts it with the external password, and saves it to local storage.
+// Returns an error wrapping [os.ErrNotExist] only if the remote store does not
+// hold an encrypted internal password. Any other read error is returned without
+// it so that a local password is never used in place of an unreadable remote
+// one.
+func syncFromRemote(externalPassword string, rs remoteStore,
+	remotePath string) ([]byte, error) {
+	data, err := rs.Read(remotePasswordPath(remotePath))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			jww.DEBUG.Printf(
+				"No encrypted internal password in remote store: %+v", err)
+			return nil, errors.WithMessagef(os.ErrNotExist, remoteReadErr, err)
+		}
+		return nil, errors.Errorf(remoteReadErr, err)
+	}
+
+	var wp wrappedPassword
+	if err = json.Unmarshal(data, &wp); err != nil {
+		return nil, errors.Errorf(remoteUnmarshalErr, err)
+	}
+
+	key := deriveKey(externalPassword, wp.Salt, wp.Params)
+	internalPassword, err := decryptPassword(wp.EncryptedInternalPassword, key)
+	if err != nil {
+		return nil, errors.Errorf(remoteDecryptErr, err)
+	}
+
+	// Only update local storage if it differs from the remote copy
+	localStorage := storage.GetLocalStorage()
+	local, err := localStorage.Get(passwordKey)
+	if err == nil && bytes.Equal(local, wp.EncryptedInternalPassword) {
+		return internalPassword, nil
+	}
+
+	if err = wp.storeLocal(localStorage); err != nil {
+		return nil, errors.Errorf(remoteStoreLocalErr, err)
+	}
+
+	return internalPassword, nil
+}
+
+// loadWrappedPassword loads the wrappedPassword saved in local storage.
+func loadWrappedPassword(
+	localStorage storage.LocalStorage) (wrappedPassword, error) {
+	var wp wrappedPassword
+	var err error
+	wp.EncryptedInternalPassword, err = localStorage.Get(passwordKey)
+	if err != nil {
+		return wrappedPassword{}, errors.Errorf(loadLocalErr, err)
+	}
+	if wp.Salt, err = localStorage.Get(saltKey); err != nil {
+		return wrappedPassword{}, errors.Errorf(loadLocalErr, err)
+	}
+	paramsData, err := localStorage.Get(argonParamsKey)
+	if err != nil {
+		return wrappedPassword{}, errors.Errorf(loadLocalErr, err)
+	}
+	if err = json.Unmarshal(paramsData, &wp.Params); err != nil {
+		return wrappedPassword{}, errors.Errorf(loadLocalErr, err)
+	}
+	return wp, nil
+}
+
+// storeRemote writes the wrappedPassword to the remote store.
+func (wp wrappedPassword) storeRemote(rs remoteStore, remotePath string) error {
+	data, err := json.Marshal(wp)
+	if err != nil {
+		return err
+	}
+
+	if err = rs.Write(remotePasswordPath(remotePath), data); err != nil {
+		return errors.Errorf(remoteWriteErr, err)
+	}
+
+	return nil
+}
+
+// storeLocal saves the wrappedPassword to local storage. If any value fails to
+// save, then all values are restored to their previous state so that the
+// internal password can still be decrypted with the old external password.
+func (wp wrappedPassword) storeLocal(localStorage storage.LocalStorage) error {
+	paramsData, err := json.Marshal(wp.Params)
+	if err != nil {
+		return err
+	}
+
+	values := []struct {
+		key   string
+		value []byte
+	}{
+		{saltKey, wp.Salt},
+		{argonParamsKey, paramsData},
+		{passwordKey, wp.EncryptedInternalPassword},
+	}
+
+	// Save the current values in case they need to be restored
+	previous := make(map[string][]byte, len(values))
+	for _, v := range values {
+		if old, err := localStorage.Get(v.key); err == nil {
+			previous[v.key] = old
+		}
+	}
+
+	for _, v := range values {
+		if err = localStorage.Set(v.key, v.value); err != nil {
+			for key := range previous {
+				_ = localStorage.Set(key, previous[key])
+			}
+			for _, v2 := range values {
+				if _, exists := previous[v2.key]; !exists {
+					localStorage.RemoveItem(v2.key)
+				}
+			}
+			return errors.Errorf(localStoreRollbackErr, v.key, err)
+		}
+	}
+
+	return nil
+}
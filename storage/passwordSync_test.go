@@ -0,0 +1,191 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package storage
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"gitlab.com/elixxir/wasm-utils/storage"
+)
+
+// Tests that a password changed on one device with a remote store can be used
+// to get the same internal password on another device (simulated by clearing
+// local storage) and on a device with an outdated local copy.
+func Test_changeExternalPassword_RemoteStore(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+	rs := newMockRemoteStore()
+	remotePath := "remote/path"
+	oldExternalPassword := "myPassword"
+	newExternalPassword := "hunter2"
+
+	internalPassword, err :=
+		getOrInitWithRemote(oldExternalPassword, rs, remotePath)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	// The new password is published so that other devices use the same one
+	if _, exists := rs.files[remotePasswordPath(remotePath)]; !exists {
+		t.Fatalf("Password not written to remote store on init.")
+	}
+
+	// Save the outdated local copy to simulate a second device
+	outdated, err := loadWrappedPassword(ls)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	err = changeExternalPassword(
+		oldExternalPassword, newExternalPassword, rs, remotePath)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if _, exists := rs.files[remotePasswordPath(remotePath)]; !exists {
+		t.Fatalf("Password not written to remote store.")
+	}
+
+	// New device
+	ls.Clear()
+	loaded, err := getOrInitWithRemote(newExternalPassword, rs, remotePath)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if !bytes.Equal(internalPassword, loaded) {
+		t.Errorf("Internal password on new device does not match."+
+			"\nexpected: %+v\nreceived: %+v", internalPassword, loaded)
+	}
+
+	// Device with an outdated local copy
+	if err = outdated.storeLocal(ls); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	loaded, err = getOrInitWithRemote(newExternalPassword, rs, remotePath)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if !bytes.Equal(internalPassword, loaded) {
+		t.Errorf("Internal password on outdated device does not match."+
+			"\nexpected: %+v\nreceived: %+v", internalPassword, loaded)
+	}
+	if !verifyPassword(newExternalPassword) {
+		t.Errorf("Local storage not updated from remote store.")
+	}
+
+	// The old password no longer works
+	_, err = getOrInitWithRemote(oldExternalPassword, rs, remotePath)
+	expectedErr := strings.Split(remoteDecryptErr, "%")[0]
+	if err == nil || !strings.Contains(err.Error(), expectedErr) {
+		t.Errorf("Unexpected error for old password.\nexpected: %s"+
+			"\nreceived: %+v", expectedErr, err)
+	}
+}
+
+// Error path: Tests that changeExternalPassword does not change local storage
+// when writing to the remote store fails.
+func Test_changeExternalPassword_RemoteWriteError(t *testing.T) {
+	storage.GetLocalStorage().Clear()
+	rs := newMockRemoteStore()
+	rs.writeErr = errors.New("write failed")
+	externalPassword := "myPassword"
+
+	if _, err := getOrInitWithRemote(externalPassword, rs, ""); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	err := changeExternalPassword(externalPassword, "hunter2", rs, "")
+	expectedErr := strings.Split(remoteWriteErr, "%")[0]
+	if err == nil || !strings.Contains(err.Error(), expectedErr) {
+		t.Errorf("Unexpected error when remote write fails."+
+			"\nexpected: %s\nreceived: %+v", expectedErr, err)
+	}
+
+	if !verifyPassword(externalPassword) {
+		t.Errorf("Password %q no longer valid after failed change.",
+			externalPassword)
+	}
+}
+
+// Error path: Tests that getOrInitWithRemote and changeExternalPassword fail
+// without falling back to local storage when the remote store cannot be read
+// for a reason other than the password not existing.
+func Test_getOrInitWithRemote_RemoteReadError(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+	rs := newMockRemoteStore()
+	rs.readErr = errors.New("network error")
+	externalPassword := "myPassword"
+
+	_, err := getOrInitWithRemote(externalPassword, rs, "")
+	expectedErr := strings.Split(remoteReadErr, "%")[0]
+	if err == nil || !strings.Contains(err.Error(), expectedErr) ||
+		errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Unexpected error when remote read fails."+
+			"\nexpected: %s\nreceived: %+v", expectedErr, err)
+	}
+	if _, err = ls.Get(passwordKey); err == nil {
+		t.Errorf("Password initialised locally after remote read failed.")
+	}
+
+	// A stale local copy is not rotated when the remote cannot be read
+	rs.readErr = nil
+	if _, err = getOrInitWithRemote(externalPassword, rs, ""); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	remote := rs.files[remotePasswordPath("")]
+	rs.readErr = errors.New("network error")
+	err = changeExternalPassword(externalPassword, "hunter2", rs, "")
+	if err == nil || !strings.Contains(err.Error(), expectedErr) {
+		t.Errorf("Unexpected error when remote read fails."+
+			"\nexpected: %s\nreceived: %+v", expectedErr, err)
+	}
+	if !bytes.Equal(remote, rs.files[remotePasswordPath("")]) {
+		t.Errorf("Remote password changed after remote read failed.")
+	}
+	if !verifyPassword(externalPassword) {
+		t.Errorf("Password %q no longer valid after failed change.",
+			externalPassword)
+	}
+}
+
+// mockRemoteStore is an in-memory remoteStore used for testing.
+type mockRemoteStore struct {
+	files    map[string][]byte
+	readErr  error
+	writeErr error
+}
+
+func newMockRemoteStore() *mockRemoteStore {
+	return &mockRemoteStore{files: make(map[string][]byte)}
+}
+
+func (m *mockRemoteStore) Read(path string) ([]byte, error) {
+	if m.readErr != nil {
+		return nil, m.readErr
+	}
+	data, exists := m.files[path]
+	if !exists {
+		return nil, os.ErrNotExist
+	}
+	return data, nil
+}
+
+func (m *mockRemoteStore) Write(path string, data []byte) error {
+	if m.writeErr != nil {
+		return m.writeErr
+	}
+	m.files[path] = data
+	return nil
+}
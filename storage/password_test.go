@@ -43,38 +43,62 @@ func Test_getOrInit(t *testing.T) {
 }
 
 // Tests that changeExternalPassword correctly changes the password and updates
-// the encryption.
-// func Test_changeExternalPassword(t *testing.T) {
-// 	oldExternalPassword := "myPassword"
-// 	newExternalPassword := "hunter2"
-// 	oldInternalPassword, err := getOrInit(oldExternalPassword)
-// 	if err != nil {
-// 		t.Errorf("%+v", err)
-// 	}
+// the encryption without changing the internal password.
+func Test_changeExternalPassword(t *testing.T) {
+	storage.GetLocalStorage().Clear()
+	oldExternalPassword := "myPassword"
+	newExternalPassword := "hunter2"
+	oldInternalPassword, err := getOrInit(oldExternalPassword)
+	if err != nil {
+		t.Errorf("%+v", err)
+	}
 
-// 	err = changeExternalPassword(oldExternalPassword, newExternalPassword)
-// 	if err != nil {
-// 		t.Errorf("%+v", err)
-// 	}
+	err = changeExternalPassword(
+		oldExternalPassword, newExternalPassword, nil, "")
+	if err != nil {
+		t.Errorf("%+v", err)
+	}
 
-// 	newInternalPassword, err := getOrInit(newExternalPassword)
-// 	if err != nil {
-// 		t.Errorf("%+v", err)
-// 	}
+	newInternalPassword, err := getOrInit(newExternalPassword)
+	if err != nil {
+		t.Errorf("%+v", err)
+	}
 
-// 	if !bytes.Equal(oldInternalPassword, newInternalPassword) {
-// 		t.Errorf("Internal password was not changed in storage. Old and new "+
-// 			"should be different.\nold: %+v\nnew: %+v",
-// 			oldInternalPassword, newInternalPassword)
-// 	}
+	if !bytes.Equal(oldInternalPassword, newInternalPassword) {
+		t.Errorf("Internal password was changed in storage. Old and new "+
+			"should be the same.\nold: %+v\nnew: %+v",
+			oldInternalPassword, newInternalPassword)
+	}
 
-// 	_, err = getOrInit(oldExternalPassword)
-// 	expectedErr := strings.Split(decryptWithPasswordErr, "%")[0]
-// 	if err == nil || !strings.Contains(err.Error(), expectedErr) {
-// 		t.Errorf("Unexpected error when trying to get internal password with "+
-// 			"old external password.\nexpected: %s\nreceived: %+v", expectedErr, err)
-// 	}
-// }
+	_, err = getOrInit(oldExternalPassword)
+	expectedErr := strings.Split(decryptWithPasswordErr, "%")[0]
+	if err == nil || !strings.Contains(err.Error(), expectedErr) {
+		t.Errorf("Unexpected error when trying to get internal password with "+
+			"old external password.\nexpected: %s\nreceived: %+v", expectedErr, err)
+	}
+}
+
+// Error path: Tests that changeExternalPassword returns an error and does not
+// change the password when the old password is incorrect.
+func Test_changeExternalPassword_WrongPasswordError(t *testing.T) {
+	storage.GetLocalStorage().Clear()
+	externalPassword := "myPassword"
+	if _, err := getOrInit(externalPassword); err != nil {
+		t.Errorf("%+v", err)
+	}
+
+	err := changeExternalPassword("wrong password", "hunter2", nil, "")
+	expectedErr := strings.Split(decryptWithPasswordErr, "%")[0]
+	if err == nil || !strings.Contains(err.Error(), expectedErr) {
+		t.Errorf("Unexpected error when changing password with incorrect old "+
+			"password.\nexpected: %s\nreceived: %+v", expectedErr, err)
+	}
+
+	if !verifyPassword(externalPassword) {
+		t.Errorf("Password %q no longer valid after failed change.",
+			externalPassword)
+	}
+}
 
 // Tests that verifyPassword returns true for a valid password and false for an
 // invalid password
@@ -0,0 +1,469 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"syscall/js"
+	"time"
+
+	"github.com/hack-pad/go-indexeddb/idb"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/wasm-utils/exception"
+	"gitlab.com/elixxir/wasm-utils/storage"
+	"gitlab.com/elixxir/wasm-utils/utils"
+)
+
+// Suffixes appended to the name of each type of indexedDb database.
+const (
+	ChannelsDatabaseSuffix = "_speakeasy"
+	DmDatabaseSuffix       = "_speakeasy_dm"
+	StateDatabaseSuffix    = "_speakeasy_state"
+)
+
+// Types of indexedDb databases reported in DatabaseUsage.
+const (
+	ChannelsDatabase = "channels"
+	DmDatabase       = "dm"
+	StateDatabase    = "state"
+	UnknownDatabase  = "unknown"
+)
+
+const (
+	// evictionPolicyKey is the localStorage key for the EvictionPolicy.
+	evictionPolicyKey = "xxdkWasmEvictionPolicy"
+
+	// filesStoreName is the name of the object store that holds file blobs in
+	// channels databases.
+	filesStoreName = "files"
+
+	// usageTimeout is the maximum time to read the size of one object store.
+	usageTimeout = 30 * time.Second
+)
+
+// StorageEstimate is the quota and usage of the origin, as reported by the
+// browser's StorageManager.
+type StorageEstimate struct {
+	// Quota is the number of bytes the origin may use.
+	Quota uint64 `json:"quota"`
+
+	// Usage is the number of bytes the origin currently uses.
+	Usage uint64 `json:"usage"`
+
+	// Persisted is true if the storage is persistent and will not be evicted
+	// by the browser under storage pressure.
+	Persisted bool `json:"persisted"`
+}
+
+// EstimateStorage returns the storage quota and usage of the origin. It is
+// available on both the main thread and in workers.
+func EstimateStorage() (StorageEstimate, error) {
+	manager, err := storageManager()
+	if err != nil {
+		return StorageEstimate{}, err
+	}
+
+	result, awaitErr := utils.Await(manager.Call("estimate"))
+	if awaitErr != nil {
+		return StorageEstimate{}, errors.Wrap(
+			js.Error{Value: awaitErr[0]}, "failed to estimate storage")
+	}
+
+	estimate := StorageEstimate{
+		Quota: uint64(result[0].Get("quota").Float()),
+		Usage: uint64(result[0].Get("usage").Float()),
+	}
+
+	// persisted is not supported by all browsers
+	if manager.Get("persisted").Type() == js.TypeFunction {
+		persisted, awaitErr := utils.Await(manager.Call("persisted"))
+		if awaitErr != nil {
+			return StorageEstimate{}, errors.Wrap(js.Error{Value: awaitErr[0]},
+				"failed to check if storage is persisted")
+		}
+		estimate.Persisted = persisted[0].Bool()
+	}
+
+	return estimate, nil
+}
+
+// RequestPersistentStorage asks the browser to make the storage of the origin
+// persistent so that it is not evicted under storage pressure. Returns true if
+// the storage is persistent. The browser may deny the request without asking
+// the user.
+func RequestPersistentStorage() (bool, error) {
+	manager, err := storageManager()
+	if err != nil {
+		return false, err
+	}
+
+	result, awaitErr := utils.Await(manager.Call("persist"))
+	if awaitErr != nil {
+		return false, errors.Wrap(js.Error{Value: awaitErr[0]},
+			"failed to request persistent storage")
+	}
+	return result[0].Bool(), nil
+}
+
+// storageManager returns the browser's StorageManager.
+func storageManager() (js.Value, error) {
+	manager := js.Global().Get("navigator").Get("storage")
+	if manager.IsUndefined() {
+		return js.Undefined(), errors.New("StorageManager is not supported")
+	}
+	return manager, nil
+}
+
+// EvictionPolicy describes when and how data is evicted from the indexedDb
+// databases to keep the origin under its storage quota. When usage reaches the
+// high-water mark, the oldest file blobs are removed first, and then the
+// bodies of old messages, until usage is below the low-water mark.
+type EvictionPolicy struct {
+	// Disabled stops all eviction. Writes fail once the quota is exceeded.
+	Disabled bool `json:"disabled"`
+
+	// HighWaterMark is the fraction of the quota at which eviction starts.
+	HighWaterMark float64 `json:"highWaterMark"`
+
+	// LowWaterMark is the fraction of the quota at which eviction stops.
+	LowWaterMark float64 `json:"lowWaterMark"`
+
+	// MinMessageAge is the age a message must reach before its body may be
+	// evicted. Pinned messages are never evicted.
+	MinMessageAge time.Duration `json:"minMessageAge"`
+}
+
+// DefaultEvictionPolicy returns the EvictionPolicy used when none has been
+// set.
+func DefaultEvictionPolicy() EvictionPolicy {
+	return EvictionPolicy{
+		HighWaterMark: 0.9,
+		LowWaterMark:  0.8,
+		MinMessageAge: 30 * 24 * time.Hour,
+	}
+}
+
+// Validate returns an error if the water marks are not fractions of the quota
+// or if the low-water mark is above the high-water mark.
+func (p EvictionPolicy) Validate() error {
+	if p.HighWaterMark <= 0 || p.HighWaterMark > 1 {
+		return errors.Errorf("high-water mark must be in (0, 1], received %g",
+			p.HighWaterMark)
+	} else if p.LowWaterMark < 0 || p.LowWaterMark > p.HighWaterMark {
+		return errors.Errorf("low-water mark must be in [0, %g], received %g",
+			p.HighWaterMark, p.LowWaterMark)
+	} else if p.MinMessageAge < 0 {
+		return errors.Errorf("minimum message age cannot be negative, "+
+			"received %s", p.MinMessageAge)
+	}
+	return nil
+}
+
+// GetEvictionPolicy returns the stored EvictionPolicy or the
+// DefaultEvictionPolicy if none is stored. It can only be called from the main
+// thread.
+func GetEvictionPolicy() (EvictionPolicy, error) {
+	data, err := storage.GetLocalStorage().Get(evictionPolicyKey)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return DefaultEvictionPolicy(), nil
+		}
+		return EvictionPolicy{}, err
+	}
+
+	var policy EvictionPolicy
+	if err = json.Unmarshal(data, &policy); err != nil {
+		return EvictionPolicy{}, errors.Wrap(err,
+			"failed to JSON unmarshal EvictionPolicy")
+	}
+	return policy, nil
+}
+
+// StoreEvictionPolicy saves the EvictionPolicy to localStorage. It is applied
+// to databases opened afterwards. It can only be called from the main thread.
+func StoreEvictionPolicy(policy EvictionPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return errors.Wrap(err, "invalid EvictionPolicy")
+	}
+
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+
+	err = storage.GetLocalStorage().Set(evictionPolicyKey, data)
+	if err != nil {
+		return errors.Wrapf(err,
+			"localStorage: failed to set %q", evictionPolicyKey)
+	}
+	return nil
+}
+
+// DatabaseUsage is the approximate size of one indexedDb database.
+type DatabaseUsage struct {
+	Name string `json:"name"`
+
+	// Type is one of ChannelsDatabase, DmDatabase, StateDatabase, or
+	// UnknownDatabase.
+	Type string `json:"type"`
+
+	// Bytes is the size of every object store in the database.
+	Bytes uint64 `json:"bytes"`
+
+	// Stores is the size of each object store.
+	Stores map[string]uint64 `json:"stores"`
+}
+
+// StorageUsage is the storage used by the origin and by each indexedDb
+// database created by this WASM binary.
+type StorageUsage struct {
+	StorageEstimate
+
+	// Channels, DM, and State are the total size of all databases of each
+	// type. File blobs in channels databases are counted in Files instead of
+	// Channels.
+	Channels uint64 `json:"channels"`
+	DM       uint64 `json:"dm"`
+	State    uint64 `json:"state"`
+	Files    uint64 `json:"files"`
+
+	Databases      []DatabaseUsage `json:"databases"`
+	EvictionPolicy EvictionPolicy  `json:"evictionPolicy"`
+}
+
+// getStorageUsage returns the storage quota and usage of the origin and the
+// size of each indexedDb database. The size of a database is estimated from
+// the JSON encoding of its records, so it does not include indexes or the
+// overhead of the browser.
+func getStorageUsage() (*StorageUsage, error) {
+	estimate, err := EstimateStorage()
+	if err != nil {
+		return nil, err
+	}
+
+	policy, err := GetEvictionPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	databaseList, err := GetIndexedDbList()
+	if err != nil {
+		return nil, errors.Wrap(err,
+			"failed to get list of indexedDb database names")
+	}
+	names := make([]string, 0, len(databaseList))
+	for name := range databaseList {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	usage := &StorageUsage{
+		StorageEstimate: estimate,
+		Databases:       make([]DatabaseUsage, 0, len(names)),
+		EvictionPolicy:  policy,
+	}
+	for _, name := range names {
+		dbUsage, err := getDatabaseUsage(name)
+		if err != nil {
+			return nil, errors.Wrapf(err,
+				"failed to get usage of database %q", name)
+		} else if dbUsage == nil {
+			// The database was listed but never created or was deleted
+			continue
+		}
+		usage.Databases = append(usage.Databases, *dbUsage)
+
+		switch dbUsage.Type {
+		case ChannelsDatabase:
+			usage.Files += dbUsage.Stores[filesStoreName]
+			usage.Channels += dbUsage.Bytes - dbUsage.Stores[filesStoreName]
+		case DmDatabase:
+			usage.DM += dbUsage.Bytes
+		case StateDatabase:
+			usage.State += dbUsage.Bytes
+		}
+	}
+
+	return usage, nil
+}
+
+// databaseType returns the type of the database from the suffix of its name.
+func databaseType(databaseName string) string {
+	// Check the longest suffixes first, since they share a prefix
+	switch {
+	case strings.HasSuffix(databaseName, DmDatabaseSuffix):
+		return DmDatabase
+	case strings.HasSuffix(databaseName, StateDatabaseSuffix):
+		return StateDatabase
+	case strings.HasSuffix(databaseName, ChannelsDatabaseSuffix):
+		return ChannelsDatabase
+	default:
+		return UnknownDatabase
+	}
+}
+
+// getDatabaseUsage returns the size of each object store in the database.
+// Returns nil if the database does not exist.
+func getDatabaseUsage(databaseName string) (*DatabaseUsage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), usageTimeout)
+	defer cancel()
+
+	// Open the current version of the database without creating it
+	errNotExist := errors.New("database does not exist")
+	openRequest, err := idb.Global().Open(ctx, databaseName, 0,
+		func(*idb.Database, uint, uint) error { return errNotExist })
+	if err != nil {
+		return nil, err
+	}
+	db, err := openRequest.Await(ctx)
+	if err != nil {
+		if strings.Contains(err.Error(), errNotExist.Error()) ||
+			strings.Contains(err.Error(), "AbortError") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			jww.WARN.Printf("Failed to close database %q: %+v",
+				databaseName, err)
+		}
+	}()
+
+	storeNames, err := db.ObjectStoreNames()
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &DatabaseUsage{
+		Name:   databaseName,
+		Type:   databaseType(databaseName),
+		Stores: make(map[string]uint64, len(storeNames)),
+	}
+	for _, storeName := range storeNames {
+		size, err := getObjectStoreSize(db, storeName)
+		if err != nil {
+			return nil, errors.Wrapf(err,
+				"failed to get size of object store %q", storeName)
+		}
+		usage.Stores[storeName] = size
+		usage.Bytes += size
+	}
+
+	return usage, nil
+}
+
+// getObjectStoreSize returns the total length of the JSON encoding of every
+// record in the object store.
+func getObjectStoreSize(db *idb.Database, storeName string) (uint64, error) {
+	txn, err := db.Transaction(idb.TransactionReadOnly, storeName)
+	if err != nil {
+		return 0, errors.Errorf("Unable to create Transaction: %+v", err)
+	}
+	store, err := txn.ObjectStore(storeName)
+	if err != nil {
+		return 0, errors.Errorf("Unable to get ObjectStore: %+v", err)
+	}
+	cursorRequest, err := store.OpenCursor(idb.CursorNext)
+	if err != nil {
+		return 0, errors.Errorf("Unable to open Cursor: %+v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), usageTimeout)
+	defer cancel()
+	var size uint64
+	err = cursorRequest.Iter(ctx, func(cursor *idb.CursorWithValue) error {
+		value, err := cursor.Value()
+		if err != nil {
+			return err
+		}
+		size += uint64(len(utils.JsToJson(value)))
+		return nil
+	})
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+	return size, err
+}
+
+// RequestPersistentStorageOnStart requests persistent storage and logs the
+// result. It is called once when the WASM binary starts.
+func RequestPersistentStorageOnStart() {
+	persisted, err := RequestPersistentStorage()
+	if err != nil {
+		jww.WARN.Printf("Failed to request persistent storage: %+v", err)
+	} else if !persisted {
+		jww.WARN.Printf("Persistent storage was denied; the browser may " +
+			"evict the databases under storage pressure")
+	} else {
+		jww.INFO.Printf("Persistent storage granted")
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Javascript Bindings                                                        //
+////////////////////////////////////////////////////////////////////////////////
+
+// GetStorageUsage returns the storage quota and usage of the origin, the
+// approximate size of each indexedDb database created by this WASM binary, and
+// the current eviction policy.
+//
+// Returns a promise:
+//   - Resolves to the JSON of [StorageUsage] (Uint8Array).
+//   - Rejected with an error if the usage cannot be read.
+func GetStorageUsage(js.Value, []js.Value) any {
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		usage, err := getStorageUsage()
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		data, err := json.Marshal(usage)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+		resolve(utils.CopyBytesToJS(data))
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// SetEvictionPolicy sets the policy used to evict data from the indexedDb
+// databases as the storage quota is approached. The policy applies to
+// databases opened after it is set.
+//
+// Parameters:
+//   - args[0] - JSON of [EvictionPolicy] (Uint8Array).
+//
+// Returns:
+//   - Throws an error if the policy is invalid or cannot be stored.
+func SetEvictionPolicy(_ js.Value, args []js.Value) any {
+	var policy EvictionPolicy
+	err := json.Unmarshal(utils.CopyBytesToGo(args[0]), &policy)
+	if err != nil {
+		exception.Throwf("failed to JSON unmarshal EvictionPolicy: %+v", err)
+		return nil
+	}
+
+	if err = StoreEvictionPolicy(policy); err != nil {
+		exception.ThrowTrace(err)
+		return nil
+	}
+
+	return nil
+}
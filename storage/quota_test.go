@@ -0,0 +1,86 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package storage
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gitlab.com/elixxir/wasm-utils/storage"
+)
+
+// Tests that GetEvictionPolicy returns the default policy when none is stored
+// and returns the policy saved by StoreEvictionPolicy.
+func TestStoreEvictionPolicy_GetEvictionPolicy(t *testing.T) {
+	storage.GetLocalStorage().Clear()
+
+	policy, err := GetEvictionPolicy()
+	if err != nil {
+		t.Fatalf("Failed to get default policy: %+v", err)
+	} else if !reflect.DeepEqual(DefaultEvictionPolicy(), policy) {
+		t.Errorf("Unexpected default policy.\nexpected: %+v\nreceived: %+v",
+			DefaultEvictionPolicy(), policy)
+	}
+
+	expected := EvictionPolicy{
+		HighWaterMark: 0.75,
+		LowWaterMark:  0.5,
+		MinMessageAge: time.Hour,
+	}
+	if err = StoreEvictionPolicy(expected); err != nil {
+		t.Fatalf("Failed to store policy: %+v", err)
+	}
+
+	policy, err = GetEvictionPolicy()
+	if err != nil {
+		t.Fatalf("Failed to get policy: %+v", err)
+	} else if !reflect.DeepEqual(expected, policy) {
+		t.Errorf("Unexpected policy.\nexpected: %+v\nreceived: %+v",
+			expected, policy)
+	}
+}
+
+// Tests that StoreEvictionPolicy rejects invalid policies.
+func TestStoreEvictionPolicy_Invalid(t *testing.T) {
+	storage.GetLocalStorage().Clear()
+
+	invalid := []EvictionPolicy{
+		{},
+		{HighWaterMark: 1.5, LowWaterMark: 0.5},
+		{HighWaterMark: 0.5, LowWaterMark: 0.8},
+		{HighWaterMark: 0.9, LowWaterMark: -0.1},
+		{HighWaterMark: 0.9, LowWaterMark: 0.8, MinMessageAge: -time.Hour},
+	}
+	for i, policy := range invalid {
+		if err := StoreEvictionPolicy(policy); err == nil {
+			t.Errorf("Did not receive error for invalid policy %+v (%d).",
+				policy, i)
+		}
+	}
+}
+
+// Tests that databaseType returns the correct type for the suffix of each
+// database name.
+func Test_databaseType(t *testing.T) {
+	tests := map[string]string{
+		"user" + ChannelsDatabaseSuffix: ChannelsDatabase,
+		"user" + DmDatabaseSuffix:       DmDatabase,
+		"user" + StateDatabaseSuffix:    StateDatabase,
+		"user":                          UnknownDatabase,
+	}
+
+	for name, expected := range tests {
+		if dbType := databaseType(name); dbType != expected {
+			t.Errorf("Unexpected type for database %q."+
+				"\nexpected: %s\nreceived: %s", name, expected, dbType)
+		}
+	}
+}
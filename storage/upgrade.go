@@ -0,0 +1,180 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package storage
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/wasm-utils/storage"
+)
+
+// Storage keys for the version of the last upgrade that completed
+// successfully. They are only set while an upgrade is in progress.
+const (
+	wasmUpgradeProgressKey   = "xxdkWasmUpgradeProgress"
+	clientUpgradeProgressKey = "xxdkClientUpgradeProgress"
+)
+
+// Error messages.
+const (
+	downgradeErr       = "cannot downgrade %s from v%s to v%s; clear storage to use an older version"
+	invalidSemverErr   = "invalid semantic version %q"
+	upgradeOrderErr    = "%s upgrade v%s (%s) must have a higher version than v%s"
+	upgradeFailedErr   = "%s upgrade v%s (%s) failed"
+	upgradeProgressErr = "localStorage: failed to set %q"
+)
+
+// Upgrade is a single upgrade step that changes stored data for a new version.
+// It is run when upgrading from a version below Version to Version or higher.
+type Upgrade struct {
+	// Version is the semantic version that introduced the change.
+	Version string
+
+	// Name describes the upgrade. It is used in logs and errors.
+	Name string
+
+	// Run performs the upgrade. If it returns an error, the upgrade is retried
+	// on the next load.
+	Run func(ls storage.LocalStorage) error
+}
+
+// wasmUpgrades is the list of upgrades run when the xxDK WASM version changes.
+// Upgrades must be in ascending order of version and can never be removed or
+// reordered once released.
+var wasmUpgrades []Upgrade
+
+// clientUpgrades is the list of upgrades run when the xxDK client version
+// changes. Upgrades must be in ascending order of version and can never be
+// removed or reordered once released.
+var clientUpgrades []Upgrade
+
+// runUpgrades runs, in order, every upgrade with a version greater than the
+// stored version and less than or equal to the current version. The version of
+// each upgrade is saved to local storage at progressKey once it completes so
+// that an interrupted upgrade resumes after the last successful step. Returns
+// an error if the current version is older than the stored version.
+func runUpgrades(name, progressKey, storedVer, currentVer string,
+	upgrades []Upgrade, ls storage.LocalStorage) error {
+	cmp, err := compareSemver(currentVer, storedVer)
+	if err != nil {
+		return err
+	} else if cmp < 0 {
+		return errors.Errorf(downgradeErr, name, storedVer, currentVer)
+	}
+
+	// Skip upgrades that completed before an interruption
+	lastVer := storedVer
+	progress, err := ls.Get(progressKey)
+	if err == nil {
+		if cmp, err = compareSemver(string(progress), lastVer); err != nil {
+			return err
+		} else if cmp > 0 {
+			jww.INFO.Printf("Resuming %s upgrade after v%s", name, progress)
+			lastVer = string(progress)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return errors.Errorf("could not load %s from storage: %+v",
+			progressKey, err)
+	}
+
+	var prevVer string
+	for _, u := range upgrades {
+		// Upgrades must be strictly ascending for progress to be resumable
+		if prevVer != "" {
+			if cmp, err = compareSemver(u.Version, prevVer); err != nil {
+				return err
+			} else if cmp <= 0 {
+				return errors.Errorf(
+					upgradeOrderErr, name, u.Version, u.Name, prevVer)
+			}
+		}
+		prevVer = u.Version
+
+		// Only run upgrades in the range (lastVer, currentVer]
+		if cmp, err = compareSemver(u.Version, lastVer); err != nil {
+			return err
+		} else if cmp <= 0 {
+			continue
+		}
+		if cmp, err = compareSemver(u.Version, currentVer); err != nil {
+			return err
+		} else if cmp > 0 {
+			break
+		}
+
+		jww.INFO.Printf("Running %s upgrade v%s: %s", name, u.Version, u.Name)
+		if err = u.Run(ls); err != nil {
+			return errors.Wrapf(err, upgradeFailedErr, name, u.Version, u.Name)
+		}
+
+		if err = ls.Set(progressKey, []byte(u.Version)); err != nil {
+			return errors.Wrapf(err, upgradeProgressErr, progressKey)
+		}
+	}
+
+	return nil
+}
+
+// compareSemver compares two semantic versions. Returns 0 if a == b, -1 if
+// a < b, and +1 if a > b. Versions may have any number of numeric components
+// (e.g., "1.2" or "1.2.3"); missing components are treated as zero. A leading
+// "v" and any pre-release or build metadata are ignored.
+func compareSemver(a, b string) (int, error) {
+	aParts, err := parseSemver(a)
+	if err != nil {
+		return 0, err
+	}
+	bParts, err := parseSemver(b)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		var x, y int
+		if i < len(aParts) {
+			x = aParts[i]
+		}
+		if i < len(bParts) {
+			y = bParts[i]
+		}
+		if x < y {
+			return -1, nil
+		} else if x > y {
+			return 1, nil
+		}
+	}
+
+	return 0, nil
+}
+
+// parseSemver returns the numeric components of the semantic version.
+func parseSemver(v string) ([]int, error) {
+	s := strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(s, "-+"); i != -1 {
+		s = s[:i]
+	}
+
+	fields := strings.Split(s, ".")
+	parts := make([]int, len(fields))
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return nil, errors.Errorf(invalidSemverErr, v)
+		}
+		parts[i] = n
+	}
+
+	return parts, nil
+}
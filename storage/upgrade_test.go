@@ -0,0 +1,154 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package storage
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"gitlab.com/elixxir/wasm-utils/storage"
+)
+
+// newTestUpgrades returns a list of upgrades that record their version to ran
+// when run. The upgrade with the version failVer returns an error.
+func newTestUpgrades(ran *[]string, failVer string, versions ...string) []Upgrade {
+	upgrades := make([]Upgrade, len(versions))
+	for i, v := range versions {
+		v := v
+		upgrades[i] = Upgrade{
+			Version: v,
+			Name:    "test upgrade " + v,
+			Run: func(storage.LocalStorage) error {
+				if v == failVer {
+					return errors.New("upgrade failed")
+				}
+				*ran = append(*ran, v)
+				return nil
+			},
+		}
+	}
+	return upgrades
+}
+
+// Tests that runUpgrades only runs upgrades between the stored and current
+// versions, in order.
+func Test_runUpgrades(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+
+	var ran []string
+	upgrades := newTestUpgrades(&ran, "", "0.1.0", "0.2.0", "0.2.5", "0.3", "1.0.0")
+	err := runUpgrades("test", "progressKey", "0.1.0", "0.3.0", upgrades, ls)
+	if err != nil {
+		t.Fatalf("Failed to run upgrades: %+v", err)
+	}
+
+	expected := []string{"0.2.0", "0.2.5", "0.3"}
+	if !reflect.DeepEqual(expected, ran) {
+		t.Errorf("Unexpected upgrades run.\nexpected: %s\nreceived: %s",
+			expected, ran)
+	}
+}
+
+// Tests that when an upgrade fails, runUpgrades resumes after the last
+// successful upgrade on the next run.
+func Test_runUpgrades_Resume(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+
+	var ran []string
+	upgrades := newTestUpgrades(&ran, "0.3.0", "0.2.0", "0.3.0", "0.4.0")
+	err := runUpgrades("test", "progressKey", "0.1.0", "0.4.0", upgrades, ls)
+	if err == nil || !strings.Contains(err.Error(), "upgrade failed") {
+		t.Errorf("Unexpected error for failed upgrade: %+v", err)
+	}
+
+	progress, err := ls.Get("progressKey")
+	if err != nil || string(progress) != "0.2.0" {
+		t.Errorf("Unexpected progress.\nexpected: %s\nreceived: %s (%+v)",
+			"0.2.0", progress, err)
+	}
+
+	upgrades = newTestUpgrades(&ran, "", "0.2.0", "0.3.0", "0.4.0")
+	err = runUpgrades("test", "progressKey", "0.1.0", "0.4.0", upgrades, ls)
+	if err != nil {
+		t.Fatalf("Failed to run upgrades: %+v", err)
+	}
+
+	expected := []string{"0.2.0", "0.3.0", "0.4.0"}
+	if !reflect.DeepEqual(expected, ran) {
+		t.Errorf("Unexpected upgrades run.\nexpected: %s\nreceived: %s",
+			expected, ran)
+	}
+}
+
+// Error path: Tests that runUpgrades returns an error when the current version
+// is older than the stored version.
+func Test_runUpgrades_DowngradeError(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+
+	var ran []string
+	upgrades := newTestUpgrades(&ran, "", "0.2.0")
+	err := runUpgrades("test", "progressKey", "0.10.0", "0.9.1", upgrades, ls)
+	if err == nil || !strings.Contains(err.Error(), "cannot downgrade") {
+		t.Errorf("Unexpected error for downgrade: %+v", err)
+	}
+	if len(ran) != 0 {
+		t.Errorf("Upgrades run on downgrade: %s", ran)
+	}
+}
+
+// Error path: Tests that runUpgrades returns an error when the upgrades are not
+// in ascending order.
+func Test_runUpgrades_OrderError(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+
+	var ran []string
+	upgrades := newTestUpgrades(&ran, "", "0.3.0", "0.2.0")
+	err := runUpgrades("test", "progressKey", "0.1.0", "0.4.0", upgrades, ls)
+	if err == nil || !strings.Contains(err.Error(), "must have a higher") {
+		t.Errorf("Unexpected error for out of order upgrades: %+v", err)
+	}
+}
+
+// Tests that compareSemver correctly compares versions.
+func Test_compareSemver(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"0.3.18", "0.3.18", 0},
+		{"0.3.18", "0.3.9", 1},
+		{"0.3.9", "0.3.18", -1},
+		{"1.0", "1.0.0", 0},
+		{"v4.7.2", "4.7.2-rc1", 0},
+		{"2.5", "2.6", -1},
+		{"10.0.0", "9.9.9", 1},
+	}
+
+	for i, tt := range tests {
+		cmp, err := compareSemver(tt.a, tt.b)
+		if err != nil {
+			t.Errorf("Failed to compare %q and %q (%d): %+v", tt.a, tt.b, i, err)
+		} else if cmp != tt.expected {
+			t.Errorf("Unexpected comparison of %q and %q (%d)."+
+				"\nexpected: %d\nreceived: %d", tt.a, tt.b, i, tt.expected, cmp)
+		}
+	}
+
+	if _, err := compareSemver("1.x", "1.0"); err == nil {
+		t.Errorf("Failed to get error for invalid version.")
+	}
+}
@@ -34,6 +34,7 @@ const (
 // client to storage.
 //
 // On first load, only the xxDK WASM and xxDK client versions are stored.
+// Returns an error if either stored version is newer than the current version.
 func CheckAndStoreVersions() error {
 	return checkAndStoreVersions(
 		SEMVER, bindings.GetVersion(), storage.GetLocalStorage())
@@ -65,6 +66,11 @@ func checkAndStoreVersions(
 	} else {
 		jww.INFO.Printf("xxDK client version is current: v%s", storedClientVer)
 	}
+	err = runUpgrades("xxDK client", clientUpgradeProgressKey,
+		storedClientVer, currentClientVer, clientUpgrades, ls)
+	if err != nil {
+		return err
+	}
 
 	// Check if WASM needs an update
 	if storedWasmVer != currentWasmVer {
@@ -73,8 +79,11 @@ func checkAndStoreVersions(
 	} else {
 		jww.INFO.Printf("xxDK WASM version is current: v%s", storedWasmVer)
 	}
-
-	// Upgrade path code goes here
+	err = runUpgrades("xxDK WASM", wasmUpgradeProgressKey,
+		storedWasmVer, currentWasmVer, wasmUpgrades, ls)
+	if err != nil {
+		return err
+	}
 
 	// Save current versions
 	if err = ls.Set(clientVerKey, []byte(currentClientVer)); err != nil {
@@ -84,6 +93,10 @@ func checkAndStoreVersions(
 		return errors.Wrapf(err, "localStorage: failed to set %q", semverKey)
 	}
 
+	// Upgrades are complete, so progress no longer needs to be tracked
+	ls.RemoveItem(clientUpgradeProgressKey)
+	ls.RemoveItem(wasmUpgradeProgressKey)
+
 	return nil
 }
 
@@ -102,3 +102,29 @@ func Test_initOrLoadStoredSemver(t *testing.T) {
 			"\nexpected: %s\nreceived: %s", oldVersion, loadedVersion)
 	}
 }
+
+// Error path: Tests that checkAndStoreVersions returns an error and does not
+// overwrite the stored version when the current WASM version is older than the
+// stored version.
+func Test_checkAndStoreVersions_DowngradeError(t *testing.T) {
+	ls := storage.GetLocalStorage()
+	ls.Clear()
+	err := checkAndStoreVersions("1.0", "2.5", ls)
+	if err != nil {
+		t.Errorf("CheckAndStoreVersions error: %+v", err)
+	}
+
+	err = checkAndStoreVersions("0.9", "2.5", ls)
+	if err == nil {
+		t.Errorf("Failed to get error for downgrade.")
+	}
+
+	storedWasmVer, err := ls.Get(semverKey)
+	if err != nil {
+		t.Errorf("Failed to get WASM version from storage: %+v", err)
+	}
+	if string(storedWasmVer) != "1.0" {
+		t.Errorf("Stored WASM version overwritten on downgrade."+
+			"\nexpected: %s\nreceived: %s", "1.0", storedWasmVer)
+	}
+}
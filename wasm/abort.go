@@ -0,0 +1,48 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package wasm
+
+import (
+	"context"
+	"syscall/js"
+)
+
+// newAbortContext returns a context that is cancelled when the Javascript
+// AbortSignal at args[i] is aborted. The argument is optional; if it is not
+// provided or is null, the context is only cancelled by the returned
+// CancelFunc. The CancelFunc must always be called to release the listener on
+// the signal.
+//
+// Doc: https://developer.mozilla.org/en-US/docs/Web/API/AbortSignal
+func newAbortContext(
+	args []js.Value, i int) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if len(args) <= i || args[i].IsUndefined() || args[i].IsNull() {
+		return ctx, cancel
+	}
+
+	signal := args[i]
+	if signal.Get("aborted").Bool() {
+		cancel()
+		return ctx, cancel
+	}
+
+	onAbort := js.FuncOf(func(js.Value, []js.Value) any {
+		cancel()
+		return nil
+	})
+	signal.Call("addEventListener", "abort", onAbort)
+
+	return ctx, func() {
+		signal.Call("removeEventListener", "abort", onAbort)
+		onAbort.Release()
+		cancel()
+	}
+}
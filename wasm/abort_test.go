@@ -0,0 +1,47 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package wasm
+
+import (
+	"syscall/js"
+	"testing"
+	"time"
+)
+
+// Tests that the context returned by newAbortContext is cancelled when the
+// AbortSignal is aborted, whether before or after the context is created.
+func Test_newAbortContext(t *testing.T) {
+	// Without a signal, the context is not cancelled
+	ctx, cancel := newAbortContext([]js.Value{js.ValueOf("query")}, 1)
+	if ctx.Err() != nil {
+		t.Errorf("Context without signal cancelled: %+v", ctx.Err())
+	}
+	cancel()
+
+	// Signal already aborted
+	controller := js.Global().Get("AbortController").New()
+	controller.Call("abort")
+	ctx, cancel = newAbortContext([]js.Value{controller.Get("signal")}, 0)
+	if ctx.Err() == nil {
+		t.Errorf("Context not cancelled for aborted signal.")
+	}
+	cancel()
+
+	// Signal aborted after creation
+	controller = js.Global().Get("AbortController").New()
+	ctx, cancel = newAbortContext([]js.Value{controller.Get("signal")}, 0)
+	defer cancel()
+	controller.Call("abort")
+	select {
+	case <-ctx.Done():
+	case <-time.After(50 * time.Millisecond):
+		t.Errorf("Context not cancelled after signal aborted.")
+	}
+}
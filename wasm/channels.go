@@ -18,9 +18,12 @@ import (
 
 	"gitlab.com/elixxir/client/v4/bindings"
 	"gitlab.com/elixxir/client/v4/channels"
+	cryptoChannel "gitlab.com/elixxir/crypto/channel"
+	"gitlab.com/elixxir/crypto/message"
 	"gitlab.com/elixxir/wasm-utils/exception"
 	"gitlab.com/elixxir/wasm-utils/utils"
 	channelsDb "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/channels"
+	"gitlab.com/xx_network/primitives/id"
 )
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -31,12 +34,18 @@ import (
 // can be wrapped to be Javascript compatible.
 type ChannelsManager struct {
 	api *bindings.ChannelsManager
+
+	// model is the IndexedDb event model used by the manager. It is nil if the
+	// manager was not created with an IndexedDb backend.
+	model channelsDb.EventModel
 }
 
 // newChannelsManagerJS creates a new Javascript compatible object
-// (map[string]any) that matches the [ChannelsManager] structure.
-func newChannelsManagerJS(api *bindings.ChannelsManager) map[string]any {
-	cm := ChannelsManager{api}
+// (map[string]any) that matches the [ChannelsManager] structure. The model may
+// be nil if the manager does not use an IndexedDb backend.
+func newChannelsManagerJS(api *bindings.ChannelsManager,
+	model channelsDb.EventModel) map[string]any {
+	cm := ChannelsManager{api, model}
 	channelsManagerMap := map[string]any{
 		// Basic Channel API
 		"GetID":                 js.FuncOf(cm.GetID),
@@ -80,6 +89,22 @@ func newChannelsManagerJS(api *bindings.ChannelsManager) map[string]any {
 		// Channel Receiving Logic and Callback Registration
 		"RegisterReceiveHandler": js.FuncOf(cm.RegisterReceiveHandler),
 
+		// Message History
+		"GetMessages":        js.FuncOf(cm.GetMessages),
+		"GetPinnedMessages":  js.FuncOf(cm.GetPinnedMessages),
+		"SearchMessages":     js.FuncOf(cm.SearchMessages),
+		"MarkRead":           js.FuncOf(cm.MarkRead),
+		"GetUnreadCount":     js.FuncOf(cm.GetUnreadCount),
+		"GetUnreadSummary":   js.FuncOf(cm.GetUnreadSummary),
+		"GetReactions":       js.FuncOf(cm.GetReactions),
+		"GetThread":          js.FuncOf(cm.GetThread),
+		"GetMentions":        js.FuncOf(cm.GetMentions),
+		"GetReplyCounts":     js.FuncOf(cm.GetReplyCounts),
+		"SetRetentionPolicy": js.FuncOf(cm.SetRetentionPolicy),
+		"GetChangesSince":    js.FuncOf(cm.GetChangesSince),
+		"Subscribe":          js.FuncOf(cm.Subscribe),
+		"Unsubscribe":        js.FuncOf(cm.Unsubscribe),
+
 		// Notifications
 		"GetNotificationLevel":  js.FuncOf(cm.GetNotificationLevel),
 		"GetNotificationStatus": js.FuncOf(cm.GetNotificationStatus),
@@ -294,7 +319,7 @@ func NewChannelsManager(_ js.Value, args []js.Value) any {
 		return nil
 	}
 
-	return newChannelsManagerJS(cm)
+	return newChannelsManagerJS(cm, nil)
 }
 
 // LoadChannelsManager loads an existing [ChannelsManager] for the given storage
@@ -341,7 +366,7 @@ func LoadChannelsManager(_ js.Value, args []js.Value) any {
 		return nil
 	}
 
-	return newChannelsManagerJS(cm)
+	return newChannelsManagerJS(cm, nil)
 }
 
 // NewChannelsManagerWithIndexedDb creates a new [ChannelsManager] from a new
@@ -447,8 +472,14 @@ func newChannelsManagerWithIndexedDb(cmixID int, wasmJsPath string,
 	privateIdentity, extensionBuilderIDsJSON []byte, notificationsID int,
 	channelsCbs bindings.ChannelUICallbacks, cipher *DbCipher) any {
 
-	model := channelsDb.NewWASMEventModelBuilder(
-		wasmJsPath, cipher.api, channelsCbs)
+	// Keep a reference to the model so that the manager can query it directly
+	var eventModel channelsDb.EventModel
+	model := func(path string) (channels.EventModel, error) {
+		var err error
+		eventModel, err = channelsDb.NewWASMEventModel(
+			path, wasmJsPath, cipher.api, channelsCbs)
+		return eventModel, err
+	}
 
 	promiseFn := func(resolve, reject func(args ...any) js.Value) {
 		cm, err := bindings.NewChannelsManagerGoEventModel(cmixID,
@@ -456,14 +487,39 @@ func newChannelsManagerWithIndexedDb(cmixID int, wasmJsPath string,
 			channelsCbs)
 		if err != nil {
 			reject(exception.NewTrace(err))
+		} else if err = setModelIdentity(cm, eventModel); err != nil {
+			reject(exception.NewTrace(err))
 		} else {
-			resolve(newChannelsManagerJS(cm))
+			resolve(newChannelsManagerJS(cm, eventModel))
 		}
 	}
 
 	return utils.CreatePromise(promiseFn)
 }
 
+// setModelIdentity sets the identity of the manager on the IndexedDb event
+// model, which flags the received messages that mention it.
+func setModelIdentity(
+	cm *bindings.ChannelsManager, model channelsDb.EventModel) error {
+	identity, err := getChannelIdentity(cm)
+	if err != nil {
+		return err
+	}
+	return model.SetIdentity(identity.PubKey, identity.CodesetVersion)
+}
+
+// getChannelIdentity returns the public identity of the manager.
+func getChannelIdentity(
+	cm *bindings.ChannelsManager) (cryptoChannel.Identity, error) {
+	identityJSON, err := cm.GetIdentity()
+	if err != nil {
+		return cryptoChannel.Identity{}, err
+	}
+	var identity cryptoChannel.Identity
+	err = json.Unmarshal(identityJSON, &identity)
+	return identity, err
+}
+
 // LoadChannelsManagerWithIndexedDb loads an existing [ChannelsManager] using
 // an existing indexedDb database as a backend to manage the event model.
 //
@@ -560,8 +616,14 @@ func loadChannelsManagerWithIndexedDb(cmixID int, wasmJsPath, storageTag string,
 	extensionBuilderIDsJSON []byte, notificationsID int,
 	channelsCbs bindings.ChannelUICallbacks, cipher *DbCipher) any {
 
-	model := channelsDb.NewWASMEventModelBuilder(
-		wasmJsPath, cipher.api, channelsCbs)
+	// Keep a reference to the model so that the manager can query it directly
+	var eventModel channelsDb.EventModel
+	model := func(path string) (channels.EventModel, error) {
+		var err error
+		eventModel, err = channelsDb.NewWASMEventModel(
+			path, wasmJsPath, cipher.api, channelsCbs)
+		return eventModel, err
+	}
 
 	promiseFn := func(resolve, reject func(args ...any) js.Value) {
 		cm, err := bindings.LoadChannelsManagerGoEventModel(
@@ -569,8 +631,10 @@ func loadChannelsManagerWithIndexedDb(cmixID int, wasmJsPath, storageTag string,
 			channelsCbs)
 		if err != nil {
 			reject(exception.NewTrace(err))
+		} else if err = setModelIdentity(cm, eventModel); err != nil {
+			reject(exception.NewTrace(err))
 		} else {
-			resolve(newChannelsManagerJS(cm))
+			resolve(newChannelsManagerJS(cm, eventModel))
 		}
 	}
 
@@ -2058,6 +2122,804 @@ func (cm *ChannelsManager) RegisterReceiveHandler(_ js.Value, args []js.Value) a
 	return nil
 }
 
+////////////////////////////////////////////////////////////////////////////////
+// Message History                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// errNoIndexedDbModel is returned when a query is made on a [ChannelsManager]
+// that was not created with an IndexedDb backend.
+var errNoIndexedDbModel = errors.New(
+	"channels manager does not have an IndexedDb event model")
+
+// GetMessages returns a page of messages stored for the given channel, ordered
+// from newest to oldest. Only available on managers created with an IndexedDb
+// backend (e.g., [NewChannelsManagerWithIndexedDb]).
+//
+// Messages are ordered by timestamp, to the millisecond, and then by UUID. To
+// load older messages, call GetMessages again with a cursor made from the
+// "timestamp" and "uuid" fields of the oldest message in the previous page.
+//
+// Parameters:
+//   - args[0] - Marshalled bytes of the channel's [id.ID] (Uint8Array).
+//   - args[1] - JSON of the [channelsDb.MessageCursor] to start after
+//     (Uint8Array). Pass null or an empty array to get the newest messages.
+//   - args[2] - The maximum number of messages to return (int).
+//   - args[3] - Set to true to include hidden messages, which include the
+//     messages of muted users (boolean).
+//   - args[4] - An optional AbortSignal used to abort the lookup
+//     (AbortSignal).
+//
+// Returns a promise:
+//   - Resolves to the JSON of an array of [channels.ModelMessage]
+//     (Uint8Array).
+//   - Rejected with an error if the arguments are invalid, the manager has no
+//     IndexedDb backend, the lookup fails, or it is aborted.
+func (cm *ChannelsManager) GetMessages(_ js.Value, args []js.Value) any {
+	channelIDBytes := utils.CopyBytesToGo(args[0])
+	var cursorJSON []byte
+	if !args[1].IsNull() && !args[1].IsUndefined() {
+		cursorJSON = utils.CopyBytesToGo(args[1])
+	}
+	limit := args[2].Int()
+	includeHidden := args[3].Bool()
+	ctx, cancel := newAbortContext(args, 4)
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		defer cancel()
+		if cm.model == nil {
+			reject(exception.NewTrace(errNoIndexedDbModel))
+			return
+		}
+
+		channelID, err := id.Unmarshal(channelIDBytes)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		var cursor *channelsDb.MessageCursor
+		if len(cursorJSON) > 0 {
+			cursor = &channelsDb.MessageCursor{}
+			if err = json.Unmarshal(cursorJSON, cursor); err != nil {
+				reject(exception.NewTrace(err))
+				return
+			}
+		}
+
+		messages, err := cm.model.GetMessages(
+			ctx, channelID, cursor, limit, includeHidden)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		messagesJSON, err := json.Marshal(messages)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(utils.CopyBytesToJS(messagesJSON))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// GetPinnedMessages returns the pinned messages in the channel, ordered from
+// most to least recently pinned. Hidden messages are excluded. Only available
+// on managers created with an IndexedDb backend (e.g.,
+// [NewChannelsManagerWithIndexedDb]).
+//
+// Parameters:
+//   - args[0] - Marshalled bytes of the channel's [id.ID] (Uint8Array).
+//   - args[1] - An optional AbortSignal used to abort the request
+//     (AbortSignal).
+//
+// Returns a promise:
+//   - Resolves to the JSON of an array of [channels.ModelMessage]
+//     (Uint8Array).
+//   - Rejected with an error if the arguments are invalid, the manager has no
+//     IndexedDb backend, the lookup fails, or it is aborted.
+func (cm *ChannelsManager) GetPinnedMessages(_ js.Value, args []js.Value) any {
+	channelIDBytes := utils.CopyBytesToGo(args[0])
+	ctx, cancel := newAbortContext(args, 1)
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		defer cancel()
+		if cm.model == nil {
+			reject(exception.NewTrace(errNoIndexedDbModel))
+			return
+		}
+
+		channelID, err := id.Unmarshal(channelIDBytes)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		messages, err := cm.model.GetPinnedMessages(ctx, channelID)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		messagesJSON, err := json.Marshal(messages)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(utils.CopyBytesToJS(messagesJSON))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// SearchMessages returns the UUIDs of stored messages whose text contains every
+// word in the query, ordered from newest to oldest. Only available on managers
+// created with an IndexedDb backend (e.g., [NewChannelsManagerWithIndexedDb]).
+//
+// Matching is on whole words and is case-insensitive. Messages of muted users
+// are not matched. Use [ChannelsManager.GetMessages] or the event model to load
+// the matched messages.
+//
+// Parameters:
+//   - args[0] - The search query (string).
+//   - args[1] - Marshalled bytes of the channel's [id.ID] to restrict the
+//     search to. Pass an empty array to search all channels (Uint8Array).
+//   - args[2] - The maximum number of UUIDs to return (int).
+//   - args[3] - An optional AbortSignal used to abort the search
+//     (AbortSignal).
+//
+// Returns a promise:
+//   - Resolves to the JSON of an array of message UUIDs (Uint8Array).
+//   - Rejected with an error if the arguments are invalid, the manager has no
+//     IndexedDb backend, the search fails, or it is aborted.
+func (cm *ChannelsManager) SearchMessages(_ js.Value, args []js.Value) any {
+	query := args[0].String()
+	channelIDBytes := utils.CopyBytesToGo(args[1])
+	limit := args[2].Int()
+	ctx, cancel := newAbortContext(args, 3)
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		defer cancel()
+		if cm.model == nil {
+			reject(exception.NewTrace(errNoIndexedDbModel))
+			return
+		}
+
+		var channelID *id.ID
+		if len(channelIDBytes) > 0 {
+			var err error
+			channelID, err = id.Unmarshal(channelIDBytes)
+			if err != nil {
+				reject(exception.NewTrace(err))
+				return
+			}
+		}
+
+		uuids, err := cm.model.SearchMessages(ctx, query, channelID, limit)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		uuidsJSON, err := json.Marshal(uuids)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(utils.CopyBytesToJS(uuidsJSON))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// MarkRead marks the message with the given UUID, and every message in its
+// channel sent before it, as read. Marking a message older than the last read
+// message does nothing. Only available on managers created with an IndexedDb
+// backend (e.g., [NewChannelsManagerWithIndexedDb]).
+//
+// Whenever the unread count of a channel changes, the event update callback is
+// called with the event type 100001 and the JSON of [channelsDb.UnreadCount].
+//
+// Parameters:
+//   - args[0] - The UUID of the message (int).
+//   - args[1] - An optional AbortSignal used to abort the request
+//     (AbortSignal).
+//
+// Returns a promise:
+//   - Resolves on success.
+//   - Rejected with an error if the manager has no IndexedDb backend, the
+//     message cannot be marked as read, or it is aborted.
+func (cm *ChannelsManager) MarkRead(_ js.Value, args []js.Value) any {
+	uuid := uint64(args[0].Int())
+	ctx, cancel := newAbortContext(args, 1)
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		defer cancel()
+		if cm.model == nil {
+			reject(exception.NewTrace(errNoIndexedDbModel))
+			return
+		}
+
+		if err := cm.model.MarkRead(ctx, uuid); err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve()
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// GetUnreadCount returns the number of unread messages in the channel. Hidden
+// messages and messages from muted users are not counted. Only available on
+// managers created with an IndexedDb backend (e.g.,
+// [NewChannelsManagerWithIndexedDb]).
+//
+// Parameters:
+//   - args[0] - Marshalled bytes of the channel's [id.ID] (Uint8Array).
+//   - args[1] - An optional AbortSignal used to abort the request
+//     (AbortSignal).
+//
+// Returns a promise:
+//   - Resolves to the number of unread messages (int).
+//   - Rejected with an error if the arguments are invalid, the manager has no
+//     IndexedDb backend, the count fails, or it is aborted.
+func (cm *ChannelsManager) GetUnreadCount(_ js.Value, args []js.Value) any {
+	channelIDBytes := utils.CopyBytesToGo(args[0])
+	ctx, cancel := newAbortContext(args, 1)
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		defer cancel()
+		if cm.model == nil {
+			reject(exception.NewTrace(errNoIndexedDbModel))
+			return
+		}
+
+		channelID, err := id.Unmarshal(channelIDBytes)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		unread, err := cm.model.GetUnreadCount(ctx, channelID)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(unread)
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// GetUnreadSummary returns the unread count and last read message of every
+// joined channel. Only available on managers created with an IndexedDb backend
+// (e.g., [NewChannelsManagerWithIndexedDb]).
+//
+// Parameters:
+//   - args[0] - An optional AbortSignal used to abort the request
+//     (AbortSignal).
+//
+// Returns a promise:
+//   - Resolves to the JSON of an array of [channelsDb.UnreadCount]
+//     (Uint8Array).
+//   - Rejected with an error if the manager has no IndexedDb backend, the
+//     lookup fails, or it is aborted.
+func (cm *ChannelsManager) GetUnreadSummary(_ js.Value, args []js.Value) any {
+	ctx, cancel := newAbortContext(args, 0)
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		defer cancel()
+		if cm.model == nil {
+			reject(exception.NewTrace(errNoIndexedDbModel))
+			return
+		}
+
+		summary, err := cm.model.GetUnreadSummary(ctx)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		summaryJSON, err := json.Marshal(summary)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(utils.CopyBytesToJS(summaryJSON))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// GetReactions returns the reactions to each of the messages, with the number
+// of users that reacted with each emoji and whether the user of this manager
+// reacted with it. Hidden reactions, reactions from muted users, and reactions
+// that are not valid according to [ValidateReaction] are not counted. Only
+// available on managers created with an IndexedDb backend (e.g.,
+// [NewChannelsManagerWithIndexedDb]).
+//
+// Parameters:
+//   - args[0] - JSON of an array of [message.ID] (Uint8Array).
+//   - args[1] - An optional AbortSignal used to abort the request
+//     (AbortSignal).
+//
+// Returns a promise:
+//   - Resolves to the JSON of an array of [channelsDb.MessageReactions], in
+//     the same order as the message IDs (Uint8Array).
+//   - Rejected with an error if the arguments are invalid, the manager has no
+//     IndexedDb backend, the lookup fails, or it is aborted.
+func (cm *ChannelsManager) GetReactions(_ js.Value, args []js.Value) any {
+	messageIDsJSON := utils.CopyBytesToGo(args[0])
+	ctx, cancel := newAbortContext(args, 1)
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		defer cancel()
+		if cm.model == nil {
+			reject(exception.NewTrace(errNoIndexedDbModel))
+			return
+		}
+
+		var messageIDs []message.ID
+		err := json.Unmarshal(messageIDsJSON, &messageIDs)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		identity, err := getChannelIdentity(cm.api)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		reactions, err := cm.model.GetReactions(
+			ctx, messageIDs, identity.PubKey)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		reactionsJSON, err := json.Marshal(reactions)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(utils.CopyBytesToJS(reactionsJSON))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// GetThread returns a page of replies to a message, ordered from oldest to
+// newest. Hidden replies are excluded. Only available on managers created with
+// an IndexedDb backend (e.g., [NewChannelsManagerWithIndexedDb]).
+//
+// To page through the thread, call GetThread again with the next cursor of the
+// previous result until it is not set.
+//
+// Parameters:
+//   - args[0] - The marshalled [message.ID] of the root message (Uint8Array).
+//   - args[1] - The maximum number of replies to return (int).
+//   - args[2] - JSON of the [channelsDb.ThreadCursor] to start after
+//     (Uint8Array). Pass null or an empty array to start with the first reply.
+//   - args[3] - An optional AbortSignal used to abort the request
+//     (AbortSignal).
+//
+// Returns a promise:
+//   - Resolves to the JSON of the [channelsDb.Thread] (Uint8Array).
+//   - Rejected with an error if the arguments are invalid, the manager has no
+//     IndexedDb backend, the lookup fails, or it is aborted.
+func (cm *ChannelsManager) GetThread(_ js.Value, args []js.Value) any {
+	messageIDBytes := utils.CopyBytesToGo(args[0])
+	limit := args[1].Int()
+	var cursorJSON []byte
+	if !args[2].IsNull() && !args[2].IsUndefined() {
+		cursorJSON = utils.CopyBytesToGo(args[2])
+	}
+	ctx, cancel := newAbortContext(args, 3)
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		defer cancel()
+		if cm.model == nil {
+			reject(exception.NewTrace(errNoIndexedDbModel))
+			return
+		}
+
+		rootMessageID, err := message.UnmarshalID(messageIDBytes)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		var cursor *channelsDb.ThreadCursor
+		if len(cursorJSON) > 0 {
+			cursor = &channelsDb.ThreadCursor{}
+			if err = json.Unmarshal(cursorJSON, cursor); err != nil {
+				reject(exception.NewTrace(err))
+				return
+			}
+		}
+
+		thread, err := cm.model.GetThread(ctx, rootMessageID, limit, cursor)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		threadJSON, err := json.Marshal(thread)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(utils.CopyBytesToJS(threadJSON))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// GetMentions returns a page of messages that mention an identity, ordered
+// from newest to oldest. Hidden messages are excluded. Only available on
+// managers created with an IndexedDb backend (e.g.,
+// [NewChannelsManagerWithIndexedDb]).
+//
+// A mention is an @ followed by the base64 encoded public key, the DM token,
+// or the codename of the mentioned identity. Mentions by DM token or codename
+// are only found if the identity sent a message before the mention was
+// received. Messages that mention this user are also flagged with mentionsMe
+// in the [bindings.MessageReceived] event.
+//
+// To page through the mentions, call GetMentions again with the next cursor of
+// the previous result until it is not set.
+//
+// Parameters:
+//   - args[0] - The Ed25519 public key of the mentioned identity (Uint8Array).
+//     Pass null to use the identity of this manager.
+//   - args[1] - JSON of the [channelsDb.MentionCursor] to start after
+//     (Uint8Array). Pass null or an empty array to start with the newest
+//     mention.
+//   - args[2] - The maximum number of messages to return (int).
+//   - args[3] - An optional AbortSignal used to abort the request
+//     (AbortSignal).
+//
+// Returns a promise:
+//   - Resolves to the JSON of the [channelsDb.Mentions] (Uint8Array).
+//   - Rejected with an error if the arguments are invalid, the manager has no
+//     IndexedDb backend, the lookup fails, or it is aborted.
+func (cm *ChannelsManager) GetMentions(_ js.Value, args []js.Value) any {
+	var pubKey []byte
+	if !args[0].IsNull() && !args[0].IsUndefined() {
+		pubKey = utils.CopyBytesToGo(args[0])
+	}
+	var cursorJSON []byte
+	if !args[1].IsNull() && !args[1].IsUndefined() {
+		cursorJSON = utils.CopyBytesToGo(args[1])
+	}
+	limit := args[2].Int()
+	ctx, cancel := newAbortContext(args, 3)
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		defer cancel()
+		if cm.model == nil {
+			reject(exception.NewTrace(errNoIndexedDbModel))
+			return
+		}
+
+		if pubKey == nil {
+			identity, err := getChannelIdentity(cm.api)
+			if err != nil {
+				reject(exception.NewTrace(err))
+				return
+			}
+			pubKey = identity.PubKey
+		}
+
+		var cursor *channelsDb.MentionCursor
+		if len(cursorJSON) > 0 {
+			cursor = &channelsDb.MentionCursor{}
+			if err := json.Unmarshal(cursorJSON, cursor); err != nil {
+				reject(exception.NewTrace(err))
+				return
+			}
+		}
+
+		mentions, err := cm.model.GetMentions(ctx, pubKey, cursor, limit)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		mentionsJSON, err := json.Marshal(mentions)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(utils.CopyBytesToJS(mentionsJSON))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// GetReplyCounts returns the number of replies to each of the messages, not
+// including hidden replies. The counts are stored with each message, so the
+// replies are not read. Only available on managers created with an IndexedDb
+// backend (e.g., [NewChannelsManagerWithIndexedDb]).
+//
+// Parameters:
+//   - args[0] - JSON of an array of [message.ID] (Uint8Array).
+//   - args[1] - An optional AbortSignal used to abort the request
+//     (AbortSignal).
+//
+// Returns a promise:
+//   - Resolves to the JSON of an array of reply counts, in the same order as
+//     the message IDs (Uint8Array).
+//   - Rejected with an error if the arguments are invalid, the manager has no
+//     IndexedDb backend, the lookup fails, or it is aborted.
+func (cm *ChannelsManager) GetReplyCounts(_ js.Value, args []js.Value) any {
+	messageIDsJSON := utils.CopyBytesToGo(args[0])
+	ctx, cancel := newAbortContext(args, 1)
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		defer cancel()
+		if cm.model == nil {
+			reject(exception.NewTrace(errNoIndexedDbModel))
+			return
+		}
+
+		var messageIDs []message.ID
+		err := json.Unmarshal(messageIDsJSON, &messageIDs)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		counts, err := cm.model.GetReplyCounts(ctx, messageIDs)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		countsJSON, err := json.Marshal(counts)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(utils.CopyBytesToJS(countsJSON))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// SetRetentionPolicy sets the limits on the messages kept in the channel.
+// Messages outside the limits are deleted by a background sweeper, oldest
+// first, which also deletes messages whose lease has expired. Pinned messages
+// are not counted. The event model is notified of each deleted message. Only
+// available on managers created with an IndexedDb backend (e.g.,
+// [NewChannelsManagerWithIndexedDb]).
+//
+// Parameters:
+//   - args[0] - Marshalled bytes of the channel's [id.ID] (Uint8Array).
+//   - args[1] - JSON of the [channelsDb.RetentionPolicy] (Uint8Array). The max
+//     age is in nanoseconds. Zero values are unlimited, so an empty policy
+//     removes all limits.
+//   - args[2] - An optional AbortSignal used to abort the request
+//     (AbortSignal).
+//
+// Example policy JSON:
+//
+//	{
+//	  "maxAge": 604800000000000,
+//	  "maxCount": 1000,
+//	  "maxBytes": 0
+//	}
+//
+// Returns a promise:
+//   - Resolves on success.
+//   - Rejected with an error if the arguments are invalid, the manager has no
+//     IndexedDb backend, the policy cannot be saved, or it is aborted.
+func (cm *ChannelsManager) SetRetentionPolicy(_ js.Value, args []js.Value) any {
+	channelIDBytes := utils.CopyBytesToGo(args[0])
+	policyJSON := utils.CopyBytesToGo(args[1])
+	ctx, cancel := newAbortContext(args, 2)
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		defer cancel()
+		if cm.model == nil {
+			reject(exception.NewTrace(errNoIndexedDbModel))
+			return
+		}
+
+		channelID, err := id.Unmarshal(channelIDBytes)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		var policy channelsDb.RetentionPolicy
+		if err = json.Unmarshal(policyJSON, &policy); err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		err = cm.model.SetRetentionPolicy(ctx, channelID, policy)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve()
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// GetChangesSince returns up to limit changes made after the change with the
+// given sequence number, ordered by sequence number. Every message received,
+// updated, or deleted, and every user muted or unmuted, is recorded as a
+// change. Changes are kept for seven days. Only available on managers created
+// with an IndexedDb backend (e.g., [NewChannelsManagerWithIndexedDb]).
+//
+// Each change is also sent on the event update callback with the event type
+// 100002 and the JSON of the change, in order, once it is committed. To resume
+// after a reload, pass the sequence number of the last change handled.
+//
+// Example change JSON:
+//
+//	{
+//	  "seq": 42,
+//	  "eventType": 3000,
+//	  "data": {"uuid": 7, "channelID": "...", "update": false},
+//	  "timestamp": "2022-01-01T00:00:00Z"
+//	}
+//
+// Parameters:
+//   - args[0] - The sequence number of the last change received. Pass in 0
+//     to get the oldest changes kept (int).
+//   - args[1] - The maximum number of changes to return (int).
+//   - args[2] - An optional AbortSignal used to abort the request
+//     (AbortSignal).
+//
+// Returns a promise:
+//   - Resolves to the JSON of an array of changes (Uint8Array).
+//   - Rejected with an error if the manager has no IndexedDb backend, the
+//     lookup fails, or it is aborted.
+func (cm *ChannelsManager) GetChangesSince(_ js.Value, args []js.Value) any {
+	seq := uint64(args[0].Int())
+	limit := args[1].Int()
+	ctx, cancel := newAbortContext(args, 2)
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		defer cancel()
+		if cm.model == nil {
+			reject(exception.NewTrace(errNoIndexedDbModel))
+			return
+		}
+
+		changes, err := cm.model.GetChangesSince(ctx, seq, limit)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		changesJSON, err := json.Marshal(changes)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(utils.CopyBytesToJS(changesJSON))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// Subscribe registers a live query on the messages of a channel. The worker
+// sends the messages of the query, and then each change to them, to the
+// callback over a dedicated channel, so the view does not need to be queried
+// again after every event. Only available on managers created with an
+// IndexedDb backend (e.g., [NewChannelsManagerWithIndexedDb]).
+//
+// The first update has "reset" set and lists every message of the query in
+// "inserted", ordered from newest to oldest. Later updates list the messages
+// that were inserted, updated, or removed. An update with "reset" set is also
+// sent after the database worker restarts and replaces all previous messages.
+// The first update may be received before the promise resolves.
+//
+// Example query JSON:
+//
+//	{
+//	  "channelID": "...",
+//	  "start": "2022-01-01T00:00:00Z",
+//	  "end": "0001-01-01T00:00:00Z",
+//	  "types": [1],
+//	  "includeHidden": false,
+//	  "pinnedOnly": false
+//	}
+//
+// Parameters:
+//   - args[0] - JSON of the [channelsDb.LiveQuery]. Messages are matched if
+//     they are in the channel, have a timestamp in the window (a zero start
+//     or end leaves that side open), have one of the types (all if empty), and
+//     match the hidden and pinned filters (Uint8Array).
+//   - args[1] - Javascript object that has functions that implement the
+//     [liveQueryCallback] interface. It is called with each update.
+//
+// Returns a promise:
+//   - Resolves to the subscription ID used to cancel the live query (int).
+//   - Rejected with an error if the query is invalid, the manager has no
+//     IndexedDb backend, or the query fails.
+func (cm *ChannelsManager) Subscribe(_ js.Value, args []js.Value) any {
+	queryJSON := utils.CopyBytesToGo(args[0])
+	cb := &liveQueryCallback{utils.WrapCB(args[1], "Callback")}
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		if cm.model == nil {
+			reject(exception.NewTrace(errNoIndexedDbModel))
+			return
+		}
+
+		var query channelsDb.LiveQuery
+		if err := json.Unmarshal(queryJSON, &query); err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		subscriptionID, err := cm.model.Subscribe(query,
+			func(update channelsDb.LiveQueryUpdate) {
+				updateJSON, err := json.Marshal(update)
+				if err != nil {
+					exception.ThrowTrace(err)
+					return
+				}
+				cb.Callback(updateJSON)
+			})
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(subscriptionID)
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// Unsubscribe cancels a live query registered with [ChannelsManager.Subscribe].
+// Its callback is not called afterward.
+//
+// Parameters:
+//   - args[0] - The subscription ID returned by [ChannelsManager.Subscribe]
+//     (int).
+//
+// Returns:
+//   - Throws an error if the manager has no IndexedDb backend or there is no
+//     live query with the ID.
+func (cm *ChannelsManager) Unsubscribe(_ js.Value, args []js.Value) any {
+	if cm.model == nil {
+		exception.ThrowTrace(errNoIndexedDbModel)
+		return nil
+	}
+
+	err := cm.model.Unsubscribe(uint64(args[0].Int()))
+	if err != nil {
+		exception.ThrowTrace(err)
+	}
+	return nil
+}
+
+// liveQueryCallback wraps Javascript callbacks to receive the updates of a
+// live query.
+type liveQueryCallback struct {
+	callback func(args ...any) js.Value
+}
+
+// Callback is called with each update of a live query.
+//
+// Parameters:
+//   - update - Returns the JSON of a [channelsDb.LiveQueryUpdate]
+//     (Uint8Array).
+func (lqc *liveQueryCallback) Callback(update []byte) {
+	lqc.callback(utils.CopyBytesToJS(update))
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // Event Model Logic                                                          //
 ////////////////////////////////////////////////////////////////////////////////
@@ -24,7 +24,7 @@ import (
 func Test_newChannelsManagerJS(t *testing.T) {
 	cmType := reflect.TypeOf(&ChannelsManager{})
 
-	cm := newChannelsManagerJS(&bindings.ChannelsManager{})
+	cm := newChannelsManagerJS(&bindings.ChannelsManager{}, nil)
 	if len(cm) != cmType.NumMethod() {
 		t.Errorf("ChannelsManager JS object does not have all methods."+
 			"\nexpected: %d\nreceived: %d", cmType.NumMethod(), len(cm))
@@ -45,10 +45,23 @@ func Test_ChannelsManagerMethods(t *testing.T) {
 	cmType := reflect.TypeOf(&ChannelsManager{})
 	binCmType := reflect.TypeOf(&bindings.ChannelsManager{})
 
-	if binCmType.NumMethod() != cmType.NumMethod() {
+	// Methods that only exist on the WASM ChannelsManager
+	var numOfExcludedFields int
+	for _, name := range []string{"GetMessages", "SearchMessages", "MarkRead",
+		"GetUnreadCount", "GetUnreadSummary", "GetReactions", "GetThread",
+		"GetReplyCounts", "SetRetentionPolicy", "GetChangesSince", "Subscribe",
+		"Unsubscribe", "GetPinnedMessages", "GetMentions"} {
+		if _, exists := cmType.MethodByName(name); !exists {
+			t.Errorf("%s was not found.", name)
+		} else {
+			numOfExcludedFields++
+		}
+	}
+
+	nm := cmType.NumMethod() - numOfExcludedFields
+	if binCmType.NumMethod() != nm {
 		t.Errorf("WASM ChannelsManager object does not have all methods from "+
-			"bindings.\nexpected: %d\nreceived: %d",
-			binCmType.NumMethod(), cmType.NumMethod())
+			"bindings.\nexpected: %d\nreceived: %d", binCmType.NumMethod(), nm)
 	}
 
 	for i := 0; i < binCmType.NumMethod(); i++ {
@@ -12,6 +12,7 @@ package wasm
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"syscall/js"
 
 	jww "github.com/spf13/jwalterweatherman"
@@ -19,6 +20,7 @@ import (
 	"gitlab.com/elixxir/client/v4/bindings"
 	"gitlab.com/elixxir/client/v4/dm"
 	"gitlab.com/elixxir/crypto/codename"
+	"gitlab.com/elixxir/crypto/message"
 	"gitlab.com/elixxir/wasm-utils/exception"
 	"gitlab.com/elixxir/wasm-utils/utils"
 	indexDB "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/dm"
@@ -31,13 +33,16 @@ import (
 // DMClient wraps the [bindings.DMClient] object so its methods can be wrapped
 // to be Javascript compatible.
 type DMClient struct {
-	api *bindings.DMClient
+	api   *bindings.DMClient
+	model indexDB.EventModel
 }
 
 // newDMClientJS creates a new Javascript compatible object (map[string]any)
-// that matches the [DMClient] structure.
-func newDMClientJS(api *bindings.DMClient) map[string]any {
-	cm := DMClient{api}
+// that matches the [DMClient] structure. The model may be nil if the client
+// was not created with an IndexedDb backend.
+func newDMClientJS(
+	api *bindings.DMClient, model indexDB.EventModel) map[string]any {
+	cm := DMClient{api, model}
 	dmClientMap := map[string]any{
 		// Basic Channel API
 		"GetID": js.FuncOf(cm.GetID),
@@ -71,6 +76,20 @@ func newDMClientJS(api *bindings.DMClient) map[string]any {
 		"GetNotificationLevel": js.FuncOf(cm.GetNotificationLevel),
 		"SetMobileNotificationsLevel": js.FuncOf(
 			cm.SetMobileNotificationsLevel),
+
+		// Message History
+		"SearchMessages":   js.FuncOf(cm.SearchMessages),
+		"MarkRead":         js.FuncOf(cm.MarkRead),
+		"GetUnreadCount":   js.FuncOf(cm.GetUnreadCount),
+		"GetUnreadSummary": js.FuncOf(cm.GetUnreadSummary),
+		"GetConversationsByActivity": js.FuncOf(
+			cm.GetConversationsByActivity),
+		"GetReactions":    js.FuncOf(cm.GetReactions),
+		"GetThread":       js.FuncOf(cm.GetThread),
+		"GetReplyCounts":  js.FuncOf(cm.GetReplyCounts),
+		"GetChangesSince": js.FuncOf(cm.GetChangesSince),
+		"Subscribe":       js.FuncOf(cm.Subscribe),
+		"Unsubscribe":     js.FuncOf(cm.Unsubscribe),
 	}
 
 	return dmClientMap
@@ -132,7 +151,7 @@ func NewDMClient(_ js.Value, args []js.Value) any {
 		return nil
 	}
 
-	return newDMClientJS(cm)
+	return newDMClientJS(cm, nil)
 }
 
 // NewDMClientWithIndexedDb creates a new [DMClient] from a private identity
@@ -241,7 +260,7 @@ func newDMClientWithIndexedDb(cmixID, notificationsID int, wasmJsPath string,
 		if err != nil {
 			reject(exception.NewTrace(err))
 		} else {
-			resolve(newDMClientJS(cm))
+			resolve(newDMClientJS(cm, model))
 		}
 	}
 
@@ -910,6 +929,568 @@ func GetDmNotificationReportsForMe(_ js.Value, args []js.Value) any {
 	return utils.CreatePromise(promiseFn)
 }
 
+////////////////////////////////////////////////////////////////////////////////
+// Message History                                                            //
+////////////////////////////////////////////////////////////////////////////////
+
+// errNoIndexedDbDmModel is returned when a query is made on a [DMClient] that
+// was not created with an IndexedDb backend.
+var errNoIndexedDbDmModel = errors.New(
+	"DM client does not have an IndexedDb event model")
+
+// SearchMessages returns the UUIDs of stored messages whose text contains every
+// word in the query, ordered from newest to oldest. Only available on clients
+// created with an IndexedDb backend (e.g., [NewDMClientWithIndexedDb]).
+//
+// Matching is on whole words and is case-insensitive.
+//
+// Parameters:
+//   - args[0] - The search query (string).
+//   - args[1] - The Ed25519 public key of the conversation partner to restrict
+//     the search to. Pass an empty array to search all conversations
+//     (Uint8Array).
+//   - args[2] - The maximum number of UUIDs to return (int).
+//   - args[3] - An optional AbortSignal used to abort the search
+//     (AbortSignal).
+//
+// Returns a promise:
+//   - Resolves to the JSON of an array of message UUIDs (Uint8Array).
+//   - Rejected with an error if the client has no IndexedDb backend, the
+//     search fails, or it is aborted.
+func (dmc *DMClient) SearchMessages(_ js.Value, args []js.Value) any {
+	query := args[0].String()
+	partnerKey := utils.CopyBytesToGo(args[1])
+	limit := args[2].Int()
+	ctx, cancel := newAbortContext(args, 3)
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		defer cancel()
+		if dmc.model == nil {
+			reject(exception.NewTrace(errNoIndexedDbDmModel))
+			return
+		}
+
+		if len(partnerKey) == 0 {
+			partnerKey = nil
+		}
+
+		uuids, err := dmc.model.SearchMessages(ctx, query, partnerKey, limit)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		uuidsJSON, err := json.Marshal(uuids)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(utils.CopyBytesToJS(uuidsJSON))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// GetConversationsByActivity returns a page of conversations ordered from most
+// to least recently active, with a preview of their most recent message. Only
+// available on clients created with an IndexedDb backend (e.g.,
+// [NewDMClientWithIndexedDb]).
+//
+// Conversations are ordered by last activity, to the millisecond, and then by
+// public key. To load the next page, call GetConversationsByActivity again
+// with a cursor made from the "last_activity" and "pub_key" fields of the last
+// conversation in the previous page.
+//
+// Parameters:
+//   - args[0] - The maximum number of conversations to return (int).
+//   - args[1] - JSON of the [indexDB.ConversationCursor] to start after
+//     (Uint8Array). Pass null or an empty array to get the most recently
+//     active conversations.
+//   - args[2] - An optional AbortSignal used to abort the request
+//     (AbortSignal).
+//
+// Returns a promise:
+//   - Resolves to the JSON of an array of [indexDB.ConversationSummary]
+//     (Uint8Array).
+//   - Rejected with an error if the arguments are invalid, the client has no
+//     IndexedDb backend, the lookup fails, or it is aborted.
+func (dmc *DMClient) GetConversationsByActivity(
+	_ js.Value, args []js.Value) any {
+	limit := args[0].Int()
+	var cursorJSON []byte
+	if !args[1].IsNull() && !args[1].IsUndefined() {
+		cursorJSON = utils.CopyBytesToGo(args[1])
+	}
+	ctx, cancel := newAbortContext(args, 2)
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		defer cancel()
+		if dmc.model == nil {
+			reject(exception.NewTrace(errNoIndexedDbDmModel))
+			return
+		}
+
+		var cursor *indexDB.ConversationCursor
+		if len(cursorJSON) > 0 {
+			cursor = &indexDB.ConversationCursor{}
+			if err := json.Unmarshal(cursorJSON, cursor); err != nil {
+				reject(exception.NewTrace(err))
+				return
+			}
+		}
+
+		conversations, err :=
+			dmc.model.GetConversationsByActivity(ctx, limit, cursor)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		conversationsJSON, err := json.Marshal(conversations)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(utils.CopyBytesToJS(conversationsJSON))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// GetReactions returns the reactions to each of the messages, with the number
+// of users that reacted with each emoji and whether the user of this client
+// reacted with it. Reactions from blocked partners and reactions that are not
+// valid according to [ValidateReaction] are not counted. Only available on
+// clients created with an IndexedDb backend (e.g.,
+// [NewDMClientWithIndexedDb]).
+//
+// Parameters:
+//   - args[0] - JSON of an array of [message.ID] (Uint8Array).
+//   - args[1] - An optional AbortSignal used to abort the request
+//     (AbortSignal).
+//
+// Returns a promise:
+//   - Resolves to the JSON of an array of [indexDB.MessageReactions], in the
+//     same order as the message IDs (Uint8Array).
+//   - Rejected with an error if the arguments are invalid, the client has no
+//     IndexedDb backend, the lookup fails, or it is aborted.
+func (dmc *DMClient) GetReactions(_ js.Value, args []js.Value) any {
+	messageIDsJSON := utils.CopyBytesToGo(args[0])
+	ctx, cancel := newAbortContext(args, 1)
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		defer cancel()
+		if dmc.model == nil {
+			reject(exception.NewTrace(errNoIndexedDbDmModel))
+			return
+		}
+
+		var messageIDs []message.ID
+		err := json.Unmarshal(messageIDsJSON, &messageIDs)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		reactions, err := dmc.model.GetReactions(ctx,
+			messageIDs, dmc.api.GetPublicKey())
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		reactionsJSON, err := json.Marshal(reactions)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(utils.CopyBytesToJS(reactionsJSON))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// GetThread returns a page of replies to a message, ordered from oldest to
+// newest. Only available on clients created with an IndexedDb backend (e.g.,
+// [NewDMClientWithIndexedDb]).
+//
+// To page through the thread, call GetThread again with the next cursor of the
+// previous result until it is not set.
+//
+// Parameters:
+//   - args[0] - The marshalled [message.ID] of the root message (Uint8Array).
+//   - args[1] - The maximum number of replies to return (int).
+//   - args[2] - JSON of the [indexDB.ThreadCursor] to start after
+//     (Uint8Array). Pass null or an empty array to start with the first reply.
+//   - args[3] - An optional AbortSignal used to abort the request
+//     (AbortSignal).
+//
+// Returns a promise:
+//   - Resolves to the JSON of the [indexDB.Thread] (Uint8Array).
+//   - Rejected with an error if the arguments are invalid, the client has no
+//     IndexedDb backend, the lookup fails, or it is aborted.
+func (dmc *DMClient) GetThread(_ js.Value, args []js.Value) any {
+	messageIDBytes := utils.CopyBytesToGo(args[0])
+	limit := args[1].Int()
+	var cursorJSON []byte
+	if !args[2].IsNull() && !args[2].IsUndefined() {
+		cursorJSON = utils.CopyBytesToGo(args[2])
+	}
+	ctx, cancel := newAbortContext(args, 3)
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		defer cancel()
+		if dmc.model == nil {
+			reject(exception.NewTrace(errNoIndexedDbDmModel))
+			return
+		}
+
+		rootMessageID, err := message.UnmarshalID(messageIDBytes)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		var cursor *indexDB.ThreadCursor
+		if len(cursorJSON) > 0 {
+			cursor = &indexDB.ThreadCursor{}
+			if err = json.Unmarshal(cursorJSON, cursor); err != nil {
+				reject(exception.NewTrace(err))
+				return
+			}
+		}
+
+		thread, err := dmc.model.GetThread(ctx, rootMessageID, limit, cursor)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		threadJSON, err := json.Marshal(thread)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(utils.CopyBytesToJS(threadJSON))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// GetReplyCounts returns the number of replies to each of the messages. The
+// counts are stored with each message, so the replies are not read. Only
+// available on clients created with an IndexedDb backend (e.g.,
+// [NewDMClientWithIndexedDb]).
+//
+// Parameters:
+//   - args[0] - JSON of an array of [message.ID] (Uint8Array).
+//   - args[1] - An optional AbortSignal used to abort the request
+//     (AbortSignal).
+//
+// Returns a promise:
+//   - Resolves to the JSON of an array of reply counts, in the same order as
+//     the message IDs (Uint8Array).
+//   - Rejected with an error if the arguments are invalid, the client has no
+//     IndexedDb backend, the lookup fails, or it is aborted.
+func (dmc *DMClient) GetReplyCounts(_ js.Value, args []js.Value) any {
+	messageIDsJSON := utils.CopyBytesToGo(args[0])
+	ctx, cancel := newAbortContext(args, 1)
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		defer cancel()
+		if dmc.model == nil {
+			reject(exception.NewTrace(errNoIndexedDbDmModel))
+			return
+		}
+
+		var messageIDs []message.ID
+		err := json.Unmarshal(messageIDsJSON, &messageIDs)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		counts, err := dmc.model.GetReplyCounts(ctx, messageIDs)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		countsJSON, err := json.Marshal(counts)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(utils.CopyBytesToJS(countsJSON))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// GetChangesSince returns up to limit changes made after the change with the
+// given sequence number, ordered by sequence number. Every message received,
+// updated, or deleted is recorded as a change. Changes are kept for seven
+// days. Only available on clients created with an IndexedDb backend (e.g.,
+// [NewDMClientWithIndexedDb]).
+//
+// Each change is also sent on the event update callback with the event type
+// 100002 and the JSON of the change, in order, once it is committed. To resume
+// after a reload, pass the sequence number of the last change handled.
+//
+// Example change JSON:
+//
+//	{
+//	  "seq": 42,
+//	  "eventType": 3000,
+//	  "data": {"uuid": 7, "pubKey": "...", "messageUpdate": false, ...},
+//	  "timestamp": "2022-01-01T00:00:00Z"
+//	}
+//
+// Parameters:
+//   - args[0] - The sequence number of the last change received. Pass in 0
+//     to get the oldest changes kept (int).
+//   - args[1] - The maximum number of changes to return (int).
+//   - args[2] - An optional AbortSignal used to abort the request
+//     (AbortSignal).
+//
+// Returns a promise:
+//   - Resolves to the JSON of an array of changes (Uint8Array).
+//   - Rejected with an error if the client has no IndexedDb backend, the lookup
+//     fails, or it is aborted.
+func (dmc *DMClient) GetChangesSince(_ js.Value, args []js.Value) any {
+	seq := uint64(args[0].Int())
+	limit := args[1].Int()
+	ctx, cancel := newAbortContext(args, 2)
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		defer cancel()
+		if dmc.model == nil {
+			reject(exception.NewTrace(errNoIndexedDbDmModel))
+			return
+		}
+
+		changes, err := dmc.model.GetChangesSince(ctx, seq, limit)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		changesJSON, err := json.Marshal(changes)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(utils.CopyBytesToJS(changesJSON))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// Subscribe registers a live query on the messages of a conversation. The
+// worker sends the messages of the query, and then each change to them, to the
+// callback over a dedicated channel, so the view does not need to be queried
+// again after every event. Only available on clients created with an
+// IndexedDb backend (e.g., [NewDMClientWithIndexedDb]).
+//
+// The first update has "reset" set and lists every message of the query in
+// "inserted", ordered from newest to oldest. Later updates list the messages
+// that were inserted, updated, or removed. An update with "reset" set is also
+// sent after the database worker restarts and replaces all previous messages.
+// The first update may be received before the promise resolves.
+//
+// Example query JSON:
+//
+//	{
+//	  "partnerKey": "...",
+//	  "start": "2022-01-01T00:00:00Z",
+//	  "end": "0001-01-01T00:00:00Z",
+//	  "types": [1]
+//	}
+//
+// Parameters:
+//   - args[0] - JSON of the [indexDB.LiveQuery]. Messages are matched if they
+//     are in the conversation, have a timestamp in the window (a zero start or
+//     end leaves that side open), and have one of the types (all if empty)
+//     (Uint8Array).
+//   - args[1] - Javascript object that has functions that implement the
+//     [liveQueryCallback] interface. It is called with each update.
+//
+// Returns a promise:
+//   - Resolves to the subscription ID used to cancel the live query (int).
+//   - Rejected with an error if the query is invalid, the client has no
+//     IndexedDb backend, or the query fails.
+func (dmc *DMClient) Subscribe(_ js.Value, args []js.Value) any {
+	queryJSON := utils.CopyBytesToGo(args[0])
+	cb := &liveQueryCallback{utils.WrapCB(args[1], "Callback")}
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		if dmc.model == nil {
+			reject(exception.NewTrace(errNoIndexedDbDmModel))
+			return
+		}
+
+		var query indexDB.LiveQuery
+		if err := json.Unmarshal(queryJSON, &query); err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		subscriptionID, err := dmc.model.Subscribe(query,
+			func(update indexDB.LiveQueryUpdate) {
+				updateJSON, err := json.Marshal(update)
+				if err != nil {
+					exception.ThrowTrace(err)
+					return
+				}
+				cb.Callback(updateJSON)
+			})
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(subscriptionID)
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// Unsubscribe cancels a live query registered with [DMClient.Subscribe]. Its
+// callback is not called afterward.
+//
+// Parameters:
+//   - args[0] - The subscription ID returned by [DMClient.Subscribe] (int).
+//
+// Returns:
+//   - Throws an error if the client has no IndexedDb backend or there is no
+//     live query with the ID.
+func (dmc *DMClient) Unsubscribe(_ js.Value, args []js.Value) any {
+	if dmc.model == nil {
+		exception.ThrowTrace(errNoIndexedDbDmModel)
+		return nil
+	}
+
+	err := dmc.model.Unsubscribe(uint64(args[0].Int()))
+	if err != nil {
+		exception.ThrowTrace(err)
+	}
+	return nil
+}
+
+// MarkRead marks the message with the given UUID, and every message in its
+// conversation sent before it, as read. Marking a message older than the last
+// read message does nothing. Only available on clients created with an
+// IndexedDb backend (e.g., [NewDMClientWithIndexedDb]).
+//
+// Whenever the unread count of a conversation changes, the event update
+// callback is called with the event type 100001 and the JSON of
+// [indexDB.UnreadCount].
+//
+// Parameters:
+//   - args[0] - The UUID of the message (int).
+//   - args[1] - An optional AbortSignal used to abort the request
+//     (AbortSignal).
+//
+// Returns a promise:
+//   - Resolves on success.
+//   - Rejected with an error if the client has no IndexedDb backend, the
+//     message cannot be marked as read, or it is aborted.
+func (dmc *DMClient) MarkRead(_ js.Value, args []js.Value) any {
+	uuid := uint64(args[0].Int())
+	ctx, cancel := newAbortContext(args, 1)
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		defer cancel()
+		if dmc.model == nil {
+			reject(exception.NewTrace(errNoIndexedDbDmModel))
+			return
+		}
+
+		if err := dmc.model.MarkRead(ctx, uuid); err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve()
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// GetUnreadCount returns the number of unread messages in the conversation
+// with the partner. Only messages sent by the partner are counted, and the
+// count is zero if the partner is blocked. Only available on clients created
+// with an IndexedDb backend (e.g., [NewDMClientWithIndexedDb]).
+//
+// Parameters:
+//   - args[0] - The Ed25519 public key of the conversation partner
+//     (Uint8Array).
+//   - args[1] - An optional AbortSignal used to abort the request
+//     (AbortSignal).
+//
+// Returns a promise:
+//   - Resolves to the number of unread messages (int).
+//   - Rejected with an error if the client has no IndexedDb backend, the count
+//     fails, or it is aborted.
+func (dmc *DMClient) GetUnreadCount(_ js.Value, args []js.Value) any {
+	partnerKey := utils.CopyBytesToGo(args[0])
+	ctx, cancel := newAbortContext(args, 1)
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		defer cancel()
+		if dmc.model == nil {
+			reject(exception.NewTrace(errNoIndexedDbDmModel))
+			return
+		}
+
+		unread, err := dmc.model.GetUnreadCount(ctx, partnerKey)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(unread)
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// GetUnreadSummary returns the unread count and last read message of every
+// conversation with a partner that is not blocked. Only available on clients
+// created with an IndexedDb backend (e.g., [NewDMClientWithIndexedDb]).
+//
+// Parameters:
+//   - args[0] - An optional AbortSignal used to abort the request
+//     (AbortSignal).
+//
+// Returns a promise:
+//   - Resolves to the JSON of an array of [indexDB.UnreadCount] (Uint8Array).
+//   - Rejected with an error if the client has no IndexedDb backend, the lookup
+//     fails, or it is aborted.
+func (dmc *DMClient) GetUnreadSummary(_ js.Value, args []js.Value) any {
+	ctx, cancel := newAbortContext(args, 0)
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		defer cancel()
+		if dmc.model == nil {
+			reject(exception.NewTrace(errNoIndexedDbDmModel))
+			return
+		}
+
+		summary, err := dmc.model.GetUnreadSummary(ctx)
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		summaryJSON, err := json.Marshal(summary)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(utils.CopyBytesToJS(summaryJSON))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // Event Model Logic                                                          //
 ////////////////////////////////////////////////////////////////////////////////
@@ -20,7 +20,7 @@ import (
 func Test_newDMClientJS(t *testing.T) {
 	dmcType := reflect.TypeOf(&DMClient{})
 
-	dmc := newDMClientJS(&bindings.DMClient{})
+	dmc := newDMClientJS(&bindings.DMClient{}, nil)
 	if len(dmc) != dmcType.NumMethod() {
 		t.Errorf("DMClient JS object does not have all methods."+
 			"\nexpected: %d\nreceived: %d", dmcType.NumMethod(), len(dmc))
@@ -41,11 +41,17 @@ func Test_DMClientMethods(t *testing.T) {
 	dmcType := reflect.TypeOf(&DMClient{})
 	binDmcType := reflect.TypeOf(&bindings.DMClient{})
 
+	// Methods that only exist on the WASM DMClient
 	var numOfExcludedFields int
-	if _, exists := dmcType.MethodByName("GetDatabaseName"); !exists {
-		t.Errorf("GetDatabaseName was not found.")
-	} else {
-		numOfExcludedFields++
+	for _, name := range []string{"GetDatabaseName", "SearchMessages",
+		"MarkRead", "GetUnreadCount", "GetUnreadSummary",
+		"GetConversationsByActivity", "GetReactions", "GetThread",
+		"GetReplyCounts", "GetChangesSince", "Subscribe", "Unsubscribe"} {
+		if _, exists := dmcType.MethodByName(name); !exists {
+			t.Errorf("%s was not found.", name)
+		} else {
+			numOfExcludedFields++
+		}
 	}
 
 	nm := dmcType.NumMethod() - numOfExcludedFields
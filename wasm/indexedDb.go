@@ -0,0 +1,56 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package wasm
+
+import (
+	"encoding/json"
+	"syscall/js"
+
+	"gitlab.com/elixxir/wasm-utils/exception"
+	"gitlab.com/elixxir/wasm-utils/utils"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+)
+
+// SetDatabaseTimeouts sets the timeouts for indexedDb operations. Only the
+// non-zero timeouts are changed. The timeouts apply to databases opened after
+// they are set and override the startup flags of their workers.
+//
+// Each timeout is a duration in nanoseconds. The cursor timeout is the time
+// allowed between two steps of a cursor, so iterating over a large store does
+// not time out as long as it makes progress.
+//
+// Example JSON:
+//
+//	{
+//	  "request": 1000000000,
+//	  "cursor": 5000000000,
+//	  "commit": 2000000000
+//	}
+//
+// Parameters:
+//   - args[0] - JSON of [impl.Timeouts] (Uint8Array).
+//
+// Returns:
+//   - Throws an error if the JSON is invalid or any timeout is negative.
+func SetDatabaseTimeouts(_ js.Value, args []js.Value) any {
+	var timeouts impl.Timeouts
+	err := json.Unmarshal(utils.CopyBytesToGo(args[0]), &timeouts)
+	if err != nil {
+		exception.Throwf("failed to JSON unmarshal Timeouts: %+v", err)
+		return nil
+	}
+
+	if err = impl.SetTimeouts(timeouts); err != nil {
+		exception.ThrowTrace(err)
+		return nil
+	}
+
+	return nil
+}
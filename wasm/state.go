@@ -0,0 +1,212 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package wasm
+
+import (
+	"encoding/json"
+	"strings"
+	"syscall/js"
+
+	"gitlab.com/elixxir/crypto/indexedDb"
+	"gitlab.com/elixxir/wasm-utils/exception"
+	"gitlab.com/elixxir/wasm-utils/utils"
+	"gitlab.com/elixxir/xxdk-wasm/indexedDb/impl"
+	stateDb "gitlab.com/elixxir/xxdk-wasm/indexedDb/worker/state"
+)
+
+// StateStore wraps the [impl.WebState] object so its methods can be wrapped to
+// be Javascript compatible.
+type StateStore struct {
+	api impl.WebState
+}
+
+// newStateStoreJS creates a new Javascript compatible object (map[string]any)
+// that matches the [StateStore] structure.
+func newStateStoreJS(api impl.WebState) map[string]any {
+	ss := StateStore{api}
+	stateStoreMap := map[string]any{
+		"Get":    js.FuncOf(ss.Get),
+		"Set":    js.FuncOf(ss.Set),
+		"Delete": js.FuncOf(ss.Delete),
+		"Keys":   js.FuncOf(ss.Keys),
+		"Clear":  js.FuncOf(ss.Clear),
+	}
+
+	return stateStoreMap
+}
+
+// NewStateStore creates a new [StateStore], a persistent key-value store backed
+// by an IndexedDb worker. Use it to persist application state that does not fit
+// in localStorage.
+//
+// The database is registered so that it is deleted by [storage.Purge].
+//
+// Parameters:
+//   - args[0] - Path to Javascript file that starts the worker (string).
+//   - args[1] - Name of the store. Stores with the same name share the same
+//     data (string).
+//   - args[2] - ID of [DbCipher] object in tracker (int). Create this object
+//     with [NewDatabaseCipher] and get its id with [DbCipher.GetID]. Pass in
+//     null or undefined to store values in plaintext. Once a store has been
+//     created, it must always be opened with the same encryption setting.
+//
+// Returns a promise:
+//   - Resolves to a Javascript representation of the [StateStore] object.
+//   - Rejected with an error if the cipher ID does not correspond to a cipher
+//     or if loading the IndexedDb worker fails.
+func NewStateStore(_ js.Value, args []js.Value) any {
+	wasmJsPath := args[0].String()
+	name := args[1].String()
+
+	var cipher indexedDb.Cipher
+	var cipherErr error
+	if len(args) > 2 && !args[2].IsUndefined() && !args[2].IsNull() {
+		var c *DbCipher
+		c, cipherErr = dbCipherTrackerSingleton.get(args[2].Int())
+		if cipherErr == nil {
+			cipher = c.api
+		}
+	}
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		if cipherErr != nil {
+			reject(exception.NewTrace(cipherErr))
+			return
+		}
+
+		api, err := stateDb.NewState(name, wasmJsPath, cipher)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(newStateStoreJS(api))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// Get returns the value stored at the given key.
+//
+// Parameters:
+//   - args[0] - Key (string).
+//
+// Returns a promise:
+//   - Resolves to the stored value (Uint8Array) or null if the key does not
+//     exist.
+//   - Rejected with an error if the lookup fails.
+func (ss *StateStore) Get(_ js.Value, args []js.Value) any {
+	key := args[0].String()
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		value, err := ss.api.Get(key)
+		if err != nil {
+			if strings.Contains(err.Error(), impl.ErrDoesNotExist) {
+				resolve(js.Null())
+			} else {
+				reject(exception.NewTrace(err))
+			}
+		} else {
+			resolve(utils.CopyBytesToJS(value))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// Set stores the value at the given key, replacing any existing value.
+//
+// Parameters:
+//   - args[0] - Key (string).
+//   - args[1] - Value (Uint8Array).
+//
+// Returns a promise:
+//   - Resolves on success (void).
+//   - Rejected with an error if storing the value fails.
+func (ss *StateStore) Set(_ js.Value, args []js.Value) any {
+	key := args[0].String()
+	value := utils.CopyBytesToGo(args[1])
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		err := ss.api.Set(key, value)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve()
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// Delete removes the value stored at the given key. Deleting a key that does
+// not exist is not an error.
+//
+// Parameters:
+//   - args[0] - Key (string).
+//
+// Returns a promise:
+//   - Resolves on success (void).
+//   - Rejected with an error if deleting the value fails.
+func (ss *StateStore) Delete(_ js.Value, args []js.Value) any {
+	key := args[0].String()
+
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		err := ss.api.Delete(key)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve()
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// Keys returns all keys in the store in ascending order.
+//
+// Returns a promise:
+//   - Resolves to the JSON of an array of keys (Uint8Array).
+//   - Rejected with an error if the lookup fails.
+func (ss *StateStore) Keys(js.Value, []js.Value) any {
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		keys, err := ss.api.Keys()
+		if err != nil {
+			reject(exception.NewTrace(err))
+			return
+		}
+
+		keysJSON, err := json.Marshal(keys)
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve(utils.CopyBytesToJS(keysJSON))
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
+
+// Clear removes all values from the store.
+//
+// Returns a promise:
+//   - Resolves on success (void).
+//   - Rejected with an error if clearing the store fails.
+func (ss *StateStore) Clear(js.Value, []js.Value) any {
+	promiseFn := func(resolve, reject func(args ...any) js.Value) {
+		err := ss.api.Clear()
+		if err != nil {
+			reject(exception.NewTrace(err))
+		} else {
+			resolve()
+		}
+	}
+
+	return utils.CreatePromise(promiseFn)
+}
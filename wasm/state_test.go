@@ -0,0 +1,35 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package wasm
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Tests that the map representing StateStore returned by newStateStoreJS
+// contains all the methods on StateStore.
+func Test_newStateStoreJS(t *testing.T) {
+	ssType := reflect.TypeOf(&StateStore{})
+
+	ss := newStateStoreJS(nil)
+	if len(ss) != ssType.NumMethod() {
+		t.Errorf("StateStore JS object does not have all methods."+
+			"\nexpected: %d\nreceived: %d", ssType.NumMethod(), len(ss))
+	}
+
+	for i := 0; i < ssType.NumMethod(); i++ {
+		method := ssType.Method(i)
+
+		if _, exists := ss[method.Name]; !exists {
+			t.Errorf("Method %s does not exist.", method.Name)
+		}
+	}
+}
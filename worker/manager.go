@@ -10,11 +10,15 @@
 package worker
 
 import (
+	"context"
+	"encoding/json"
+	"sync"
 	"syscall/js"
 	"time"
 
 	"github.com/hack-pad/safejs"
 	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
 )
 
 // initID is the ID for the first item in the callback list. If the list only
@@ -36,32 +40,95 @@ type Manager struct {
 	// Wrapper of the Worker Javascript object.
 	// Doc: https://developer.mozilla.org/en-US/docs/Web/API/Worker
 	w Worker
+
+	// aURL is the URL of the script the worker runs. It is used to start a new
+	// worker on restart.
+	aURL string
+
+	// name is the name of the worker.
+	name string
+
+	p Params
+
+	// callbacks are all the receiver callbacks registered on the manager. They
+	// are registered on the new worker on restart.
+	callbacks map[Tag]ReceiverCallback
+
+	// init is called to initialise a worker after it is restarted. If it is
+	// nil, then the worker is not supervised.
+	init RestartFunc
+
+	// restarting is set while the worker is being restarted and closed once
+	// the restart completes.
+	restarting chan struct{}
+
+	// err is set when the worker failed and could not be restarted.
+	err error
+
+	// quit is closed when the manager is stopped.
+	quit chan struct{}
+
+	mux sync.Mutex
 }
 
 // NewManager generates a new Manager. This functions will only return once
 // communication with the worker has been established.
 func NewManager(aURL, name string, messageLogging bool) (*Manager, error) {
-	w, err := NewWorker(aURL, newWorkerOptions("", "", name))
+	p := DefaultParams()
+	p.MessageLogging = messageLogging
+
+	m := &Manager{
+		aURL:      aURL,
+		name:      name,
+		p:         p,
+		callbacks: make(map[Tag]ReceiverCallback),
+		quit:      make(chan struct{}),
+	}
+
+	var err error
+	m.w, m.mm, err = m.spawn()
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to construct Worker")
+		return nil, err
 	}
 
-	p := DefaultParams()
-	p.MessageLogging = messageLogging
-	mm, err := NewMessageManager(w.Value, name+"-main", p)
+	return m, nil
+}
+
+// spawn starts a new worker and returns once communication with the worker has
+// been established. All registered callbacks are registered on the new worker.
+func (m *Manager) spawn() (Worker, *MessageManager, error) {
+	w, err := NewWorker(m.aURL, newWorkerOptions("", "", m.name))
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to construct message manager")
+		return Worker{}, nil, errors.Wrapf(err, "failed to construct Worker")
 	}
 
-	m := &Manager{
-		mm: mm,
-		w:  w,
+	mm, err := NewMessageManager(w.Value, m.name+"-main", m.p)
+	if err != nil {
+		_ = w.Terminate()
+		return Worker{}, nil,
+			errors.Wrapf(err, "failed to construct message manager")
 	}
 
+	m.mux.Lock()
+	for tag, cb := range m.callbacks {
+		mm.RegisterCallback(tag, cb)
+	}
+	m.mux.Unlock()
+
 	// Register a callback that will receive initial message from worker
 	// indicating that it is ready
 	ready := make(chan struct{})
-	mm.RegisterCallback(readyTag, func([]byte, func([]byte)) {
+	mm.RegisterCallback(readyTag, func(data []byte, _ func([]byte)) {
+		// Use the binary codec if the worker supports it. Older workers send
+		// no data and only understand JSON.
+		var rm ReadyMessage
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &rm); err != nil {
+				jww.WARN.Printf("[WW] [%s] Failed to unmarshal ready signal: "+
+					"%+v", mm.name, err)
+			}
+		}
+		mm.SetBinaryCodec(rm.BinaryCodec)
 		ready <- struct{}{}
 	})
 
@@ -69,12 +136,14 @@ func NewManager(aURL, name string, messageLogging bool) (*Manager, error) {
 	select {
 	case <-ready:
 	case <-time.After(workerInitialConnectionTimeout):
-		return nil, errors.Errorf("[WW] [%s] timed out after %s waiting for "+
-			"initial message from worker",
+		mm.Stop()
+		_ = w.Terminate()
+		return Worker{}, nil, errors.Errorf("[WW] [%s] timed out after %s "+
+			"waiting for initial message from worker",
 			mm.name, workerInitialConnectionTimeout)
 	}
 
-	return m, nil
+	return w, mm, nil
 }
 
 // NewManagerFromScript generates a new Manager. This functions will only return
@@ -103,6 +172,14 @@ func NewManagerFromScript(
 
 // Stop closes the worker manager and terminates the worker.
 func (m *Manager) Stop() error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	select {
+	case <-m.quit:
+	default:
+		close(m.quit)
+	}
+
 	m.mm.Stop()
 
 	// Terminate the worker
@@ -111,9 +188,15 @@ func (m *Manager) Stop() error {
 }
 
 // SendMessage sends a message to the worker with the given tag and waits for a
-// response. An error is returned on failure to send or on timeout.
+// response. An error is returned on failure to send or on timeout. If the
+// worker is supervised and is restarted while waiting, a [RestartError] is
+// returned.
 func (m *Manager) SendMessage(tag Tag, data []byte) (response []byte, err error) {
-	return m.mm.Send(tag, data)
+	mm, err := m.current()
+	if err != nil {
+		return nil, err
+	}
+	return mm.Send(tag, data)
 }
 
 // SendTimeout sends a message to the worker with the given tag and waits for a
@@ -121,18 +204,55 @@ func (m *Manager) SendMessage(tag Tag, data []byte) (response []byte, err error)
 // timeout.
 func (m *Manager) SendTimeout(
 	tag Tag, data []byte, timeout time.Duration) (response []byte, err error) {
-	return m.mm.SendTimeout(tag, data, timeout)
+	mm, err := m.current()
+	if err != nil {
+		return nil, err
+	}
+	return mm.SendTimeout(tag, data, timeout)
+}
+
+// SendContext sends a message to the worker with the given tag and waits for a
+// response until the context is done. If the context has no deadline, the
+// default response timeout is used. If the context is done first, the worker
+// is notified so that it can abort the request and the context's error is
+// returned.
+func (m *Manager) SendContext(
+	ctx context.Context, tag Tag, data []byte) (response []byte, err error) {
+	mm, err := m.current()
+	if err != nil {
+		return nil, err
+	}
+	return mm.SendContext(ctx, tag, data)
+}
+
+// SendStream sends a message to the worker with the given tag and returns a
+// [StreamReader] that receives the response in chunks. The worker must handle
+// the tag with a [StreamReceiverCallback].
+func (m *Manager) SendStream(
+	ctx context.Context, tag Tag, data []byte) (*StreamReader, error) {
+	mm, err := m.current()
+	if err != nil {
+		return nil, err
+	}
+	return mm.SendStream(ctx, tag, data)
 }
 
 // SendNoResponse sends a message to the worker with the given tag. It returns
 // immediately and does not wait for a response.
 func (m *Manager) SendNoResponse(tag Tag, data []byte) error {
-	return m.mm.SendNoResponse(tag, data)
+	mm, err := m.current()
+	if err != nil {
+		return err
+	}
+	return mm.SendNoResponse(tag, data)
 }
 
 // RegisterCallback registers the callback for the given tag. Previous tags are
 // overwritten. This function is thread safe.
 func (m *Manager) RegisterCallback(tag Tag, receiverCB ReceiverCallback) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.callbacks[tag] = receiverCB
 	m.mm.RegisterCallback(tag, receiverCB)
 }
 
@@ -142,7 +262,7 @@ func (m *Manager) RegisterCallback(tag Tag, receiverCB ReceiverCallback) {
 func (m *Manager) GetWorker() js.Value { return safejs.Unsafe(m.w.Value) }
 
 // Name returns the name of the web worker object.
-func (m *Manager) Name() string { return m.mm.name }
+func (m *Manager) Name() string { return m.name + "-main" }
 
 ////////////////////////////////////////////////////////////////////////////////
 // Worker Wrapper                                                             //
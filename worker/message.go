@@ -9,11 +9,103 @@
 
 package worker
 
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
 // Message is the outer message that contains the contents of each message sent
-// to the worker. It is transmitted as JSON.
+// to the worker. It is transmitted as JSON or, if both sides support it, as a
+// binary frame (see [Message.MarshalBinary]).
 type Message struct {
 	Tag      Tag    `json:"tag"`
 	ID       uint64 `json:"id"`
 	Response bool   `json:"response"`
 	Data     []byte `json:"data"`
 }
+
+// binaryFrameMarker is the first byte of a Message encoded with the binary
+// codec. JSON encoded messages always start with '{', so the two can be told
+// apart.
+const binaryFrameMarker byte = 0xB1
+
+// Flags in the binary frame.
+const (
+	binaryFlagResponse byte = 1 << iota
+)
+
+// ReadyMessage is JSON marshalled and sent with the ready signal from the
+// worker to describe its capabilities. Old workers send no data.
+type ReadyMessage struct {
+	// BinaryCodec is true if the worker can receive messages encoded with the
+	// binary codec.
+	BinaryCodec bool `json:"binaryCodec"`
+}
+
+// CancelMessage is JSON marshalled and sent to the remote thread when a sent
+// message is cancelled before its response is received.
+type CancelMessage struct {
+	Tag Tag    `json:"tag"`
+	ID  uint64 `json:"id"`
+}
+
+// MarshalBinary encodes the Message into a compact binary frame. Unlike JSON,
+// the data is not base64 encoded. The frame has the format:
+//
+//	+--------+-------+----------+------------+-----+------+
+//	| marker | flags |    ID    | tag length | tag | data |
+//	| 1 byte | 1 byte| uvarint  |  uvarint   |     |      |
+//	+--------+-------+----------+------------+-----+------+
+func (m Message) MarshalBinary() ([]byte, error) {
+	buff := make([]byte, 0,
+		2+2*binary.MaxVarintLen64+len(m.Tag)+len(m.Data))
+
+	var flags byte
+	if m.Response {
+		flags |= binaryFlagResponse
+	}
+
+	buff = append(buff, binaryFrameMarker, flags)
+	buff = binary.AppendUvarint(buff, m.ID)
+	buff = binary.AppendUvarint(buff, uint64(len(m.Tag)))
+	buff = append(buff, m.Tag...)
+	buff = append(buff, m.Data...)
+	return buff, nil
+}
+
+// UnmarshalBinary decodes the binary frame into the Message.
+func (m *Message) UnmarshalBinary(b []byte) error {
+	if len(b) < 2 || b[0] != binaryFrameMarker {
+		return errors.New("data is not a binary frame")
+	}
+	flags := b[1]
+	b = b[2:]
+
+	id, n := binary.Uvarint(b)
+	if n <= 0 {
+		return errors.New("invalid ID in binary frame")
+	}
+	b = b[n:]
+
+	tagLen, n := binary.Uvarint(b)
+	if n <= 0 || tagLen > uint64(len(b)-n) {
+		return errors.New("invalid tag length in binary frame")
+	}
+	b = b[n:]
+
+	m.Tag = Tag(b[:tagLen])
+	m.ID = id
+	m.Response = flags&binaryFlagResponse != 0
+	m.Data = nil
+	if len(b[tagLen:]) > 0 {
+		m.Data = make([]byte, len(b[tagLen:]))
+		copy(m.Data, b[tagLen:])
+	}
+	return nil
+}
+
+// isBinaryFrame returns true if the data is encoded with the binary codec.
+func isBinaryFrame(data []byte) bool {
+	return len(data) > 0 && data[0] == binaryFrameMarker
+}
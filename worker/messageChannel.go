@@ -47,8 +47,6 @@ func CreateMessageChannel(w1, w2 *Manager, channelName, key string) error {
 	if err != nil {
 		return err
 	}
-	channelNameJS := utils.CopyBytesToJS([]byte(channelName))
-	keyJS := utils.CopyBytesToJS([]byte(key))
 
 	port1, err := mc.Port1()
 	if err != nil {
@@ -60,23 +58,58 @@ func CreateMessageChannel(w1, w2 *Manager, channelName, key string) error {
 		return errors.Wrap(err, "could not get port2")
 	}
 
-	obj1 := map[string]any{
-		"port": port1.Value, "channel": channelNameJS, "key": keyJS}
-	err = w1.w.PostMessageTransfer(obj1, port1.Value)
-	if err != nil {
+	if err = w1.sendPort(port1, channelName, key); err != nil {
 		return errors.Wrap(err, "failed to send port1")
 	}
 
-	obj2 := map[string]any{
-		"port": port2.Value, "channel": channelNameJS, "key": keyJS}
-	err = w2.w.PostMessageTransfer(obj2, port2.Value)
-	if err != nil {
+	if err = w2.sendPort(port2, channelName, key); err != nil {
 		return errors.Wrap(err, "failed to send port2")
 	}
 
 	return nil
 }
 
+// OpenMessageChannel creates a new Javascript MessageChannel between the
+// current context and the worker. One port is sent to the worker, which
+// handles it with the callback registered for the key, and the other is
+// returned. Like [CreateMessageChannel], the channelName is used in logs.
+//
+// The returned port is usually wrapped with [NewMessageManager] to exchange
+// messages with the worker separately from its main messages.
+func (m *Manager) OpenMessageChannel(
+	channelName, key string) (MessagePort, error) {
+	mc, err := NewMessageChannel()
+	if err != nil {
+		return MessagePort{}, err
+	}
+
+	port1, err := mc.Port1()
+	if err != nil {
+		return MessagePort{}, errors.Wrap(err, "could not get port1")
+	}
+
+	port2, err := mc.Port2()
+	if err != nil {
+		return MessagePort{}, errors.Wrap(err, "could not get port2")
+	}
+
+	if err = m.sendPort(port2, channelName, key); err != nil {
+		return MessagePort{}, errors.Wrap(err, "failed to send port2")
+	}
+
+	return port1, nil
+}
+
+// sendPort transfers the port to the worker with the channel name and key.
+func (m *Manager) sendPort(port MessagePort, channelName, key string) error {
+	obj := map[string]any{
+		"port":    port.Value,
+		"channel": utils.CopyBytesToJS([]byte(channelName)),
+		"key":     utils.CopyBytesToJS([]byte(key)),
+	}
+	return m.w.PostMessageTransfer(obj, port.Value)
+}
+
 // Port1 returns the first port of the message channel — the port attached to
 // the context that originated the channel.
 //
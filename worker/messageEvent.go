@@ -14,6 +14,10 @@ import (
 	"github.com/pkg/errors"
 )
 
+// errMessageError is the error returned by a MessageEvent for a messageerror
+// event, which is fired when a message cannot be deserialized.
+var errMessageError = errors.New("received message that cannot be deserialized")
+
 // MessageEvent is received from the channel returned by Listen().
 // Represents a JS MessageEvent.
 type MessageEvent struct {
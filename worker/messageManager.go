@@ -35,6 +35,18 @@ type SenderCallback func(message []byte)
 // [SenderCallback].
 type ReceiverCallback func(message []byte, reply func(message []byte))
 
+// ContextReceiverCallback is a [ReceiverCallback] that also receives a context
+// that is cancelled if the sender cancels the request (see
+// [MessageManager.SendContext]). Like a ReceiverCallback, it is never run
+// concurrently with other callbacks, but cancellations are still received
+// while it runs. Reply must be called exactly once.
+type ContextReceiverCallback func(
+	ctx context.Context, message []byte, reply func(message []byte))
+
+// callQueueSize is the number of received messages that can wait for their
+// callback to be run before the message reception thread blocks.
+const callQueueSize = 1024
+
 // NewPortCallback is called with a MessagePort Javascript object when received.
 type NewPortCallback func(port js.Value, channelName string)
 
@@ -53,6 +65,42 @@ type MessageManager struct {
 	// receiving a message.
 	receiverCallbacks map[Tag]ReceiverCallback
 
+	// contextCallbacks are a list of ContextReceiverCallback that are called
+	// when receiving a message. They take precedence over receiverCallbacks.
+	contextCallbacks map[Tag]ContextReceiverCallback
+
+	// inFlight contains the cancel function for the context of each
+	// ContextReceiverCallback that has not yet replied. It is called when a
+	// cancellation is received for the message.
+	inFlight map[Tag]map[uint64]context.CancelFunc
+
+	// streamCallbacks are a list of StreamReceiverCallback that are called
+	// when receiving a message that expects a streamed response.
+	streamCallbacks map[Tag]StreamReceiverCallback
+
+	// streamWriters are the open streams being sent to the remote thread.
+	streamWriters map[Tag]map[uint64]*StreamWriter
+
+	// streamReaders are the open streams being received from the remote
+	// thread.
+	streamReaders map[Tag]map[uint64]*StreamReader
+
+	// cancelled contains the IDs of sent messages that were cancelled before
+	// receiving a response so that late responses can be dropped quietly. Each
+	// ID is forgotten once its response is received or after the response
+	// timeout.
+	cancelled map[Tag]map[uint64]struct{}
+
+	// calls receives the callbacks of received messages, which are run one at
+	// a time by runCallbacks in the order the messages were received. The
+	// event models used by the callbacks are not thread safe.
+	calls chan func()
+
+	// callMux is held while a callback runs. A StreamReceiverCallback runs on
+	// its own goroutine and releases it while waiting for the receiver, so
+	// other callbacks can run between the chunks of a stream.
+	callMux sync.Mutex
+
 	// responseIDs is a list of the newest ID to assign to each senderCallbacks
 	// when registered. The IDs are used to connect a reply to the original
 	// message.
@@ -62,8 +110,20 @@ type MessageManager struct {
 	// message channel is received.
 	messageChannelCB map[string]NewPortCallback
 
-	// quit, when triggered, stops the thread that processes received messages.
-	quit chan struct{}
+	// quit, when closed, stops the thread that processes received messages and
+	// fails all messages waiting on a response with closeErr.
+	quit     chan struct{}
+	closeErr error
+	stopOnce sync.Once
+
+	// binaryCodec is true if messages are sent as binary frames instead of
+	// JSON. It is enabled once the remote thread is known to support it.
+	binaryCodec bool
+
+	// errorHandler, if set, is called when an error event is received from
+	// the remote thread (e.g., when it crashes). If it is not set, the error is
+	// thrown.
+	errorHandler func(err error)
 
 	// name names the underlying Javascript object. It is used for debugging and
 	// logging purposes.
@@ -79,11 +139,11 @@ type MessageManager struct {
 // TODO: test
 func NewMessageManager(
 	v safejs.Value, name string, p Params) (*MessageManager, error) {
-	mm := initMessageManager(name, p)
 	mp, err := NewMessagePort(v)
 	if err != nil {
 		return nil, errors.Wrap(err, "invalid MessagePort value")
 	}
+	mm := initMessageManager(name, p)
 	mm.p = mp
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -99,17 +159,29 @@ func NewMessageManager(
 	return mm, nil
 }
 
-// initMessageManager initialises a new empty MessageManager.
+// initMessageManager initialises a new empty MessageManager and starts the
+// thread that runs its callbacks.
 func initMessageManager(name string, p Params) *MessageManager {
-	return &MessageManager{
+	mm := &MessageManager{
 		senderCallbacks:   make(map[Tag]map[uint64]SenderCallback),
 		receiverCallbacks: make(map[Tag]ReceiverCallback),
+		contextCallbacks:  make(map[Tag]ContextReceiverCallback),
+		inFlight:          make(map[Tag]map[uint64]context.CancelFunc),
+		cancelled:         make(map[Tag]map[uint64]struct{}),
+		streamCallbacks:   make(map[Tag]StreamReceiverCallback),
+		streamWriters:     make(map[Tag]map[uint64]*StreamWriter),
+		streamReaders:     make(map[Tag]map[uint64]*StreamReader),
 		responseIDs:       make(map[Tag]uint64),
 		messageChannelCB:  make(map[string]NewPortCallback),
+		calls:             make(chan func(), callQueueSize),
 		quit:              make(chan struct{}),
 		name:              name,
 		Params:            p,
 	}
+
+	go mm.runCallbacks()
+
+	return mm
 }
 
 // Send sends the data to the remote thread with the given tag and waits for a
@@ -125,23 +197,79 @@ func (mm *MessageManager) Send(tag Tag, data []byte) (response []byte, err error
 
 // SendTimeout sends the data to the remote thread with a custom timeout. Refer
 // to [Send] for more information.
-// TODO: test
 func (mm *MessageManager) SendTimeout(
 	tag Tag, data []byte, timeout time.Duration) (response []byte, err error) {
-	responseCh := make(chan []byte)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	response, err = mm.SendContext(ctx, tag, data)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil,
+			errors.Errorf("timed out after %s waiting for response", timeout)
+	}
+	return response, err
+}
+
+// SendContext sends the data to the remote thread with the given tag and waits
+// for a response until the context is done. If the context has no deadline,
+// the default response timeout is used.
+//
+// If the context is cancelled or its deadline passes before the response is
+// received, the response is discarded and a cancellation is sent to the remote
+// thread, which cancels the context passed to the [ContextReceiverCallback]
+// handling the message. The context's error is returned.
+func (mm *MessageManager) SendContext(
+	ctx context.Context, tag Tag, data []byte) (response []byte, err error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, mm.ResponseTimeout)
+		defer cancel()
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	responseCh := make(chan []byte, 1)
 	id := mm.registerSenderCallback(tag, func(msg []byte) { responseCh <- msg })
 
 	err = mm.sendMessage(tag, id, data)
 	if err != nil {
+		mm.deleteSenderCallback(tag, id)
 		return nil, err
 	}
 
 	select {
 	case response = <-responseCh:
 		return response, nil
-	case <-time.After(timeout):
-		return nil,
-			errors.Errorf("timed out after %s waiting for response", timeout)
+	case <-mm.quit:
+		return nil, mm.closeErr
+	case <-ctx.Done():
+		mm.cancelMessage(tag, id)
+		return nil, ctx.Err()
+	}
+}
+
+// cancelMessage removes the sender callback for the message with the given tag
+// and ID and notifies the remote thread that the message was cancelled. It does
+// nothing if the response has already been received.
+func (mm *MessageManager) cancelMessage(tag Tag, id uint64) {
+	if !mm.deleteSenderCallback(tag, id) {
+		return
+	}
+
+	mm.addCancelled(tag, id)
+
+	data, err := json.Marshal(CancelMessage{Tag: tag, ID: id})
+	if err != nil {
+		jww.ERROR.Printf("[WW] [%s] Failed to marshal cancellation for %q "+
+			"and ID %d: %+v", mm.name, tag, id, err)
+		return
+	}
+
+	err = mm.sendMessage(cancelTag, initID, data)
+	if err != nil {
+		jww.WARN.Printf("[WW] [%s] Failed to send cancellation for %q and "+
+			"ID %d: %+v", mm.name, tag, id, err)
 	}
 }
 
@@ -161,6 +289,12 @@ func (mm *MessageManager) SendNoResponse(tag Tag, data []byte) error {
 // to the remote thread.
 // TODO: test
 func (mm *MessageManager) sendMessage(tag Tag, id uint64, data []byte) error {
+	select {
+	case <-mm.quit:
+		return mm.closeErr
+	default:
+	}
+
 	if mm.MessageLogging {
 		jww.DEBUG.Printf("[WW] [%s] Sending message for %q and ID %d: %s",
 			mm.name, tag, id, truncate.Truncate(
@@ -173,7 +307,7 @@ func (mm *MessageManager) sendMessage(tag Tag, id uint64, data []byte) error {
 		Response: false,
 		Data:     data,
 	}
-	payload, err := json.Marshal(msg)
+	payload, err := mm.marshalMessage(msg)
 	if err != nil {
 		return err
 	}
@@ -182,8 +316,11 @@ func (mm *MessageManager) sendMessage(tag Tag, id uint64, data []byte) error {
 }
 
 // sendResponse sends a reply to the remote thread with the given tag and ID.
+// The reply is encoded with the binary codec if binaryCodec is true so that it
+// matches the encoding of the original message.
 // TODO: test
-func (mm *MessageManager) sendResponse(tag Tag, id uint64, data []byte) error {
+func (mm *MessageManager) sendResponse(
+	tag Tag, id uint64, data []byte, binaryCodec bool) error {
 	if mm.MessageLogging {
 		jww.DEBUG.Printf("[WW] [%s] Sending reply for %q and ID %d: %s",
 			mm.name, tag, id, truncate.Truncate(
@@ -197,7 +334,13 @@ func (mm *MessageManager) sendResponse(tag Tag, id uint64, data []byte) error {
 		Data:     data,
 	}
 
-	payload, err := json.Marshal(msg)
+	var payload []byte
+	var err error
+	if binaryCodec {
+		payload, err = msg.MarshalBinary()
+	} else {
+		payload, err = json.Marshal(msg)
+	}
 	if err != nil {
 		return err
 	}
@@ -221,6 +364,16 @@ func (mm *MessageManager) messageReception(
 
 			safeData, err := event.Data()
 			if err != nil {
+				mm.mux.Lock()
+				errorHandler := mm.errorHandler
+				mm.mux.Unlock()
+				if errorHandler != nil {
+					go errorHandler(err)
+					continue
+				} else if errors.Is(err, errMessageError) {
+					jww.ERROR.Printf("[WW] [%s] %+v", mm.name, err)
+					continue
+				}
 				exception.Throwf("Failed to process message: %+v", err)
 			}
 			data := safejs.Unsafe(safeData)
@@ -252,14 +405,16 @@ func (mm *MessageManager) messageReception(
 	}
 }
 
-// processReceivedMessage processes the received message and calls the
-// associated callback. This functions blocks until the callback returns.
+// processReceivedMessage processes the received message. Responses,
+// cancellations, and stream acknowledgements are handled immediately; all
+// other messages are queued to be handled by their callback once the callbacks
+// of previously received messages return.
 func (mm *MessageManager) processReceivedMessage(data []byte) error {
-	var msg Message
-	err := json.Unmarshal(data, &msg)
+	msg, err := mm.unmarshalMessage(data)
 	if err != nil {
 		return err
 	}
+	binaryCodec := isBinaryFrame(data)
 
 	if mm.MessageLogging {
 		jww.DEBUG.Printf("[WW] [%s] Received message for %q and ID %d "+
@@ -268,29 +423,143 @@ func (mm *MessageManager) processReceivedMessage(data []byte) error {
 	}
 
 	if msg.Response {
+		if isStream, err := mm.receiveStreamFrame(
+			msg.Tag, msg.ID, msg.Data); isStream {
+			return err
+		}
+
+		if mm.isCancelled(msg.Tag, msg.ID) {
+			jww.DEBUG.Printf("[WW] [%s] Dropping response for cancelled "+
+				"message %q with ID %d", mm.name, msg.Tag, msg.ID)
+			return nil
+		}
+
 		callback, err := mm.getSenderCallback(msg.Tag, msg.ID)
 		if err != nil {
 			return err
 		}
 
 		callback(msg.Data)
+	} else if msg.Tag == cancelTag {
+		return mm.processCancellation(msg.Data)
+	} else if msg.Tag == streamAckTag {
+		return mm.processStreamAck(msg.Data)
+	} else if callback, exists := mm.getStreamCallback(msg.Tag); exists {
+		w := mm.newStreamWriter(msg.Tag, msg.ID, binaryCodec)
+		mm.queueCallback(func() {
+			go func() {
+				defer mm.callMux.Unlock()
+				callback(w.ctx, msg.Data, w)
+			}()
+		})
+	} else if callback, exists := mm.getContextCallback(msg.Tag); exists {
+		ctx, cancel := mm.addInFlight(msg.Tag, msg.ID)
+		mm.queueCallback(func() {
+			defer mm.callMux.Unlock()
+			callback(ctx, msg.Data, func(message []byte) {
+				mm.removeInFlight(msg.Tag, msg.ID)
+				cancel()
+				err := mm.sendResponse(msg.Tag, msg.ID, message, binaryCodec)
+				if err != nil {
+					jww.ERROR.Printf("[WW] [%s] Failed to send response for "+
+						"%q and ID %d: %+v", mm.name, msg.Tag, msg.ID, err)
+				}
+			})
+		})
 	} else {
 		callback, err := mm.getReceiverCallback(msg.Tag)
 		if err != nil {
 			return err
 		}
 
-		callback(msg.Data, func(message []byte) {
-			if err = mm.sendResponse(msg.Tag, msg.ID, message); err != nil {
+		reply := func(message []byte) {
+			err := mm.sendResponse(msg.Tag, msg.ID, message, binaryCodec)
+			if err != nil {
 				jww.FATAL.Panicf("[WW] [%s] Failed to send response for %q "+
 					"and ID %d: %+v", mm.name, msg.Tag, msg.ID, err)
 			}
+		}
+
+		// Heartbeats are answered immediately so that a long-running callback
+		// is not mistaken for an unresponsive thread
+		if msg.Tag == heartbeatTag {
+			callback(msg.Data, reply)
+			return nil
+		}
+
+		mm.queueCallback(func() {
+			defer mm.callMux.Unlock()
+			callback(msg.Data, reply)
 		})
 	}
 
 	return nil
 }
 
+// queueCallback queues the call to run once the callbacks of all previously
+// received messages have returned. The call is made with callMux locked and
+// must unlock it once its callback returns. It blocks if the queue is full.
+func (mm *MessageManager) queueCallback(call func()) {
+	select {
+	case mm.calls <- call:
+	case <-mm.quit:
+	}
+}
+
+// Run queues fn to run like the callback of a received message, once the
+// callbacks of all previously received messages have returned, so that it is
+// never run concurrently with them. It blocks until fn returns or the
+// MessageManager is stopped. It must not be called from a callback, since the
+// queue waits for that callback to return.
+func (mm *MessageManager) Run(fn func()) {
+	done := make(chan struct{})
+	mm.queueCallback(func() {
+		defer close(done)
+		defer mm.callMux.Unlock()
+		fn()
+	})
+
+	select {
+	case <-done:
+	case <-mm.quit:
+	}
+}
+
+// runCallbacks runs the queued callbacks one at a time until the
+// MessageManager is stopped.
+func (mm *MessageManager) runCallbacks() {
+	for {
+		select {
+		case <-mm.quit:
+			return
+		case call := <-mm.calls:
+			mm.callMux.Lock()
+			call()
+		}
+	}
+}
+
+// processCancellation cancels the context of the in-flight message described
+// by the JSON marshalled CancelMessage.
+func (mm *MessageManager) processCancellation(data []byte) error {
+	var cm CancelMessage
+	if err := json.Unmarshal(data, &cm); err != nil {
+		return errors.Wrapf(err, "failed to unmarshal %T", cm)
+	}
+
+	cancel, exists := mm.removeInFlight(cm.Tag, cm.ID)
+	if !exists {
+		jww.DEBUG.Printf("[WW] [%s] No message %q with ID %d in flight to "+
+			"cancel", mm.name, cm.Tag, cm.ID)
+		return nil
+	}
+
+	jww.DEBUG.Printf("[WW] [%s] Cancelling message %q with ID %d",
+		mm.name, cm.Tag, cm.ID)
+	cancel()
+	return nil
+}
+
 // processReceivedPort processes the received Javascript MessagePort and calls
 // the associated NewPortCallback callback. This functions blocks until the
 // callback returns.
@@ -327,6 +596,66 @@ func (mm *MessageManager) RegisterCallback(tag Tag, receiverCB ReceiverCallback)
 	mm.receiverCallbacks[tag] = receiverCB
 }
 
+// RegisterContextCallback registers the context callback for the given tag.
+// Previous tags are overwritten. This function is thread safe.
+func (mm *MessageManager) RegisterContextCallback(
+	tag Tag, receiverCB ContextReceiverCallback) {
+	mm.mux.Lock()
+	defer mm.mux.Unlock()
+
+	jww.DEBUG.Printf("[WW] [%s] Registering context callback for tag %q",
+		mm.name, tag)
+
+	mm.contextCallbacks[tag] = receiverCB
+}
+
+// getContextCallback returns the ContextReceiverCallback for the given Tag, if
+// one exists. This function is thread safe.
+func (mm *MessageManager) getContextCallback(
+	tag Tag) (ContextReceiverCallback, bool) {
+	mm.mux.Lock()
+	defer mm.mux.Unlock()
+	callback, exists := mm.contextCallbacks[tag]
+	return callback, exists
+}
+
+// addInFlight creates a new context for the received message with the given
+// tag and ID and saves its cancel function so that the message can be
+// cancelled by the sender. This function is thread safe.
+func (mm *MessageManager) addInFlight(
+	tag Tag, id uint64) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	mm.mux.Lock()
+	defer mm.mux.Unlock()
+	if _, exists := mm.inFlight[tag]; !exists {
+		mm.inFlight[tag] = make(map[uint64]context.CancelFunc)
+	}
+	mm.inFlight[tag][id] = cancel
+
+	return ctx, cancel
+}
+
+// removeInFlight removes and returns the cancel function for the received
+// message with the given tag and ID. Returns false if the message is not in
+// flight. This function is thread safe.
+func (mm *MessageManager) removeInFlight(
+	tag Tag, id uint64) (context.CancelFunc, bool) {
+	mm.mux.Lock()
+	defer mm.mux.Unlock()
+	cancel, exists := mm.inFlight[tag][id]
+	if !exists {
+		return nil, false
+	}
+
+	delete(mm.inFlight[tag], id)
+	if len(mm.inFlight[tag]) == 0 {
+		delete(mm.inFlight, tag)
+	}
+
+	return cancel, true
+}
+
 // getReceiverCallback returns the ReceiverCallback for the given Tag or returns
 // an error if no callback is found. This function is thread safe.
 func (mm *MessageManager) getReceiverCallback(tag Tag) (ReceiverCallback, error) {
@@ -388,6 +717,46 @@ func (mm *MessageManager) getSenderCallback(
 	return callback, nil
 }
 
+// deleteSenderCallback deletes the SenderCallback for the given Tag and ID.
+// Returns false if no callback exists (i.e., the response was already
+// received). This function is thread safe.
+func (mm *MessageManager) deleteSenderCallback(tag Tag, id uint64) bool {
+	_, err := mm.getSenderCallback(tag, id)
+	return err == nil
+}
+
+// addCancelled saves the sent message with the given Tag and ID as cancelled
+// so that its response is dropped. It is forgotten after the response timeout
+// if no response is received. This function is thread safe.
+func (mm *MessageManager) addCancelled(tag Tag, id uint64) {
+	mm.mux.Lock()
+	defer mm.mux.Unlock()
+	if _, exists := mm.cancelled[tag]; !exists {
+		mm.cancelled[tag] = make(map[uint64]struct{})
+	}
+	mm.cancelled[tag][id] = struct{}{}
+
+	time.AfterFunc(mm.ResponseTimeout, func() { mm.isCancelled(tag, id) })
+}
+
+// isCancelled returns true if the sent message with the given Tag and ID was
+// cancelled. The message is forgotten so that only the first response is
+// dropped. This function is thread safe.
+func (mm *MessageManager) isCancelled(tag Tag, id uint64) bool {
+	mm.mux.Lock()
+	defer mm.mux.Unlock()
+	if _, exists := mm.cancelled[tag][id]; !exists {
+		return false
+	}
+
+	delete(mm.cancelled[tag], id)
+	if len(mm.cancelled[tag]) == 0 {
+		delete(mm.cancelled, tag)
+	}
+
+	return true
+}
+
 // RegisterMessageChannelCallback registers a callback that will be called when
 // a MessagePort with the given Channel is received.
 func (mm *MessageManager) RegisterMessageChannelCallback(
@@ -397,13 +766,70 @@ func (mm *MessageManager) RegisterMessageChannelCallback(
 	mm.messageChannelCB[key] = fn
 }
 
+// marshalMessage encodes the Message using the binary codec, if enabled, or
+// JSON otherwise.
+func (mm *MessageManager) marshalMessage(msg Message) ([]byte, error) {
+	mm.mux.Lock()
+	binaryCodec := mm.binaryCodec
+	mm.mux.Unlock()
+
+	if binaryCodec {
+		return msg.MarshalBinary()
+	}
+	return json.Marshal(msg)
+}
+
+// unmarshalMessage decodes a Message encoded with either the binary codec or
+// JSON. Receiving a binary frame means the remote thread supports the binary
+// codec, so it is enabled for sending.
+func (mm *MessageManager) unmarshalMessage(data []byte) (Message, error) {
+	var msg Message
+	if !isBinaryFrame(data) {
+		return msg, json.Unmarshal(data, &msg)
+	}
+
+	if err := msg.UnmarshalBinary(data); err != nil {
+		return msg, err
+	}
+	mm.SetBinaryCodec(true)
+	return msg, nil
+}
+
+// SetBinaryCodec sets whether messages are sent as binary frames instead of
+// JSON. Only enable it once the remote thread is known to support it. This
+// function is thread safe.
+func (mm *MessageManager) SetBinaryCodec(enabled bool) {
+	mm.mux.Lock()
+	defer mm.mux.Unlock()
+	if mm.binaryCodec != enabled && mm.MessageLogging {
+		jww.DEBUG.Printf("[WW] [%s] Binary codec enabled: %t", mm.name, enabled)
+	}
+	mm.binaryCodec = enabled
+}
+
+// SetErrorHandler sets the function called when an error event is received
+// from the remote thread (e.g., an uncaught exception or a message that cannot
+// be deserialized). This function is thread safe.
+func (mm *MessageManager) SetErrorHandler(fn func(err error)) {
+	mm.mux.Lock()
+	defer mm.mux.Unlock()
+	mm.errorHandler = fn
+}
+
 // Stop closes the message reception thread and closes the port.
 // TODO: test
 func (mm *MessageManager) Stop() {
-	// Stop messageReception
-	select {
-	case mm.quit <- struct{}{}:
-	}
+	mm.close(errors.Errorf("[WW] [%s] message manager stopped", mm.name))
+}
+
+// close stops the message reception thread. Any messages waiting on a
+// response, and any sent after, return the given error. Only the first call
+// has an effect.
+func (mm *MessageManager) close(err error) {
+	mm.stopOnce.Do(func() {
+		mm.closeErr = err
+		close(mm.quit)
+	})
 }
 
 // getNextID returns the next unique ID for the given tag. This function is not
@@ -10,14 +10,19 @@
 package worker
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"reflect"
 	"strconv"
+	"strings"
+	"sync"
 	"syscall/js"
 	"testing"
 	"time"
 
 	"github.com/hack-pad/safejs"
+	"github.com/pkg/errors"
 	"gitlab.com/elixxir/wasm-utils/utils"
 )
 
@@ -29,8 +34,15 @@ func Test_initMessageManager(t *testing.T) {
 	expected := &MessageManager{
 		senderCallbacks:   make(map[Tag]map[uint64]SenderCallback),
 		receiverCallbacks: make(map[Tag]ReceiverCallback),
+		contextCallbacks:  make(map[Tag]ContextReceiverCallback),
+		inFlight:          make(map[Tag]map[uint64]context.CancelFunc),
+		cancelled:         make(map[Tag]map[uint64]struct{}),
+		streamCallbacks:   make(map[Tag]StreamReceiverCallback),
+		streamWriters:     make(map[Tag]map[uint64]*StreamWriter),
+		streamReaders:     make(map[Tag]map[uint64]*StreamReader),
 		responseIDs:       make(map[Tag]uint64),
 		messageChannelCB:  make(map[string]NewPortCallback),
+		calls:             make(chan func(), callQueueSize),
 		quit:              make(chan struct{}),
 		name:              "name",
 		Params:            DefaultParams(),
@@ -38,6 +50,7 @@ func Test_initMessageManager(t *testing.T) {
 
 	received := initMessageManager(expected.name, expected.Params)
 
+	received.calls = expected.calls
 	received.quit = expected.quit
 	if !reflect.DeepEqual(expected, received) {
 		t.Errorf("Unexpected MessageManager.\nexpected: %+v\nreceived: %+v",
@@ -48,7 +61,262 @@ func Test_initMessageManager(t *testing.T) {
 func TestMessageManager_Send(t *testing.T) {
 }
 
+// Error path: Tests that MessageManager.SendTimeout returns a timeout error and
+// removes the sender callback when no response is received.
 func TestMessageManager_SendTimeout(t *testing.T) {
+	sender, _ := newTestMessageManagers(t)
+
+	_, err := sender.SendTimeout("tag", []byte("data"), 5*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Unexpected error for timeout: %+v", err)
+	}
+
+	sender.mux.Lock()
+	defer sender.mux.Unlock()
+	if len(sender.senderCallbacks) != 0 {
+		t.Errorf("Sender callback not removed on timeout: %v",
+			sender.senderCallbacks)
+	}
+}
+
+// Tests that MessageManager.SendContext returns the response from a
+// ContextReceiverCallback.
+func TestMessageManager_SendContext(t *testing.T) {
+	sender, receiver := newTestMessageManagers(t)
+	receiver.RegisterContextCallback("tag",
+		func(_ context.Context, message []byte, reply func([]byte)) {
+			reply(append([]byte("reply to "), message...))
+		})
+
+	response, err := sender.SendContext(
+		context.Background(), "tag", []byte("data"))
+	if err != nil {
+		t.Fatalf("Failed to send: %+v", err)
+	}
+
+	if expected := []byte("reply to data"); !bytes.Equal(expected, response) {
+		t.Errorf("Unexpected response.\nexpected: %q\nreceived: %q",
+			expected, response)
+	}
+}
+
+// Tests that cancelling the context passed to MessageManager.SendContext
+// returns the context error, removes the sender callback, and cancels the
+// context of the ContextReceiverCallback on the remote thread.
+func TestMessageManager_SendContext_Cancel(t *testing.T) {
+	sender, receiver := newTestMessageManagers(t)
+	remoteCancelled := make(chan struct{})
+	receiver.RegisterContextCallback("tag",
+		func(ctx context.Context, _ []byte, reply func([]byte)) {
+			<-ctx.Done()
+			close(remoteCancelled)
+			reply([]byte("late reply"))
+		})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		cancel()
+	}()
+
+	_, err := sender.SendContext(ctx, "tag", []byte("data"))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error.\nexpected: %v\nreceived: %+v",
+			context.Canceled, err)
+	}
+
+	select {
+	case <-remoteCancelled:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("Timed out waiting for remote context to be cancelled.")
+	}
+
+	// Wait for the late reply to be dropped
+	time.Sleep(10 * time.Millisecond)
+	sender.mux.Lock()
+	defer sender.mux.Unlock()
+	if len(sender.senderCallbacks) != 0 || len(sender.cancelled) != 0 {
+		t.Errorf("Cancelled message not cleaned up.\nsenderCallbacks: %v"+
+			"\ncancelled: %v", sender.senderCallbacks, sender.cancelled)
+	}
+
+	receiver.mux.Lock()
+	defer receiver.mux.Unlock()
+	if len(receiver.inFlight) != 0 {
+		t.Errorf("In-flight message not removed: %v", receiver.inFlight)
+	}
+}
+
+// Tests that the callbacks of received messages are run one at a time, in the
+// order the messages were received, while heartbeats are still answered.
+func TestMessageManager_processReceivedMessage_Serial(t *testing.T) {
+	sender, receiver := newTestMessageManagers(t)
+	receiver.RegisterCallback(heartbeatTag, func(_ []byte, reply func([]byte)) {
+		reply(nil)
+	})
+
+	var mux sync.Mutex
+	var running int
+	var order []string
+	cb := func(message []byte) {
+		mux.Lock()
+		running++
+		if running > 1 {
+			t.Errorf("%d callbacks running at once", running)
+		}
+		order = append(order, string(message))
+		mux.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mux.Lock()
+		running--
+		mux.Unlock()
+	}
+	receiver.RegisterContextCallback("context",
+		func(_ context.Context, message []byte, reply func([]byte)) {
+			cb(message)
+			reply(nil)
+		})
+	receiver.RegisterCallback("plain", func(message []byte, reply func([]byte)) {
+		cb(message)
+		reply(nil)
+	})
+
+	const numMessages = 6
+	var wg sync.WaitGroup
+	for i := 0; i < numMessages; i++ {
+		tag := Tag("plain")
+		if i%2 == 0 {
+			tag = "context"
+		}
+		err := sender.SendNoResponse(tag, []byte(strconv.Itoa(i)))
+		if err != nil {
+			t.Fatalf("Failed to send message %d: %+v", i, err)
+		}
+	}
+
+	// The heartbeat does not wait for the queued callbacks
+	start := time.Now()
+	_, err := sender.SendTimeout(heartbeatTag, nil, time.Second)
+	if err != nil {
+		t.Fatalf("Failed to send heartbeat: %+v", err)
+	} else if elapsed := time.Since(start); elapsed > 15*time.Millisecond {
+		t.Errorf("Heartbeat waited %s for callbacks to return", elapsed)
+	}
+
+	wg.Add(1)
+	receiver.RegisterCallback("done", func(_ []byte, reply func([]byte)) {
+		wg.Done()
+		reply(nil)
+	})
+	if err = sender.SendNoResponse("done", nil); err != nil {
+		t.Fatalf("Failed to send message: %+v", err)
+	}
+	wg.Wait()
+
+	mux.Lock()
+	defer mux.Unlock()
+	expected := []string{"0", "1", "2", "3", "4", "5"}
+	if !reflect.DeepEqual(expected, order) {
+		t.Errorf("Callbacks run out of order.\nexpected: %q\nreceived: %q",
+			expected, order)
+	}
+}
+
+// Tests that MessageManager.Run waits for the callbacks of previously received
+// messages to return before running its function.
+func TestMessageManager_Run(t *testing.T) {
+	sender, receiver := newTestMessageManagers(t)
+
+	var mux sync.Mutex
+	var order []string
+	started := make(chan struct{})
+	receiver.RegisterCallback("slow", func(_ []byte, reply func([]byte)) {
+		close(started)
+		time.Sleep(10 * time.Millisecond)
+		mux.Lock()
+		order = append(order, "callback")
+		mux.Unlock()
+		reply(nil)
+	})
+	if err := sender.SendNoResponse("slow", nil); err != nil {
+		t.Fatalf("Failed to send message: %+v", err)
+	}
+
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for callback to start.")
+	}
+	receiver.Run(func() {
+		mux.Lock()
+		order = append(order, "run")
+		mux.Unlock()
+	})
+
+	mux.Lock()
+	defer mux.Unlock()
+	expected := []string{"callback", "run"}
+	if !reflect.DeepEqual(expected, order) {
+		t.Errorf("Function run before callback returned."+
+			"\nexpected: %q\nreceived: %q", expected, order)
+	}
+}
+
+// Tests that MessageManager.addCancelled forgets a cancelled message after the
+// response timeout if no response is received.
+func TestMessageManager_addCancelled(t *testing.T) {
+	p := DefaultParams()
+	p.ResponseTimeout = 5 * time.Millisecond
+	mm := initMessageManager("", p)
+
+	mm.addCancelled("tag", 5)
+	mm.mux.Lock()
+	if _, exists := mm.cancelled["tag"][5]; !exists {
+		t.Errorf("Cancelled message not saved: %v", mm.cancelled)
+	}
+	mm.mux.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	mm.mux.Lock()
+	defer mm.mux.Unlock()
+	if len(mm.cancelled) != 0 {
+		t.Errorf("Cancelled message not forgotten: %v", mm.cancelled)
+	}
+}
+
+// newTestMessageManagers returns two MessageManager connected to each other by
+// a MessageChannel. Both are stopped when the test completes.
+func newTestMessageManagers(t *testing.T) (*MessageManager, *MessageManager) {
+	mc, err := NewMessageChannel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	port1, err := mc.Port1()
+	if err != nil {
+		t.Fatalf("Failed to get port1: %+v", err)
+	}
+	port2, err := mc.Port2()
+	if err != nil {
+		t.Fatalf("Failed to get port2: %+v", err)
+	}
+
+	mm1, err := NewMessageManager(port1.Value, "sender", DefaultParams())
+	if err != nil {
+		t.Fatalf("Failed to create MessageManager: %+v", err)
+	}
+	mm2, err := NewMessageManager(port2.Value, "receiver", DefaultParams())
+	if err != nil {
+		t.Fatalf("Failed to create MessageManager: %+v", err)
+	}
+	t.Cleanup(func() {
+		mm1.Stop()
+		mm2.Stop()
+	})
+
+	return mm1, mm2
 }
 
 func TestMessageManager_SendNoResponse(t *testing.T) {
@@ -111,6 +379,43 @@ func TestMessageManager_processReceivedMessage(t *testing.T) {
 	time.Sleep(15 * time.Millisecond)
 }
 
+// Tests that MessageManager.processReceivedMessage decodes a binary frame and
+// enables the binary codec for sending.
+func TestMessageManager_processReceivedMessage_Binary(t *testing.T) {
+	mm := initMessageManager("", DefaultParams())
+
+	msg := Message{Tag: "tag", Response: true, Data: []byte("response")}
+	received := make(chan []byte, 1)
+	msg.ID = mm.registerSenderCallback(
+		msg.Tag, func(data []byte) { received <- data })
+
+	data, err := msg.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Failed to marshal Message: %+v", err)
+	}
+
+	if err = mm.processReceivedMessage(data); err != nil {
+		t.Fatalf("Failed to receive message: %+v", err)
+	}
+
+	select {
+	case r := <-received:
+		if !bytes.Equal(msg.Data, r) {
+			t.Errorf("Unexpected data.\nexpected: %q\nreceived: %q",
+				msg.Data, r)
+		}
+	case <-time.After(10 * time.Millisecond):
+		t.Error("Timed out waiting for callback to be called.")
+	}
+
+	payload, err := mm.marshalMessage(Message{Tag: "tag"})
+	if err != nil {
+		t.Fatalf("Failed to marshal message: %+v", err)
+	} else if !isBinaryFrame(payload) {
+		t.Errorf("Binary codec not enabled after receiving binary frame.")
+	}
+}
+
 // Tests MessageManager.processReceivedPort calls the expected callback.
 func TestMessageManager_processReceivedPort(t *testing.T) {
 	mm := initMessageManager("", DefaultParams())
@@ -326,7 +631,48 @@ func TestMessageManager_RegisterMessageChannelCallback(t *testing.T) {
 	time.Sleep(15 * time.Millisecond)
 }
 
-func TestMessageManager_Stop(t *testing.T) {
+// Tests that once a MessageManager is closed, messages waiting on a response
+// and messages sent after return the close error.
+func TestMessageManager_close(t *testing.T) {
+	mc, err := NewMessageChannel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	port1, err := mc.Port1()
+	if err != nil {
+		t.Fatalf("Failed to get port1: %+v", err)
+	}
+	mm, err := NewMessageManager(port1.Value, "test", DefaultParams())
+	if err != nil {
+		t.Fatalf("Failed to create MessageManager: %+v", err)
+	}
+
+	// Nothing replies on port2, so the message waits until the close
+	errChan := make(chan error)
+	go func() {
+		_, err := mm.SendTimeout("tag", []byte("data"), time.Second)
+		errChan <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	closeErr := &RestartError{Worker: "test", Cause: errors.New("crashed")}
+	mm.close(closeErr)
+	mm.close(errors.New("ignored"))
+
+	select {
+	case err = <-errChan:
+		if err != closeErr {
+			t.Errorf("Unexpected error.\nexpected: %+v\nreceived: %+v",
+				closeErr, err)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatalf("Timed out waiting for SendTimeout to return.")
+	}
+
+	if err = mm.SendNoResponse("tag", nil); err != closeErr {
+		t.Errorf("Unexpected error after close.\nexpected: %+v\nreceived: %+v",
+			closeErr, err)
+	}
 }
 
 // Tests that MessageManager.getNextID returns the expected ID for various Tags.
@@ -82,7 +82,7 @@ func (mp MessagePort) Listen(
 		return nil, err
 	}
 	messageErrorHandler, err := nonBlocking(func(args []safejs.Value) {
-		events <- parseMessageEvent(args[0])
+		events <- MessageEvent{err: errMessageError}
 	})
 	if err != nil {
 		return nil, err
@@ -0,0 +1,96 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package worker
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// Tests that a Message encoded with Message.MarshalBinary and decoded with
+// Message.UnmarshalBinary matches the original.
+func TestMessage_MarshalBinary_UnmarshalBinary(t *testing.T) {
+	tests := []Message{
+		{Tag: "tag", ID: 0, Response: false, Data: []byte("data")},
+		{Tag: "GetMessage", ID: 5, Response: true, Data: bytes.Repeat(
+			[]byte{0, 1, 2, 255}, 1000)},
+		{Tag: readyTag, ID: math.MaxUint64, Response: false, Data: nil},
+		{Tag: "", ID: 42, Response: true, Data: []byte{binaryFrameMarker}},
+	}
+
+	for i, expected := range tests {
+		data, err := expected.MarshalBinary()
+		if err != nil {
+			t.Errorf("Failed to marshal message %d: %+v", i, err)
+		}
+
+		if !isBinaryFrame(data) {
+			t.Errorf("Marshalled message %d is not a binary frame.", i)
+		}
+
+		var received Message
+		if err = received.UnmarshalBinary(data); err != nil {
+			t.Errorf("Failed to unmarshal message %d: %+v", i, err)
+		}
+
+		if !reflect.DeepEqual(expected, received) {
+			t.Errorf("Unexpected message %d.\nexpected: %+v\nreceived: %+v",
+				i, expected, received)
+		}
+	}
+}
+
+// Tests that the binary frame is smaller than the JSON encoding for a message
+// with a large payload.
+func TestMessage_MarshalBinary_Size(t *testing.T) {
+	msg := Message{Tag: "ReceiveFile", ID: 12, Data: make([]byte, 1<<16)}
+	binaryData, err := msg.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Failed to marshal binary: %+v", err)
+	}
+	jsonData, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Failed to marshal JSON: %+v", err)
+	}
+
+	if len(binaryData) >= len(msg.Data)+len(msg.Tag)+8 {
+		t.Errorf("Binary frame too large: %d bytes", len(binaryData))
+	}
+	if len(binaryData) >= len(jsonData) {
+		t.Errorf("Binary frame (%d bytes) is not smaller than JSON (%d bytes).",
+			len(binaryData), len(jsonData))
+	}
+}
+
+// Error path: Tests that Message.UnmarshalBinary returns an error for invalid
+// frames.
+func TestMessage_UnmarshalBinary_Error(t *testing.T) {
+	valid, _ := Message{Tag: "tag", ID: 300, Data: []byte("data")}.
+		MarshalBinary()
+
+	tests := [][]byte{
+		nil,
+		[]byte(`{"tag":"tag"}`),
+		{binaryFrameMarker},
+		{binaryFrameMarker, 0, 0x80},
+		{binaryFrameMarker, 0, 1, 10, 't'},
+		valid[:4],
+	}
+
+	for i, data := range tests {
+		var msg Message
+		if err := msg.UnmarshalBinary(data); err == nil {
+			t.Errorf("Failed to get error for invalid frame %d: %v", i, data)
+		}
+	}
+}
@@ -20,12 +20,32 @@ type Params struct {
 	// ResponseTimeout is the default timeout to wait for a response before
 	// timing out and returning an error.
 	ResponseTimeout time.Duration
+
+	// HeartbeatInterval is how often a supervised worker is sent a heartbeat
+	// to check that it is responsive. Set to zero to disable heartbeats.
+	HeartbeatInterval time.Duration
+
+	// HeartbeatTimeout is the time to wait for a response to a heartbeat
+	// before it is considered missed.
+	HeartbeatTimeout time.Duration
+
+	// MaxMissedHeartbeats is the number of consecutive missed heartbeats after
+	// which a supervised worker is restarted.
+	MaxMissedHeartbeats int
+
+	// StreamWindow is the number of chunks of a streamed response that can be
+	// sent before waiting for the receiver to consume one.
+	StreamWindow int
 }
 
 // DefaultParams returns the default parameters.
 func DefaultParams() Params {
 	return Params{
-		MessageLogging:  false,
-		ResponseTimeout: 30 * time.Second,
+		MessageLogging:      false,
+		ResponseTimeout:     30 * time.Second,
+		HeartbeatInterval:   15 * time.Second,
+		HeartbeatTimeout:    30 * time.Second,
+		MaxMissedHeartbeats: 3,
+		StreamWindow:        8,
 	}
 }
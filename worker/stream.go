@@ -0,0 +1,389 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+)
+
+// Stream frame kinds. Each part of a streamed response is sent as a response
+// Message whose data starts with one of these bytes.
+const (
+	streamFrameChunk byte = iota
+	streamFrameEnd
+	streamFrameError
+
+	// streamFramePlain marks a response that is not part of a stream, which is
+	// sent by a remote thread that handles the tag with a [ReceiverCallback],
+	// such as an older version of the worker. It is never sent; it is only
+	// added to the response when it is received.
+	streamFramePlain
+)
+
+// StreamReceiverCallback is called when receiving a message from the sender
+// that expects a streamed response (see [MessageManager.SendStream]). The
+// response is sent in chunks using the [StreamWriter], which must be closed
+// once the response is complete. It is called on its own goroutine with a
+// context that is cancelled if the sender cancels the request. Other callbacks
+// are not run while it runs, except while it waits in [StreamWriter.Write] for
+// the receiver to consume a chunk, so any state it reads must be consistent
+// between writes.
+type StreamReceiverCallback func(
+	ctx context.Context, message []byte, w *StreamWriter)
+
+// StreamAck is JSON marshalled and sent to the remote thread each time a chunk
+// of a streamed response is consumed, allowing it to send another chunk.
+type StreamAck struct {
+	Tag Tag    `json:"tag"`
+	ID  uint64 `json:"id"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Stream Writer                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// StreamWriter sends a streamed response to the remote thread in chunks. Only
+// [Params.StreamWindow] chunks can be unconsumed by the receiver at once;
+// further writes block until the receiver catches up.
+type StreamWriter struct {
+	mm          *MessageManager
+	tag         Tag
+	id          uint64
+	binaryCodec bool
+
+	// ctx is cancelled when the sender cancels the request or the writer is
+	// closed.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// credits holds one token for each chunk that can be sent before waiting
+	// for the receiver to consume a chunk.
+	credits chan struct{}
+
+	closeOnce sync.Once
+}
+
+// newStreamWriter creates a new StreamWriter for the received message with the
+// given tag and ID and saves it so that it can receive acknowledgements and
+// cancellations.
+func (mm *MessageManager) newStreamWriter(
+	tag Tag, id uint64, binaryCodec bool) *StreamWriter {
+	ctx, cancel := mm.addInFlight(tag, id)
+	w := &StreamWriter{
+		mm:          mm,
+		tag:         tag,
+		id:          id,
+		binaryCodec: binaryCodec,
+		ctx:         ctx,
+		cancel:      cancel,
+		credits:     make(chan struct{}, mm.StreamWindow),
+	}
+	for i := 0; i < mm.StreamWindow; i++ {
+		w.credits <- struct{}{}
+	}
+
+	mm.mux.Lock()
+	defer mm.mux.Unlock()
+	if _, exists := mm.streamWriters[tag]; !exists {
+		mm.streamWriters[tag] = make(map[uint64]*StreamWriter)
+	}
+	mm.streamWriters[tag][id] = w
+
+	return w
+}
+
+// Write sends the chunk to the receiver. It blocks until the receiver is ready
+// for another chunk, during which other callbacks may run. It must only be
+// called by the StreamReceiverCallback before it returns. Returns an error if
+// the request is cancelled or the writer is closed.
+func (w *StreamWriter) Write(chunk []byte) error {
+	w.mm.callMux.Unlock()
+	defer w.mm.callMux.Lock()
+
+	select {
+	case <-w.credits:
+	case <-w.ctx.Done():
+		return w.ctx.Err()
+	case <-w.mm.quit:
+		return w.mm.closeErr
+	}
+
+	return w.send(streamFrameChunk, chunk)
+}
+
+// Close ends the stream. If err is not nil, it is returned to the receiver
+// after all previously written chunks. Only the first call has an effect.
+func (w *StreamWriter) Close(err error) error {
+	var sendErr error
+	w.closeOnce.Do(func() {
+		w.mm.mux.Lock()
+		delete(w.mm.streamWriters[w.tag], w.id)
+		if len(w.mm.streamWriters[w.tag]) == 0 {
+			delete(w.mm.streamWriters, w.tag)
+		}
+		w.mm.mux.Unlock()
+		w.mm.removeInFlight(w.tag, w.id)
+		w.cancel()
+
+		if err != nil {
+			sendErr = w.send(streamFrameError, []byte(err.Error()))
+		} else {
+			sendErr = w.send(streamFrameEnd, nil)
+		}
+	})
+	return sendErr
+}
+
+// send sends a single stream frame to the receiver.
+func (w *StreamWriter) send(kind byte, data []byte) error {
+	frame := make([]byte, 1+len(data))
+	frame[0] = kind
+	copy(frame[1:], data)
+	return w.mm.sendResponse(w.tag, w.id, frame, w.binaryCodec)
+}
+
+// processStreamAck adds a credit to the StreamWriter described by the JSON
+// marshalled StreamAck.
+func (mm *MessageManager) processStreamAck(data []byte) error {
+	var ack StreamAck
+	if err := json.Unmarshal(data, &ack); err != nil {
+		return errors.Wrapf(err, "failed to unmarshal %T", ack)
+	}
+
+	mm.mux.Lock()
+	w, exists := mm.streamWriters[ack.Tag][ack.ID]
+	mm.mux.Unlock()
+	if !exists {
+		jww.DEBUG.Printf("[WW] [%s] No stream %q with ID %d to acknowledge",
+			mm.name, ack.Tag, ack.ID)
+		return nil
+	}
+
+	select {
+	case w.credits <- struct{}{}:
+	default:
+		jww.WARN.Printf("[WW] [%s] Received more acknowledgements than "+
+			"chunks sent for stream %q with ID %d", mm.name, ack.Tag, ack.ID)
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Stream Reader                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// StreamReader receives a streamed response from the remote thread. It is not
+// safe for concurrent use.
+type StreamReader struct {
+	mm  *MessageManager
+	tag Tag
+	id  uint64
+	ctx context.Context
+
+	// frames receives each frame of the response. It has room for a full
+	// window of chunks plus the end frame.
+	frames chan []byte
+
+	// closed is true once the reader is closed before the end of the stream.
+	// Remaining frames are dropped until the end frame is received. It is
+	// protected by the MessageManager's mutex.
+	closed bool
+
+	// err is the error returned by Next once the stream has ended.
+	err error
+}
+
+// SendStream sends the data to the remote thread with the given tag and
+// returns a StreamReader that receives the response in chunks. The remote
+// thread must handle the tag with a [StreamReceiverCallback]. If the context
+// is cancelled, the remote thread is notified and the reader returns the
+// context's error.
+func (mm *MessageManager) SendStream(
+	ctx context.Context, tag Tag, data []byte) (*StreamReader, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	mm.mux.Lock()
+	id := mm.getNextID(tag)
+	r := &StreamReader{
+		mm:     mm,
+		tag:    tag,
+		id:     id,
+		ctx:    ctx,
+		frames: make(chan []byte, mm.StreamWindow+1),
+	}
+	if _, exists := mm.streamReaders[tag]; !exists {
+		mm.streamReaders[tag] = make(map[uint64]*StreamReader)
+	}
+	mm.streamReaders[tag][id] = r
+	mm.mux.Unlock()
+
+	if err := mm.sendMessage(tag, id, data); err != nil {
+		mm.removeStreamReader(tag, id)
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Next returns the next chunk of the response. It blocks until the chunk is
+// received. Returns [io.EOF] once the stream ends, the error sent by the remote
+// thread if it fails, or an error if the context is done or no chunk is
+// received within the response timeout.
+//
+// If the remote thread does not stream responses for the tag, such as an older
+// version of the worker, its whole response is returned as the only chunk.
+func (r *StreamReader) Next() ([]byte, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	select {
+	case frame := <-r.frames:
+		switch frame[0] {
+		case streamFrameChunk:
+			r.ack()
+			return frame[1:], nil
+		case streamFrameEnd:
+			r.err = io.EOF
+		case streamFramePlain:
+			r.err = io.EOF
+			return frame[1:], nil
+		default:
+			r.err = errors.New(string(frame[1:]))
+		}
+	case <-r.ctx.Done():
+		r.Close()
+		r.err = r.ctx.Err()
+	case <-r.mm.quit:
+		r.err = r.mm.closeErr
+	case <-time.After(r.mm.ResponseTimeout):
+		r.Close()
+		r.err = errors.Errorf(
+			"timed out after %s waiting for stream", r.mm.ResponseTimeout)
+	}
+
+	return nil, r.err
+}
+
+// Close stops receiving the response and notifies the remote thread that the
+// request is cancelled. It does nothing if the stream has already ended.
+func (r *StreamReader) Close() {
+	if r.err != nil {
+		return
+	}
+	r.err = errors.New("stream closed")
+
+	r.mm.mux.Lock()
+	r.closed = true
+	r.mm.mux.Unlock()
+
+	data, err := json.Marshal(CancelMessage{Tag: r.tag, ID: r.id})
+	if err != nil {
+		jww.ERROR.Printf("[WW] [%s] Failed to marshal cancellation for "+
+			"stream %q and ID %d: %+v", r.mm.name, r.tag, r.id, err)
+		return
+	}
+	if err = r.mm.sendMessage(cancelTag, initID, data); err != nil {
+		jww.WARN.Printf("[WW] [%s] Failed to send cancellation for stream "+
+			"%q and ID %d: %+v", r.mm.name, r.tag, r.id, err)
+	}
+}
+
+// ack notifies the remote thread that a chunk was consumed.
+func (r *StreamReader) ack() {
+	data, err := json.Marshal(StreamAck{Tag: r.tag, ID: r.id})
+	if err != nil {
+		jww.ERROR.Printf("[WW] [%s] Failed to marshal acknowledgement for "+
+			"stream %q and ID %d: %+v", r.mm.name, r.tag, r.id, err)
+		return
+	}
+	if err = r.mm.sendMessage(streamAckTag, initID, data); err != nil {
+		jww.WARN.Printf("[WW] [%s] Failed to send acknowledgement for stream "+
+			"%q and ID %d: %+v", r.mm.name, r.tag, r.id, err)
+	}
+}
+
+// receiveStreamFrame passes the frame to the StreamReader for the given tag
+// and ID. Returns false if there is no StreamReader.
+func (mm *MessageManager) receiveStreamFrame(
+	tag Tag, id uint64, frame []byte) (bool, error) {
+	mm.mux.Lock()
+	r, exists := mm.streamReaders[tag][id]
+	mm.mux.Unlock()
+	if !exists {
+		return false, nil
+	} else if len(frame) == 0 || frame[0] > streamFrameError {
+		// The remote thread sent a single response instead of a stream
+		frame = append([]byte{streamFramePlain}, frame...)
+	}
+
+	// The reader is removed once the stream ends
+	if frame[0] != streamFrameChunk {
+		mm.removeStreamReader(tag, id)
+	}
+
+	mm.mux.Lock()
+	closed := r.closed
+	mm.mux.Unlock()
+	if closed {
+		return true, nil
+	}
+
+	select {
+	case r.frames <- frame:
+		return true, nil
+	default:
+		return true, errors.Errorf("stream %q with ID %d received more "+
+			"chunks than its window of %d", tag, id, mm.StreamWindow)
+	}
+}
+
+// removeStreamReader deletes the StreamReader for the given tag and ID. This
+// function is thread safe.
+func (mm *MessageManager) removeStreamReader(tag Tag, id uint64) {
+	mm.mux.Lock()
+	defer mm.mux.Unlock()
+	delete(mm.streamReaders[tag], id)
+	if len(mm.streamReaders[tag]) == 0 {
+		delete(mm.streamReaders, tag)
+	}
+}
+
+// RegisterStreamCallback registers the stream callback for the given tag.
+// Previous tags are overwritten. This function is thread safe.
+func (mm *MessageManager) RegisterStreamCallback(
+	tag Tag, receiverCB StreamReceiverCallback) {
+	mm.mux.Lock()
+	defer mm.mux.Unlock()
+
+	jww.DEBUG.Printf("[WW] [%s] Registering stream callback for tag %q",
+		mm.name, tag)
+
+	mm.streamCallbacks[tag] = receiverCB
+}
+
+// getStreamCallback returns the StreamReceiverCallback for the given Tag, if
+// one exists. This function is thread safe.
+func (mm *MessageManager) getStreamCallback(
+	tag Tag) (StreamReceiverCallback, bool) {
+	mm.mux.Lock()
+	defer mm.mux.Unlock()
+	callback, exists := mm.streamCallbacks[tag]
+	return callback, exists
+}
@@ -0,0 +1,178 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package worker
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Tests that all chunks written to a StreamWriter are received in order by the
+// StreamReader, followed by io.EOF, and that the writer does not get more than
+// a window of chunks ahead of the reader.
+func TestMessageManager_SendStream(t *testing.T) {
+	sender, receiver := newTestMessageManagers(t)
+	sender.StreamWindow, receiver.StreamWindow = 2, 2
+
+	const chunks = 20
+	var written atomic.Int32
+	receiver.RegisterStreamCallback("tag",
+		func(_ context.Context, message []byte, w *StreamWriter) {
+			for i := 0; i < chunks; i++ {
+				err := w.Write([]byte(string(message) + strconv.Itoa(i)))
+				if err != nil {
+					t.Errorf("Failed to write chunk %d: %+v", i, err)
+				}
+				written.Add(1)
+			}
+			if err := w.Close(nil); err != nil {
+				t.Errorf("Failed to close stream: %+v", err)
+			}
+		})
+
+	r, err := sender.SendStream(context.Background(), "tag", []byte("chunk"))
+	if err != nil {
+		t.Fatalf("Failed to send: %+v", err)
+	}
+
+	// Nothing is read, so the writer must stop after a window of chunks
+	time.Sleep(20 * time.Millisecond)
+	if n := written.Load(); n != 2 {
+		t.Errorf("Writer not blocked by window.\nexpected: %d\nreceived: %d",
+			2, n)
+	}
+
+	var received, expected []string
+	for i := 0; i < chunks; i++ {
+		expected = append(expected, "chunk"+strconv.Itoa(i))
+	}
+	for {
+		chunk, err := r.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Failed to read chunk %d: %+v", len(received), err)
+		}
+		received = append(received, string(chunk))
+	}
+
+	if !reflect.DeepEqual(expected, received) {
+		t.Errorf("Unexpected chunks.\nexpected: %s\nreceived: %s",
+			expected, received)
+	}
+}
+
+// Error path: Tests that an error passed to StreamWriter.Close is returned by
+// StreamReader.Next after the chunks written before it.
+func TestMessageManager_SendStream_Error(t *testing.T) {
+	sender, receiver := newTestMessageManagers(t)
+	receiver.RegisterStreamCallback("tag",
+		func(_ context.Context, _ []byte, w *StreamWriter) {
+			_ = w.Write([]byte("chunk"))
+			_ = w.Close(errors.New("read failed"))
+		})
+
+	r, err := sender.SendStream(context.Background(), "tag", nil)
+	if err != nil {
+		t.Fatalf("Failed to send: %+v", err)
+	}
+
+	if chunk, err := r.Next(); err != nil || string(chunk) != "chunk" {
+		t.Errorf("Unexpected first chunk %q: %+v", chunk, err)
+	}
+	if _, err = r.Next(); err == nil || err.Error() != "read failed" {
+		t.Errorf("Unexpected error.\nexpected: %s\nreceived: %+v",
+			"read failed", err)
+	}
+}
+
+// Tests that when the remote thread handles the tag with a ReceiverCallback
+// instead of a StreamReceiverCallback, its reply is returned by
+// StreamReader.Next as the only chunk, followed by io.EOF.
+func TestMessageManager_SendStream_PlainResponse(t *testing.T) {
+	sender, receiver := newTestMessageManagers(t)
+	for _, reply := range []string{`["a","b"]`, ""} {
+		reply := reply
+		receiver.RegisterCallback("tag",
+			func(_ []byte, r func(message []byte)) { r([]byte(reply)) })
+
+		r, err := sender.SendStream(context.Background(), "tag", nil)
+		if err != nil {
+			t.Fatalf("Failed to send: %+v", err)
+		}
+
+		if chunk, err := r.Next(); err != nil || string(chunk) != reply {
+			t.Errorf("Unexpected chunk.\nexpected: %q\nreceived: %q: %+v",
+				reply, chunk, err)
+		}
+		if _, err = r.Next(); err != io.EOF {
+			t.Errorf("Unexpected error.\nexpected: %v\nreceived: %+v",
+				io.EOF, err)
+		}
+	}
+}
+
+// Tests that closing a StreamReader cancels the context of the
+// StreamReceiverCallback, unblocking its writer, and that the reader is
+// removed once the remote stream ends.
+func TestStreamReader_Close(t *testing.T) {
+	sender, receiver := newTestMessageManagers(t)
+	sender.StreamWindow, receiver.StreamWindow = 1, 1
+
+	writeErr := make(chan error, 1)
+	receiver.RegisterStreamCallback("tag",
+		func(ctx context.Context, _ []byte, w *StreamWriter) {
+			var err error
+			for err == nil {
+				err = w.Write([]byte("chunk"))
+			}
+			writeErr <- err
+			_ = w.Close(err)
+		})
+
+	r, err := sender.SendStream(context.Background(), "tag", nil)
+	if err != nil {
+		t.Fatalf("Failed to send: %+v", err)
+	}
+	if _, err = r.Next(); err != nil {
+		t.Fatalf("Failed to read chunk: %+v", err)
+	}
+	r.Close()
+
+	select {
+	case err = <-writeErr:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Unexpected write error.\nexpected: %v\nreceived: %+v",
+				context.Canceled, err)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("Timed out waiting for writer to be cancelled.")
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	sender.mux.Lock()
+	defer sender.mux.Unlock()
+	if len(sender.streamReaders) != 0 {
+		t.Errorf("Stream reader not removed: %v", sender.streamReaders)
+	}
+	receiver.mux.Lock()
+	defer receiver.mux.Unlock()
+	if len(receiver.streamWriters) != 0 || len(receiver.inFlight) != 0 {
+		t.Errorf("Stream writer not removed.\nstreamWriters: %v"+
+			"\ninFlight: %v", receiver.streamWriters, receiver.inFlight)
+	}
+}
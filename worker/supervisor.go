@@ -0,0 +1,222 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package worker
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+)
+
+// Restart settings.
+const (
+	// maxRestartAttempts is the number of times to attempt to restart a
+	// failed worker before giving up.
+	maxRestartAttempts = 3
+
+	// restartBackoff is the time to wait after the first failed restart
+	// attempt. It is doubled after each subsequent failure.
+	restartBackoff = time.Second
+)
+
+// RestartFunc is called to initialise a worker after it is restarted, before
+// any other messages are sent to it. Messages sent to the new worker must be
+// sent with the provided send function; calling [Manager.SendMessage] from a
+// RestartFunc deadlocks.
+type RestartFunc func(send func(tag Tag, data []byte) ([]byte, error)) error
+
+// RestartError is returned for messages that were waiting on a response when
+// the worker crashed or stopped responding. The worker is restarted, but the
+// message may or may not have been processed before the failure, so it should
+// only be retried if it is safe to process twice.
+type RestartError struct {
+	// Worker is the name of the worker that was restarted.
+	Worker string
+
+	// Cause is the failure that triggered the restart.
+	Cause error
+}
+
+// Error returns the error message.
+func (e *RestartError) Error() string {
+	return fmt.Sprintf("[WW] [%s] worker restarted: %v", e.Worker, e.Cause)
+}
+
+// Unwrap returns the failure that triggered the restart.
+func (e *RestartError) Unwrap() error { return e.Cause }
+
+// Retryable always returns true. It indicates that the message may be sent
+// again once the worker has restarted.
+func (e *RestartError) Retryable() bool { return true }
+
+// IsRetryable returns true if the error is, or wraps, an error that indicates
+// the message may be sent again (e.g., a [RestartError]).
+func IsRetryable(err error) bool {
+	var re interface{ Retryable() bool }
+	return errors.As(err, &re) && re.Retryable()
+}
+
+// Supervise enables automatic restarts of the worker. If the worker reports an
+// error event or misses too many heartbeats, it is terminated and a new worker
+// is started from the same script. All registered callbacks are registered on
+// the new worker and init is called to initialise it (e.g., by replaying the
+// message that opens its database). Messages sent while the worker restarts
+// wait until it is ready.
+func (m *Manager) Supervise(init RestartFunc) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if m.init != nil {
+		m.init = init
+		return
+	}
+	m.init = init
+
+	mm := m.mm
+	mm.SetErrorHandler(func(err error) { m.restart(mm, err) })
+
+	if m.p.HeartbeatInterval > 0 {
+		go m.heartbeat()
+	}
+}
+
+// current returns the MessageManager for the current worker. If the worker is
+// restarting, it blocks until the restart completes. Returns an error if the
+// worker failed and could not be restarted.
+func (m *Manager) current() (*MessageManager, error) {
+	m.mux.Lock()
+	for m.restarting != nil {
+		restarting := m.restarting
+		m.mux.Unlock()
+		<-restarting
+		m.mux.Lock()
+	}
+	defer m.mux.Unlock()
+
+	return m.mm, m.err
+}
+
+// restart terminates the failed worker and starts a new one in its place. It
+// does nothing if the MessageManager is no longer for the current worker (i.e.,
+// the worker has already been restarted) or if the manager is stopped.
+func (m *Manager) restart(failed *MessageManager, cause error) {
+	m.mux.Lock()
+	select {
+	case <-m.quit:
+		m.mux.Unlock()
+		return
+	default:
+	}
+	if m.mm != failed || m.restarting != nil || m.err != nil {
+		m.mux.Unlock()
+		return
+	}
+	restarting := make(chan struct{})
+	m.restarting = restarting
+	oldWorker := m.w
+	m.mux.Unlock()
+
+	jww.ERROR.Printf("[WW] [%s] Worker failed; restarting: %+v",
+		failed.name, cause)
+
+	// Fail all messages waiting on the old worker
+	failed.close(&RestartError{Worker: failed.name, Cause: cause})
+	if err := oldWorker.Terminate(); err != nil {
+		jww.WARN.Printf("[WW] [%s] Failed to terminate worker: %+v",
+			failed.name, err)
+	}
+
+	var err error
+	backoff := restartBackoff
+	for attempt := 1; attempt <= maxRestartAttempts; attempt++ {
+		if err = m.respawn(); err == nil {
+			break
+		}
+		jww.ERROR.Printf("[WW] [%s] Failed to restart worker (attempt %d of "+
+			"%d): %+v", failed.name, attempt, maxRestartAttempts, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if err != nil {
+		m.err = errors.Wrapf(err, "[WW] [%s] worker failed and could not be "+
+			"restarted after %d attempts", failed.name, maxRestartAttempts)
+	} else {
+		jww.INFO.Printf("[WW] [%s] Worker restarted.", failed.name)
+	}
+	m.restarting = nil
+	close(restarting)
+}
+
+// respawn starts a new worker, makes it the current worker, and initialises
+// it.
+func (m *Manager) respawn() error {
+	w, mm, err := m.spawn()
+	if err != nil {
+		return err
+	}
+
+	m.mux.Lock()
+	m.w, m.mm = w, mm
+	init := m.init
+	m.mux.Unlock()
+
+	if err = init(mm.Send); err != nil {
+		mm.Stop()
+		_ = w.Terminate()
+		return errors.Wrap(err, "failed to initialise restarted worker")
+	}
+
+	mm.SetErrorHandler(func(err error) { m.restart(mm, err) })
+
+	return nil
+}
+
+// heartbeat periodically sends a message to the worker and restarts it if it
+// fails to respond too many times in a row. A single missed heartbeat is
+// allowed since the worker handles messages one at a time and may be busy with
+// a long operation.
+func (m *Manager) heartbeat() {
+	ticker := time.NewTicker(m.p.HeartbeatInterval)
+	defer ticker.Stop()
+
+	var missed int
+	for {
+		select {
+		case <-m.quit:
+			return
+		case <-ticker.C:
+		}
+
+		mm, err := m.current()
+		if err != nil {
+			jww.ERROR.Printf("[WW] [%s] Stopping heartbeat: %+v", m.Name(), err)
+			return
+		}
+
+		_, err = mm.SendTimeout(heartbeatTag, nil, m.p.HeartbeatTimeout)
+		if err == nil || IsRetryable(err) {
+			missed = 0
+			continue
+		}
+
+		missed++
+		jww.WARN.Printf("[WW] [%s] Missed heartbeat %d of %d: %+v",
+			mm.name, missed, m.p.MaxMissedHeartbeats, err)
+		if missed >= m.p.MaxMissedHeartbeats {
+			missed = 0
+			m.restart(mm, errors.Errorf(
+				"worker missed %d heartbeats", m.p.MaxMissedHeartbeats))
+		}
+	}
+}
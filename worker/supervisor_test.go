@@ -0,0 +1,104 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build js && wasm
+
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Tests that IsRetryable returns true only for errors that are or wrap a
+// RestartError.
+func TestIsRetryable(t *testing.T) {
+	restartErr := &RestartError{Worker: "test", Cause: errors.New("crashed")}
+
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{restartErr, true},
+		{errors.Wrap(restartErr, "failed to send"), true},
+		{errors.WithMessage(restartErr, "failed to send"), true},
+		{errors.New("timed out"), false},
+		{nil, false},
+	}
+
+	for i, tt := range tests {
+		if IsRetryable(tt.err) != tt.expected {
+			t.Errorf("Unexpected result for error %q (%d)."+
+				"\nexpected: %t\nreceived: %t",
+				tt.err, i, tt.expected, !tt.expected)
+		}
+	}
+}
+
+// Tests that Manager.current blocks while the worker is restarting and returns
+// the new MessageManager once the restart completes.
+func TestManager_current(t *testing.T) {
+	oldMM := initMessageManager("old", DefaultParams())
+	newMM := initMessageManager("new", DefaultParams())
+	m := &Manager{mm: oldMM, quit: make(chan struct{})}
+
+	restarting := make(chan struct{})
+	m.restarting = restarting
+
+	mmChan := make(chan *MessageManager)
+	go func() {
+		mm, err := m.current()
+		if err != nil {
+			t.Errorf("Failed to get current MessageManager: %+v", err)
+		}
+		mmChan <- mm
+	}()
+
+	select {
+	case <-mmChan:
+		t.Fatalf("current returned while restarting.")
+	case <-time.After(5 * time.Millisecond):
+	}
+
+	m.mux.Lock()
+	m.mm = newMM
+	m.restarting = nil
+	close(restarting)
+	m.mux.Unlock()
+
+	select {
+	case mm := <-mmChan:
+		if mm != newMM {
+			t.Errorf("Received old MessageManager after restart.")
+		}
+	case <-time.After(50 * time.Millisecond):
+		t.Fatalf("Timed out waiting for current to return.")
+	}
+}
+
+// Error path: Tests that Manager.current returns the error when the worker could
+// not be restarted and that Manager.restart does nothing for a MessageManager
+// that is no longer current.
+func TestManager_current_FailedError(t *testing.T) {
+	m := &Manager{
+		mm:   initMessageManager("test", DefaultParams()),
+		err:  errors.New("could not be restarted"),
+		quit: make(chan struct{}),
+	}
+
+	if _, err := m.current(); err == nil {
+		t.Errorf("Failed to get error for failed worker.")
+	}
+
+	m.restart(initMessageManager("stale", DefaultParams()),
+		errors.New("crashed"))
+	if m.restarting != nil {
+		t.Errorf("Restart started for stale MessageManager.")
+	}
+}
@@ -14,7 +14,10 @@ type Tag string
 
 // Generic tags used by all workers.
 const (
-	readyTag Tag = "<WW>Ready</WW>"
+	readyTag     Tag = "<WW>Ready</WW>"
+	heartbeatTag Tag = "<WW>Heartbeat</WW>"
+	cancelTag    Tag = "<WW>Cancel</WW>"
+	streamAckTag Tag = "<WW>StreamAck</WW>"
 )
 
 const (
@@ -10,6 +10,7 @@
 package worker
 
 import (
+	"encoding/json"
 	"syscall/js"
 	"time"
 
@@ -52,6 +53,12 @@ func NewThreadManager(name string, messageLogging bool) (*ThreadManager, error)
 		t:  t,
 	}
 
+	// Respond to heartbeats from the main thread so that it knows this worker
+	// is still responsive
+	tm.mm.RegisterCallback(heartbeatTag, func(_ []byte, reply func([]byte)) {
+		reply(nil)
+	})
+
 	return tm, nil
 }
 
@@ -71,8 +78,17 @@ func (tm *ThreadManager) GetWorker() js.Value {
 // SignalReady sends a signal to the main thread indicating that the worker is
 // ready. Once the main thread receives this, it will initiate communication.
 // Therefore, this should only be run once all listeners are ready.
+//
+// The signal advertises that this worker supports the binary codec. It is sent
+// as JSON so that older main threads can read it.
 func (tm *ThreadManager) SignalReady() {
-	err := tm.mm.SendNoResponse(readyTag, nil)
+	data, err := json.Marshal(ReadyMessage{BinaryCodec: true})
+	if err != nil {
+		jww.FATAL.Panicf(
+			"[WW] [%s] Failed to marshal ready signal: %+v", tm.Name(), err)
+	}
+
+	err = tm.mm.SendNoResponse(readyTag, data)
 	if err != nil {
 		jww.FATAL.Panicf(
 			"[WW] [%s] Failed to send ready signal: %+v", tm.Name(), err)
@@ -113,6 +129,31 @@ func (tm *ThreadManager) RegisterCallback(tag Tag, receiverCB ReceiverCallback)
 	tm.mm.RegisterCallback(tag, receiverCB)
 }
 
+// RegisterContextCallback registers a callback for the given tag that receives
+// a context that is cancelled if the main thread cancels the request. Like
+// other callbacks, it is never run concurrently with them. Previous tags are
+// overwritten. This function is thread safe.
+func (tm *ThreadManager) RegisterContextCallback(
+	tag Tag, receiverCB ContextReceiverCallback) {
+	tm.mm.RegisterContextCallback(tag, receiverCB)
+}
+
+// RegisterStreamCallback registers a callback for the given tag that sends its
+// response to the main thread in chunks using a [StreamWriter]. The callback is
+// run on its own goroutine, but other callbacks only run while it waits in
+// [StreamWriter.Write]. Previous tags are overwritten. This function is thread
+// safe.
+func (tm *ThreadManager) RegisterStreamCallback(
+	tag Tag, receiverCB StreamReceiverCallback) {
+	tm.mm.RegisterStreamCallback(tag, receiverCB)
+}
+
+// Run runs fn once the callbacks of all previously received messages have
+// returned, so that background work, such as deleting expired data, is never
+// run concurrently with the callbacks. It blocks until fn returns and must not
+// be called from a callback.
+func (tm *ThreadManager) Run(fn func()) { tm.mm.Run(fn) }
+
 // Name returns the name of the web worker.
 func (tm *ThreadManager) Name() string { return tm.mm.name }
 